@@ -3,6 +3,7 @@
 """
 
 import os
+import struct
 import torch
 import chess
 import torch.nn as nn
@@ -388,6 +389,33 @@ class ModelTrainer:
         # print(f"Model successfully exported to ONNX: {os.path.join(out_dir, 'chess_model_onnx.onnx')}")
         pass
 
+    def save_bin(self, out_dir):
+        """
+        Simple binary dump for pure-Go inference (evilchess aiengine)
+        Format (little-endian):
+            magic 'EVCM', uint32 version, uint32 flags (bit 0: transformer), uint32 count
+            count * [uint16 name_len, name, uint8 ndim, uint32 dims[ndim], float32 data]
+        """
+        self.model.eval()
+        os.makedirs(out_dir, exist_ok=True)
+        # skip non-float tensors (BatchNorm num_batches_tracked)
+        tensors = [(k, v) for k, v in self.model.state_dict().items() if v.is_floating_point()]
+        flags = 1 if self.model.use_transformer else 0
+        bin_path = os.path.join(out_dir, 'chess_model.bin')
+        with open(bin_path, 'wb') as f:
+            f.write(b'EVCM')
+            f.write(struct.pack('<III', 1, flags, len(tensors)))
+            for name, t in tensors:
+                data = t.detach().cpu().to(torch.float32).contiguous()
+                raw = name.encode('utf-8')
+                f.write(struct.pack('<H', len(raw)))
+                f.write(raw)
+                f.write(struct.pack('<B', data.dim()))
+                for d in data.shape:
+                    f.write(struct.pack('<I', d))
+                f.write(data.numpy().astype('<f4').tobytes())
+        print(f"Model successfully exported to binary: {bin_path}")
+
     def predict(self, fen: str, rating: float = 2500.0, topk: int = 5) -> List[Tuple[str, float]]:
         """
         Predict legal move by FEN
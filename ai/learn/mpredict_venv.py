@@ -15,6 +15,7 @@ def main():
     parser.add_argument('-r','--rating', type=int, required=True, help='Rating value prediction')
     parser.add_argument('--jit', action='store_true', help='Save JIT model')
     parser.add_argument('--onnx', action='store_true', help='Save ONNX model')
+    parser.add_argument('--bin', action='store_true', help='Save binary model (for evilchess)')
     
     args = parser.parse_args()
 
@@ -81,6 +82,8 @@ def main():
         chess_model.save_jit(args.outdir)
     if args.onnx:
         chess_model.save_onnx(args.outdir)
+    if args.bin:
+        chess_model.save_bin(args.outdir)
 
     print('\nDone.')
 
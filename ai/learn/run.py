@@ -17,6 +17,7 @@ def main():
     parser.add_argument('--device', type=str, default='cuda', help='Device')
     parser.add_argument('--jit', action='store_true', help='Save JIT model')
     parser.add_argument('--onnx', action='store_true', help='Save ONNX model')
+    parser.add_argument('--bin', action='store_true', help='Save binary model (for evilchess)')
     parser.add_argument('--csv', type=str, default='', help='Path to CSV dataset')
     parser.add_argument('--venv_learn', type=str, default="mlearn_venv.py", help='Script for training')
     parser.add_argument('--venv_predict', type=str, default="mpredict_venv.py", help='Script for prediction')
@@ -63,7 +64,7 @@ def main():
             return
         venv_script = args.venv_learn
         for key, val in vars(args).items():
-            if key in {'logfile', 'venv_learn', 'venv_predict', 'command', 'fen', 'rating'}:
+            if key in {'logfile', 'venv_learn', 'venv_predict', 'command', 'fen', 'rating', 'bin'}:
                 continue
             if isinstance(val, bool):
                 if val:
@@ -77,7 +78,7 @@ def main():
             return
         venv_script = args.venv_predict
         for key, val in vars(args).items():
-            if key in {'fen', 'rating', 'outdir', 'use_transformer', 'jit', 'onnx', 'device', 'play'}:
+            if key in {'fen', 'rating', 'outdir', 'use_transformer', 'jit', 'onnx', 'bin', 'device', 'play'}:
                 if isinstance(val, bool):
                     if val:
                         arg_list.append(f"--{key}")
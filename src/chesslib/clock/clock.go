@@ -0,0 +1,303 @@
+package clock
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/outcome"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------
+// Chess clock
+// --------------------------------------------------
+// Side counts time of one player by spent time of moves (matches of engines),
+// Clock runs two sides by wall time (games with people)
+
+const (
+	// moves to go of control without moves per stage
+	DefaultMovesToGo = 30
+	// shortest time of search
+	minBudget = 10 * time.Millisecond
+)
+
+// time of one player
+type Side struct {
+	Grace time.Duration // lateness which is not flag-fall (latency of engines)
+
+	control Control
+	left    time.Duration
+	stage   int
+	inStage int // moves made in stage
+	moves   int
+	flag    bool
+}
+
+func NewSide(c Control) *Side {
+	return &Side{control: c, left: c.Initial()}
+}
+
+func (s *Side) Control() Control     { return s.control }
+func (s *Side) Left() time.Duration  { return s.left }
+func (s *Side) Moves() int           { return s.moves }
+func (s *Side) Flagged() bool        { return s.flag }
+func (s *Side) Bonus() time.Duration { return s.current().Bonus }
+
+func (s *Side) current() Stage {
+	if !s.control.HasClock() {
+		return Stage{}
+	}
+	return s.control.Stages[s.stage]
+}
+
+// moves to the next stage (0 - the rest of game)
+func (s *Side) MovesToGo() int {
+	if st := s.current(); st.Moves > 0 {
+		return st.Moves - s.inStage
+	}
+	return 0
+}
+
+// move took d, false - flag has fallen
+func (s *Side) Spend(d time.Duration) bool {
+	s.moves++
+	if !s.control.HasClock() || s.flag {
+		return !s.flag
+	}
+	st := s.current()
+	switch s.control.Mode {
+	case SimpleDelay:
+		s.left -= max(d-st.Bonus, 0)
+	case Bronstein:
+		s.left -= d
+		if s.left >= -s.Grace {
+			s.left += min(d, st.Bonus)
+		}
+	default:
+		s.left -= d
+	}
+	if s.left < -s.Grace {
+		s.flag = true
+		return false
+	}
+	s.left = max(s.left, 0)
+	if s.control.Mode == Fischer {
+		s.left += st.Bonus
+	}
+	s.inStage++
+	if st.Moves > 0 && s.inStage == st.Moves {
+		// the last stage with moves is repeated
+		s.stage = min(s.stage+1, len(s.control.Stages)-1)
+		s.inStage = 0
+		s.left += s.control.Stages[s.stage].Time
+	}
+	return true
+}
+
+// time is added (hourglass)
+func (s *Side) Add(d time.Duration) {
+	s.left += d
+}
+
+// time of display while the move takes elapsed
+func (s *Side) Running(elapsed time.Duration) time.Duration {
+	if s.control.Mode == SimpleDelay {
+		elapsed = max(elapsed-s.current().Bonus, 0)
+	}
+	return s.left - elapsed
+}
+
+// time which the next move can take before flag-fall
+func (s *Side) Limit() time.Duration {
+	if s.control.Mode == SimpleDelay {
+		return s.left + s.current().Bonus
+	}
+	return s.left
+}
+
+// time of the next search of engine
+func (s *Side) Budget(overhead time.Duration) time.Duration {
+	return Allocate(s.left, s.current().Bonus, s.MovesToGo(), overhead)
+}
+
+// time of move: left time is split over moves to go (default if 0),
+// most of increment is used, reserve is kept for answer
+func Allocate(left, bonus time.Duration, toGo int, overhead time.Duration) time.Duration {
+	if toGo <= 0 {
+		toGo = DefaultMovesToGo
+	}
+	alloc := left/time.Duration(toGo) + bonus*3/4
+	alloc = min(alloc, left-left/10-overhead)
+	return max(alloc, minBudget)
+}
+
+// ---- Clock of game ----
+
+// clock of two players by wall time
+type Clock struct {
+	mu      sync.Mutex
+	sides   [2]*Side // white, black
+	white   bool     // side to move
+	running bool
+	since   time.Time // start of move
+	now     func() time.Time
+}
+
+func New(c Control) *Clock {
+	return NewOdds(c, c)
+}
+
+// different controls of white and black
+func NewOdds(white, black Control) *Clock {
+	return &Clock{sides: [2]*Side{NewSide(white), NewSide(black)}, white: true, now: time.Now}
+}
+
+func index(white bool) int {
+	if white {
+		return 0
+	}
+	return 1
+}
+
+// clock of side to move runs
+func (c *Clock) Start(white bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.white, c.running, c.since = white, true, c.now()
+}
+
+// move of white (or black) is made while the clock is stopped: it takes no time,
+// but it is counted (increment, moves of stage), then the clock of opponent runs
+func (c *Clock) StartAfter(white bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.sides[index(white)].Spend(0) {
+		return false
+	}
+	c.white, c.running, c.since = !white, true, c.now()
+	return true
+}
+
+// pause: time of current move is kept
+func (c *Clock) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		c.sides[index(c.white)].left = c.sides[index(c.white)].Running(c.now().Sub(c.since))
+		c.running = false
+	}
+}
+
+func (c *Clock) Running() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+func (c *Clock) WhiteToMove() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.white
+}
+
+// move of side to move is done: the clock of opponent runs, false - flag has fallen
+func (c *Clock) Press() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var used time.Duration
+	if c.running {
+		used = now.Sub(c.since)
+	}
+	side := c.sides[index(c.white)]
+	if !side.Spend(used) {
+		c.running = false
+		return false
+	}
+	if side.control.Mode == Hourglass {
+		c.sides[index(!c.white)].Add(used)
+	}
+	c.white, c.running, c.since = !c.white, true, now
+	return true
+}
+
+// time of side (the running clock counts current move)
+func (c *Clock) Left(white bool) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	side := c.sides[index(white)]
+	if c.running && white == c.white {
+		return side.Running(c.now().Sub(c.since))
+	}
+	return side.Left()
+}
+
+// side whose time is over: the clock is stopped
+func (c *Clock) Flagged() (white, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range []bool{true, false} {
+		side := c.sides[index(w)]
+		if !side.control.HasClock() {
+			continue
+		}
+		if side.flag || (c.running && w == c.white && side.Running(c.now().Sub(c.since)) < -side.Grace) {
+			side.flag = true
+			c.running = false
+			return w, true
+		}
+	}
+	return false, false
+}
+
+// time which the current move of side can still take before flag-fall
+func (c *Clock) Limit(white bool) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	side := c.sides[index(white)]
+	if c.running && white == c.white {
+		return side.Limit() - c.now().Sub(c.since)
+	}
+	return side.Limit()
+}
+
+// state of side (moves, controls), time of running move is not counted
+func (c *Clock) Side(white bool) *Side {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sides[index(white)]
+}
+
+// time of next search of side
+func (c *Clock) Budget(white bool, overhead time.Duration) time.Duration {
+	left := c.Left(white)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	side := c.sides[index(white)]
+	return Allocate(left, side.current().Bonus, side.MovesToGo(), overhead)
+}
+
+// ---- Result ----
+
+// result of flag-fall of white (or black) in position: draw if the opponent
+// can't mate by any sequence of moves
+func FlagResult(b *base.Board, white bool) (convpgn.PGNStatusGame, string) {
+	o := outcome.FlagFall(b, white)
+	return o.Result, o.Reason.String()
+}
+
+// "5:03", "1:30:00", "0:09.4" (tenths under 10 seconds)
+func Format(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	if d < 10*time.Second {
+		return fmt.Sprintf("0:%02d.%d", int(d.Seconds()), int(d/(100*time.Millisecond))%10)
+	}
+	sec := int(d.Seconds())
+	if sec >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	}
+	return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+}
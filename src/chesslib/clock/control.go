@@ -0,0 +1,186 @@
+package clock
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------------------------------------
+// Time controls
+// --------------------------------------------------
+// PGN TimeControl tag: stages are separated by ':'
+//
+//	"300"          5 minutes for the game
+//	"180+2"        Fischer increment of 2 seconds
+//	"40/5400+30:1800+30"  40 moves in 90 minutes, then 30 minutes, increment 30 seconds from move 1
+//	"*60"          hourglass: time used by one side is added to the other
+//	"-"            no clock
+//
+// extensions: "300d3" simple delay (clock starts after 3 seconds),
+// "300b3" Bronstein delay (used time up to 3 seconds is returned)
+
+type Mode int
+
+const (
+	Fischer     Mode = iota // bonus is added after every move
+	Bronstein               // used time up to bonus is added after move
+	SimpleDelay             // clock runs after bonus of every move
+	Hourglass               // time used by one side is added to the other
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Fischer:
+		return "fischer"
+	case Bronstein:
+		return "bronstein"
+	case SimpleDelay:
+		return "delay"
+	case Hourglass:
+		return "hourglass"
+	}
+	return "unknown"
+}
+
+// stage of time control: the last one is repeated if it has moves
+type Stage struct {
+	Moves int           // moves of stage (0 - rest of game)
+	Time  time.Duration // added at start of stage
+	Bonus time.Duration // increment or delay
+}
+
+type Control struct {
+	Mode   Mode
+	Stages []Stage // empty - no clock
+}
+
+var ErrUnknown = errors.New("unknown time control")
+
+// separator of time and bonus of stage
+var bonusSep = map[Mode]string{Fischer: "+", SimpleDelay: "d", Bronstein: "b"}
+
+// control of whole game with increment
+func Sudden(base, increment time.Duration) Control {
+	return Control{Stages: []Stage{{Time: base, Bonus: increment}}}
+}
+
+// parse PGN TimeControl
+func Parse(s string) (Control, error) {
+	var c Control
+	s = strings.TrimSpace(s)
+	switch s {
+	case "":
+		return c, fmt.Errorf("empty time control")
+	case "?":
+		return c, ErrUnknown
+	case "-":
+		return c, nil
+	}
+	if v, ok := strings.CutPrefix(s, "*"); ok {
+		d, err := parseSeconds(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid hourglass %q", s)
+		}
+		return Control{Mode: Hourglass, Stages: []Stage{{Time: d}}}, nil
+	}
+	modes := map[Mode]bool{}
+	fields := strings.Split(s, ":")
+	for i, field := range fields {
+		st, mode, err := parseStage(field)
+		if err != nil {
+			return c, err
+		}
+		if st.Moves == 0 && i != len(fields)-1 {
+			return c, fmt.Errorf("stage %q without moves is not the last", field)
+		}
+		if st.Bonus > 0 {
+			modes[mode] = true
+			c.Mode = mode
+		}
+		c.Stages = append(c.Stages, st)
+	}
+	if len(modes) > 1 {
+		return Control{}, fmt.Errorf("mixed increment and delays in %q", s)
+	}
+	return c, nil
+}
+
+// "40/5400+30", "300d3"
+func parseStage(s string) (Stage, Mode, error) {
+	var st Stage
+	if moves, rest, ok := strings.Cut(s, "/"); ok {
+		n, err := strconv.Atoi(moves)
+		if err != nil || n <= 0 {
+			return st, Fischer, fmt.Errorf("invalid moves %q", moves)
+		}
+		st.Moves, s = n, rest
+	}
+	mode := Fischer
+	base, bonus, hasBonus := s, "", false
+	for _, m := range []Mode{Fischer, SimpleDelay, Bronstein} {
+		if b, v, ok := strings.Cut(s, bonusSep[m]); ok {
+			base, bonus, hasBonus, mode = b, v, true, m
+			break
+		}
+	}
+	d, err := parseSeconds(base)
+	if err != nil || d <= 0 {
+		return st, mode, fmt.Errorf("invalid time %q", base)
+	}
+	st.Time = d
+	if hasBonus {
+		if st.Bonus, err = parseSeconds(bonus); err != nil || st.Bonus < 0 {
+			return st, mode, fmt.Errorf("invalid increment %q", bonus)
+		}
+	}
+	return st, mode, nil
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// clock is used (game can be lost on time)
+func (c Control) HasClock() bool { return len(c.Stages) > 0 }
+
+// time of the first stage
+func (c Control) Initial() time.Duration {
+	if !c.HasClock() {
+		return 0
+	}
+	return c.Stages[0].Time
+}
+
+// PGN TimeControl
+func (c Control) String() string {
+	if !c.HasClock() {
+		return "-"
+	}
+	if c.Mode == Hourglass {
+		return "*" + formatSeconds(c.Stages[0].Time)
+	}
+	sep := bonusSep[c.Mode]
+	list := make([]string, len(c.Stages))
+	for i, st := range c.Stages {
+		s := formatSeconds(st.Time)
+		if st.Moves > 0 {
+			s = fmt.Sprintf("%d/%s", st.Moves, s)
+		}
+		if st.Bonus > 0 {
+			s += sep + formatSeconds(st.Bonus)
+		}
+		list[i] = s
+	}
+	return strings.Join(list, ":")
+}
@@ -0,0 +1,212 @@
+package aiengine
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const DefaultRating = 2500
+
+// engine playing moves of the trained model (one network pass, no search)
+type AIEngine struct {
+	mu       sync.RWMutex
+	model    *Model
+	board    *base.Board
+	rating   int
+	sample   bool // play random move by policy instead of the most probable one
+	running  bool
+	ponder   bool
+	lastInfo engine.AnalysisInfo
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	subsMu    sync.Mutex
+	subs      map[int]chan<- engine.AnalysisInfo
+	nextSubID int
+}
+
+func NewAIEngine(m *Model) *AIEngine {
+	return &AIEngine{
+		model:  m,
+		rating: DefaultRating,
+		subs:   make(map[int]chan<- engine.AnalysisInfo),
+	}
+}
+
+// rating of player the model imitates
+func (e *AIEngine) SetRating(rating int) {
+	e.mu.Lock()
+	e.rating = rating
+	e.mu.Unlock()
+}
+
+// human-like play: move is sampled from policy at the rating
+func (e *AIEngine) SetSampling(on bool) {
+	e.mu.Lock()
+	e.sample = on
+	e.mu.Unlock()
+}
+
+func (e *AIEngine) Init() error {
+	if e.model == nil {
+		return fmt.Errorf("model not loaded")
+	}
+	return nil
+}
+
+func (e *AIEngine) SetPositionFEN(fen string) error {
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return err
+	}
+	return e.SetPosition(b)
+}
+
+func (e *AIEngine) SetPosition(b *base.Board) error {
+	e.mu.Lock()
+	e.board = b
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *AIEngine) StartAnalysis(params engine.SearchParams) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running {
+		return fmt.Errorf("analysis already running")
+	}
+	if e.model == nil {
+		return fmt.Errorf("model not loaded")
+	}
+	if e.board == nil {
+		return fmt.Errorf("position not set")
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.running = true
+	e.ponder = params.Ponder
+	e.lastInfo = engine.AnalysisInfo{}
+
+	b := *e.board
+	e.wg.Add(1)
+	go e.worker(&b, e.rating, e.sample)
+	return nil
+}
+
+// inference can't be interrupted: the prediction is published (and is BestNow)
+// even if the analysis is stopped meanwhile
+func (e *AIEngine) worker(b *base.Board, rating int, sample bool) {
+	defer e.wg.Done()
+	start := time.Now()
+
+	pred := e.model.Predict(b, rating)
+	ranked := pred.RankMoves(b)
+
+	info := engine.AnalysisInfo{
+		Depth:   1,
+		TimeMs:  time.Since(start).Milliseconds(),
+		Nodes:   1,
+		ScoreCP: pred.ScoreCP(b.WhiteToMove),
+	}
+	if len(ranked) > 0 {
+		best := ranked[0].Move
+		if sample {
+			best = SampleMove(ranked, rand.Float32())
+		}
+		info.PV = []base.Move{best}
+		info.BestMove = &info.PV[0]
+	}
+	e.publish(info)
+
+	e.mu.Lock()
+	e.running = false
+	e.mu.Unlock()
+}
+
+func (e *AIEngine) StopAnalysis() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running {
+		return fmt.Errorf("not running")
+	}
+	e.cancel()
+	return nil
+}
+
+// prediction doesn't depend on time, result of ponder is final
+func (e *AIEngine) PonderHit() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.ponder {
+		return fmt.Errorf("not pondering")
+	}
+	e.ponder = false
+	return nil
+}
+
+func (e *AIEngine) BestNow() engine.AnalysisInfo {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.lastInfo
+}
+
+func (e *AIEngine) WaitDone() {
+	e.wg.Wait()
+}
+
+func (e *AIEngine) Subscribe(ch chan<- engine.AnalysisInfo) (unsubscribe func()) {
+	e.subsMu.Lock()
+	id := e.nextSubID
+	e.nextSubID++
+	e.subs[id] = ch
+	e.subsMu.Unlock()
+	return func() {
+		e.subsMu.Lock()
+		delete(e.subs, id)
+		e.subsMu.Unlock()
+	}
+}
+
+func (e *AIEngine) Close() {
+	_ = e.StopAnalysis()
+	e.wg.Wait()
+}
+
+func (e *AIEngine) publish(info engine.AnalysisInfo) {
+	e.mu.Lock()
+	e.lastInfo = info
+	e.mu.Unlock()
+
+	e.subsMu.Lock()
+	for _, ch := range e.subs {
+		select {
+		case ch <- info:
+		default:
+		}
+	}
+	e.subsMu.Unlock()
+}
+
+// move by cumulative probability r (0..1) of ranked moves
+func SampleMove(ranked []ScoredMove, r float32) base.Move {
+	for _, sm := range ranked {
+		if r < sm.Prob {
+			return sm.Move
+		}
+		r -= sm.Prob
+	}
+	return ranked[0].Move
+}
+
+// expected result (0..1) to centipawns (logistic model, 1 pawn ~ 64%)
+func WinProbToCP(p float32) int {
+	x := math.Min(math.Max(float64(p), 0.01), 0.99)
+	return int(math.Round(400 * math.Log10(x/(1-x))))
+}
@@ -0,0 +1,133 @@
+package dataset
+
+import (
+	"errors"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/history"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// --------------------------------------------------
+// Training positions from PGN (like ai/scripts/pgn2csv.py)
+// --------------------------------------------------
+
+// position before move of the game
+type Sample struct {
+	ID       int     // sequential number of exported game (1, 2, ...)
+	GID      string  // game uid from Site tag
+	Rating   int     // rating of side to move (0 - unknown)
+	White    bool    // side to move
+	Result   float64 // 1 white won, 0 black won, 0.5 draw, NaN - unknown
+	Halfmove int     // ply of the game
+	Move     base.Move
+	UCI      string
+	Board    *base.Board
+}
+
+type Writer interface {
+	Write(s *Sample) error
+	Close() error
+}
+
+type Stats struct {
+	Games     int            // read games
+	Exported  int            // games passed filter
+	Positions int            // written samples
+	Skipped   map[string]int // skipped games by reason
+}
+
+type Exporter struct {
+	filter *Filter
+	w      Writer
+	stats  Stats
+}
+
+func NewExporter(filter *Filter, w Writer) *Exporter {
+	return &Exporter{filter: filter, w: w, stats: Stats{Skipped: make(map[string]int)}}
+}
+
+func (e *Exporter) Stats() Stats { return e.stats }
+
+var reSiteUID = regexp.MustCompile(`([^/\s]+)$`)
+
+func gameResult(s convpgn.PGNStatusGame) float64 {
+	switch s {
+	case convpgn.PGNStatusWW:
+		return 1
+	case convpgn.PGNStatusBW:
+		return 0
+	case convpgn.PGNStatusDraw:
+		return 0.5
+	}
+	return math.NaN()
+}
+
+// stream games of PGN, progress is called after every game (can be nil)
+func (e *Exporter) ReadPGN(r io.Reader, progress func(Stats)) error {
+	p := convpgn.NewPGNParser(r)
+	for {
+		g, err := p.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		e.stats.Games++
+		if ok, reason := e.filter.Check(g); !ok {
+			e.stats.Skipped[reason]++
+		} else if err := e.exportGame(g); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(e.stats)
+		}
+	}
+}
+
+func (e *Exporter) exportGame(g *convpgn.PGNGame) error {
+	fen := g.Tags["FEN"]
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		e.stats.Skipped["bad FEN"]++
+		return nil
+	}
+	h := history.NewHistory()
+	if err := h.ImportPGNGame(g, b); err != nil {
+		e.stats.Skipped["illegal moves"]++
+		return nil
+	}
+
+	e.stats.Exported++
+	s := Sample{ID: e.stats.Exported, Result: gameResult(g.Result)}
+	if m := reSiteUID.FindStringSubmatch(strings.TrimSpace(g.Tags["Site"])); m != nil {
+		s.GID = m[1]
+	}
+	whiteElo, blackElo := tagInt(g, "WhiteElo"), tagInt(g, "BlackElo")
+
+	entries := h.Moves()
+	for i := 1; i < len(entries); i++ {
+		before := &entries[i-1].Board
+		s.Board, s.Move = before, entries[i].Move
+		s.White, s.Halfmove = before.WhiteToMove, i-1
+		s.Rating = blackElo
+		if s.White {
+			s.Rating = whiteElo
+		}
+		s.UCI = moves.MoveToUCI(before, s.Move)
+		if err := e.w.Write(&s); err != nil {
+			return err
+		}
+		e.stats.Positions++
+	}
+	return nil
+}
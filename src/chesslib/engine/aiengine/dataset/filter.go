@@ -0,0 +1,214 @@
+package dataset
+
+import (
+	"crypto/sha1"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --------------------------------------------------
+// Game filter (like ai/scripts/pgn_filter.py)
+// --------------------------------------------------
+// differences from the script: MaxElo has no flag there, duplicates are
+// found by hash of tags and moves (not of the game text) in memory
+// instead of sqlite
+
+type FilterOptions struct {
+	MinWhite      int      // min rating of white (0 - any)
+	MinBlack      int      // min rating of black (0 - any)
+	MaxElo        int      // max rating of both players (0 - any)
+	MaxRatingDiff int      // max abs WhiteRatingDiff/BlackRatingDiff (<0 - any)
+	MinMoves      int      // min full moves
+	TimeControl   string   // exact TimeControl (empty - any)
+	TimeMin       int      // min base time in seconds (<0 - any)
+	TimeMax       int      // max base time in seconds (<0 - any)
+	MaxIncrement  int      // games with increment >= value are skipped (<0 - any)
+	Modes         []string // substrings of Event (blitz, rapid, ...), empty - any
+
+	SkipIncomplete  bool // result is "*" or missing
+	SkipTermination bool // Termination is not "Normal"
+	SkipBots        bool
+	SkipAnonymous   bool
+	SkipNonRated    bool // Event without "rated"
+	Dedupe          bool // skip games with the same hash (~100 bytes of memory per game)
+}
+
+// defaults of pgn_filter.py
+func DefaultFilterOptions() FilterOptions {
+	return FilterOptions{
+		MaxRatingDiff:   150,
+		TimeMin:         -1,
+		TimeMax:         -1,
+		MaxIncrement:    31,
+		SkipIncomplete:  true,
+		SkipTermination: true,
+		SkipBots:        true,
+		SkipAnonymous:   true,
+		SkipNonRated:    true,
+	}
+}
+
+type Filter struct {
+	opts FilterOptions
+	seen map[[sha1.Size]byte]struct{}
+}
+
+func NewFilter(opts FilterOptions) *Filter {
+	return &Filter{opts: opts, seen: make(map[[sha1.Size]byte]struct{})}
+}
+
+// base time and increment in seconds ("600+5"), -1 if unknown
+func ParseTimeControl(tc string) (int, int) {
+	tc = strings.TrimSpace(tc)
+	if tc == "" || strings.EqualFold(tc, "unlimited") {
+		return -1, -1
+	}
+	parts := strings.SplitN(tc, "+", 2)
+	base, err := strconv.Atoi(parts[0])
+	if err != nil {
+		base = -1
+	}
+	inc := -1
+	if len(parts) > 1 {
+		if v, err := strconv.Atoi(parts[1]); err == nil {
+			inc = v
+		}
+	}
+	return base, inc
+}
+
+func isBot(name string) bool {
+	return strings.Contains(strings.ToLower(name), "bot")
+}
+
+func isAnonymous(name string) bool {
+	if name == "" {
+		return true
+	}
+	s := strings.ToLower(name)
+	return strings.HasPrefix(s, "anon") || strings.Contains(s, "anonymous") || strings.Contains(s, "guest") ||
+		strings.TrimSpace(s) == "-"
+}
+
+// rating by tag, 0 if unknown
+func tagInt(g *convpgn.PGNGame, tag string) int {
+	v, err := strconv.Atoi(strings.TrimPrefix(g.Tags[tag], "+"))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// hash of game by tags and moves (comments and spaces do not matter)
+func GameHash(g *convpgn.PGNGame) [sha1.Size]byte {
+	keys := make([]string, 0, len(g.Tags))
+	for k := range g.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha1.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, g.Tags[k])
+	}
+	h.Write([]byte(strings.Join(g.Moves, " ")))
+	var sum [sha1.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// check game, reason of skip is returned
+func (f *Filter) Check(g *convpgn.PGNGame) (bool, string) {
+	o := &f.opts
+	if len(g.Tags) == 0 {
+		return false, "missing tags"
+	}
+	if len(g.Moves) == 0 {
+		return false, "no moves"
+	}
+
+	white, black := g.Tags["White"], g.Tags["Black"]
+	event := strings.ToLower(g.Tags["Event"])
+	termination := g.Tags["Termination"]
+
+	if o.SkipIncomplete && g.Result != convpgn.PGNStatusWW && g.Result != convpgn.PGNStatusBW && g.Result != convpgn.PGNStatusDraw {
+		return false, "incomplete result"
+	}
+	if o.SkipTermination && termination != "" && !strings.EqualFold(termination, "normal") {
+		return false, "termination " + termination
+	}
+	if o.SkipBots && (isBot(white) || isBot(black) || isBot(g.Tags["WhiteTitle"]) || isBot(g.Tags["BlackTitle"])) {
+		return false, "bot involved"
+	}
+	if o.SkipAnonymous && (isAnonymous(white) || isAnonymous(black)) {
+		return false, "anonymous player"
+	}
+	if o.SkipNonRated && event != "" && !strings.Contains(event, "rated") {
+		return false, "non-rated event"
+	}
+
+	whiteElo, blackElo := tagInt(g, "WhiteElo"), tagInt(g, "BlackElo")
+	if o.MinWhite > 0 && whiteElo < o.MinWhite {
+		return false, "white rating too low"
+	}
+	if o.MinBlack > 0 && blackElo < o.MinBlack {
+		return false, "black rating too low"
+	}
+	if o.MaxElo > 0 && max(whiteElo, blackElo) > o.MaxElo {
+		return false, "rating too high"
+	}
+	if o.MaxRatingDiff >= 0 {
+		for _, tag := range []string{"WhiteRatingDiff", "BlackRatingDiff"} {
+			if d := tagInt(g, tag); int(math.Abs(float64(d))) > o.MaxRatingDiff {
+				return false, tag + " too high"
+			}
+		}
+	}
+
+	tc := g.Tags["TimeControl"]
+	base, inc := ParseTimeControl(tc)
+	if o.MaxIncrement >= 0 && inc >= o.MaxIncrement {
+		return false, "increment too high"
+	}
+	if o.TimeControl != "" && tc != o.TimeControl {
+		return false, "time control " + tc
+	}
+	if o.TimeMin >= 0 || o.TimeMax >= 0 {
+		switch {
+		case base < 0:
+			return false, "time control unknown"
+		case o.TimeMin >= 0 && base < o.TimeMin:
+			return false, "base time too low"
+		case o.TimeMax >= 0 && base > o.TimeMax:
+			return false, "base time too high"
+		}
+	}
+
+	if o.MinMoves > 0 && (len(g.Moves)+1)/2 < o.MinMoves {
+		return false, "too few moves"
+	}
+	if len(o.Modes) > 0 {
+		allowed := false
+		for _, m := range o.Modes {
+			if strings.Contains(event, strings.ToLower(m)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, "event not in modes"
+		}
+	}
+
+	if o.Dedupe {
+		h := GameHash(g)
+		if _, ok := f.seen[h]; ok {
+			return false, "duplicate"
+		}
+		f.seen[h] = struct{}{}
+	}
+	return true, ""
+}
@@ -0,0 +1,195 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine/aiengine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// --------------------------------------------------
+// CSV: columns of pgn2csv.py
+// --------------------------------------------------
+
+var Columns = []string{"id", "gid", "rating", "side", "result", "halfmove", "move", "fen"}
+
+type CSVWriter struct {
+	w       *csv.Writer
+	columns []string
+	row     []string
+}
+
+// columns in order of Columns, exclude - names of skipped columns
+func SelectColumns(exclude []string) ([]string, error) {
+	for _, c := range exclude {
+		if !slices.Contains(Columns, c) {
+			return nil, fmt.Errorf("unknown column: %s", c)
+		}
+	}
+	var cols []string
+	for _, c := range Columns {
+		if !slices.Contains(exclude, c) {
+			cols = append(cols, c)
+		}
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+	return cols, nil
+}
+
+func NewCSVWriter(w io.Writer, columns []string) (*CSVWriter, error) {
+	cw := &CSVWriter{w: csv.NewWriter(w), columns: columns, row: make([]string, len(columns))}
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *CSVWriter) Write(s *Sample) error {
+	for i, c := range cw.columns {
+		var v string
+		switch c {
+		case "id":
+			v = strconv.Itoa(s.ID)
+		case "gid":
+			v = s.GID
+		case "rating":
+			if s.Rating > 0 {
+				v = strconv.Itoa(s.Rating)
+			}
+		case "side":
+			v = "b"
+			if s.White {
+				v = "w"
+			}
+		case "result":
+			if !math.IsNaN(s.Result) {
+				v = strconv.FormatFloat(s.Result, 'f', 1, 64)
+			}
+		case "halfmove":
+			v = strconv.Itoa(s.Halfmove)
+		case "move":
+			v = s.UCI
+		case "fen":
+			v = fenOf(s.Board)
+		}
+		cw.row[i] = v
+	}
+	return cw.w.Write(cw.row)
+}
+
+// FEN like python-chess: en passant square only if capture is legal
+func fenOf(b *base.Board) string {
+	if b.EnPassant == -1 {
+		return convfen.ConvertBoardToFEN(*b)
+	}
+	for _, mv := range moves.GenerateLegalMoves(b) {
+		if base.ConvPointToIndex(mv.To) == b.EnPassant && mv.From.W != mv.To.W {
+			if p := b.Mailbox[base.ConvPointToIndex(mv.From)]; p == base.WPawn || p == base.BPawn {
+				return convfen.ConvertBoardToFEN(*b)
+			}
+		}
+	}
+	nb := *b
+	nb.EnPassant = -1
+	return convfen.ConvertBoardToFEN(nb)
+}
+
+func (cw *CSVWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// --------------------------------------------------
+// NPY: structured array of samples for numpy
+// --------------------------------------------------
+// np.load(path) gives records:
+//   board    int8 (13, 8, 8) - planes of mtools.fen_to_tensor
+//   from, to uint8          - squares of move (a1 = 0, h8 = 63)
+//   rating   uint16         - 0 if unknown
+//   halfmove uint16
+//   result   float32        - NaN if unknown
+
+const (
+	npyDescr = "[('board', '|i1', (13, 8, 8)), ('from', '|u1'), ('to', '|u1'), " +
+		"('rating', '<u2'), ('halfmove', '<u2'), ('result', '<f4')]"
+	// header is written again on close with final count, so its size is fixed
+	npyHeaderLen = 256
+	npyRecordLen = 13*64 + 1 + 1 + 2 + 2 + 4
+)
+
+type NPYWriter struct {
+	f     io.WriteSeeker
+	w     *bufio.Writer
+	count int
+	rec   [npyRecordLen]byte
+}
+
+func NewNPYWriter(f io.WriteSeeker) (*NPYWriter, error) {
+	nw := &NPYWriter{f: f, w: bufio.NewWriter(f)}
+	if err := nw.writeHeader(); err != nil {
+		return nil, err
+	}
+	return nw, nil
+}
+
+// format 1.0: magic, version, header length, dict padded with spaces
+func (nw *NPYWriter) writeHeader() error {
+	dict := fmt.Sprintf("{'descr': %s, 'fortran_order': False, 'shape': (%d,), }", npyDescr, nw.count)
+	pad := npyHeaderLen - 10 - len(dict) - 1
+	if pad < 0 {
+		return fmt.Errorf("npy header is too long")
+	}
+	var hdr [10]byte
+	copy(hdr[:], "\x93NUMPY\x01\x00")
+	binary.LittleEndian.PutUint16(hdr[8:], uint16(npyHeaderLen-10))
+	if _, err := nw.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := nw.w.WriteString(dict + strings.Repeat(" ", pad) + "\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (nw *NPYWriter) Write(s *Sample) error {
+	for i, v := range aiengine.EncodeBoard(s.Board) {
+		nw.rec[i] = byte(int8(v))
+	}
+	off := 13 * 64
+	nw.rec[off] = byte(base.ConvPointToIndex(s.Move.From))
+	nw.rec[off+1] = byte(base.ConvPointToIndex(s.Move.To))
+	binary.LittleEndian.PutUint16(nw.rec[off+2:], uint16(min(max(s.Rating, 0), math.MaxUint16)))
+	binary.LittleEndian.PutUint16(nw.rec[off+4:], uint16(min(s.Halfmove, math.MaxUint16)))
+	binary.LittleEndian.PutUint32(nw.rec[off+6:], math.Float32bits(float32(s.Result)))
+	if _, err := nw.w.Write(nw.rec[:]); err != nil {
+		return err
+	}
+	nw.count++
+	return nil
+}
+
+// flush records and write final count to header
+func (nw *NPYWriter) Close() error {
+	if err := nw.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := nw.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	nw.w.Reset(nw.f)
+	if err := nw.writeHeader(); err != nil {
+		return err
+	}
+	return nw.w.Flush()
+}
@@ -0,0 +1,258 @@
+package aiengine
+
+import "math"
+
+// --------------------------------------------------
+// Layers (inference only, batch = 1, board 8x8)
+// --------------------------------------------------
+
+const (
+	bnEps        = 1e-5
+	lnEps        = 1e-5
+	defaultHeads = 8
+)
+
+type linear struct {
+	w       []float32 // (out, in)
+	b       []float32
+	out, in int
+}
+
+func (l *linear) apply(x []float32) []float32 {
+	y := make([]float32, l.out)
+	for o := 0; o < l.out; o++ {
+		row := l.w[o*l.in : (o+1)*l.in]
+		sum := l.b[o]
+		for i, v := range row {
+			sum += v * x[i]
+		}
+		y[o] = sum
+	}
+	return y
+}
+
+// x is a sequence of rows (len(x)/in rows)
+func (l *linear) applySeq(x []float32) []float32 {
+	n := len(x) / l.in
+	y := make([]float32, 0, n*l.out)
+	for s := 0; s < n; s++ {
+		y = append(y, l.apply(x[s*l.in:(s+1)*l.in])...)
+	}
+	return y
+}
+
+// convolution (same padding, no bias) with folded BatchNorm
+type convBN struct {
+	w            []float32 // (out, in, k, k)
+	out, in, k   int
+	scale, shift []float32
+}
+
+// x: (in, 8, 8) -> (out, 8, 8)
+func (c *convBN) apply(x []float32) []float32 {
+	y := make([]float32, c.out*64)
+	pad := c.k / 2
+	for o := 0; o < c.out; o++ {
+		dst := y[o*64 : (o+1)*64]
+		for i := 0; i < c.in; i++ {
+			src := x[i*64 : (i+1)*64]
+			kern := c.w[(o*c.in+i)*c.k*c.k:]
+			for ky := 0; ky < c.k; ky++ {
+				dy := ky - pad
+				y0, y1 := max(0, -dy), min(8, 8-dy)
+				for kx := 0; kx < c.k; kx++ {
+					wv := kern[ky*c.k+kx]
+					if wv == 0 {
+						continue
+					}
+					dx := kx - pad
+					x0, x1 := max(0, -dx), min(8, 8-dx)
+					for r := y0; r < y1; r++ {
+						drow := dst[r*8 : r*8+8]
+						srow := src[(r+dy)*8 : (r+dy)*8+8]
+						for col := x0; col < x1; col++ {
+							drow[col] += wv * srow[col+dx]
+						}
+					}
+				}
+			}
+		}
+		s, b := c.scale[o], c.shift[o]
+		for j := range dst {
+			dst[j] = dst[j]*s + b
+		}
+	}
+	return y
+}
+
+type resBlock struct {
+	c1, c2 convBN
+	short  *convBN // nil - identity
+}
+
+func (rb *resBlock) apply(x []float32) []float32 {
+	out := rb.c1.apply(x)
+	relu(out)
+	out = rb.c2.apply(out)
+	res := x
+	if rb.short != nil {
+		res = rb.short.apply(x)
+	}
+	for i := range out {
+		out[i] += res[i]
+	}
+	relu(out)
+	return out
+}
+
+type layerNorm struct {
+	g, b []float32
+}
+
+// normalize every row of x in place
+func (ln *layerNorm) apply(x []float32) {
+	d := len(ln.g)
+	for s := 0; s+d <= len(x); s += d {
+		row := x[s : s+d]
+		mean := float32(0)
+		for _, v := range row {
+			mean += v
+		}
+		mean /= float32(d)
+		variance := float32(0)
+		for _, v := range row {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float32(d)
+		inv := float32(1 / math.Sqrt(float64(variance)+lnEps))
+		for i, v := range row {
+			row[i] = (v-mean)*inv*ln.g[i] + ln.b[i]
+		}
+	}
+}
+
+// post-LN encoder layer (norm_first=False, GELU)
+type encoderLayer struct {
+	inProj, outProj linear
+	l1, l2          linear
+	n1, n2          layerNorm
+}
+
+type transformerNet struct {
+	emb    linear
+	pos    []float32 // (64, d)
+	layers []encoderLayer
+	norm   layerNorm
+	heads  int
+}
+
+// seq: (64, d) -> pooled (d)
+func (t *transformerNet) apply(seq []float32) []float32 {
+	x := t.emb.applySeq(seq)
+	for i := range x {
+		x[i] += t.pos[i]
+	}
+	for i := range t.layers {
+		x = t.layers[i].apply(x, t.heads)
+	}
+	t.norm.apply(x)
+	d := t.emb.out
+	pooled := make([]float32, d)
+	for s := 0; s < 64; s++ {
+		for i := 0; i < d; i++ {
+			pooled[i] += x[s*d+i]
+		}
+	}
+	for i := range pooled {
+		pooled[i] /= 64
+	}
+	return pooled
+}
+
+func (l *encoderLayer) apply(x []float32, heads int) []float32 {
+	d := l.outProj.out
+	n := len(x) / d
+	hd := d / heads
+	qkv := l.inProj.applySeq(x) // (n, 3d)
+	attn := make([]float32, n*d)
+	scale := float32(1 / math.Sqrt(float64(hd)))
+	scores := make([]float32, n)
+	for h := 0; h < heads; h++ {
+		for i := 0; i < n; i++ {
+			q := qkv[i*3*d+h*hd : i*3*d+h*hd+hd]
+			maxScore := float32(math.Inf(-1))
+			for j := 0; j < n; j++ {
+				k := qkv[j*3*d+d+h*hd : j*3*d+d+h*hd+hd]
+				sum := float32(0)
+				for e := range q {
+					sum += q[e] * k[e]
+				}
+				scores[j] = sum * scale
+				if scores[j] > maxScore {
+					maxScore = scores[j]
+				}
+			}
+			softmaxFrom(scores, maxScore)
+			out := attn[i*d+h*hd : i*d+h*hd+hd]
+			for j := 0; j < n; j++ {
+				v := qkv[j*3*d+2*d+h*hd : j*3*d+2*d+h*hd+hd]
+				p := scores[j]
+				for e := range out {
+					out[e] += p * v[e]
+				}
+			}
+		}
+	}
+	sa := l.outProj.applySeq(attn)
+	for i := range x {
+		sa[i] += x[i]
+	}
+	l.n1.apply(sa)
+
+	ff := l.l1.applySeq(sa)
+	gelu(ff)
+	ff = l.l2.applySeq(ff)
+	for i := range ff {
+		ff[i] += sa[i]
+	}
+	l.n2.apply(ff)
+	return ff
+}
+
+func relu(x []float32) {
+	for i, v := range x {
+		if v < 0 {
+			x[i] = 0
+		}
+	}
+}
+
+// exact GELU (torch default)
+func gelu(x []float32) {
+	for i, v := range x {
+		x[i] = float32(0.5 * float64(v) * (1 + math.Erf(float64(v)/math.Sqrt2)))
+	}
+}
+
+// in place softmax, m is max of x
+func softmaxFrom(x []float32, m float32) {
+	sum := float32(0)
+	for i, v := range x {
+		e := float32(math.Exp(float64(v - m)))
+		x[i] = e
+		sum += e
+	}
+	for i := range x {
+		x[i] /= sum
+	}
+}
+
+func softmax(x []float32) {
+	m := float32(math.Inf(-1))
+	for _, v := range x {
+		if v > m {
+			m = v
+		}
+	}
+	softmaxFrom(x, m)
+}
@@ -0,0 +1,413 @@
+package aiengine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// --------------------------------------------------
+// Model file (exported by ModelTrainer.save_bin in ai/learn/mmodel/model.py)
+// --------------------------------------------------
+// little-endian:
+//
+//	magic "EVCM", uint32 version, uint32 flags (bit 0: transformer), uint32 count
+//	count * [uint16 name_len, name, uint8 ndim, uint32 dims[ndim], float32 data]
+
+const (
+	modelMagic   = "EVCM"
+	modelVersion = 1
+	flagTransf   = 1
+
+	// default path of exported model
+	DefaultModelFile = "chess_model.bin"
+
+	// rating is normalized like in dataset.py
+	ratingScale = 3500.0
+
+	// planes of EncodeBoard
+	inputPlanes = 13
+
+	// limits of file: dimensions are not trusted
+	maxTensors    = 4096
+	maxTensorDims = 4
+	maxTensorSize = 1 << 26 // floats of one tensor (256MB)
+)
+
+type tensor struct {
+	shape []int
+	data  []float32
+}
+
+func (t *tensor) size() int {
+	n := 1
+	for _, d := range t.shape {
+		n *= d
+	}
+	return n
+}
+
+// dimensions are positive and the size is within maxTensorSize
+func (t *tensor) checkSize() error {
+	n := 1
+	for _, d := range t.shape {
+		if d <= 0 || d > maxTensorSize/n {
+			return fmt.Errorf("invalid shape %v", t.shape)
+		}
+		n *= d
+	}
+	return nil
+}
+
+// CNN (+ transformer) model with from/to/value heads
+type Model struct {
+	transformer bool
+
+	stem   convBN
+	blocks []resBlock
+	trans  *transformerNet
+
+	fc    linear
+	from  linear
+	to    linear
+	value [2]linear
+}
+
+func LoadModel(path string) (*Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadModel(f)
+}
+
+func ReadModel(r io.Reader) (*Model, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != modelMagic {
+		return nil, errors.New("invalid model file")
+	}
+	var hdr [3]uint32
+	if err := binary.Read(br, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr[0] != modelVersion {
+		return nil, fmt.Errorf("unsupported model version: %d", hdr[0])
+	}
+
+	if hdr[2] > maxTensors {
+		return nil, fmt.Errorf("too many tensors: %d", hdr[2])
+	}
+	tensors := make(map[string]*tensor, hdr[2])
+	for i := uint32(0); i < hdr[2]; i++ {
+		name, t, err := readTensor(br)
+		if err != nil {
+			return nil, fmt.Errorf("error read tensor %d: %v", i, err)
+		}
+		tensors[name] = t
+	}
+	return buildModel(tensors, hdr[1]&flagTransf != 0)
+}
+
+func readTensor(r io.Reader) (string, *tensor, error) {
+	var nameLen uint16
+	if err := binary.Read(r, binary.LittleEndian, &nameLen); err != nil {
+		return "", nil, err
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", nil, err
+	}
+	var ndim uint8
+	if err := binary.Read(r, binary.LittleEndian, &ndim); err != nil {
+		return "", nil, err
+	}
+	if ndim > maxTensorDims {
+		return "", nil, fmt.Errorf("tensor %s: %d dimensions", name, ndim)
+	}
+	t := &tensor{shape: make([]int, ndim)}
+	for i := range t.shape {
+		var d uint32
+		if err := binary.Read(r, binary.LittleEndian, &d); err != nil {
+			return "", nil, err
+		}
+		t.shape[i] = int(d)
+	}
+	if err := t.checkSize(); err != nil {
+		return "", nil, fmt.Errorf("tensor %s: %v", name, err)
+	}
+	raw := make([]byte, 4*t.size())
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return "", nil, err
+	}
+	t.data = make([]float32, t.size())
+	for i := range t.data {
+		t.data[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+	}
+	return string(name), t, nil
+}
+
+// tensors lookup with shape checks
+type weights struct {
+	m   map[string]*tensor
+	err error
+}
+
+func (w *weights) get(name string, shape ...int) *tensor {
+	if w.err != nil {
+		return nil
+	}
+	t, ok := w.m[name]
+	if !ok {
+		w.err = fmt.Errorf("tensor %s not found", name)
+		return nil
+	}
+	if len(shape) > 0 {
+		ok := len(shape) == len(t.shape)
+		for i := 0; ok && i < len(shape); i++ {
+			// -1: any size
+			ok = shape[i] < 0 || shape[i] == t.shape[i]
+		}
+		if !ok {
+			w.err = fmt.Errorf("tensor %s: unexpected shape %v", name, t.shape)
+			return nil
+		}
+	}
+	return t
+}
+
+func (w *weights) has(name string) bool {
+	_, ok := w.m[name]
+	return ok
+}
+
+func (w *weights) linear(prefix string) linear {
+	return w.linearNamed(prefix+".weight", prefix+".bias")
+}
+
+func (w *weights) linearNamed(weight, bias string) linear {
+	wt := w.get(weight, -1, -1)
+	if wt == nil {
+		return linear{}
+	}
+	b := w.get(bias, wt.shape[0])
+	if b == nil {
+		return linear{}
+	}
+	return linear{w: wt.data, b: b.data, out: wt.shape[0], in: wt.shape[1]}
+}
+
+func (w *weights) layerNorm(prefix string) layerNorm {
+	g := w.get(prefix+".weight", -1)
+	if g == nil {
+		return layerNorm{}
+	}
+	b := w.get(prefix+".bias", g.shape[0])
+	if b == nil {
+		return layerNorm{}
+	}
+	return layerNorm{g: g.data, b: b.data}
+}
+
+// conv without bias + BatchNorm (folded into scale/shift)
+func (w *weights) convBN(conv, bn string) convBN {
+	wt := w.get(conv+".weight", -1, -1, -1, -1)
+	if wt == nil {
+		return convBN{}
+	}
+	// same padding: square kernel of odd size
+	if k := wt.shape[2]; k != wt.shape[3] || k%2 == 0 || k > 15 {
+		w.err = fmt.Errorf("tensor %s: unexpected kernel %v", conv+".weight", wt.shape)
+		return convBN{}
+	}
+	out := wt.shape[0]
+	g := w.get(bn+".weight", out)
+	b := w.get(bn+".bias", out)
+	mean := w.get(bn+".running_mean", out)
+	variance := w.get(bn+".running_var", out)
+	if w.err != nil {
+		return convBN{}
+	}
+	c := convBN{
+		w:     wt.data,
+		out:   out,
+		in:    wt.shape[1],
+		k:     wt.shape[2],
+		scale: make([]float32, out),
+		shift: make([]float32, out),
+	}
+	for o := 0; o < out; o++ {
+		s := g.data[o] / float32(math.Sqrt(float64(variance.data[o])+bnEps))
+		c.scale[o] = s
+		c.shift[o] = b.data[o] - mean.data[o]*s
+	}
+	return c
+}
+
+func buildModel(m map[string]*tensor, transformer bool) (*Model, error) {
+	w := &weights{m: m}
+	model := &Model{transformer: transformer}
+
+	// conv_block: 0 conv, 1 bn, 2 relu, 3.. residual blocks
+	model.stem = w.convBN("conv_block.0", "conv_block.1")
+	for i := 3; w.has(fmt.Sprintf("conv_block.%d.conv1.weight", i)); i++ {
+		p := fmt.Sprintf("conv_block.%d", i)
+		rb := resBlock{
+			c1: w.convBN(p+".conv1", p+".bn1"),
+			c2: w.convBN(p+".conv2", p+".bn2"),
+		}
+		if w.has(p + ".shortcut.0.weight") {
+			sc := w.convBN(p+".shortcut.0", p+".shortcut.1")
+			rb.short = &sc
+		}
+		model.blocks = append(model.blocks, rb)
+	}
+	if len(model.blocks) == 0 && w.err == nil {
+		w.err = errors.New("no residual blocks")
+	}
+
+	if transformer {
+		t := &transformerNet{
+			emb:   w.linear("transformer.embedding"),
+			norm:  w.layerNorm("transformer.norm_final"),
+			heads: defaultHeads,
+		}
+		if pos := w.get("transformer.pos_embed", 1, 64, -1); pos != nil {
+			t.pos = pos.data
+		}
+		for i := 0; w.has(fmt.Sprintf("transformer.transformer_encoder.layers.%d.linear1.weight", i)); i++ {
+			p := fmt.Sprintf("transformer.transformer_encoder.layers.%d", i)
+			t.layers = append(t.layers, encoderLayer{
+				inProj:  w.linearNamed(p+".self_attn.in_proj_weight", p+".self_attn.in_proj_bias"),
+				outProj: w.linear(p + ".self_attn.out_proj"),
+				l1:      w.linear(p + ".linear1"),
+				l2:      w.linear(p + ".linear2"),
+				n1:      w.layerNorm(p + ".norm1"),
+				n2:      w.layerNorm(p + ".norm2"),
+			})
+		}
+		model.trans = t
+	}
+
+	model.fc = w.linear("fc_common.0")
+	model.from = w.linear("from_head")
+	model.to = w.linear("to_head")
+	model.value[0] = w.linear("value_head.0")
+	model.value[1] = w.linear("value_head.2")
+	if w.err != nil {
+		return nil, w.err
+	}
+	if model.from.out != 64 || model.to.out != 64 || model.value[1].out != 1 {
+		return nil, errors.New("unexpected heads size")
+	}
+	if err := model.checkShapes(); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// outputs of layers fit inputs of the next ones (forward doesn't check sizes)
+func (m *Model) checkShapes() error {
+	if m.stem.in != inputPlanes {
+		return fmt.Errorf("stem: %d input planes instead of %d", m.stem.in, inputPlanes)
+	}
+	channels := m.stem.out
+	for i, rb := range m.blocks {
+		if rb.c1.in != channels || rb.c2.in != rb.c1.out {
+			return fmt.Errorf("block %d: unexpected input channels", i)
+		}
+		if rb.short == nil && rb.c2.out != channels ||
+			rb.short != nil && (rb.short.in != channels || rb.short.out != rb.c2.out) {
+			return fmt.Errorf("block %d: shortcut doesn't fit", i)
+		}
+		channels = rb.c2.out
+	}
+
+	feat := channels
+	if t := m.trans; m.transformer {
+		d := t.emb.out
+		switch {
+		case t.emb.in != channels:
+			return errors.New("transformer: embedding doesn't fit channels")
+		case d%t.heads != 0:
+			return fmt.Errorf("transformer: size %d is not divisible by %d heads", d, t.heads)
+		case len(t.pos) != 64*d:
+			return errors.New("transformer: unexpected positional embedding")
+		case len(t.norm.g) != d:
+			return errors.New("transformer: unexpected final norm")
+		}
+		for i, l := range t.layers {
+			if l.inProj.in != d || l.inProj.out != 3*d || l.outProj.in != d || l.outProj.out != d ||
+				l.l1.in != d || l.l2.in != l.l1.out || l.l2.out != d || len(l.n1.g) != d || len(l.n2.g) != d {
+				return fmt.Errorf("transformer layer %d: unexpected shapes", i)
+			}
+		}
+		feat = d
+	}
+
+	// rating is the last input of common layer
+	if m.fc.in != feat+1 {
+		return errors.New("common layer doesn't fit features")
+	}
+	if m.from.in != m.fc.out || m.to.in != m.fc.out || m.value[0].in != m.fc.out || m.value[1].in != m.value[0].out {
+		return errors.New("heads don't fit common layer")
+	}
+	return nil
+}
+
+// raw outputs of the network
+type output struct {
+	from  [64]float32 // logits
+	to    [64]float32 // logits
+	value float32     // expected result for white (1 win, 0 loss)
+}
+
+func (m *Model) forward(planes []float32, rating float32) output {
+	x := m.stem.apply(planes)
+	relu(x)
+	for i := range m.blocks {
+		x = m.blocks[i].apply(x)
+	}
+
+	channels := len(x) / 64
+	var feat []float32
+	if m.transformer {
+		// (C, 64) -> (64, C)
+		seq := make([]float32, len(x))
+		for c := 0; c < channels; c++ {
+			for s := 0; s < 64; s++ {
+				seq[s*channels+c] = x[c*64+s]
+			}
+		}
+		feat = m.trans.apply(seq)
+	} else {
+		// global average pooling
+		feat = make([]float32, channels)
+		for c := 0; c < channels; c++ {
+			sum := float32(0)
+			for _, v := range x[c*64 : (c+1)*64] {
+				sum += v
+			}
+			feat[c] = sum / 64
+		}
+	}
+
+	common := m.fc.apply(append(feat, rating))
+	relu(common)
+
+	var out output
+	copy(out.from[:], m.from.apply(common))
+	copy(out.to[:], m.to.apply(common))
+	v := m.value[0].apply(common)
+	relu(v)
+	out.value = m.value[1].apply(v)[0]
+	return out
+}
@@ -0,0 +1,86 @@
+package aiengine
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"sort"
+)
+
+// planes of pieces in order of mtools.piece_to_plane
+var piecePlane = map[base.Piece]int{
+	base.WPawn: 0, base.WKnight: 1, base.WBishop: 2, base.WRook: 3, base.WQueen: 4, base.WKing: 5,
+	base.BPawn: 6, base.BKnight: 7, base.BBishop: 8, base.BRook: 9, base.BQueen: 10, base.BKing: 11,
+}
+
+// board as (13, 8, 8) tensor like mtools.fen_to_tensor:
+// planes 0-5 white pieces, 6-11 black pieces, 12 side to move (1 if white),
+// row 0 is the 8th rank
+func EncodeBoard(b *base.Board) []float32 {
+	planes := make([]float32, inputPlanes*64)
+	for idx, p := range b.Mailbox {
+		plane, ok := piecePlane[p]
+		if !ok {
+			continue
+		}
+		row, col := 7-idx/8, idx%8
+		planes[plane*64+row*8+col] = 1
+	}
+	if b.WhiteToMove {
+		for i := 12 * 64; i < inputPlanes*64; i++ {
+			planes[i] = 1
+		}
+	}
+	return planes
+}
+
+// policy and value of position
+type Prediction struct {
+	From  [64]float32 // probability of move from square (mailbox index)
+	To    [64]float32 // probability of move to square
+	Value float32     // expected result for white: 1 win, 0.5 draw, 0 loss
+}
+
+func (m *Model) Predict(b *base.Board, rating int) Prediction {
+	out := m.forward(EncodeBoard(b), float32(rating)/ratingScale)
+	p := Prediction{From: out.from, To: out.to, Value: out.value}
+	softmax(p.From[:])
+	softmax(p.To[:])
+	return p
+}
+
+type ScoredMove struct {
+	Move base.Move
+	Prob float32 // normalized over legal moves
+}
+
+// legal moves sorted by policy (from * to), underpromotions get zero
+func (p *Prediction) RankMoves(b *base.Board) []ScoredMove {
+	legal := moves.GenerateLegalMoves(b)
+	res := make([]ScoredMove, 0, len(legal))
+	sum := float32(0)
+	for _, mv := range legal {
+		from, to := base.ConvPointToIndex(mv.From), base.ConvPointToIndex(mv.To)
+		prob := p.From[from] * p.To[to]
+		if pc := b.Mailbox[from]; mv.Piece != pc && mv.Piece != base.WQueen && mv.Piece != base.BQueen {
+			prob = 0
+		}
+		res = append(res, ScoredMove{Move: mv, Prob: prob})
+		sum += prob
+	}
+	if sum > 0 {
+		for i := range res {
+			res[i].Prob /= sum
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Prob > res[j].Prob })
+	return res
+}
+
+// value of prediction in centipawns from side to move POV
+func (p *Prediction) ScoreCP(whiteToMove bool) int {
+	cp := WinProbToCP(p.Value)
+	if !whiteToMove {
+		cp = -cp
+	}
+	return cp
+}
@@ -0,0 +1,136 @@
+package arena
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/syzygy"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/endgame"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// --------------------------------------------------
+// Adjudication: games are finished by scores of engines and tablebases
+// --------------------------------------------------
+
+const mateScore = 100000
+
+type Adjudication struct {
+	DrawMoveNumber  int // draw adjudication starts at full move N
+	DrawMoveCount   int // both engines score |cp| <= DrawScore for N consecutive moves (0 - off)
+	DrawScore       int
+	ResignMoveCount int // engine scores <= -ResignScore for N consecutive moves (0 - off)
+	ResignScore     int
+
+	Syzygy  *syzygy.Tablebase // result by Syzygy tables (nil - off)
+	Endgame *endgame.Tables   // result by own endgame tables (nil - off)
+}
+
+// parse options like "movenumber=40,movecount=8,score=10" into move number, move count and score
+func ParseAdjudicationRule(s string) (number, count, score int, err error) {
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return 0, 0, 0, fmt.Errorf("invalid option %q", kv)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, 0, fmt.Errorf("invalid value of %s: %q", k, v)
+		}
+		switch k {
+		case "movenumber":
+			number = n
+		case "movecount":
+			count = n
+		case "score":
+			score = n
+		default:
+			return 0, 0, 0, fmt.Errorf("unknown option %q", k)
+		}
+	}
+	return number, count, score, nil
+}
+
+type adjudicator struct {
+	a      Adjudication
+	draw   int    // consecutive plies with draw score
+	resign [2]int // consecutive moves with lost score (white, black)
+}
+
+func newAdjudicator(a Adjudication) *adjudicator {
+	return &adjudicator{a: a}
+}
+
+// result by tablebases before move
+func (ad *adjudicator) tablebase(b *base.Board) (convpgn.PGNStatusGame, string, bool) {
+	if ad.a.Syzygy != nil && ad.a.Syzygy.Covers(b) {
+		if wdl, err := ad.a.Syzygy.ProbeWDL(b); err == nil {
+			switch wdl {
+			case syzygy.Win:
+				return lossOf(!b.WhiteToMove), "tablebase win", true
+			case syzygy.Loss:
+				return lossOf(b.WhiteToMove), "tablebase win", true
+			}
+			return convpgn.PGNStatusDraw, "tablebase draw", true
+		}
+	}
+	if ad.a.Endgame != nil {
+		if res, err := ad.a.Endgame.Probe(b); err == nil {
+			switch res.WDL {
+			case 1:
+				return lossOf(!b.WhiteToMove), "tablebase win", true
+			case -1:
+				return lossOf(b.WhiteToMove), "tablebase win", true
+			}
+			return convpgn.PGNStatusDraw, "tablebase draw", true
+		}
+	}
+	return 0, "", false
+}
+
+// result by score of engine after its move (b - position after move)
+func (ad *adjudicator) move(b *base.Board, info engine.AnalysisInfo, white bool) (convpgn.PGNStatusGame, string, bool) {
+	if info.Depth <= 0 {
+		// engine has no score
+		ad.draw = 0
+		ad.resign = [2]int{}
+		return 0, "", false
+	}
+	score := scoreOf(info)
+	side := 0
+	if !white {
+		side = 1
+	}
+
+	if ad.a.ResignMoveCount > 0 {
+		if score <= -ad.a.ResignScore {
+			ad.resign[side]++
+		} else {
+			ad.resign[side] = 0
+		}
+		if ad.resign[side] >= ad.a.ResignMoveCount {
+			return lossOf(white), "resign by score", true
+		}
+	}
+
+	if ad.a.DrawMoveCount > 0 && b.Fullmove >= ad.a.DrawMoveNumber {
+		if abs(score) <= ad.a.DrawScore {
+			ad.draw++
+		} else {
+			ad.draw = 0
+		}
+		if ad.draw >= 2*ad.a.DrawMoveCount {
+			return convpgn.PGNStatusDraw, "draw by score", true
+		}
+	}
+	return 0, "", false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
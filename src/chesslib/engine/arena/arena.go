@@ -0,0 +1,261 @@
+package arena
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/chesslib/outcome"
+	"fmt"
+	"time"
+)
+
+// --------------------------------------------------
+// Arena: games between two engines
+// --------------------------------------------------
+
+const (
+	DefaultMaxPlies = 300
+
+	// extra time for engine to answer after limit
+	moveGrace = 2 * time.Second
+)
+
+type GameOptions struct {
+	StartFEN     string              // empty - start position
+	Opening      []base.Move         // moves from StartFEN played before engines
+	White        engine.SearchParams // limits of white engine
+	Black        engine.SearchParams // limits of black engine
+	WhiteTC      TimeControl         // zero - only limits of params
+	BlackTC      TimeControl
+	MaxPlies     int // draw by adjudication after N plies (0 - default)
+	Adjudication Adjudication
+}
+
+type GameResult struct {
+	Result      convpgn.PGNStatusGame
+	Reason      string // checkmate, stalemate, repetition, ...
+	Termination string // PGN Termination: normal, adjudication, time forfeit, rules infraction
+	Moves       []base.Move
+	SAN         []string
+	Comments    []string // score/depth and time of engine moves ("" - opening move)
+	Plies       int
+}
+
+const (
+	TerminationNormal       = outcome.TerminationNormal
+	TerminationAdjudication = outcome.TerminationAdjudication
+	TerminationTimeForfeit  = outcome.TerminationTimeForfeit
+	TerminationInfraction   = outcome.TerminationInfraction
+)
+
+// position key for repetition detection (counters are ignored)
+type positionKey struct {
+	mailbox   base.Mailbox
+	white     bool
+	casting   base.StatusCasting
+	enPassant int
+}
+
+func keyOf(b *base.Board) positionKey {
+	return positionKey{mailbox: b.Mailbox, white: b.WhiteToMove, casting: b.Casting, enPassant: outcome.EnPassant(b)}
+}
+
+// side to move loses
+func lossOf(whiteToMove bool) convpgn.PGNStatusGame {
+	if whiteToMove {
+		return convpgn.PGNStatusBW
+	}
+	return convpgn.PGNStatusWW
+}
+
+// play one game, engines must be initialized
+func PlayGame(ctx context.Context, white, black engine.Engine, opts GameOptions) (GameResult, error) {
+	fen := opts.StartFEN
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return GameResult{}, err
+	}
+	maxPlies := opts.MaxPlies
+	if maxPlies <= 0 {
+		maxPlies = DefaultMaxPlies
+	}
+
+	var res GameResult
+	seen := map[positionKey]int{keyOf(b): 1}
+	for _, mv := range opts.Opening {
+		san := moves.MoveToSAN(b, mv)
+		if err := moves.ApplyMove(b, mv); err != nil {
+			return res, fmt.Errorf("opening move %s: %v", san, err)
+		}
+		res.SAN = append(res.SAN, san)
+		res.Moves = append(res.Moves, mv)
+		res.Comments = append(res.Comments, "")
+		res.Plies++
+		seen[keyOf(b)]++
+	}
+
+	end := func(result convpgn.PGNStatusGame, reason, termination string) (GameResult, error) {
+		res.Result, res.Reason, res.Termination = result, reason, termination
+		return res, nil
+	}
+	clocks := [2]*engineClock{newEngineClock(opts.WhiteTC), newEngineClock(opts.BlackTC)}
+	adj := newAdjudicator(opts.Adjudication)
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		switch rules.GameStatusOf(b) {
+		case base.Checkmate:
+			return end(convpgn.ConvGameStatusToPGNStatus(base.Checkmate, b.WhiteToMove), "checkmate", TerminationNormal)
+		case base.Stalemate:
+			return end(convpgn.PGNStatusDraw, "stalemate", TerminationNormal)
+		case base.Draw:
+			return end(convpgn.PGNStatusDraw, "insufficient material", TerminationNormal)
+		}
+		if seen[keyOf(b)] >= 3 {
+			return end(convpgn.PGNStatusDraw, "threefold repetition", TerminationNormal)
+		}
+		if b.Halfmove >= 100 {
+			return end(convpgn.PGNStatusDraw, "fifty-move rule", TerminationNormal)
+		}
+		if result, reason, ok := adj.tablebase(b); ok {
+			return end(result, reason, TerminationAdjudication)
+		}
+		if res.Plies >= maxPlies {
+			return end(convpgn.PGNStatusDraw, "max plies", TerminationAdjudication)
+		}
+
+		eng, params, clk := white, opts.White, clocks[0]
+		if !b.WhiteToMove {
+			eng, params, clk = black, opts.Black, clocks[1]
+		}
+		params = clk.params(params)
+		soft, hard := clk.limits(params)
+		mv, info, elapsed, err := engineMove(ctx, eng, b, params, soft, hard)
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		if !clk.side.Spend(elapsed) {
+			result, reason := clock.FlagResult(b, b.WhiteToMove)
+			return end(result, reason, TerminationTimeForfeit)
+		}
+		if clk.tc.Clock.Mode == clock.Hourglass {
+			// time of mover goes to the opponent
+			other := clocks[1]
+			if !b.WhiteToMove {
+				other = clocks[0]
+			}
+			other.side.Add(elapsed)
+		}
+		if err != nil {
+			// side to move forfeits
+			return end(lossOf(b.WhiteToMove), err.Error(), TerminationInfraction)
+		}
+
+		mover := b.WhiteToMove
+		res.SAN = append(res.SAN, moves.MoveToSAN(b, mv))
+		res.Moves = append(res.Moves, mv)
+		res.Comments = append(res.Comments, moveComment(info, elapsed))
+		res.Plies++
+		if err := moves.ApplyMove(b, mv); err != nil {
+			return res, err
+		}
+		seen[keyOf(b)]++
+		if result, reason, ok := adj.move(b, info, mover); ok {
+			return end(result, reason, TerminationAdjudication)
+		}
+	}
+}
+
+// score of engine for side to move (mate is a big score)
+func scoreOf(info engine.AnalysisInfo) int {
+	switch {
+	case info.MateIn > 0:
+		return mateScore - info.MateIn
+	case info.MateIn < 0:
+		return -mateScore - info.MateIn
+	}
+	return info.ScoreCP
+}
+
+// comment of engine move: score/depth time (like "+0.35/12 0.51s")
+func moveComment(info engine.AnalysisInfo, elapsed time.Duration) string {
+	score := fmt.Sprintf("%+.2f", float64(info.ScoreCP)/100)
+	switch {
+	case info.MateIn > 0:
+		score = fmt.Sprintf("+M%d", info.MateIn)
+	case info.MateIn < 0:
+		score = fmt.Sprintf("-M%d", -info.MateIn)
+	}
+	return fmt.Sprintf("%s/%d %.2fs", score, info.Depth, elapsed.Seconds())
+}
+
+// search of one move, engine answer is checked against legal moves,
+// search is stopped after soft limit if engine has a move, after hard anyway (0 - no limit)
+func engineMove(ctx context.Context, eng engine.Engine, b *base.Board, params engine.SearchParams, soft, hard time.Duration) (base.Move, engine.AnalysisInfo, time.Duration, error) {
+	var info engine.AnalysisInfo
+	start := time.Now()
+	if err := eng.SetPosition(moves.CloneBoard(b)); err != nil {
+		return base.Move{}, info, 0, err
+	}
+	if err := eng.StartAnalysis(params); err != nil {
+		return base.Move{}, info, 0, err
+	}
+	done := make(chan struct{})
+	go func() {
+		eng.WaitDone()
+		close(done)
+	}()
+	timer := func(d time.Duration) <-chan time.Time {
+		if d <= 0 {
+			return nil
+		}
+		return time.After(d - time.Since(start))
+	}
+	softC, hardC := timer(soft), timer(hard)
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-softC:
+			softC = nil
+			if best := eng.BestNow(); best.BestMove == nil && best.UCIBestMove == "" {
+				// no move yet: wait for the first iteration
+				continue
+			}
+		case <-hardC:
+		case <-ctx.Done():
+			_ = eng.StopAnalysis()
+			<-done
+			return base.Move{}, info, time.Since(start), ctx.Err()
+		}
+		_ = eng.StopAnalysis()
+		<-done
+		break wait
+	}
+	elapsed := time.Since(start)
+
+	// UCI answer keeps promotion piece, BestMove may not
+	info = eng.BestNow()
+	uci := info.UCIBestMove
+	if uci == "" && info.BestMove != nil {
+		uci = moves.MoveToUCI(b, *info.BestMove)
+	}
+	if uci == "" {
+		return base.Move{}, info, elapsed, fmt.Errorf("no move")
+	}
+	mv, err := moves.UCIToMove(b, uci)
+	if err != nil {
+		return base.Move{}, info, elapsed, fmt.Errorf("illegal move %s", uci)
+	}
+	return mv, info, elapsed, nil
+}
@@ -0,0 +1,138 @@
+package arena
+
+import (
+	"bufio"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --------------------------------------------------
+// Opening suites (PGN or EPD)
+// --------------------------------------------------
+
+type Opening struct {
+	Name  string
+	FEN   string      // start position (empty - start of game)
+	Moves []base.Move // moves from start position
+}
+
+// load openings from .pgn (first plies of games, 0 - all moves)
+// or from .epd/.fen (position per line)
+func LoadOpenings(path string, plies int) ([]Opening, error) {
+	var list []Opening
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".pgn") {
+		list, err = loadPGNOpenings(path, plies)
+	} else {
+		list, err = loadEPDOpenings(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no openings in %s", path)
+	}
+	return list, nil
+}
+
+func loadPGNOpenings(path string, plies int) ([]Opening, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	games, err := convpgn.ParseAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var list []Opening
+	for i, g := range games {
+		op := Opening{Name: g.Headers[convpgn.PGNHeaderOpening], FEN: g.Tags["FEN"]}
+		if op.Name == "" {
+			op.Name = g.Tags["ECO"]
+		}
+		fen := op.FEN
+		if fen == "" {
+			fen = base.FEN_START_GAME
+		}
+		b, err := convfen.ConvertFENToBoard(fen)
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %v", i+1, err)
+		}
+		for _, san := range g.Moves {
+			if plies > 0 && len(op.Moves) >= plies {
+				break
+			}
+			mv, err := moves.SANToMove(b, san)
+			if err != nil {
+				return nil, fmt.Errorf("game %d: move %s: %v", i+1, san, err)
+			}
+			if err := moves.ApplyMove(b, mv); err != nil {
+				return nil, fmt.Errorf("game %d: move %s: %v", i+1, san, err)
+			}
+			op.Moves = append(op.Moves, mv)
+		}
+		list = append(list, op)
+	}
+	return list, nil
+}
+
+// EPD line: 4 fields of FEN and operations ("id" is name), FEN line is accepted too
+func loadEPDOpenings(path string) ([]Opening, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []Opening
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: invalid position", n)
+		}
+		fen := strings.Join(fields[:4], " ") + " 0 1"
+		ops := strings.Join(fields[4:], " ")
+		if len(fields) >= 6 && isNumber(fields[4]) && isNumber(fields[5]) {
+			fen = strings.Join(fields[:6], " ")
+			ops = strings.Join(fields[6:], " ")
+		}
+		if _, err := convfen.ConvertFENToBoard(fen); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		list = append(list, Opening{Name: epdID(ops), FEN: fen})
+	}
+	return list, sc.Err()
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// value of "id" operation of EPD
+func epdID(ops string) string {
+	for _, op := range strings.Split(ops, ";") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(op), "id "); ok {
+			return strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package arena
+
+import (
+	"fmt"
+	"math"
+)
+
+// --------------------------------------------------
+// SPRT: sequential probability ratio test of game pairs
+// --------------------------------------------------
+// H0: elo = Elo0, H1: elo = Elo1 (logistic Elo), game pairs with the same opening
+// and swapped colors give pentanomial results (0, 0.5, 1, 1.5, 2 points of pair);
+// LLR uses normal approximation of pair score (generalized SPRT)
+
+type SPRT struct {
+	Elo0, Elo1  float64
+	Alpha, Beta float64 // errors of the first and the second kind
+}
+
+type SPRTStatus int
+
+const (
+	SPRTContinue SPRTStatus = iota
+	SPRTAcceptH0            // change is not stronger by Elo1
+	SPRTAcceptH1            // change is stronger by Elo0
+)
+
+func (st SPRTStatus) String() string {
+	switch st {
+	case SPRTAcceptH0:
+		return "H0 accepted"
+	case SPRTAcceptH1:
+		return "H1 accepted"
+	}
+	return "continue"
+}
+
+func (s SPRT) Validate() error {
+	if s.Elo1 <= s.Elo0 {
+		return fmt.Errorf("elo1 must be greater than elo0")
+	}
+	if s.Alpha <= 0 || s.Alpha >= 0.5 || s.Beta <= 0 || s.Beta >= 0.5 {
+		return fmt.Errorf("alpha and beta must be in (0, 0.5)")
+	}
+	return nil
+}
+
+// bounds of LLR: H0 is accepted below lower, H1 above upper
+func (s SPRT) Bounds() (lower, upper float64) {
+	return math.Log(s.Beta / (1 - s.Alpha)), math.Log((1 - s.Beta) / s.Alpha)
+}
+
+// counts of game pairs by points of the first player: 0, 0.5, 1, 1.5, 2
+type Pentanomial [5]int
+
+// add pair by points of its two games (0, 0.5 or 1 each)
+func (p *Pentanomial) Add(first, second float64) {
+	p[int(math.Round((first+second)*2))]++
+}
+
+func (p Pentanomial) Pairs() int {
+	return p[0] + p[1] + p[2] + p[3] + p[4]
+}
+
+// mean and variance of game score (pair points / 2),
+// empty counts are replaced by eps (variance of identical pairs is not zero)
+func (p Pentanomial) stats(eps float64) (mean, variance float64) {
+	var counts [5]float64
+	n := 0.0
+	for i, c := range p {
+		counts[i] = max(float64(c), eps)
+		n += counts[i]
+	}
+	if p.Pairs() == 0 {
+		return 0.5, 0
+	}
+	for i, c := range counts {
+		mean += c * float64(i) / 4
+	}
+	mean /= n
+	for i, c := range counts {
+		d := float64(i)/4 - mean
+		variance += c * d * d
+	}
+	return mean, variance / n
+}
+
+// log-likelihood ratio of H1 against H0
+func (s SPRT) LLR(p Pentanomial) float64 {
+	mean, variance := p.stats(1e-3)
+	if p.Pairs() == 0 || variance == 0 {
+		return 0
+	}
+	s0, s1 := eloScore(s.Elo0), eloScore(s.Elo1)
+	return float64(p.Pairs()) * (s1 - s0) * (2*mean - s0 - s1) / (2 * variance)
+}
+
+func (s SPRT) Status(p Pentanomial) SPRTStatus {
+	llr := s.LLR(p)
+	lower, upper := s.Bounds()
+	switch {
+	case llr <= lower:
+		return SPRTAcceptH0
+	case llr >= upper:
+		return SPRTAcceptH1
+	}
+	return SPRTContinue
+}
+
+// expected score of Elo difference
+func eloScore(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// Elo and 95% error margin by pentanomial results
+func (p Pentanomial) Elo() (elo, margin float64) {
+	n := float64(p.Pairs())
+	if n == 0 {
+		return 0, 0
+	}
+	mean, variance := p.stats(0)
+	if mean <= 0 || mean >= 1 {
+		return EloDiff(mean), math.Inf(1)
+	}
+	delta := 1.959964 * math.Sqrt(variance/n)
+	lo, hi := max(mean-delta, 1e-6), min(mean+delta, 1-1e-6)
+	return EloDiff(mean), (EloDiff(hi) - EloDiff(lo)) / 2
+}
+
+func (p Pentanomial) String() string {
+	return fmt.Sprintf("[%d, %d, %d, %d, %d]", p[0], p[1], p[2], p[3], p[4])
+}
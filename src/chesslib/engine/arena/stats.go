@@ -0,0 +1,183 @@
+package arena
+
+import (
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// --------------------------------------------------
+// Statistics: score, Elo with error bars, crosstable
+// --------------------------------------------------
+
+type Score struct {
+	Win, Draw, Loss int
+}
+
+func (s Score) Games() int { return s.Win + s.Draw + s.Loss }
+
+func (s Score) Points() float64 { return float64(s.Win) + float64(s.Draw)/2 }
+
+// part of points in [0, 1]
+func (s Score) Ratio() float64 {
+	if s.Games() == 0 {
+		return 0.5
+	}
+	return s.Points() / float64(s.Games())
+}
+
+func (s Score) Add(o Score) Score {
+	return Score{s.Win + o.Win, s.Draw + o.Draw, s.Loss + o.Loss}
+}
+
+// score of opponent
+func (s Score) Reverse() Score { return Score{s.Loss, s.Draw, s.Win} }
+
+// Elo difference of score ratio (logistic model)
+func EloDiff(ratio float64) float64 {
+	return -400 * math.Log10(1/ratio-1)
+}
+
+// Elo difference and 95% error margin (inf - no losses or no wins)
+func (s Score) Elo() (elo, margin float64) {
+	n := float64(s.Games())
+	if n == 0 {
+		return 0, 0
+	}
+	mu := s.Ratio()
+	if mu <= 0 || mu >= 1 {
+		return EloDiff(mu), math.Inf(1)
+	}
+	// variance of game result
+	dev := func(x float64) float64 { return (x - mu) * (x - mu) }
+	variance := (float64(s.Win)*dev(1) + float64(s.Draw)*dev(0.5) + float64(s.Loss)*dev(0)) / n
+	delta := 1.959964 * math.Sqrt(variance/n)
+	lo, hi := max(mu-delta, 1e-6), min(mu+delta, 1-1e-6)
+	return EloDiff(mu), (EloDiff(hi) - EloDiff(lo)) / 2
+}
+
+// likelihood of superiority
+func (s Score) LOS() float64 {
+	if s.Win+s.Loss == 0 {
+		return 0.5
+	}
+	return 0.5 * (1 + math.Erf(float64(s.Win-s.Loss)/math.Sqrt(2*float64(s.Win+s.Loss))))
+}
+
+func (s Score) String() string {
+	return fmt.Sprintf("+%d =%d -%d", s.Win, s.Draw, s.Loss)
+}
+
+func formatElo(elo, margin float64) string {
+	if math.Abs(elo) < 0.5 {
+		elo = 0 // without "-0"
+	}
+	e := fmt.Sprintf("%+.0f", elo)
+	if math.IsInf(elo, 1) {
+		e = "+inf"
+	} else if math.IsInf(elo, -1) {
+		e = "-inf"
+	}
+	m := fmt.Sprintf("%.0f", margin)
+	if math.IsInf(margin, 0) || math.IsNaN(margin) {
+		m = "-"
+	}
+	return fmt.Sprintf("%6s +/- %s", e, m)
+}
+
+// results of pairs of players
+type Crosstable struct {
+	Names []string
+	Pairs [][]Score // Pairs[i][j] - score of i against j
+}
+
+func NewCrosstable(names []string) *Crosstable {
+	ct := &Crosstable{Names: names, Pairs: make([][]Score, len(names))}
+	for i := range ct.Pairs {
+		ct.Pairs[i] = make([]Score, len(names))
+	}
+	return ct
+}
+
+func (ct *Crosstable) Add(white, black int, result convpgn.PGNStatusGame) {
+	var s Score
+	switch result {
+	case convpgn.PGNStatusWW:
+		s.Win = 1
+	case convpgn.PGNStatusBW:
+		s.Loss = 1
+	case convpgn.PGNStatusDraw:
+		s.Draw = 1
+	default:
+		return
+	}
+	ct.Pairs[white][black] = ct.Pairs[white][black].Add(s)
+	ct.Pairs[black][white] = ct.Pairs[black][white].Add(s.Reverse())
+}
+
+// score of player against all opponents
+func (ct *Crosstable) Total(i int) Score {
+	var s Score
+	for j := range ct.Pairs[i] {
+		s = s.Add(ct.Pairs[i][j])
+	}
+	return s
+}
+
+// table sorted by points: Elo against the field, score and results of pairs
+func (ct *Crosstable) Write(w io.Writer) {
+	order := make([]int, len(ct.Names))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		pa, pb := ct.Total(a).Points(), ct.Total(b).Points()
+		switch {
+		case pa > pb:
+			return -1
+		case pa < pb:
+			return 1
+		}
+		return 0
+	})
+
+	width := 4
+	for _, n := range ct.Names {
+		width = max(width, len(n))
+	}
+	fmt.Fprintf(w, "%-4s %-*s %16s %6s %7s %6s %6s", "Rank", width, "Name", "Elo", "Games", "Score", "Points", "Draws")
+	for k := range order {
+		fmt.Fprintf(w, " %9d", k+1)
+	}
+	fmt.Fprintln(w)
+	for k, i := range order {
+		total := ct.Total(i)
+		fmt.Fprintf(w, "%-4d %-*s %16s %6d %6.1f%% %6.1f %5.1f%%", k+1, width, ct.Names[i],
+			formatElo(total.Elo()), total.Games(), total.Ratio()*100, total.Points(), percent(total.Draw, total.Games()))
+		for _, j := range order {
+			cell := "-"
+			if p := ct.Pairs[i][j]; i != j && p.Games() > 0 {
+				cell = fmt.Sprintf("%g/%d", p.Points(), p.Games())
+			}
+			fmt.Fprintf(w, " %9s", cell)
+		}
+		fmt.Fprintln(w)
+	}
+
+	// head-to-head of two players
+	if len(ct.Names) == 2 {
+		s := ct.Pairs[order[0]][order[1]]
+		fmt.Fprintf(w, "\n%s vs %s: %s, Elo %s, LOS %.1f%%\n", ct.Names[order[0]], ct.Names[order[1]],
+			s, strings.TrimSpace(formatElo(s.Elo())), s.LOS()*100)
+	}
+}
+
+func percent(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b) * 100
+}
@@ -0,0 +1,117 @@
+package arena
+
+import (
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/engine"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------------------------------------
+// Time controls
+// --------------------------------------------------
+// formats: PGN TimeControl of clock package ("40/60+0.6", "60+0.6", "300",
+// "300d2", "40/5400+30:1800+30"), "st=0.5" (seconds per move),
+// "depth=8" (fixed depth without time)
+
+const (
+	// engine is not flagged if it is late less than margin
+	timeMargin = 50 * time.Millisecond
+)
+
+type TimeControl struct {
+	Clock    clock.Control // stages of clock
+	MoveTime time.Duration // fixed time per move (no clock)
+	Depth    int           // fixed depth (no clock)
+}
+
+func ParseTimeControl(s string) (TimeControl, error) {
+	var tc TimeControl
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return tc, fmt.Errorf("empty time control")
+	}
+	if v, ok := strings.CutPrefix(s, "depth="); ok {
+		d, err := strconv.Atoi(v)
+		if err != nil || d <= 0 {
+			return tc, fmt.Errorf("invalid depth %q", v)
+		}
+		tc.Depth = d
+		return tc, nil
+	}
+	if v, ok := strings.CutPrefix(s, "st="); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return tc, fmt.Errorf("invalid time per move %q", v)
+		}
+		tc.MoveTime = time.Duration(f * float64(time.Second))
+		return tc, nil
+	}
+	c, err := clock.Parse(s)
+	if err != nil {
+		return tc, err
+	}
+	if !c.HasClock() {
+		return tc, fmt.Errorf("time control %q without time", s)
+	}
+	tc.Clock = c
+	return tc, nil
+}
+
+// clock is used (game can be lost on time)
+func (tc TimeControl) HasClock() bool { return tc.Clock.HasClock() }
+
+// time control of PGN (TimeControl tag)
+func (tc TimeControl) String() string {
+	switch {
+	case tc.Depth > 0:
+		return fmt.Sprintf("depth=%d", tc.Depth)
+	case tc.MoveTime > 0:
+		return "st=" + strconv.FormatFloat(tc.MoveTime.Seconds(), 'f', -1, 64)
+	}
+	return tc.Clock.String()
+}
+
+// clock of one side
+type engineClock struct {
+	tc   TimeControl
+	side *clock.Side
+}
+
+func newEngineClock(tc TimeControl) *engineClock {
+	side := clock.NewSide(tc.Clock)
+	side.Grace = timeMargin
+	return &engineClock{tc: tc, side: side}
+}
+
+// limits of next search: time is split over moves to go
+func (c *engineClock) params(p engine.SearchParams) engine.SearchParams {
+	switch {
+	case c.tc.Depth > 0:
+		p.MaxDepth, p.MaxTimeMs = c.tc.Depth, 0
+		return p
+	case c.tc.MoveTime > 0:
+		p.MaxTimeMs = c.tc.MoveTime.Milliseconds()
+		return p
+	case !c.tc.HasClock():
+		return p
+	}
+	// keep reserve for answer of engine
+	p.MaxTimeMs = c.side.Budget(timeMargin).Milliseconds()
+	return p
+}
+
+// deadlines of engine answer: search is stopped at soft deadline if engine has
+// a move (internal engine checks time only between iterations), at hard anyway
+func (c *engineClock) limits(p engine.SearchParams) (soft, hard time.Duration) {
+	if c.tc.HasClock() {
+		return time.Duration(p.MaxTimeMs) * time.Millisecond, c.side.Limit() + timeMargin
+	}
+	if p.MaxTimeMs > 0 {
+		d := time.Duration(p.MaxTimeMs)*time.Millisecond + moveGrace
+		return d, d
+	}
+	return 0, 0
+}
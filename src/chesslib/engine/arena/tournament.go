@@ -0,0 +1,220 @@
+package arena
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------
+// Tournament: round-robin or gauntlet of engines
+// --------------------------------------------------
+
+type Format int
+
+const (
+	RoundRobin Format = iota // every player against every other
+	Gauntlet                 // first player against all others
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "round-robin", "roundrobin", "rr":
+		return RoundRobin, nil
+	case "gauntlet":
+		return Gauntlet, nil
+	}
+	return 0, fmt.Errorf("unknown tournament format %q", s)
+}
+
+type Player struct {
+	Name   string
+	New    func() (engine.Engine, error) // new initialized engine for every game
+	Params engine.SearchParams           // threads, depth, ...
+	TC     TimeControl
+}
+
+type TournamentOptions struct {
+	Format       Format
+	Games        int       // games of every pair
+	Repeat       bool      // every opening is played twice with swapped colors
+	Openings     []Opening // empty - start position
+	MaxPlies     int
+	Adjudication Adjudication
+	Concurrency  int // games at the same time (0 - one)
+	Event        string
+}
+
+// game of schedule
+type Pairing struct {
+	Number       int // from 1
+	White, Black int // indices of players
+	Opening      Opening
+}
+
+type Game struct {
+	Pairing
+	Result GameResult
+	Err    error // game is not played (engine failed)
+}
+
+// games of tournament: colors alternate, every pair plays the same openings
+func Schedule(players int, opts TournamentOptions) []Pairing {
+	var pairs [][2]int
+	for i := 0; i < players; i++ {
+		for j := i + 1; j < players; j++ {
+			if opts.Format == Gauntlet && i != 0 {
+				break
+			}
+			pairs = append(pairs, [2]int{i, j})
+		}
+	}
+	var list []Pairing
+	for g := 0; g < opts.Games; g++ {
+		var op Opening
+		if n := len(opts.Openings); n > 0 {
+			k := g
+			if opts.Repeat {
+				k = g / 2
+			}
+			op = opts.Openings[k%n]
+		}
+		for _, p := range pairs {
+			white, black := p[0], p[1]
+			if g%2 == 1 {
+				white, black = black, white
+			}
+			list = append(list, Pairing{Number: len(list) + 1, White: white, Black: black, Opening: op})
+		}
+	}
+	return list
+}
+
+// play games of schedule, done is called after every game (one at a time)
+func RunTournament(ctx context.Context, players []Player, opts TournamentOptions, done func(g *Game, ct *Crosstable)) (*Crosstable, error) {
+	if len(players) < 2 {
+		return nil, fmt.Errorf("tournament needs at least 2 players")
+	}
+	names := make([]string, len(players))
+	for i, p := range players {
+		names[i] = p.Name
+	}
+	ct := NewCrosstable(names)
+
+	jobs := make(chan Pairing)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < max(opts.Concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				g := &Game{Pairing: p}
+				g.Result, g.Err = playPairing(ctx, players, opts, p)
+				if ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				if g.Err == nil {
+					ct.Add(p.White, p.Black, g.Result.Result)
+				}
+				if done != nil {
+					done(g, ct)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+schedule:
+	for _, p := range Schedule(len(players), opts) {
+		select {
+		case jobs <- p:
+		case <-ctx.Done():
+			break schedule
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return ct, ctx.Err()
+}
+
+func playPairing(ctx context.Context, players []Player, opts TournamentOptions, p Pairing) (GameResult, error) {
+	white, err := players[p.White].New()
+	if err != nil {
+		return GameResult{}, fmt.Errorf("%s: %v", players[p.White].Name, err)
+	}
+	defer white.Close()
+	black, err := players[p.Black].New()
+	if err != nil {
+		return GameResult{}, fmt.Errorf("%s: %v", players[p.Black].Name, err)
+	}
+	defer black.Close()
+	return PlayGame(ctx, white, black, GameOptions{
+		StartFEN:     p.Opening.FEN,
+		Opening:      p.Opening.Moves,
+		White:        players[p.White].Params,
+		Black:        players[p.Black].Params,
+		WhiteTC:      players[p.White].TC,
+		BlackTC:      players[p.Black].TC,
+		MaxPlies:     opts.MaxPlies,
+		Adjudication: opts.Adjudication,
+	})
+}
+
+// PGN of played game
+func (g *Game) PGN(players []Player, event string) convpgn.PGNGame {
+	pg := convpgn.PGNGame{
+		Headers: map[convpgn.PGNHeader]string{
+			convpgn.PGNHeaderEvent: event,
+			convpgn.PGNHeaderSite:  "evilchess",
+			convpgn.PGNHeaderDate:  time.Now().Format("2006.01.02"),
+			convpgn.PGNHeaderRound: strconv.Itoa(g.Number),
+			convpgn.PGNHeaderWhite: players[g.White].Name,
+			convpgn.PGNHeaderBlack: players[g.Black].Name,
+		},
+		Tags: map[string]string{
+			"PlyCount":    strconv.Itoa(g.Result.Plies),
+			"Termination": g.Result.Termination,
+		},
+		Moves:    g.Result.SAN,
+		Comments: g.Result.Comments,
+		Result:   g.Result.Result,
+	}
+	if g.Opening.Name != "" {
+		pg.Headers[convpgn.PGNHeaderOpening] = g.Opening.Name
+	}
+	if g.Opening.FEN != "" {
+		// numbers of moves are taken from FEN
+		if b, err := convfen.ConvertFENToBoard(g.Opening.FEN); err == nil && g.Opening.FEN != base.FEN_START_GAME {
+			pg.Tags["FEN"] = convfen.ConvertBoardToFEN(*b)
+			pg.Tags["SetUp"] = "1"
+		}
+	}
+	wtc, btc := players[g.White].TC, players[g.Black].TC
+	if wtc.String() == btc.String() {
+		pg.Tags["TimeControl"] = wtc.String()
+	} else {
+		pg.Tags["WhiteTimeControl"] = wtc.String()
+		pg.Tags["BlackTimeControl"] = btc.String()
+	}
+	if g.Result.Reason != "" {
+		pg.Comments = append([]string(nil), pg.Comments...)
+		if n := len(pg.Comments); n > 0 {
+			pg.Comments[n-1] = joinComment(pg.Comments[n-1], g.Result.Reason)
+		}
+	}
+	return pg
+}
+
+func joinComment(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + ", " + b
+}
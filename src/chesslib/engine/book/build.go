@@ -0,0 +1,128 @@
+package book
+
+import (
+	"errors"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/history"
+	"io"
+	"math"
+)
+
+// --------------------------------------------------
+// Book from PGN games
+// --------------------------------------------------
+// weight of move is its score for side to move: 2 per win, 1 per draw
+
+type BuildOptions struct {
+	MaxPly   int // moves of first N plies of game
+	MinGames int // move must be played in at least N games
+}
+
+func DefaultBuildOptions() BuildOptions {
+	return BuildOptions{MaxPly: 20, MinGames: 3}
+}
+
+type moveKey struct {
+	key  uint64
+	move uint16
+}
+
+type moveStat struct {
+	games int
+	score int
+}
+
+type Builder struct {
+	opts  BuildOptions
+	stats map[moveKey]*moveStat
+	games int
+}
+
+func NewBuilder(opts BuildOptions) *Builder {
+	return &Builder{opts: opts, stats: make(map[moveKey]*moveStat)}
+}
+
+func (bd *Builder) Games() int { return bd.games }
+
+// add moves of game (games with illegal moves are skipped)
+func (bd *Builder) AddGame(g *convpgn.PGNGame) bool {
+	fen := g.Tags["FEN"]
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return false
+	}
+	h := history.NewHistory()
+	if err := h.ImportPGNGame(g, b); err != nil {
+		return false
+	}
+	bd.games++
+
+	entries := h.Moves()
+	for i := 1; i < len(entries) && (bd.opts.MaxPly <= 0 || i <= bd.opts.MaxPly); i++ {
+		before := &entries[i-1].Board
+		k := moveKey{key: Hash(before), move: EncodeMove(before, entries[i].Move)}
+		st := bd.stats[k]
+		if st == nil {
+			st = &moveStat{}
+			bd.stats[k] = st
+		}
+		st.games++
+		switch {
+		case g.Result == convpgn.PGNStatusDraw:
+			st.score++
+		case g.Result == convpgn.PGNStatusWW && before.WhiteToMove,
+			g.Result == convpgn.PGNStatusBW && !before.WhiteToMove:
+			st.score += 2
+		}
+	}
+	return true
+}
+
+// add all games of PGN stream, count of added games is returned
+func (bd *Builder) AddPGN(r io.Reader) (int, error) {
+	p := convpgn.NewPGNParser(r)
+	added := 0
+	for {
+		g, err := p.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return added, nil
+			}
+			return added, err
+		}
+		if bd.AddGame(g) {
+			added++
+		}
+	}
+}
+
+// entries of book (weights are scaled down to uint16 if needed)
+func (bd *Builder) Entries() []Entry {
+	maxScore := 0
+	for _, st := range bd.stats {
+		maxScore = max(maxScore, st.score)
+	}
+	scale := 1.0
+	if maxScore > math.MaxUint16 {
+		scale = float64(math.MaxUint16) / float64(maxScore)
+	}
+	var out []Entry
+	for k, st := range bd.stats {
+		if st.games < bd.opts.MinGames {
+			continue
+		}
+		out = append(out, Entry{Key: k.key, Move: k.move, Weight: uint16(float64(st.score) * scale)})
+	}
+	sortEntries(out)
+	return out
+}
+
+func (bd *Builder) Write(w io.Writer) (int, error) {
+	entries := bd.Entries()
+	return len(entries), WriteEntries(w, entries)
+}
@@ -0,0 +1,99 @@
+package book
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"math/rand/v2"
+	"sync"
+)
+
+// --------------------------------------------------
+// Engine with opening book
+// --------------------------------------------------
+// book move is played without search while the position is in book,
+// pondering and MultiPV analysis always use the engine
+
+type BookEngine struct {
+	engine.Engine
+
+	book *Book
+
+	mu     sync.Mutex
+	board  *base.Board
+	chosen *engine.AnalysisInfo // book move of the last search
+}
+
+func NewBookEngine(inner engine.Engine, bk *Book) *BookEngine {
+	return &BookEngine{Engine: inner, book: bk}
+}
+
+func (e *BookEngine) Book() *Book           { return e.book }
+func (e *BookEngine) Unwrap() engine.Engine { return e.Engine }
+
+func (e *BookEngine) SetPosition(b *base.Board) error {
+	e.mu.Lock()
+	e.board = moves.CloneBoard(b)
+	e.mu.Unlock()
+	return e.Engine.SetPosition(b)
+}
+
+func (e *BookEngine) SetPositionFEN(fen string) error {
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.board = b
+	e.mu.Unlock()
+	return e.Engine.SetPositionFEN(fen)
+}
+
+func (e *BookEngine) StartAnalysis(params engine.SearchParams) error {
+	e.mu.Lock()
+	e.chosen = nil
+	if e.board != nil && !params.Ponder && params.MultiPV <= 1 {
+		if mv, err := e.book.Pick(e.board, rand.Float64()); err == nil {
+			e.chosen = &engine.AnalysisInfo{
+				PV:          []base.Move{mv},
+				UCIPV:       []string{moves.MoveToUCI(e.board, mv)},
+				UCIBestMove: moves.MoveToUCI(e.board, mv),
+			}
+			e.chosen.BestMove = &e.chosen.PV[0]
+			e.mu.Unlock()
+			return nil
+		}
+	}
+	e.mu.Unlock()
+	return e.Engine.StartAnalysis(params)
+}
+
+func (e *BookEngine) inBook() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.chosen != nil
+}
+
+func (e *BookEngine) StopAnalysis() error {
+	if e.inBook() {
+		return nil
+	}
+	return e.Engine.StopAnalysis()
+}
+
+func (e *BookEngine) WaitDone() {
+	if e.inBook() {
+		return
+	}
+	e.Engine.WaitDone()
+}
+
+func (e *BookEngine) BestNow() engine.AnalysisInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.chosen != nil {
+		return *e.chosen
+	}
+	return e.Engine.BestNow()
+}
@@ -0,0 +1,131 @@
+package book
+
+import (
+	"encoding/binary"
+	"evilchess/src/chesslib/base"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// --------------------------------------------------
+// Zobrist keys of Polyglot hash
+// --------------------------------------------------
+// layout of the table is the Polyglot one:
+//   0..767   pieces: 64 * kind + square (kind: bp wp bn wn bb wb br wr bq wq bk wk)
+//   768..771 castling: K Q k q
+//   772..779 en passant file
+//   780      white to move
+// default keys are the Random64 table of Polyglot, so books of other tools
+// are read as is; LoadKeys/SetKeys replace them by another table
+
+const (
+	NumKeys = 781
+
+	keyCastle    = 768
+	keyEnPassant = 772
+	keyTurn      = 780
+)
+
+var (
+	keysMu sync.RWMutex
+	keys   = random64
+)
+
+// table of 781 keys (big-endian uint64, like Random64 of polyglot sources)
+func ParseKeys(data []byte) ([NumKeys]uint64, error) {
+	var out [NumKeys]uint64
+	if len(data) != NumKeys*8 {
+		return out, fmt.Errorf("invalid keys size: %d (expected %d)", len(data), NumKeys*8)
+	}
+	for i := range out {
+		out[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+	return out, nil
+}
+
+func LoadKeys(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	k, err := ParseKeys(data)
+	if err != nil {
+		return err
+	}
+	SetKeys(k)
+	return nil
+}
+
+func SetKeys(k [NumKeys]uint64) {
+	keysMu.Lock()
+	keys = k
+	keysMu.Unlock()
+}
+
+// kind of piece in Polyglot order, -1 for empty square
+func pieceKind(p base.Piece) int {
+	switch p {
+	case base.BPawn:
+		return 0
+	case base.WPawn:
+		return 1
+	case base.BKnight:
+		return 2
+	case base.WKnight:
+		return 3
+	case base.BBishop:
+		return 4
+	case base.WBishop:
+		return 5
+	case base.BRook:
+		return 6
+	case base.WRook:
+		return 7
+	case base.BQueen:
+		return 8
+	case base.WQueen:
+		return 9
+	case base.BKing:
+		return 10
+	case base.WKing:
+		return 11
+	}
+	return -1
+}
+
+// Polyglot hash of position
+func Hash(b *base.Board) uint64 {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	var h uint64
+	for sq, p := range b.Mailbox {
+		if k := pieceKind(p); k >= 0 {
+			h ^= keys[64*k+sq]
+		}
+	}
+	for i, ok := range []bool{b.Casting.WK, b.Casting.WQ, b.Casting.BK, b.Casting.BQ} {
+		if ok {
+			h ^= keys[keyCastle+i]
+		}
+	}
+	// en passant only if pawn of side to move stands next to captured pawn
+	if b.EnPassant >= 0 {
+		file := b.EnPassant % 8
+		row, pawn := 4, base.WPawn
+		if !b.WhiteToMove {
+			row, pawn = 3, base.BPawn
+		}
+		for _, f := range []int{file - 1, file + 1} {
+			if f >= 0 && f < 8 && b.Mailbox[row*8+f] == pawn {
+				h ^= keys[keyEnPassant+file]
+				break
+			}
+		}
+	}
+	if b.WhiteToMove {
+		h ^= keys[keyTurn]
+	}
+	return h
+}
@@ -0,0 +1,204 @@
+package book
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// --------------------------------------------------
+// Polyglot opening book (.bin)
+// --------------------------------------------------
+// entries of 16 bytes (big-endian) sorted by key:
+//   key uint64, move uint16, weight uint16, learn uint32
+// move: to file (bits 0-2), to row (3-5), from file (6-8), from row (9-11),
+// promotion (12-14: 0 none, 1 knight, 2 bishop, 3 rook, 4 queen);
+// castling is written as king takes own rook (e1h1, e1a1, e8h8, e8a8)
+
+const (
+	DefaultBookFile = "book.bin"
+
+	entrySize = 16
+)
+
+type Entry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+type Book struct {
+	entries []Entry
+}
+
+// move of book with weight
+type BookMove struct {
+	Move   base.Move
+	Weight int
+}
+
+func Read(r io.Reader) (*Book, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Book, error) {
+	if len(data)%entrySize != 0 {
+		return nil, fmt.Errorf("invalid book size: %d", len(data))
+	}
+	bk := &Book{entries: make([]Entry, len(data)/entrySize)}
+	for i := range bk.entries {
+		d := data[i*entrySize:]
+		bk.entries[i] = Entry{
+			Key:    binary.BigEndian.Uint64(d),
+			Move:   binary.BigEndian.Uint16(d[8:]),
+			Weight: binary.BigEndian.Uint16(d[10:]),
+			Learn:  binary.BigEndian.Uint32(d[12:]),
+		}
+	}
+	// probe uses binary search
+	if !sort.SliceIsSorted(bk.entries, func(i, j int) bool { return bk.entries[i].Key < bk.entries[j].Key }) {
+		sortEntries(bk.entries)
+	}
+	return bk, nil
+}
+
+func Open(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(bufio.NewReader(f))
+}
+
+func (bk *Book) Len() int { return len(bk.entries) }
+
+// by key, better moves first
+func sortEntries(e []Entry) {
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].Key != e[j].Key {
+			return e[i].Key < e[j].Key
+		}
+		return e[i].Weight > e[j].Weight
+	})
+}
+
+func WriteEntries(w io.Writer, entries []Entry) error {
+	sortEntries(entries)
+	bw := bufio.NewWriter(w)
+	var d [entrySize]byte
+	for _, e := range entries {
+		binary.BigEndian.PutUint64(d[:], e.Key)
+		binary.BigEndian.PutUint16(d[8:], e.Move)
+		binary.BigEndian.PutUint16(d[10:], e.Weight)
+		binary.BigEndian.PutUint32(d[12:], e.Learn)
+		if _, err := bw.Write(d[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// --------------------------------------------------
+// moves
+// --------------------------------------------------
+
+func isKing(p base.Piece) bool { return p == base.WKing || p == base.BKing }
+
+func promotionCode(p base.Piece) uint16 {
+	switch p {
+	case base.WKnight, base.BKnight:
+		return 1
+	case base.WBishop, base.BBishop:
+		return 2
+	case base.WRook, base.BRook:
+		return 3
+	case base.WQueen, base.BQueen:
+		return 4
+	}
+	return 0
+}
+
+// legal move to Polyglot code
+func EncodeMove(b *base.Board, mv base.Move) uint16 {
+	from, to := mv.From, mv.To
+	pc := b.Mailbox[base.ConvPointToIndex(from)]
+	if isKing(pc) && (int(to.W)-int(from.W) == 2 || int(from.W)-int(to.W) == 2) {
+		// castling: king takes own rook
+		if to.W > from.W {
+			to.W = 7
+		} else {
+			to.W = 0
+		}
+	}
+	code := uint16(to.W) | uint16(to.H)<<3 | uint16(from.W)<<6 | uint16(from.H)<<9
+	if (pc == base.WPawn || pc == base.BPawn) && mv.Piece != pc {
+		code |= promotionCode(mv.Piece) << 12
+	}
+	return code
+}
+
+// Polyglot code to legal move of position
+func DecodeMove(b *base.Board, code uint16) (base.Move, bool) {
+	for _, mv := range moves.GenerateLegalMoves(b) {
+		if EncodeMove(b, mv) == code {
+			return mv, true
+		}
+	}
+	return base.Move{}, false
+}
+
+// --------------------------------------------------
+// probe
+// --------------------------------------------------
+
+// legal moves of position in book, better first
+func (bk *Book) Probe(b *base.Board) []BookMove {
+	key := Hash(b)
+	i := sort.Search(len(bk.entries), func(i int) bool { return bk.entries[i].Key >= key })
+	var out []BookMove
+	for ; i < len(bk.entries) && bk.entries[i].Key == key; i++ {
+		if mv, ok := DecodeMove(b, bk.entries[i].Move); ok {
+			out = append(out, BookMove{Move: mv, Weight: int(bk.entries[i].Weight)})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Weight > out[j].Weight })
+	return out
+}
+
+var ErrNotInBook = errors.New("position is not in book")
+
+// random move of book by weights, r is random number 0..1
+// (moves with zero weight are played only if all are zero)
+func (bk *Book) Pick(b *base.Board, r float64) (base.Move, error) {
+	list := bk.Probe(b)
+	if len(list) == 0 {
+		return base.Move{}, ErrNotInBook
+	}
+	sum := 0
+	for _, m := range list {
+		sum += m.Weight
+	}
+	if sum == 0 {
+		return list[min(int(r*float64(len(list))), len(list)-1)].Move, nil
+	}
+	x := int(r * float64(sum))
+	for _, m := range list {
+		if x < m.Weight {
+			return m.Move, nil
+		}
+		x -= m.Weight
+	}
+	return list[0].Move, nil
+}
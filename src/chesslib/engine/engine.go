@@ -16,12 +16,27 @@ type AnalysisInfo struct {
 	BestMove    *base.Move  // лучший ход на данный момент (ссылка на первый ход PV)
 	UCIPV       []string
 	UCIBestMove string
+	UCIPonder   string   // ожидаемый ответ соперника (bestmove ... ponder ...)
+	Lines       []PVLine // MultiPV: best lines sorted by score (Lines[0] is the main line)
+	Tablebase   bool     // root position is in endgame tablebase
+	TBWinIn     int      // tablebase win (+) / loss (-) in N plies to zeroing move (DTZ), 0 - draw
+}
+
+// one line of MultiPV analysis
+type PVLine struct {
+	ScoreCP int // from side to move POV
+	MateIn  int
+	PV      []base.Move
+	UCIPV   []string
 }
 
 type SearchParams struct {
 	MaxDepth  int   // 0 = unlimited (but bounded by MaxTimeMs/MaxNodes)
 	MaxTimeMs int64 // 0 = no time limits
 	Infinite  bool  // if true, search indefinitely until StopAnalysis()
+	Ponder    bool  // search on the opponent's time; limits apply after PonderHit()
+	Threads   int   // search threads, 0 = engine default
+	MultiPV   int   // number of best lines, 0/1 = only main line
 }
 
 type LevelAnalyze int
@@ -55,6 +70,7 @@ type Engine interface {
 	SetPosition(b *base.Board) error
 	StartAnalysis(params SearchParams) error
 	StopAnalysis() error
+	PonderHit() error
 	BestNow() AnalysisInfo
 	WaitDone()
 	Subscribe(ch chan<- AnalysisInfo) (unsubscribe func())
@@ -88,6 +104,15 @@ func (i *AnalysisInfo) GetBestMove(mb base.Mailbox) *base.Move {
 	}
 }
 
+// expected opponent reply (second move of PV), nil if unknown
+func (i *AnalysisInfo) GetPonderMove() *base.Move {
+	if len(i.PV) < 2 {
+		return nil
+	}
+	mv := i.PV[1]
+	return &mv
+}
+
 func LevelToParams(lvl LevelAnalyze) SearchParams {
 	switch lvl {
 	case LevelOne:
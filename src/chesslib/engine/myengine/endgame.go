@@ -0,0 +1,50 @@
+package myengine
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/chesslib/logic/rules"
+)
+
+// --------------------------------------------------
+// Own endgame tables (retrograde analysis): positions with few pieces
+// get exact mate score, root moves are limited to moves of perfect play
+// --------------------------------------------------
+
+// use endgame tables in search, nil disables them (applied on next StartAnalysis)
+func (e *EvilEngine) SetEndgameTables(t *endgame.Tables) {
+	e.mu.Lock()
+	e.eg = t
+	e.mu.Unlock()
+}
+
+func (e *EvilEngine) EndgameTables() *endgame.Tables {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.eg
+}
+
+func (s *searcher) probeEndgame(b *base.Board, ply int) (int, bool) {
+	if s.eg == nil || !endgame.Covers(b) {
+		return 0, false
+	}
+	res, err := s.eg.Probe(b)
+	if err != nil {
+		return 0, false
+	}
+	switch res.WDL {
+	case 1:
+		return MATE_SCORE - ply - res.Plies, true
+	case -1:
+		return -MATE_SCORE + ply + res.Plies, true
+	}
+	return 0, true
+}
+
+// moves of perfect play in root, nil if root is not in tables
+func endgameRoot(t *endgame.Tables, pos *base.Board) []base.Move {
+	if t == nil || !endgame.Covers(pos) {
+		return nil
+	}
+	return rules.PerfectMoves(t, pos)
+}
@@ -0,0 +1,676 @@
+package myengine
+
+import (
+	"evilchess/src/chesslib/base"
+	"fmt"
+	"strings"
+)
+
+// --------------------------------------------------
+// Tapered evaluation (middlegame/endgame scores mixed by game phase)
+// --------------------------------------------------
+
+// piece types (index of weight arrays)
+const (
+	ptPawn = iota
+	ptKnight
+	ptBishop
+	ptRook
+	ptQueen
+	ptKing
+	ptNone
+)
+
+// evaluation terms (rows of EvalBreakdown)
+const (
+	termMaterial = iota
+	termPST
+	termMobility
+	termKingSafety
+	termPawns
+	termBishopPair
+	termRooks
+	termCount
+)
+
+var termNames = [termCount]string{"material", "pst", "mobility", "king safety", "pawns", "bishop pair", "rooks"}
+
+// phase weight of pieces: full phase (24) is the start position
+var phaseInc = [6]int{0, 1, 1, 2, 4, 0}
+
+const maxPhase = 24
+
+// attacked squares counted from this number give mobility bonus
+var mobilityBase = [6]int{0, 4, 6, 7, 13, 0}
+
+// weight of attacker for king safety
+var kingAttackUnits = [6]int{0, 2, 2, 3, 5, 0}
+
+// parameters of the evaluation (tables are from white side, index 0 = a8)
+type EvalWeights struct {
+	PieceMG [6]int     `json:"piece_mg"`
+	PieceEG [6]int     `json:"piece_eg"`
+	PstMG   [6][64]int `json:"pst_mg"`
+	PstEG   [6][64]int `json:"pst_eg"`
+
+	// per attacked square over mobilityBase
+	MobilityMG [6]int `json:"mobility_mg"`
+	MobilityEG [6]int `json:"mobility_eg"`
+
+	// passed pawn bonus by relative rank
+	PassedMG   [8]int `json:"passed_mg"`
+	PassedEG   [8]int `json:"passed_eg"`
+	DoubledMG  int    `json:"doubled_mg"`
+	DoubledEG  int    `json:"doubled_eg"`
+	IsolatedMG int    `json:"isolated_mg"`
+	IsolatedEG int    `json:"isolated_eg"`
+
+	BishopPairMG   int `json:"bishop_pair_mg"`
+	BishopPairEG   int `json:"bishop_pair_eg"`
+	RookOpenMG     int `json:"rook_open_mg"`
+	RookOpenEG     int `json:"rook_open_eg"`
+	RookSemiOpenMG int `json:"rook_semi_open_mg"`
+	RookSemiOpenEG int `json:"rook_semi_open_eg"`
+
+	// king safety (middlegame only)
+	KingShield   int `json:"king_shield"`
+	KingOpenFile int `json:"king_open_file"`
+	KingAttack   int `json:"king_attack"`
+}
+
+func DefaultWeights() EvalWeights {
+	return EvalWeights{
+		PieceMG: [6]int{82, 337, 365, 477, 1025, 0},
+		PieceEG: [6]int{94, 281, 297, 512, 936, 0},
+		PstMG: [6][64]int{
+			{
+				0, 0, 0, 0, 0, 0, 0, 0,
+				50, 50, 50, 50, 50, 50, 50, 50,
+				10, 10, 20, 30, 30, 20, 10, 10,
+				5, 5, 10, 25, 25, 10, 5, 5,
+				0, 0, 0, 20, 20, 0, 0, 0,
+				5, -5, -10, 0, 0, -10, -5, 5,
+				5, 10, 10, -20, -20, 10, 10, 5,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			{
+				-50, -40, -30, -30, -30, -30, -40, -50,
+				-40, -20, 0, 0, 0, 0, -20, -40,
+				-30, 0, 10, 15, 15, 10, 0, -30,
+				-30, 5, 15, 20, 20, 15, 5, -30,
+				-30, 0, 15, 20, 20, 15, 0, -30,
+				-30, 5, 10, 15, 15, 10, 5, -30,
+				-40, -20, 0, 5, 5, 0, -20, -40,
+				-50, -40, -30, -30, -30, -30, -40, -50,
+			},
+			{
+				-20, -10, -10, -10, -10, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 10, 10, 5, 0, -10,
+				-10, 5, 5, 10, 10, 5, 5, -10,
+				-10, 0, 10, 10, 10, 10, 0, -10,
+				-10, 10, 10, 10, 10, 10, 10, -10,
+				-10, 5, 0, 0, 0, 0, 5, -10,
+				-20, -10, -10, -10, -10, -10, -10, -20,
+			},
+			{
+				0, 0, 0, 0, 0, 0, 0, 0,
+				5, 10, 10, 10, 10, 10, 10, 5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				0, 0, 0, 5, 5, 0, 0, 0,
+			},
+			{
+				-20, -10, -10, -5, -5, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-5, 0, 5, 5, 5, 5, 0, -5,
+				0, 0, 5, 5, 5, 5, 0, -5,
+				-10, 5, 5, 5, 5, 5, 0, -10,
+				-10, 0, 5, 0, 0, 0, 0, -10,
+				-20, -10, -10, -5, -5, -10, -10, -20,
+			},
+			{
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-20, -30, -30, -40, -40, -30, -30, -20,
+				-10, -20, -20, -20, -20, -20, -20, -10,
+				20, 20, 0, 0, 0, 0, 20, 20,
+				20, 30, 10, 0, 0, 10, 30, 20,
+			},
+		},
+		PstEG: [6][64]int{
+			{
+				0, 0, 0, 0, 0, 0, 0, 0,
+				80, 80, 80, 80, 80, 80, 80, 80,
+				50, 50, 50, 50, 50, 50, 50, 50,
+				30, 30, 30, 30, 30, 30, 30, 30,
+				15, 15, 15, 15, 15, 15, 15, 15,
+				5, 5, 5, 5, 5, 5, 5, 5,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			{
+				-50, -40, -30, -30, -30, -30, -40, -50,
+				-40, -20, 0, 0, 0, 0, -20, -40,
+				-30, 0, 10, 15, 15, 10, 0, -30,
+				-30, 5, 15, 20, 20, 15, 5, -30,
+				-30, 0, 15, 20, 20, 15, 0, -30,
+				-30, 5, 10, 15, 15, 10, 5, -30,
+				-40, -20, 0, 5, 5, 0, -20, -40,
+				-50, -40, -30, -30, -30, -30, -40, -50,
+			},
+			{
+				-20, -10, -10, -10, -10, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 10, 10, 5, 0, -10,
+				-10, 5, 10, 10, 10, 10, 5, -10,
+				-10, 5, 10, 10, 10, 10, 5, -10,
+				-10, 0, 5, 10, 10, 5, 0, -10,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-20, -10, -10, -10, -10, -10, -10, -20,
+			},
+			{
+				0, 0, 0, 0, 0, 0, 0, 0,
+				5, 5, 5, 5, 5, 5, 5, 5,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			{
+				-20, -10, -10, -5, -5, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-5, 0, 5, 10, 10, 5, 0, -5,
+				-5, 0, 5, 10, 10, 5, 0, -5,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-20, -10, -10, -5, -5, -10, -10, -20,
+			},
+			{
+				-50, -40, -30, -20, -20, -30, -40, -50,
+				-30, -20, -10, 0, 0, -10, -20, -30,
+				-30, -10, 20, 30, 30, 20, -10, -30,
+				-30, -10, 30, 40, 40, 30, -10, -30,
+				-30, -10, 30, 40, 40, 30, -10, -30,
+				-30, -10, 20, 30, 30, 20, -10, -30,
+				-30, -30, 0, 0, 0, 0, -30, -30,
+				-50, -30, -30, -30, -30, -30, -30, -50,
+			},
+		},
+		MobilityMG:     [6]int{0, 4, 5, 2, 1, 0},
+		MobilityEG:     [6]int{0, 4, 5, 4, 2, 0},
+		PassedMG:       [8]int{0, 5, 10, 15, 25, 40, 60, 0},
+		PassedEG:       [8]int{0, 10, 20, 35, 60, 100, 150, 0},
+		DoubledMG:      -10,
+		DoubledEG:      -20,
+		IsolatedMG:     -10,
+		IsolatedEG:     -15,
+		BishopPairMG:   30,
+		BishopPairEG:   50,
+		RookOpenMG:     25,
+		RookOpenEG:     10,
+		RookSemiOpenMG: 10,
+		RookSemiOpenEG: 5,
+		KingShield:     10,
+		KingOpenFile:   15,
+		KingAttack:     4,
+	}
+}
+
+// middlegame/endgame pair
+type score struct {
+	mg, eg int
+}
+
+func (s *score) add(mg, eg int) {
+	s.mg += mg
+	s.eg += eg
+}
+
+func taper(s score, phase int) int {
+	return (s.mg*phase + s.eg*(maxPhase-phase)) / maxPhase
+}
+
+// piece type and color of mailbox piece
+func pieceType(p base.Piece) (int, bool) {
+	white := base.PieceIsWhite(p)
+	if white {
+		p -= 10
+	}
+	switch p {
+	case base.BPawn:
+		return ptPawn, white
+	case base.BKnight:
+		return ptKnight, white
+	case base.BBishop:
+		return ptBishop, white
+	case base.BRook:
+		return ptRook, white
+	case base.BQueen:
+		return ptQueen, white
+	case base.BKing:
+		return ptKing, white
+	default:
+		return ptNone, white
+	}
+}
+
+// index in weight tables (written from white side, a8 first)
+func pstIndex(idx int, white bool) int {
+	if white {
+		return (7-idx/8)*8 + idx%8
+	}
+	return idx
+}
+
+// --------------------------------------------------
+// Attacks (pseudo-legal, for mobility and king safety)
+// --------------------------------------------------
+var (
+	knightSteps = [8][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps   = [8][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	bishopDirs  = [4][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	rookDirs    = [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+)
+
+// bitmask of squares attacked by piece of type pt on idx
+func pieceAttacks(mb *base.Mailbox, idx, pt int, white bool) uint64 {
+	var bb uint64
+	r, f := idx/8, idx%8
+	step := func(dr, df int) {
+		nr, nf := r+dr, f+df
+		if nr >= 0 && nr < 8 && nf >= 0 && nf < 8 {
+			bb |= 1 << uint(nr*8+nf)
+		}
+	}
+	slide := func(dirs [4][2]int) {
+		for _, d := range dirs {
+			for nr, nf := r+d[0], f+d[1]; nr >= 0 && nr < 8 && nf >= 0 && nf < 8; nr, nf = nr+d[0], nf+d[1] {
+				bb |= 1 << uint(nr*8+nf)
+				if mb[nr*8+nf] != base.EmptyPiece {
+					break
+				}
+			}
+		}
+	}
+	switch pt {
+	case ptPawn:
+		if white {
+			step(1, -1)
+			step(1, 1)
+		} else {
+			step(-1, -1)
+			step(-1, 1)
+		}
+	case ptKnight:
+		for _, s := range knightSteps {
+			step(s[0], s[1])
+		}
+	case ptBishop:
+		slide(bishopDirs)
+	case ptRook:
+		slide(rookDirs)
+	case ptQueen:
+		slide(bishopDirs)
+		slide(rookDirs)
+	case ptKing:
+		for _, s := range kingSteps {
+			step(s[0], s[1])
+		}
+	}
+	return bb
+}
+
+func popCount(bb uint64) int {
+	n := 0
+	for ; bb != 0; bb &= bb - 1 {
+		n++
+	}
+	return n
+}
+
+// --------------------------------------------------
+// Pawn hash (pawn structure depends only on pawns)
+// --------------------------------------------------
+var pawnKeys = func() (keys [2][64]uint64) {
+	// splitmix64 with fixed seed
+	x := uint64(0x9e3779b97f4a7c15)
+	for c := 0; c < 2; c++ {
+		for i := 0; i < 64; i++ {
+			x += 0x9e3779b97f4a7c15
+			z := x
+			z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+			z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+			keys[c][i] = z ^ (z >> 31)
+		}
+	}
+	return
+}()
+
+type pawnEntry struct {
+	key   uint64
+	used  bool
+	score [2]score // white, black
+}
+
+const pawnTableSize = 1 << 14
+
+// evaluator keeps own pawn hash, so every search thread has one (no locks)
+type evaluator struct {
+	w     *EvalWeights
+	pawns []pawnEntry
+}
+
+func newEvaluator(w *EvalWeights) *evaluator {
+	return &evaluator{w: w, pawns: make([]pawnEntry, pawnTableSize)}
+}
+
+// score in centipawns from side to move POV
+func (ev *evaluator) evaluate(b *base.Board) int {
+	terms, phase := ev.terms(b, ev.pawns != nil)
+	var total score
+	for t := range terms {
+		total.add(terms[t][0].mg-terms[t][1].mg, terms[t][0].eg-terms[t][1].eg)
+	}
+	v := taper(total, phase)
+	if !b.WhiteToMove {
+		v = -v
+	}
+	return v
+}
+
+// all terms per color ([term][white, black]) and game phase
+func (ev *evaluator) terms(b *base.Board, usePawnHash bool) ([termCount][2]score, int) {
+	var terms [termCount][2]score
+	w := ev.w
+	mb := &b.Mailbox
+
+	var (
+		phase     int
+		pawnKey   uint64
+		pawnFiles [2][8]int // pawns count per file
+		pawnAtt   [2]uint64 // squares attacked by pawns
+		kingSq    = [2]int{-1, -1}
+		bishops   [2]int
+	)
+	for idx := 0; idx < 64; idx++ {
+		pt, white := pieceType(mb[idx])
+		if pt == ptNone {
+			continue
+		}
+		c := sideIndex(white)
+		pi := pstIndex(idx, white)
+		terms[termMaterial][c].add(w.PieceMG[pt], w.PieceEG[pt])
+		terms[termPST][c].add(w.PstMG[pt][pi], w.PstEG[pt][pi])
+		phase += phaseInc[pt]
+		switch pt {
+		case ptPawn:
+			pawnKey ^= pawnKeys[c][idx]
+			pawnFiles[c][idx%8]++
+			pawnAtt[c] |= pieceAttacks(mb, idx, ptPawn, white)
+		case ptBishop:
+			bishops[c]++
+		case ptKing:
+			kingSq[c] = idx
+		}
+	}
+	if phase > maxPhase {
+		phase = maxPhase
+	}
+
+	// king zones
+	var kingZone [2]uint64
+	for c := 0; c < 2; c++ {
+		if kingSq[c] >= 0 {
+			kingZone[c] = pieceAttacks(mb, kingSq[c], ptKing, c == 0) | 1<<uint(kingSq[c])
+		}
+	}
+
+	// mobility, attacks on the king, rooks on files
+	var attackUnits [2]int
+	for idx := 0; idx < 64; idx++ {
+		pt, white := pieceType(mb[idx])
+		if pt < ptKnight || pt > ptQueen {
+			continue
+		}
+		c := sideIndex(white)
+		att := pieceAttacks(mb, idx, pt, white)
+		// own pieces and squares controlled by enemy pawns are not counted
+		safe := att &^ pawnAtt[1-c]
+		n := 0
+		for bb := safe; bb != 0; bb &= bb - 1 {
+			sq := trailingZeros(bb)
+			if p := mb[sq]; p == base.EmptyPiece || base.PieceIsWhite(p) != white {
+				n++
+			}
+		}
+		n -= mobilityBase[pt]
+		terms[termMobility][c].add(n*w.MobilityMG[pt], n*w.MobilityEG[pt])
+		if att&kingZone[1-c] != 0 {
+			attackUnits[c] += kingAttackUnits[pt]
+		}
+		if pt == ptRook {
+			file := idx % 8
+			if pawnFiles[c][file] == 0 {
+				if pawnFiles[1-c][file] == 0 {
+					terms[termRooks][c].add(w.RookOpenMG, w.RookOpenEG)
+				} else {
+					terms[termRooks][c].add(w.RookSemiOpenMG, w.RookSemiOpenEG)
+				}
+			}
+		}
+	}
+
+	// king safety: pawn shield, open files near king, attackers
+	for c := 0; c < 2; c++ {
+		ks := kingSq[c]
+		if ks < 0 {
+			continue
+		}
+		white := c == 0
+		kr, kf := ks/8, ks%8
+		relRank := kr
+		dir := 1
+		if !white {
+			relRank = 7 - kr
+			dir = -1
+		}
+		safety := 0
+		for f := kf - 1; f <= kf+1; f++ {
+			if f < 0 || f > 7 {
+				continue
+			}
+			if pawnFiles[c][f] == 0 {
+				safety -= w.KingOpenFile
+			}
+			if relRank > 1 {
+				continue
+			}
+			ownPawn := base.BPawn
+			if white {
+				ownPawn = base.WPawn
+			}
+			if r := kr + dir; r >= 0 && r < 8 && mb[r*8+f] == ownPawn {
+				safety += w.KingShield
+			} else if r := kr + 2*dir; r >= 0 && r < 8 && mb[r*8+f] == ownPawn {
+				safety += w.KingShield / 2
+			}
+		}
+		units := attackUnits[1-c]
+		if units > 20 {
+			units = 20
+		}
+		safety -= w.KingAttack * units * units / 16
+		terms[termKingSafety][c].add(safety, 0)
+	}
+
+	// pawn structure
+	if usePawnHash {
+		e := &ev.pawns[pawnKey&(pawnTableSize-1)]
+		if !e.used || e.key != pawnKey {
+			e.key, e.used = pawnKey, true
+			e.score = ev.pawnStructure(mb, &pawnFiles)
+		}
+		terms[termPawns] = e.score
+	} else {
+		terms[termPawns] = ev.pawnStructure(mb, &pawnFiles)
+	}
+
+	// bishop pair
+	for c := 0; c < 2; c++ {
+		if bishops[c] >= 2 {
+			terms[termBishopPair][c].add(w.BishopPairMG, w.BishopPairEG)
+		}
+	}
+	return terms, phase
+}
+
+// passed, doubled and isolated pawns of both colors
+func (ev *evaluator) pawnStructure(mb *base.Mailbox, files *[2][8]int) [2]score {
+	var res [2]score
+	w := ev.w
+	for c := 0; c < 2; c++ {
+		for f := 0; f < 8; f++ {
+			n := files[c][f]
+			if n == 0 {
+				continue
+			}
+			if n > 1 {
+				res[c].add((n-1)*w.DoubledMG, (n-1)*w.DoubledEG)
+			}
+			if (f == 0 || files[c][f-1] == 0) && (f == 7 || files[c][f+1] == 0) {
+				res[c].add(n*w.IsolatedMG, n*w.IsolatedEG)
+			}
+		}
+	}
+	for idx := 0; idx < 64; idx++ {
+		p := mb[idx]
+		if p != base.WPawn && p != base.BPawn {
+			continue
+		}
+		white := p == base.WPawn
+		enemy := base.WPawn
+		if white {
+			enemy = base.BPawn
+		}
+		r, f := idx/8, idx%8
+		passed := true
+		for nf := f - 1; nf <= f+1 && passed; nf++ {
+			if nf < 0 || nf > 7 {
+				continue
+			}
+			if white {
+				for nr := r + 1; nr < 8; nr++ {
+					if mb[nr*8+nf] == enemy {
+						passed = false
+						break
+					}
+				}
+			} else {
+				for nr := r - 1; nr >= 0; nr-- {
+					if mb[nr*8+nf] == enemy {
+						passed = false
+						break
+					}
+				}
+			}
+		}
+		if !passed {
+			continue
+		}
+		rel := r
+		if !white {
+			rel = 7 - r
+		}
+		res[sideIndex(white)].add(w.PassedMG[rel], w.PassedEG[rel])
+	}
+	return res
+}
+
+func trailingZeros(bb uint64) int {
+	n := 0
+	for bb&1 == 0 {
+		bb >>= 1
+		n++
+	}
+	return n
+}
+
+// --------------------------------------------------
+// Public API
+// --------------------------------------------------
+
+// static evaluation from white POV (centipawns)
+func Evaluate(b *base.Board, w *EvalWeights) int {
+	v := newEvaluatorNoCache(w).evaluate(b)
+	if !b.WhiteToMove {
+		v = -v
+	}
+	return v
+}
+
+// evaluator without pawn hash (single evaluation)
+func newEvaluatorNoCache(w *EvalWeights) *evaluator {
+	return &evaluator{w: w}
+}
+
+// one evaluation term of both colors
+type EvalTerm struct {
+	Name    string
+	WhiteMG int
+	WhiteEG int
+	BlackMG int
+	BlackEG int
+}
+
+// per-term evaluation of a position
+type EvalBreakdown struct {
+	Terms []EvalTerm
+	Phase int // 0 (endgame) .. 24 (middlegame)
+	Total int // white POV
+}
+
+// tapered value of term (white POV)
+func (t EvalTerm) Value(phase int) int {
+	return taper(score{t.WhiteMG - t.BlackMG, t.WhiteEG - t.BlackEG}, phase)
+}
+
+func EvaluateBreakdown(b *base.Board, w *EvalWeights) EvalBreakdown {
+	terms, phase := newEvaluatorNoCache(w).terms(b, false)
+	res := EvalBreakdown{Phase: phase}
+	var total score
+	for t := range terms {
+		res.Terms = append(res.Terms, EvalTerm{
+			Name:    termNames[t],
+			WhiteMG: terms[t][0].mg,
+			WhiteEG: terms[t][0].eg,
+			BlackMG: terms[t][1].mg,
+			BlackEG: terms[t][1].eg,
+		})
+		total.add(terms[t][0].mg-terms[t][1].mg, terms[t][0].eg-terms[t][1].eg)
+	}
+	res.Total = taper(total, phase)
+	return res
+}
+
+// table like:
+//
+//	term          white mg/eg   black mg/eg   total
+func (eb EvalBreakdown) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-12s %13s %13s %8s\n", "term", "white mg/eg", "black mg/eg", "total")
+	for _, t := range eb.Terms {
+		fmt.Fprintf(&sb, "%-12s %6d/%-6d %6d/%-6d %8d\n", t.Name, t.WhiteMG, t.WhiteEG, t.BlackMG, t.BlackEG, t.Value(eb.Phase))
+	}
+	fmt.Fprintf(&sb, "phase %d/%d, total %d (white POV)\n", eb.Phase, maxPhase, eb.Total)
+	return sb.String()
+}
@@ -0,0 +1,101 @@
+package myengine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// search heuristics of EvilEngine, each one can be disabled
+// to measure its contribution (e.g. in engine matches)
+type SearchFeatures struct {
+	PVS         bool // principal variation search (null window for non-first moves)
+	NullMove    bool // null-move pruning
+	LMR         bool // late move reductions
+	Killers     bool // killer moves ordering
+	History     bool // history heuristic ordering
+	CounterMove bool // countermove ordering
+	CheckExt    bool // extend search when side to move is in check
+	Aspiration  bool // aspiration windows in iterative deepening
+}
+
+func DefaultFeatures() SearchFeatures {
+	return SearchFeatures{
+		PVS:         true,
+		NullMove:    true,
+		LMR:         true,
+		Killers:     true,
+		History:     true,
+		CounterMove: true,
+		CheckExt:    true,
+		Aspiration:  true,
+	}
+}
+
+// names of features for Set/String
+var FeatureNames = []string{"pvs", "nullmove", "lmr", "killers", "history", "countermove", "checkext", "aspiration"}
+
+func (f *SearchFeatures) field(name string) *bool {
+	switch strings.ToLower(name) {
+	case "pvs":
+		return &f.PVS
+	case "nullmove", "nmp":
+		return &f.NullMove
+	case "lmr":
+		return &f.LMR
+	case "killers":
+		return &f.Killers
+	case "history":
+		return &f.History
+	case "countermove":
+		return &f.CounterMove
+	case "checkext":
+		return &f.CheckExt
+	case "aspiration":
+		return &f.Aspiration
+	default:
+		return nil
+	}
+}
+
+// enable/disable feature by name
+func (f *SearchFeatures) Set(name string, on bool) error {
+	p := f.field(name)
+	if p == nil {
+		return fmt.Errorf("unknown search feature: %s", name)
+	}
+	*p = on
+	return nil
+}
+
+// parse list like "nolmr,nonullmove" (prefix "no" disables) over default features,
+// items are separated by ',' or '+' (commas split values of CLI flags)
+func ParseFeatures(s string) (SearchFeatures, error) {
+	f := DefaultFeatures()
+	items := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '+' })
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		on := true
+		if strings.HasPrefix(item, "no") && f.field(item) == nil {
+			item = item[2:]
+			on = false
+		}
+		if err := f.Set(item, on); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// disabled features, e.g. "nolmr,nokillers" ("" if all enabled)
+func (f SearchFeatures) String() string {
+	var off []string
+	for _, name := range FeatureNames {
+		if !*f.field(name) {
+			off = append(off, "no"+name)
+		}
+	}
+	return strings.Join(off, ",")
+}
@@ -0,0 +1,169 @@
+package myengine
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine/aiengine"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"math"
+	"sync"
+)
+
+// --------------------------------------------------
+// Hybrid search: policy of the trained model orders (prunes) moves
+// near the root, value head is blended into scores of root moves and
+// into evaluation of leaves (quiescence stand pat) up to LeafPlies
+// --------------------------------------------------
+
+// max cached predictions (cache is cleared when full)
+const hybridCacheSize = 1 << 12
+
+type HybridOptions struct {
+	Rating      int     // rating of player the model imitates
+	PolicyPlies int     // policy ordering on plies [0, PolicyPlies)
+	RootTopN    int     // search only N best root moves by policy (0 - all)
+	ValueBlend  float64 // weight of model value in root move scores and leaf evaluations (0..1)
+	LeafPlies   int     // value is blended into leaves on plies [1, LeafPlies] (inference is slow)
+}
+
+func DefaultHybridOptions() HybridOptions {
+	return HybridOptions{
+		Rating:      aiengine.DefaultRating,
+		PolicyPlies: 2,
+		RootTopN:    0,
+		ValueBlend:  0.3,
+		LeafPlies:   4,
+	}
+}
+
+// model with cache of predictions shared by search threads
+type hybridNet struct {
+	model *aiengine.Model
+	opts  HybridOptions
+
+	mu    sync.Mutex
+	cache map[uint64]*aiengine.Prediction
+}
+
+// engine searching with the model (see HybridOptions)
+func NewHybridEngine(m *aiengine.Model, opts HybridOptions) *EvilEngine {
+	e := NewEvilEngine()
+	e.SetHybrid(m, opts)
+	return e
+}
+
+// enable hybrid search with model, nil model disables it (applied on next StartAnalysis)
+func (e *EvilEngine) SetHybrid(m *aiengine.Model, opts HybridOptions) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if m == nil {
+		e.hybrid = nil
+		return
+	}
+	e.hybrid = newHybridNet(m, opts)
+}
+
+func newHybridNet(m *aiengine.Model, opts HybridOptions) *hybridNet {
+	opts.ValueBlend = math.Min(math.Max(opts.ValueBlend, 0), 1)
+	return &hybridNet{model: m, opts: opts, cache: make(map[uint64]*aiengine.Prediction)}
+}
+
+func (h *hybridNet) predict(b *base.Board) *aiengine.Prediction {
+	key := hashBoard(b)
+	h.mu.Lock()
+	p, ok := h.cache[key]
+	h.mu.Unlock()
+	if ok {
+		return p
+	}
+	pred := h.model.Predict(b, h.opts.Rating)
+	h.mu.Lock()
+	if len(h.cache) >= hybridCacheSize {
+		clear(h.cache)
+	}
+	h.cache[key] = &pred
+	h.mu.Unlock()
+	return &pred
+}
+
+// policy of move in the position (unnormalized from * to)
+func policyOf(p *aiengine.Prediction, mv base.Move) float32 {
+	return p.From[base.ConvPointToIndex(mv.From)] * p.To[base.ConvPointToIndex(mv.To)]
+}
+
+// static evaluation of leaf (side to move POV) blended with model value
+// on plies up to LeafPlies, mate scores are kept as is
+func (h *hybridNet) blendLeaf(b *base.Board, eval, ply int) int {
+	w := h.opts.ValueBlend
+	if w <= 0 || ply > h.opts.LeafPlies || abs(eval) >= MATE_THRESHOLD {
+		return eval
+	}
+	n := h.predict(b).ScoreCP(b.WhiteToMove)
+	return int(math.Round((1-w)*float64(eval) + w*float64(n)))
+}
+
+// root data of the hybrid search (computed once per analysis)
+type hybridRoot struct {
+	order []base.Move       // root moves by policy, pruned to RootTopN
+	value map[base.Move]int // model value after move (cp, root side POV)
+	blend float64
+}
+
+func (h *hybridNet) prepareRoot(pos *base.Board, legal []base.Move) *hybridRoot {
+	root := &hybridRoot{value: make(map[base.Move]int, len(legal)), blend: h.opts.ValueBlend}
+	ranked := h.predict(pos).RankMoves(pos)
+	for _, sm := range ranked {
+		root.order = append(root.order, sm.Move)
+	}
+	if n := h.opts.RootTopN; n > 0 && n < len(root.order) {
+		root.order = root.order[:n]
+	}
+	if root.blend > 0 {
+		// positions after root moves are independent: evaluate in parallel
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, 4)
+		for _, mv := range root.order {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(mv base.Move) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				nb := moves.CloneBoard(pos)
+				_ = moves.ApplyMove(nb, mv)
+				cp := -h.predict(nb).ScoreCP(nb.WhiteToMove)
+				mu.Lock()
+				root.value[mv] = cp
+				mu.Unlock()
+			}(mv)
+		}
+		wg.Wait()
+	}
+	return root
+}
+
+// search window (alpha, beta) for the blended score mapped to the window of search score:
+// blended = (1-w)*s + w*n
+func (r *hybridRoot) window(mv base.Move, alpha, beta int) (int, int) {
+	n, ok := r.value[mv]
+	if !ok || r.blend <= 0 || r.blend >= 1 {
+		return alpha, beta
+	}
+	w := r.blend
+	a, b := alpha, beta
+	if alpha > -1_000_000_000 {
+		a = int(math.Floor((float64(alpha) - w*float64(n)) / (1 - w)))
+	}
+	if beta < 1_000_000_000 {
+		b = int(math.Ceil((float64(beta) - w*float64(n)) / (1 - w)))
+	}
+	return a, b
+}
+
+// blended score of root move, mate scores are kept as is
+func (r *hybridRoot) score(mv base.Move, s int) int {
+	n, ok := r.value[mv]
+	if !ok || r.blend <= 0 || abs(s) >= MATE_THRESHOLD {
+		return s
+	}
+	return int(math.Round((1-r.blend)*float64(s) + r.blend*float64(n)))
+}
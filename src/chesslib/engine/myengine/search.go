@@ -0,0 +1,850 @@
+package myengine
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/aiengine"
+	"evilchess/src/chesslib/engine/syzygy"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultThreads = 1
+	MaxThreads     = 64
+	MaxPly         = 128
+
+	aspirationWindow = 50
+)
+
+// search thread (Lazy SMP): all threads search the same root
+// and share results only through the transposition table
+type searcher struct {
+	e     *EvilEngine
+	id    int // 0 - main thread (publishes info)
+	nodes atomic.Int64
+
+	// last best root move (for move ordering between ID iterations)
+	lastRootMove *base.Move
+
+	// move ordering heuristics (per thread, no locks)
+	features SearchFeatures
+	eval     *evaluator
+	net      *hybridNet  // nil if hybrid search is disabled
+	root     *hybridRoot // shared by all threads, read only
+	tb       *syzygy.Tablebase
+	eg       *endgame.Tables
+	allowed  []base.Move // root moves allowed by tablebases
+	killers  [MaxPly][2]base.Move
+	history  [2][64][64]int // [side][from][to]
+	counter  [64][64]base.Move
+}
+
+func newSearcher(e *EvilEngine, id int, f SearchFeatures, w *EvalWeights) *searcher {
+	return &searcher{e: e, id: id, features: f, eval: newEvaluator(w)}
+}
+
+// -------------------------------
+// Quiescence (captures only)
+// -------------------------------
+func (s *searcher) quiesce(b *base.Board, alpha, beta int, ctx context.Context, ply int) int {
+	// cancellation check
+	select {
+	case <-ctx.Done():
+		return 0
+	default:
+	}
+	s.nodes.Add(1)
+	// positive = good for side to move
+	stand := s.eval.evaluate(b)
+	if s.net != nil {
+		stand = s.net.blendLeaf(b, stand, ply)
+	}
+	if stand >= beta {
+		return beta
+	}
+	if alpha < stand {
+		alpha = stand
+	}
+	// generate captures only, losing captures (by SEE) are pruned
+	legal := moves.GenerateLegalMoves(b)
+	caps := make([]base.Move, 0, len(legal))
+	see := make([]int, 0, len(legal))
+	for _, mv := range legal {
+		if !isTactical(b, mv) {
+			continue
+		}
+		v := rules.SEE(b, mv)
+		if v < 0 && !isPromotion(b, mv) {
+			continue
+		}
+		caps = append(caps, mv)
+		see = append(see, v)
+	}
+	// order by exchange result
+	for i := 1; i < len(caps); i++ {
+		mv, v := caps[i], see[i]
+		j := i - 1
+		for ; j >= 0 && see[j] < v; j-- {
+			caps[j+1], see[j+1] = caps[j], see[j]
+		}
+		caps[j+1], see[j+1] = mv, v
+	}
+	for _, mv := range caps {
+		select {
+		case <-ctx.Done():
+			return 0
+		default:
+		}
+
+		nb := moves.CloneBoard(b)
+		_ = moves.ApplyMove(nb, mv)
+		score := -s.quiesce(nb, -beta, -alpha, ctx, ply+1)
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// -------------------------------
+// Minimax with alpha-beta (PVS) + TT + pruning/reductions
+// -------------------------------
+// returns score (centipawns) from side-to-move POV,
+// prev is the move leading to this position (countermove heuristic)
+func (s *searcher) minimax(b *base.Board, depth int, alpha, beta int, ctx context.Context, ply int, prev base.Move, allowNull bool) int {
+	// cancellation check
+	select {
+	case <-ctx.Done():
+		return 0
+	default:
+	}
+	s.nodes.Add(1)
+	tt := s.e.tt
+	f := &s.features
+	pvNode := beta-alpha > 1
+
+	inCheck := rules.IsInCheck(b, b.WhiteToMove)
+	if inCheck && f.CheckExt && ply < MaxPly/2 {
+		depth++
+	}
+
+	// probe TT
+	key := hashBoard(b)
+	entry, hit := tt.probe(key)
+	if hit && int(entry.depth) >= depth {
+		// use stored score according to flag
+		if entry.flag == 0 { // exact
+			return int(entry.score)
+		}
+		if entry.flag == 1 { // lower bound
+			if int(entry.score) > alpha {
+				alpha = int(entry.score)
+			}
+		} else if entry.flag == 2 { // upper bound
+			if int(entry.score) < beta {
+				beta = int(entry.score)
+			}
+		}
+		if alpha >= beta {
+			return int(entry.score)
+		}
+	}
+
+	// exact result of tablebase
+	if score, ok := s.probeWDL(b, ply); ok {
+		tt.store(key, depth+6, 0, score, base.Move{})
+		return score
+	}
+	if score, ok := s.probeEndgame(b, ply); ok {
+		return score
+	}
+
+	if depth <= 0 || ply >= MaxPly-1 {
+		// quiescence search instead of raw eval
+		return s.quiesce(b, alpha, beta, ctx, ply)
+	}
+
+	// null move: give the opponent a free move, if still >= beta - prune
+	if f.NullMove && allowNull && !pvNode && !inCheck && depth >= 3 && hasPieces(b, b.WhiteToMove) {
+		r := 2
+		if depth > 6 {
+			r = 3
+		}
+		nb := moves.CloneBoard(b)
+		nb.WhiteToMove = !nb.WhiteToMove
+		nb.EnPassant = -1
+		score := -s.minimax(nb, depth-1-r, -beta, -beta+1, ctx, ply+1, base.Move{}, false)
+		if score >= beta && score < MATE_THRESHOLD {
+			return beta
+		}
+	}
+
+	mvs := moves.GenerateLegalMoves(b)
+	if len(mvs) == 0 {
+		// terminal: checkmate or stalemate
+		if inCheck {
+			return -MATE_SCORE + ply
+		}
+		return 0
+	}
+	var ttMove base.Move
+	if hit {
+		ttMove = entry.move
+	}
+	s.orderMoves(b, mvs, ttMove, ply, prev)
+
+	alphaOrig := alpha
+	best := -1_000_000_000
+	var bestMove base.Move
+
+	for i, mv := range mvs {
+		select {
+		case <-ctx.Done():
+			return 0
+		default:
+		}
+		nb := moves.CloneBoard(b)
+		_ = moves.ApplyMove(nb, mv)
+		tactical := isTactical(b, mv)
+
+		// late move reductions for quiet moves (with or without PVS)
+		reduction := 0
+		if f.LMR && i >= 3 && depth >= 3 && !inCheck && !tactical && !s.isKiller(ply, mv) &&
+			!rules.IsInCheck(nb, nb.WhiteToMove) {
+			reduction = 1
+			if i >= 6 && depth >= 6 {
+				reduction = 2
+			}
+		}
+
+		var score int
+		switch {
+		case i == 0:
+			score = -s.minimax(nb, depth-1, -beta, -alpha, ctx, ply+1, mv, true)
+		case f.PVS:
+			// null window search, re-search on fail high
+			score = -s.minimax(nb, depth-1-reduction, -alpha-1, -alpha, ctx, ply+1, mv, true)
+			if score > alpha && reduction > 0 {
+				score = -s.minimax(nb, depth-1, -alpha-1, -alpha, ctx, ply+1, mv, true)
+			}
+			if score > alpha && score < beta {
+				score = -s.minimax(nb, depth-1, -beta, -alpha, ctx, ply+1, mv, true)
+			}
+		default:
+			// full window search, reduced move is searched again at full depth
+			score = -s.minimax(nb, depth-1-reduction, -beta, -alpha, ctx, ply+1, mv, true)
+			if score > alpha && reduction > 0 {
+				score = -s.minimax(nb, depth-1, -beta, -alpha, ctx, ply+1, mv, true)
+			}
+		}
+
+		if score > best {
+			best = score
+			bestMove = mv
+		}
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			// beta cutoff
+			if !tactical {
+				s.updateQuiet(b, mv, depth, ply, prev)
+			}
+			break
+		}
+	}
+
+	// store in TT: determine flag
+	var flag uint8 = 0 // exact
+	if best <= alphaOrig {
+		flag = 2 // upper
+	} else if best >= beta {
+		flag = 1 // lower
+	} else {
+		flag = 0 // exact
+	}
+	tt.store(key, depth, flag, best, bestMove)
+
+	return best
+}
+
+// root search of one depth in window (alpha, beta): score and best move
+func (s *searcher) searchRoot(pos *base.Board, rootMoves []base.Move, depth, alpha, beta int, ctx context.Context) (int, base.Move) {
+	best := -1_000_000_000
+	var bestMove base.Move
+	for i, mv := range rootMoves {
+		// respect cancellation periodically
+		select {
+		case <-ctx.Done():
+			return best, bestMove
+		default:
+		}
+
+		// clone and apply move
+		nb := moves.CloneBoard(pos)
+		_ = moves.ApplyMove(nb, mv)
+		// window of search score for blended score of move
+		a, bt := alpha, beta
+		if s.root != nil {
+			a, bt = s.root.window(mv, alpha, beta)
+		}
+		var score int
+		if i == 0 || !s.features.PVS {
+			score = -s.minimax(nb, depth-1, -bt, -a, ctx, 1, mv, true)
+		} else {
+			score = -s.minimax(nb, depth-1, -a-1, -a, ctx, 1, mv, true)
+			if score > a && score < bt {
+				score = -s.minimax(nb, depth-1, -bt, -a, ctx, 1, mv, true)
+			}
+		}
+		if s.root != nil {
+			score = s.root.score(mv, score)
+		}
+		if score > best {
+			best = score
+			bestMove = mv
+		}
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return best, bestMove
+}
+
+// root move with its score (MultiPV)
+type rootLine struct {
+	score int
+	move  base.Move
+}
+
+// root search for n best moves: every move is searched with window above n-th best score,
+// lines are sorted by score
+func (s *searcher) searchRootMulti(pos *base.Board, rootMoves []base.Move, depth, n int, ctx context.Context) []rootLine {
+	var lines []rootLine
+	for _, mv := range rootMoves {
+		select {
+		case <-ctx.Done():
+			return lines
+		default:
+		}
+		alpha, beta := -1_000_000_000, 1_000_000_000
+		if len(lines) >= n {
+			alpha = lines[n-1].score
+		}
+		nb := moves.CloneBoard(pos)
+		_ = moves.ApplyMove(nb, mv)
+		a, bt := alpha, beta
+		if s.root != nil {
+			a, bt = s.root.window(mv, alpha, beta)
+		}
+		score := -s.minimax(nb, depth-1, -bt, -a, ctx, 1, mv, true)
+		if s.root != nil {
+			score = s.root.score(mv, score)
+		}
+		if ctx.Err() != nil {
+			return lines
+		}
+		if len(lines) >= n && score <= alpha {
+			// not better than n-th line (upper bound only)
+			continue
+		}
+		// insert keeping order, drop the worst line
+		i := len(lines)
+		for i > 0 && lines[i-1].score < score {
+			i--
+		}
+		lines = append(lines, rootLine{})
+		copy(lines[i+1:], lines[i:])
+		lines[i] = rootLine{score: score, move: mv}
+		if len(lines) > n {
+			lines = lines[:n]
+		}
+	}
+	return lines
+}
+
+// -------------------------------
+// iterate — iterative deepening of one thread
+// -------------------------------
+// main thread publishes every finished depth and returns on limits,
+// helpers only fill TT until main thread cancels them
+func (s *searcher) iterate(ctx context.Context, params engine.SearchParams, start time.Time) {
+	e := s.e
+	maxDepth := params.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = 10 // default
+	}
+	// iterative deepening
+	var bestPV []base.Move
+	var bestScore int
+	var bestLines []engine.PVLine
+	lastDepth := 0
+	// MultiPV lines are searched only by main thread
+	multiPV := 1
+	if s.id == 0 && params.MultiPV > 1 {
+		multiPV = params.MultiPV
+	}
+
+	// helpers with odd id search one ply deeper to desynchronize threads
+	depth := 1 + s.id%2
+	for ; depth <= maxDepth; depth++ {
+		// check cancel
+		select {
+		case <-ctx.Done():
+			// publish final and return
+			if s.id == 0 {
+				e.publish(e.makeInfo(lastDepth, start, bestScore, bestPV, bestLines))
+			}
+			return
+		default:
+		}
+
+		// snapshot root position
+		e.mu.RLock()
+		pos := moves.CloneBoard(e.board)
+		e.mu.RUnlock()
+
+		// generate root moves
+		rootMoves := moves.GenerateLegalMoves(pos)
+		if len(rootMoves) == 0 {
+			// no legal moves: publish and stop
+			if s.id == 0 {
+				e.publish(e.makeInfo(depth, start, 0, nil, nil))
+			}
+			return
+		}
+
+		// reorder root moves: prefer previous best root move (from last iteration) and TT move
+		if s.root != nil {
+			// policy order (maybe pruned)
+			rootMoves = append([]base.Move(nil), s.root.order...)
+		} else {
+			s.orderMoves(pos, rootMoves, base.Move{}, 0, base.Move{})
+		}
+		rootMoves = filterRootMoves(rootMoves, s.allowed)
+		if s.lastRootMove != nil {
+			moveToFront(rootMoves, *s.lastRootMove)
+		}
+		// if TT has move for root, try to put it first
+		if entry, ok := e.tt.probe(hashBoard(pos)); ok && entry.move != (base.Move{}) {
+			moveToFront(rootMoves, entry.move)
+		}
+		// helpers start from different root moves
+		if s.id > 0 && len(rootMoves) > 1 {
+			k := s.id % len(rootMoves)
+			rotated := make([]base.Move, 0, len(rootMoves))
+			rotated = append(rotated, rootMoves[k:]...)
+			rootMoves = append(rotated, rootMoves[:k]...)
+		}
+
+		// aspiration window around previous score, widen on fail
+		alpha, beta := -1_000_000_000, 1_000_000_000
+		window := aspirationWindow
+		if s.features.Aspiration && lastDepth >= 4 && abs(bestScore) < MATE_THRESHOLD {
+			alpha, beta = bestScore-window, bestScore+window
+		}
+		var score int
+		var bestMove base.Move
+		var lines []rootLine
+		if multiPV > 1 {
+			// full window: score of n-th line is unknown
+			lines = s.searchRootMulti(pos, rootMoves, depth, multiPV, ctx)
+			if len(lines) > 0 {
+				score, bestMove = lines[0].score, lines[0].move
+			}
+		} else {
+			for {
+				score, bestMove = s.searchRoot(pos, rootMoves, depth, alpha, beta, ctx)
+				if ctx.Err() != nil || (score > alpha && score < beta) {
+					break
+				}
+				if alpha <= -1_000_000_000 && beta >= 1_000_000_000 {
+					break
+				}
+				window *= 4
+				if score <= alpha {
+					alpha = max(bestScore-window, -1_000_000_000)
+				} else {
+					beta = min(bestScore+window, 1_000_000_000)
+				}
+				if window > 1000 {
+					alpha, beta = -1_000_000_000, 1_000_000_000
+				}
+				if bestMove != (base.Move{}) {
+					moveToFront(rootMoves, bestMove)
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			if s.id == 0 {
+				e.publish(e.makeInfo(lastDepth, start, bestScore, bestPV, bestLines))
+			}
+			return
+		}
+
+		// update current best
+		bestScore = score
+		lastDepth = depth
+
+		// root is searched here (not in minimax), so TT has no entry for it:
+		// continue PV from the position after best root move
+		bestPV = e.rootPV(pos, bestMove, depth+3)
+		bestLines = nil
+		for _, l := range lines {
+			bestLines = append(bestLines, engine.PVLine{
+				ScoreCP: l.score,
+				MateIn:  mateIn(l.score),
+				PV:      e.rootPV(pos, l.move, depth+3),
+			})
+		}
+
+		// store last root move
+		s.lastRootMove = &bestMove
+		// share root result with other threads
+		e.tt.store(hashBoard(pos), depth, 0, bestScore, bestMove)
+
+		if s.id != 0 {
+			continue
+		}
+
+		// publish snapshot for this depth
+		e.publish(e.makeInfo(depth, start, bestScore, bestPV, bestLines))
+
+		// no limits while pondering
+		if e.isPondering() {
+			continue
+		}
+		// if time limit reached
+		if params.MaxTimeMs > 0 && time.Since(e.limitStart(start)).Milliseconds() >= params.MaxTimeMs {
+			break
+		}
+	}
+}
+
+// -------------------------------
+// searchWorker — main thread + Lazy SMP helpers
+// -------------------------------
+func (e *EvilEngine) searchWorker(ctx context.Context, params engine.SearchParams) {
+	defer e.wg.Done()
+	start := time.Now()
+
+	threads := params.Threads
+	if threads <= 0 {
+		threads = DefaultThreads
+	} else if threads > MaxThreads {
+		threads = MaxThreads
+	}
+
+	e.mu.RLock()
+	features := e.features
+	weights := e.weights
+	net := e.hybrid
+	tb, eg := e.tb, e.eg
+	pos := moves.CloneBoard(e.board)
+	e.mu.RUnlock()
+
+	// tablebase moves of root are probed once
+	tbRoot := probeRoot(tb, pos)
+	allowed := rootMovesOf(tbRoot)
+	if mvs := endgameRoot(eg, pos); len(mvs) > 0 {
+		allowed = mvs
+	}
+
+	// policy and values of root moves are computed once for all depths
+	var root *hybridRoot
+	if net != nil {
+		if legal := moves.GenerateLegalMoves(pos); len(legal) > 0 {
+			root = net.prepareRoot(pos, legal)
+		}
+	}
+
+	searchers := make([]*searcher, threads)
+	for i := range searchers {
+		searchers[i] = newSearcher(e, i, features, &weights)
+		searchers[i].net, searchers[i].root = net, root
+		searchers[i].tb, searchers[i].eg, searchers[i].allowed = tb, eg, allowed
+	}
+	e.mu.Lock()
+	e.searchers = searchers
+	e.tbRoot = tbRoot
+	e.mu.Unlock()
+
+	// helpers live until main thread finished
+	helpCtx, helpCancel := context.WithCancel(ctx)
+	var helpers sync.WaitGroup
+	for _, s := range searchers[1:] {
+		helpers.Add(1)
+		go func(s *searcher) {
+			defer helpers.Done()
+			s.iterate(helpCtx, params, start)
+		}(s)
+	}
+
+	searchers[0].iterate(ctx, params, start)
+	e.waitPonderHit(ctx)
+	helpCancel()
+	helpers.Wait()
+
+	// mark stopped
+	e.mu.Lock()
+	e.running = false
+	e.pondering = false
+	e.mu.Unlock()
+}
+
+// -------------------------------
+// helper: extract PV from TT by following stored moves (root-only)
+// -------------------------------
+func (e *EvilEngine) extractPV(root *base.Board, maxPly int) []base.Move {
+	var pv []base.Move
+	b := moves.CloneBoard(root)
+	for ply := 0; ply < maxPly; ply++ {
+		key := hashBoard(b)
+		entry, ok := e.tt.probe(key)
+		if !ok || entry.move == (base.Move{}) {
+			break
+		}
+		// sanity: check move is legal in current pos
+		legal := false
+		mvs := moves.GenerateLegalMoves(b)
+		for _, mv := range mvs {
+			if mv == entry.move {
+				legal = true
+				break
+			}
+		}
+		if !legal {
+			break
+		}
+		pv = append(pv, entry.move)
+		_ = moves.ApplyMove(b, entry.move)
+	}
+	return pv
+}
+
+// aggregate nodes of all search threads
+func (e *EvilEngine) totalNodes() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var n int64
+	for _, s := range e.searchers {
+		n += s.nodes.Load()
+	}
+	return n
+}
+
+// root move and continuation from TT
+func (e *EvilEngine) rootPV(pos *base.Board, mv base.Move, maxPly int) []base.Move {
+	pv := []base.Move{mv}
+	nb := moves.CloneBoard(pos)
+	if moves.ApplyMove(nb, mv) == nil {
+		pv = append(pv, e.extractPV(nb, maxPly)...)
+	}
+	return pv
+}
+
+func (e *EvilEngine) makeInfo(depth int, start time.Time, score int, pv []base.Move, lines []engine.PVLine) engine.AnalysisInfo {
+	nodes := e.totalNodes()
+	info := engine.AnalysisInfo{
+		Depth:    depth,
+		TimeMs:   time.Since(start).Milliseconds(),
+		Nodes:    nodes,
+		NPS:      computeNPS(nodes, time.Since(start)),
+		ScoreCP:  score,
+		PV:       pv,
+		BestMove: nilIfEmpty(pv),
+		MateIn:   mateIn(score),
+		Lines:    lines,
+	}
+	e.mu.RLock()
+	tbInfo(&info, e.tbRoot)
+	e.mu.RUnlock()
+	return info
+}
+
+// mate in plies if score indicates mate (negative - mate against us)
+func mateIn(score int) int {
+	absScore := abs(score)
+	if absScore < MATE_THRESHOLD {
+		return 0
+	}
+	matePly := MATE_SCORE - absScore
+	if score < 0 {
+		return -matePly
+	}
+	return matePly
+}
+
+// utility
+func computeNPS(nodes int64, dur time.Duration) int64 {
+	s := dur.Seconds()
+	if s < 1e-6 {
+		return nodes
+	}
+	return int64(float64(nodes) / s)
+}
+
+func nilIfEmpty(pv []base.Move) *base.Move {
+	if len(pv) == 0 {
+		return nil
+	}
+	return &pv[0]
+}
+
+func moveToFront(mvs []base.Move, mv base.Move) {
+	for i := range mvs {
+		if mvs[i] == mv {
+			if i != 0 {
+				mvs[0], mvs[i] = mvs[i], mvs[0]
+			}
+			return
+		}
+	}
+}
+
+// -------------------------------
+// move ordering: TT move, captures (MVV-LVA), killers, countermove, history
+// -------------------------------
+func (s *searcher) orderMoves(b *base.Board, mvs []base.Move, ttMove base.Move, ply int, prev base.Move) {
+	f := &s.features
+	side := sideIndex(b.WhiteToMove)
+	scores := make([]int, len(mvs))
+	// policy of the model near the root (hybrid search)
+	var pred *aiengine.Prediction
+	var policySum float32
+	if s.net != nil && ply > 0 && ply < s.net.opts.PolicyPlies {
+		pred = s.net.predict(b)
+		for _, mv := range mvs {
+			policySum += policyOf(pred, mv)
+		}
+	}
+	for i, mv := range mvs {
+		from := base.ConvPointToIndex(mv.From)
+		to := base.ConvPointToIndex(mv.To)
+		switch {
+		case mv == ttMove:
+			scores[i] = 1 << 30
+		case isTactical(b, mv):
+			if see := rules.SEE(b, mv); see >= 0 {
+				// good captures: MVV-LVA
+				scores[i] = 1<<24 + moveOrderScore(b, mv)
+				if isPromotion(b, mv) {
+					scores[i] += pieceValueSimple(mv.Piece) * 1000
+				}
+			} else {
+				// losing captures after killers, but before quiet history
+				scores[i] = 1<<21 + see
+			}
+		case f.Killers && ply < MaxPly && mv == s.killers[ply][0]:
+			scores[i] = 1 << 23
+		case f.Killers && ply < MaxPly && mv == s.killers[ply][1]:
+			scores[i] = 1<<23 - 1
+		case f.CounterMove && prev != (base.Move{}) && mv == s.counter[base.ConvPointToIndex(prev.From)][base.ConvPointToIndex(prev.To)]:
+			scores[i] = 1 << 22
+		case f.History:
+			scores[i] = s.history[side][from][to]
+		}
+		if pred != nil && policySum > 0 && mv != ttMove {
+			// probable move is tried about together with killers
+			scores[i] += int(policyOf(pred, mv) / policySum * (1 << 24))
+		}
+	}
+	// insertion sort (stable, lists are short)
+	for i := 1; i < len(mvs); i++ {
+		mv, sc := mvs[i], scores[i]
+		j := i - 1
+		for ; j >= 0 && scores[j] < sc; j-- {
+			mvs[j+1], scores[j+1] = mvs[j], scores[j]
+		}
+		mvs[j+1], scores[j+1] = mv, sc
+	}
+}
+
+func (s *searcher) isKiller(ply int, mv base.Move) bool {
+	if !s.features.Killers || ply >= MaxPly {
+		return false
+	}
+	return mv == s.killers[ply][0] || mv == s.killers[ply][1]
+}
+
+// quiet move caused beta cutoff
+func (s *searcher) updateQuiet(b *base.Board, mv base.Move, depth, ply int, prev base.Move) {
+	if ply < MaxPly && s.killers[ply][0] != mv {
+		s.killers[ply][1] = s.killers[ply][0]
+		s.killers[ply][0] = mv
+	}
+	if prev != (base.Move{}) {
+		s.counter[base.ConvPointToIndex(prev.From)][base.ConvPointToIndex(prev.To)] = mv
+	}
+	side := sideIndex(b.WhiteToMove)
+	h := &s.history[side][base.ConvPointToIndex(mv.From)][base.ConvPointToIndex(mv.To)]
+	*h += depth * depth
+	if *h > 1<<20 {
+		// aging: keep values below countermove/killer scores
+		for from := range s.history[side] {
+			for to := range s.history[side][from] {
+				s.history[side][from][to] /= 2
+			}
+		}
+	}
+}
+
+// capture, en passant or promotion
+func isTactical(b *base.Board, mv base.Move) bool {
+	if rules.IsCaptureMove(mv, b) {
+		return true
+	}
+	pc := b.Mailbox[base.ConvPointToIndex(mv.From)]
+	if (pc == base.WPawn || pc == base.BPawn) && base.ConvPointToIndex(mv.To) == b.EnPassant {
+		return true
+	}
+	return isPromotion(b, mv)
+}
+
+func isPromotion(b *base.Board, mv base.Move) bool {
+	pc := b.Mailbox[base.ConvPointToIndex(mv.From)]
+	return (pc == base.WPawn || pc == base.BPawn) && mv.Piece != pc
+}
+
+// side has pieces other than pawns and king (null move is unsafe in pawn endings)
+func hasPieces(b *base.Board, white bool) bool {
+	for _, p := range b.Mailbox {
+		switch p {
+		case base.WKnight, base.WBishop, base.WRook, base.WQueen:
+			if white {
+				return true
+			}
+		case base.BKnight, base.BBishop, base.BRook, base.BQueen:
+			if !white {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sideIndex(white bool) int {
+	if white {
+		return 0
+	}
+	return 1
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
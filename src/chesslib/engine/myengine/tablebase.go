@@ -0,0 +1,113 @@
+package myengine
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/syzygy"
+	"slices"
+)
+
+// --------------------------------------------------
+// Syzygy tablebases: root moves are limited to moves keeping the best result
+// (wins by fastest zeroing), positions after zeroing moves get exact WDL score
+// --------------------------------------------------
+
+// tablebase win, below mate scores
+const TB_WIN_SCORE = MATE_THRESHOLD - 2*MaxPly
+
+// use tablebase in search, nil disables it (applied on next StartAnalysis)
+func (e *EvilEngine) SetTablebase(tb *syzygy.Tablebase) {
+	e.mu.Lock()
+	e.tb = tb
+	e.mu.Unlock()
+}
+
+func (e *EvilEngine) Tablebase() *syzygy.Tablebase {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.tb
+}
+
+func tbScore(wdl syzygy.WDL, ply int) int {
+	switch wdl {
+	case syzygy.Win:
+		return TB_WIN_SCORE - ply
+	case syzygy.Loss:
+		return -TB_WIN_SCORE + ply
+	case syzygy.CursedWin:
+		return 1
+	case syzygy.BlessedLoss:
+		return -1
+	}
+	return 0
+}
+
+// wdl of position in search (exact only with 50-move counter 0)
+func (s *searcher) probeWDL(b *base.Board, ply int) (int, bool) {
+	if s.tb == nil || b.Halfmove != 0 || !s.tb.Covers(b) {
+		return 0, false
+	}
+	wdl, err := s.tb.ProbeWDL(b)
+	if err != nil {
+		return 0, false
+	}
+	return tbScore(wdl, ply), true
+}
+
+// best root moves by tablebase, nil if root is not in tables
+func probeRoot(tb *syzygy.Tablebase, pos *base.Board) []syzygy.RootMove {
+	if tb == nil || !tb.Covers(pos) {
+		return nil
+	}
+	rm, err := tb.ProbeRoot(pos)
+	if err != nil {
+		return nil
+	}
+	n := 1
+	for n < len(rm) && rm[n].DTZ == rm[0].DTZ {
+		n++
+	}
+	return rm[:n]
+}
+
+func rootMovesOf(root []syzygy.RootMove) []base.Move {
+	var mvs []base.Move
+	for _, rm := range root {
+		mvs = append(mvs, rm.Move)
+	}
+	return mvs
+}
+
+// keep root moves allowed by tablebase (order is preserved)
+func filterRootMoves(mvs []base.Move, allowed []base.Move) []base.Move {
+	if len(allowed) == 0 {
+		return mvs
+	}
+	out := make([]base.Move, 0, len(allowed))
+	for _, mv := range mvs {
+		if slices.Contains(allowed, mv) {
+			out = append(out, mv)
+		}
+	}
+	if len(out) == 0 {
+		// pruned by policy: tablebase moves only
+		out = append(out, allowed...)
+	}
+	return out
+}
+
+// tablebase result of root in info, score is replaced if search found no mate
+func tbInfo(info *engine.AnalysisInfo, root []syzygy.RootMove) {
+	if len(root) == 0 {
+		return
+	}
+	best := root[0]
+	info.Tablebase = true
+	info.TBWinIn = best.DTZ
+	if best.WDL != syzygy.Win && best.WDL != syzygy.Loss {
+		info.TBWinIn = 0
+	}
+	if info.MateIn == 0 {
+		info.ScoreCP = tbScore(best.WDL, abs(best.DTZ))
+	}
+}
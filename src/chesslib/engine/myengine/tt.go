@@ -0,0 +1,114 @@
+package myengine
+
+import (
+	"evilchess/src/chesslib/base"
+	"sync/atomic"
+)
+
+// --------------------------------------------------
+// Lock-free Transposition Table (shared by all search threads)
+// --------------------------------------------------
+// slot keeps key^data and data, so a torn write (two threads storing
+// the same slot at once) is detected on probe as a key mismatch.
+//
+// data layout:
+//
+//	bits  0..31 score (int32)
+//	bits 32..39 depth
+//	bits 40..41 flag (0 exact, 1 lower, 2 upper)
+//	bits 42..47 move from
+//	bits 48..53 move to
+//	bits 54..58 move piece
+//	bit  59     valid
+type ttEntry struct {
+	depth int32
+	score int32
+	flag  uint8 // 0 exact, 1 lower, 2 upper
+	move  base.Move
+}
+
+type ttSlot struct {
+	key  atomic.Uint64
+	data atomic.Uint64
+}
+
+type transTable struct {
+	slots []ttSlot
+	mask  uint64
+}
+
+const ttValid uint64 = 1 << 59
+
+// size is rounded down to power of two
+func newTransTable(size int) *transTable {
+	n := 1
+	for n*2 <= size {
+		n *= 2
+	}
+	return &transTable{
+		slots: make([]ttSlot, n),
+		mask:  uint64(n - 1),
+	}
+}
+
+func packEntry(depth int, flag uint8, score int, mv base.Move) uint64 {
+	if depth < 0 {
+		depth = 0
+	} else if depth > 255 {
+		depth = 255
+	}
+	d := uint64(uint32(int32(score)))
+	d |= uint64(depth) << 32
+	d |= uint64(flag&3) << 40
+	if mv != (base.Move{}) {
+		d |= uint64(base.ConvPointToIndex(mv.From)) << 42
+		d |= uint64(base.ConvPointToIndex(mv.To)) << 48
+		d |= uint64(mv.Piece&31) << 54
+	}
+	return d | ttValid
+}
+
+func unpackEntry(d uint64) ttEntry {
+	e := ttEntry{
+		score: int32(uint32(d)),
+		depth: int32((d >> 32) & 0xff),
+		flag:  uint8((d >> 40) & 3),
+	}
+	if pc := base.Piece((d >> 54) & 31); pc != base.EmptyPiece {
+		e.move = base.Move{
+			From:  base.ConvIndexToPoint(int((d >> 42) & 63)),
+			To:    base.ConvIndexToPoint(int((d >> 48) & 63)),
+			Piece: pc,
+		}
+	}
+	return e
+}
+
+func (t *transTable) probe(key uint64) (ttEntry, bool) {
+	s := &t.slots[key&t.mask]
+	d := s.data.Load()
+	if d&ttValid == 0 || s.key.Load()^d != key {
+		return ttEntry{}, false
+	}
+	return unpackEntry(d), true
+}
+
+func (t *transTable) store(key uint64, depth int, flag uint8, score int, mv base.Move) {
+	s := &t.slots[key&t.mask]
+	// simple replacement: keep deeper entry of the same position
+	if old := s.data.Load(); old&ttValid != 0 && s.key.Load()^old == key {
+		if int((old>>32)&0xff) > depth {
+			return
+		}
+	}
+	d := packEntry(depth, flag, score, mv)
+	s.key.Store(key ^ d)
+	s.data.Store(d)
+}
+
+func (t *transTable) clear() {
+	for i := range t.slots {
+		t.slots[i].key.Store(0)
+		t.slots[i].data.Store(0)
+	}
+}
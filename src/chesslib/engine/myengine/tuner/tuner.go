@@ -0,0 +1,226 @@
+package tuner
+
+import (
+	"errors"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Texel tuning: evaluation weights are fitted to game results
+// by minimizing E = mean((R - sigmoid(K * eval))^2)
+
+// quiet position with result of the game (white POV: 1, 0.5, 0)
+type Position struct {
+	Board  base.Board
+	Result float64
+}
+
+type ExtractOptions struct {
+	SkipPlies    int // opening plies to skip
+	MaxPositions int // 0 - unlimited
+	MaxPerGame   int // 0 - unlimited
+}
+
+func DefaultExtractOptions() ExtractOptions {
+	return ExtractOptions{SkipPlies: 8, MaxPositions: 0, MaxPerGame: 0}
+}
+
+// read games from PGN stream and collect quiet positions of finished games
+func ExtractPositions(r io.Reader, opts ExtractOptions, out []Position) ([]Position, error) {
+	p := convpgn.NewPGNParser(r)
+	for {
+		if opts.MaxPositions > 0 && len(out) >= opts.MaxPositions {
+			return out, nil
+		}
+		g, err := p.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return out, nil
+			}
+			return out, err
+		}
+		var res float64
+		switch g.Result {
+		case convpgn.PGNStatusWW:
+			res = 1
+		case convpgn.PGNStatusBW:
+			res = 0
+		case convpgn.PGNStatusDraw:
+			res = 0.5
+		default:
+			continue
+		}
+		out = extractGame(g, res, opts, out)
+	}
+}
+
+func extractGame(g *convpgn.PGNGame, res float64, opts ExtractOptions, out []Position) []Position {
+	b, err := convfen.ConvertFENToBoard(base.FEN_START_GAME)
+	if err != nil {
+		return out
+	}
+	n := 0
+	for ply, san := range g.Moves {
+		mv, err := moves.SANToMove(b, san)
+		if err != nil {
+			// broken game: keep positions collected so far
+			return out
+		}
+		if err := moves.ApplyMove(b, mv); err != nil {
+			return out
+		}
+		if ply+1 < opts.SkipPlies || !IsQuiet(b) {
+			continue
+		}
+		out = append(out, Position{Board: *b, Result: res})
+		n++
+		if (opts.MaxPerGame > 0 && n >= opts.MaxPerGame) ||
+			(opts.MaxPositions > 0 && len(out) >= opts.MaxPositions) {
+			break
+		}
+	}
+	return out
+}
+
+// no check and no winning captures or promotions: static eval is meaningful
+func IsQuiet(b *base.Board) bool {
+	if rules.IsInCheck(b, b.WhiteToMove) {
+		return false
+	}
+	legal := moves.GenerateLegalMoves(b)
+	if len(legal) == 0 {
+		return false
+	}
+	for _, mv := range legal {
+		if rules.IsCaptureMove(mv, b) && rules.SEE(b, mv) > 0 {
+			return false
+		}
+		if mv.Piece != b.Mailbox[base.ConvPointToIndex(mv.From)] {
+			return false
+		}
+	}
+	return true
+}
+
+type Tuner struct {
+	positions []Position
+	weights   myengine.EvalWeights
+	K         float64
+	threads   int
+}
+
+func NewTuner(positions []Position, w myengine.EvalWeights) *Tuner {
+	return &Tuner{positions: positions, weights: w, K: 1, threads: runtime.NumCPU()}
+}
+
+func (t *Tuner) Weights() myengine.EvalWeights {
+	return t.weights
+}
+
+func sigmoid(k float64, eval int) float64 {
+	return 1 / (1 + math.Pow(10, -k*float64(eval)/400))
+}
+
+// mean squared error of weights over all positions (parallel)
+func (t *Tuner) Error(w *myengine.EvalWeights, k float64) float64 {
+	n := len(t.positions)
+	if n == 0 {
+		return 0
+	}
+	parts := make([]float64, t.threads)
+	chunk := (n + t.threads - 1) / t.threads
+	var wg sync.WaitGroup
+	for i := 0; i < t.threads; i++ {
+		lo, hi := i*chunk, (i+1)*chunk
+		if hi > n {
+			hi = n
+		}
+		if lo >= hi {
+			break
+		}
+		wg.Add(1)
+		go func(i, lo, hi int) {
+			defer wg.Done()
+			sum := 0.0
+			for j := lo; j < hi; j++ {
+				p := &t.positions[j]
+				d := p.Result - sigmoid(k, myengine.Evaluate(&p.Board, w))
+				sum += d * d
+			}
+			parts[i] = sum
+		}(i, lo, hi)
+	}
+	wg.Wait()
+	sum := 0.0
+	for _, s := range parts {
+		sum += s
+	}
+	return sum / float64(n)
+}
+
+// scaling constant K with minimal error for current weights
+func (t *Tuner) FitK() float64 {
+	best, bestErr := t.K, t.Error(&t.weights, t.K)
+	lo, hi := 0.1, 3.0
+	// coarse scan then refine around the best value
+	for step := 0.1; step > 0.001; step /= 10 {
+		for k := lo; k <= hi; k += step {
+			if e := t.Error(&t.weights, k); e < bestErr {
+				best, bestErr = k, e
+			}
+		}
+		lo, hi = math.Max(best-step, 0.01), best+step
+	}
+	t.K = best
+	return best
+}
+
+// progress of tuning pass
+type Progress struct {
+	Iteration int
+	Error     float64
+	Improved  int // changed parameters in pass
+}
+
+// local search: each parameter is moved by +-1 while the error decreases,
+// stops after iterations passes or when nothing changes
+func (t *Tuner) Tune(iterations int, report func(Progress)) float64 {
+	w := t.weights
+	params := w.Params()
+	bestErr := t.Error(&w, t.K)
+	for it := 1; it <= iterations; it++ {
+		improved := 0
+		for _, p := range params {
+			orig := *p
+			*p = orig + 1
+			if e := t.Error(&w, t.K); e < bestErr {
+				bestErr = e
+				improved++
+				continue
+			}
+			*p = orig - 1
+			if e := t.Error(&w, t.K); e < bestErr {
+				bestErr = e
+				improved++
+				continue
+			}
+			*p = orig
+		}
+		t.weights = w
+		if report != nil {
+			report(Progress{Iteration: it, Error: bestErr, Improved: improved})
+		}
+		if improved == 0 {
+			break
+		}
+	}
+	return bestErr
+}
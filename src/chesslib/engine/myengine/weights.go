@@ -0,0 +1,67 @@
+package myengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// default name of tuned weights file
+const DefaultWeightsFile = "evilchess.weights.json"
+
+// pointers to all tunable parameters (fixed ones like king value are skipped)
+func (w *EvalWeights) Params() []*int {
+	var ps []*int
+	for pt := ptPawn; pt < ptKing; pt++ {
+		ps = append(ps, &w.PieceMG[pt], &w.PieceEG[pt])
+	}
+	for pt := ptPawn; pt <= ptKing; pt++ {
+		for i := 0; i < 64; i++ {
+			// pawns never stand on the first and the last ranks
+			if pt == ptPawn && (i < 8 || i >= 56) {
+				continue
+			}
+			ps = append(ps, &w.PstMG[pt][i], &w.PstEG[pt][i])
+		}
+	}
+	for pt := ptKnight; pt <= ptQueen; pt++ {
+		ps = append(ps, &w.MobilityMG[pt], &w.MobilityEG[pt])
+	}
+	for r := 1; r < 7; r++ {
+		ps = append(ps, &w.PassedMG[r], &w.PassedEG[r])
+	}
+	ps = append(ps,
+		&w.DoubledMG, &w.DoubledEG,
+		&w.IsolatedMG, &w.IsolatedEG,
+		&w.BishopPairMG, &w.BishopPairEG,
+		&w.RookOpenMG, &w.RookOpenEG,
+		&w.RookSemiOpenMG, &w.RookSemiOpenEG,
+		&w.KingShield, &w.KingOpenFile, &w.KingAttack,
+	)
+	return ps
+}
+
+// read weights from JSON file, missing fields keep default values
+func LoadWeights(path string) (EvalWeights, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DefaultWeights(), err
+	}
+	return ParseWeights(data)
+}
+
+func ParseWeights(data []byte) (EvalWeights, error) {
+	w := DefaultWeights()
+	if err := json.Unmarshal(data, &w); err != nil {
+		return DefaultWeights(), fmt.Errorf("error decode weights: %v", err)
+	}
+	return w, nil
+}
+
+func SaveWeights(path string, w EvalWeights) error {
+	data, err := json.MarshalIndent(w, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,333 @@
+package puzzle
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/review"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/history"
+	"evilchess/src/chesslib/logic/motifs"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// --------------------------------------------------
+// Extraction of puzzles from games
+// --------------------------------------------------
+// every position of game is analyzed with two best lines: the position is a puzzle
+// if the best move wins (win probability of solver) and the second best is much worse.
+// the line goes on with the best reply of opponent while the next move of solver
+// is the only one too, so every move of solver in solution is unique
+
+const (
+	// win probability (%) of solver after the best move
+	winBest = 75
+	// the second best move is worse by win probability (%)
+	winGap = 25
+	// evaluation of crushing advantage (centipawns)
+	crushingCP = 600
+	// pieces (without kings and pawns) of one side in endgame
+	endgameMaterial = 13
+)
+
+type Options struct {
+	Params   engine.SearchParams   // limits of every position (zero - review.DefaultParams)
+	MaxMoves int                   // moves of solver in solution (0 - 5)
+	MinPly   int                   // positions of game before ply are skipped
+	Progress func(done, total int) // called after every analyzed position of game
+}
+
+// puzzles of game (entries[0] - start position), engine must be initialized
+func Extract(ctx context.Context, e engine.Engine, entries []history.MoveEntry, opts Options) ([]Puzzle, error) {
+	params := opts.Params
+	if params.MaxDepth == 0 && params.MaxTimeMs == 0 {
+		params = review.DefaultParams
+	}
+	params.Infinite, params.Ponder = false, false
+	if opts.MaxMoves <= 0 {
+		opts.MaxMoves = 5
+	}
+
+	var list []Puzzle
+	// positions of solution of the last puzzle are not puzzles again
+	skip := 0
+	for i := range entries {
+		if err := ctx.Err(); err != nil {
+			return list, err
+		}
+		if i >= opts.MinPly && i >= skip {
+			p, err := extractAt(ctx, e, entries, i, params, opts.MaxMoves)
+			if err != nil {
+				return list, fmt.Errorf("ply %d: %v", i, err)
+			}
+			if p != nil {
+				list = append(list, *p)
+				skip = i + len(p.Moves)
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(entries))
+		}
+	}
+	return list, nil
+}
+
+// puzzle of position i of game or nil
+func extractAt(ctx context.Context, e engine.Engine, entries []history.MoveEntry, i int, params engine.SearchParams, maxMoves int) (*Puzzle, error) {
+	b := &entries[i].Board
+	if len(moves.GenerateLegalMoves(b)) < 2 {
+		return nil, nil
+	}
+	info, err := analyzeLines(ctx, e, b, params, 2)
+	if err != nil || !onlyMove(info) {
+		return nil, err
+	}
+	solution, final, err := solve(ctx, e, b, info, params, maxMoves)
+	if err != nil || len(solution) == 0 {
+		return nil, err
+	}
+	p := &Puzzle{
+		FEN:   convfen.ConvertBoardToFEN(*b),
+		Moves: solution,
+		Ply:   i,
+	}
+	p.ID = ID(p.FEN)
+	if i > 0 {
+		p.LastMove = moves.MoveToUCI(&entries[i-1].Board, entries[i].Move)
+	}
+	played := ""
+	if i+1 < len(entries) {
+		played = moves.MoveToUCI(b, entries[i+1].Move)
+	}
+	p.Themes = themes(b, solution, final)
+	p.Rating = rating(*p, played)
+	return p, nil
+}
+
+// positions of solution are analyzed by the same limits,
+// final is evaluation of the last best line (solver POV)
+func solve(ctx context.Context, e engine.Engine, b *base.Board, info engine.AnalysisInfo, params engine.SearchParams, maxMoves int) (solution []string, final int, err error) {
+	nb := moves.CloneBoard(b)
+	for n := 0; n < maxMoves; n++ {
+		if n > 0 {
+			if info, err = analyzeLines(ctx, e, nb, params, 2); err != nil {
+				return nil, 0, err
+			}
+			if !onlyMove(info) {
+				// the last move of opponent is not a part of solution
+				solution = solution[:len(solution)-1]
+				break
+			}
+		}
+		mv, ok := lineMove(nb, info.Lines[0])
+		if !ok {
+			break
+		}
+		final = review.Score(lineInfo(info.Lines[0]))
+		solution = append(solution, moves.MoveToUCI(nb, mv))
+		_ = moves.ApplyMove(nb, mv)
+		if st := rules.GameStatusOf(nb); (st != base.Pass && st != base.Check) || n == maxMoves-1 {
+			break
+		}
+
+		// the best reply of opponent
+		reply, err := analyzeLines(ctx, e, nb, params, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		rmv, ok := bestMove(nb, reply)
+		if !ok {
+			break
+		}
+		solution = append(solution, moves.MoveToUCI(nb, rmv))
+		_ = moves.ApplyMove(nb, rmv)
+	}
+	if len(solution)%2 == 0 {
+		solution = solution[:max(len(solution)-1, 0)]
+	}
+	return solution, final, nil
+}
+
+// one search with n best lines
+func analyzeLines(ctx context.Context, e engine.Engine, b *base.Board, params engine.SearchParams, n int) (engine.AnalysisInfo, error) {
+	params.MultiPV = n
+	info, err := review.Analyze(ctx, e, b, params)
+	if err != nil {
+		return info, err
+	}
+	if len(info.Lines) == 0 {
+		// engine without MultiPV: main line only
+		info.Lines = []engine.PVLine{{ScoreCP: info.ScoreCP, MateIn: info.MateIn, PV: info.PV, UCIPV: info.UCIPV}}
+		if len(info.PV) == 0 && info.BestMove != nil {
+			info.Lines[0].PV = []base.Move{*info.BestMove}
+		}
+		if len(info.UCIPV) == 0 && info.UCIBestMove != "" {
+			info.Lines[0].UCIPV = []string{info.UCIBestMove}
+		}
+	}
+	return info, nil
+}
+
+// the best move wins and the second best does not
+func onlyMove(info engine.AnalysisInfo) bool {
+	if len(info.Lines) < 2 {
+		return false
+	}
+	best := review.WinPercent(review.Score(lineInfo(info.Lines[0])))
+	second := review.WinPercent(review.Score(lineInfo(info.Lines[1])))
+	return best >= winBest && best-second >= winGap
+}
+
+func lineInfo(l engine.PVLine) engine.AnalysisInfo {
+	return engine.AnalysisInfo{ScoreCP: l.ScoreCP, MateIn: l.MateIn}
+}
+
+// first move of line (external engines give UCI)
+func lineMove(b *base.Board, l engine.PVLine) (base.Move, bool) {
+	var mv base.Move
+	switch {
+	case len(l.PV) > 0:
+		mv = l.PV[0]
+	case len(l.UCIPV) > 0:
+		var err error
+		if mv, err = moves.UCIToMove(b, l.UCIPV[0]); err != nil {
+			return mv, false
+		}
+	default:
+		return mv, false
+	}
+	return mv, rules.IsLegalMove(b, mv)
+}
+
+func bestMove(b *base.Board, info engine.AnalysisInfo) (base.Move, bool) {
+	if len(info.Lines) > 0 {
+		return lineMove(b, info.Lines[0])
+	}
+	return base.Move{}, false
+}
+
+// id of puzzle is hash of its position
+func ID(fen string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(fen))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// ---- Themes and rating ----
+
+// themes by result, length, special moves and phase of game
+func themes(b *base.Board, solution []string, final int) []string {
+	var list []string
+	nb := moves.CloneBoard(b)
+	first := ""
+	special := map[string]bool{}
+	var line []base.Move
+	for i, u := range solution {
+		mv, err := moves.UCIToMove(nb, u)
+		if err != nil {
+			break
+		}
+		san := moves.MoveToSAN(nb, mv)
+		if i == 0 {
+			first = san
+		}
+		if i%2 == 0 {
+			switch {
+			case strings.Contains(san, "="):
+				special["promotion"] = true
+			case strings.HasPrefix(san, "O-O"):
+				special["castling"] = true
+			}
+		}
+		line = append(line, mv)
+		_ = moves.ApplyMove(nb, mv)
+	}
+
+	n := (len(solution) + 1) / 2
+	switch {
+	case rules.GameStatusOf(nb) == base.Checkmate:
+		list = append(list, "mate", fmt.Sprintf("mateIn%d", n))
+	case final >= crushingCP:
+		list = append(list, "crushing")
+	default:
+		list = append(list, "advantage")
+	}
+	switch {
+	case n == 1:
+		list = append(list, "oneMove")
+	case n == 2:
+		list = append(list, "short")
+	case n == 3:
+		list = append(list, "long")
+	default:
+		list = append(list, "veryLong")
+	}
+	for _, t := range []string{"promotion", "castling"} {
+		if special[t] {
+			list = append(list, t)
+		}
+	}
+	if !strings.ContainsAny(first, "x+#=") {
+		list = append(list, "quietMove")
+	}
+	// tactical motifs of moves of solver
+	found, _ := motifs.DetectLine(b, line)
+	var solver []motifs.Motif
+	for _, m := range found {
+		if m.Ply%2 == 0 {
+			solver = append(solver, m)
+		}
+	}
+	list = append(list, motifs.Themes(solver)...)
+	return append(list, phase(b))
+}
+
+func phase(b *base.Board) string {
+	if b.Fullmove <= 10 {
+		return "opening"
+	}
+	var white, black int
+	for _, p := range b.Mailbox {
+		v := 0
+		switch p {
+		case base.WQueen, base.BQueen:
+			v = 9
+		case base.WRook, base.BRook:
+			v = 5
+		case base.WBishop, base.BBishop, base.WKnight, base.BKnight:
+			v = 3
+		}
+		if p >= base.WPawn {
+			white += v
+		} else {
+			black += v
+		}
+	}
+	if white <= endgameMaterial && black <= endgameMaterial {
+		return "endgame"
+	}
+	return "middlegame"
+}
+
+// estimate of difficulty: longer solutions, quiet first moves and moves missed
+// in the game are harder, captures and checks are easier to find
+func rating(p Puzzle, played string) int {
+	r := 1000 + 200*(p.SolverMoves()-1)
+	if p.HasTheme("quietMove") {
+		r += 250
+	}
+	if played != "" && played != p.Moves[0] {
+		r += 150
+	}
+	if p.HasTheme("mate") && p.SolverMoves() == 1 {
+		r -= 200
+	}
+	if p.HasTheme("endgame") {
+		r += 50
+	}
+	return min(max(r, 600), 2800)
+}
@@ -0,0 +1,304 @@
+package puzzle
+
+import (
+	"bufio"
+	"encoding/json"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// --------------------------------------------------
+// Puzzle sets (JSON or EPD)
+// --------------------------------------------------
+// puzzle is a position with the solver to move and the only winning line:
+// moves alternate solver and opponent, the first and the last are moves of solver
+//
+// JSON set (.json):
+//
+//	{"version": 1, "puzzles": [{
+//	  "id": "1f0c3a9b",                      // hash of FEN
+//	  "fen": "...",                          // solver to move
+//	  "lastMove": "d8h4",                    // move of opponent before puzzle (UCI, optional)
+//	  "moves": ["f3h4", "g8f6", "h4f5"],     // solution (UCI)
+//	  "themes": ["advantage", "short", "middlegame"],
+//	  "rating": 1450,                        // estimate of difficulty
+//	  "game": "White - Black, Event",         // source game (optional)
+//	  "ply": 23                              // ply of source game (optional)
+//	}]}
+//
+// EPD set (.epd), puzzle per line, SAN moves:
+//
+//	<4 fields of FEN> bm Nxh4; pv Nxh4 Nf6 Nf5; id "1f0c3a9b"; c0 "advantage short middlegame"; c1 "1450"; c2 "White - Black, Event"; hmvc 0; fmvn 12;
+
+const Version = 1
+
+type Puzzle struct {
+	ID       string   `json:"id"`
+	FEN      string   `json:"fen"`
+	LastMove string   `json:"lastMove,omitempty"`
+	Moves    []string `json:"moves"`
+	Themes   []string `json:"themes"`
+	Rating   int      `json:"rating"`
+	Game     string   `json:"game,omitempty"`
+	Ply      int      `json:"ply,omitempty"`
+}
+
+type Set struct {
+	Version int      `json:"version"`
+	Puzzles []Puzzle `json:"puzzles"`
+}
+
+// start position of puzzle
+func (p Puzzle) Board() (*base.Board, error) {
+	return convfen.ConvertFENToBoard(p.FEN)
+}
+
+// solver plays moves of even indexes
+func (p Puzzle) SolverMoves() int {
+	return (len(p.Moves) + 1) / 2
+}
+
+func (p Puzzle) HasTheme(theme string) bool {
+	for _, t := range p.Themes {
+		if t == theme {
+			return true
+		}
+	}
+	return false
+}
+
+// check that position is valid and solution is legal
+func (p Puzzle) Validate() error {
+	b, err := p.Board()
+	if err != nil {
+		return err
+	}
+	if len(p.Moves) == 0 || len(p.Moves)%2 == 0 {
+		return fmt.Errorf("puzzle %s: solution must end with move of solver", p.ID)
+	}
+	for _, u := range p.Moves {
+		mv, err := moves.UCIToMove(b, u)
+		if err != nil || !rules.IsLegalMove(b, mv) {
+			return fmt.Errorf("puzzle %s: illegal move %s", p.ID, u)
+		}
+		if err := moves.ApplyMove(b, mv); err != nil {
+			return fmt.Errorf("puzzle %s: move %s: %v", p.ID, u, err)
+		}
+	}
+	return nil
+}
+
+// solution in SAN
+func (p Puzzle) SAN() ([]string, error) {
+	b, err := p.Board()
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, u := range p.Moves {
+		mv, err := moves.UCIToMove(b, u)
+		if err != nil {
+			return nil, fmt.Errorf("move %s: %v", u, err)
+		}
+		list = append(list, moves.MoveToSAN(b, mv))
+		if err := moves.ApplyMove(b, mv); err != nil {
+			return nil, fmt.Errorf("move %s: %v", u, err)
+		}
+	}
+	return list, nil
+}
+
+// ---- Files ----
+
+func isEPD(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".epd" || ext == ".fen"
+}
+
+// load set by extension of file (.epd - EPD, else JSON)
+func Load(path string) ([]Puzzle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSet(f, path)
+}
+
+// read set by extension of name (.epd - EPD, else JSON)
+func ReadSet(r io.Reader, name string) ([]Puzzle, error) {
+	var list []Puzzle
+	var err error
+	if isEPD(name) {
+		list, err = ReadEPD(r)
+	} else {
+		list, err = ReadJSON(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no puzzles in %s", name)
+	}
+	return list, nil
+}
+
+// save set by extension of file (.epd - EPD, else JSON)
+func Save(path string, list []Puzzle) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if isEPD(path) {
+		err = WriteEPD(f, list)
+	} else {
+		err = WriteJSON(f, list)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func ReadJSON(r io.Reader) ([]Puzzle, error) {
+	var set Set
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, err
+	}
+	if set.Version > Version {
+		return nil, fmt.Errorf("unsupported version %d", set.Version)
+	}
+	for _, p := range set.Puzzles {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return set.Puzzles, nil
+}
+
+func WriteJSON(w io.Writer, list []Puzzle) error {
+	if list == nil {
+		list = []Puzzle{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Set{Version: Version, Puzzles: list})
+}
+
+func ReadEPD(r io.Reader) ([]Puzzle, error) {
+	var list []Puzzle
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseEPD(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		list = append(list, p)
+	}
+	return list, sc.Err()
+}
+
+func parseEPD(line string) (Puzzle, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return Puzzle{}, fmt.Errorf("invalid position")
+	}
+	ops := epdOps(strings.Join(fields[4:], " "))
+	fen := strings.Join(fields[:4], " ") + " " + valueOr(ops["hmvc"], "0") + " " + valueOr(ops["fmvn"], "1")
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return Puzzle{}, err
+	}
+	p := Puzzle{ID: ops["id"], FEN: convfen.ConvertBoardToFEN(*b), Game: ops["c2"]}
+	line = valueOr(ops["pv"], ops["bm"])
+	for _, san := range strings.Fields(line) {
+		mv, err := moves.SANToMove(b, san)
+		if err != nil {
+			return Puzzle{}, fmt.Errorf("move %s: %v", san, err)
+		}
+		p.Moves = append(p.Moves, moves.MoveToUCI(b, mv))
+		if err := moves.ApplyMove(b, mv); err != nil {
+			return Puzzle{}, fmt.Errorf("move %s: %v", san, err)
+		}
+	}
+	if len(p.Moves) == 0 {
+		return Puzzle{}, fmt.Errorf("no solution (bm or pv)")
+	}
+	p.Themes = strings.Fields(ops["c0"])
+	p.Rating, _ = strconv.Atoi(ops["c1"])
+	if p.ID == "" {
+		p.ID = ID(p.FEN)
+	}
+	return p, p.Validate()
+}
+
+// operations of EPD by opcode, quotes of strings are removed
+func epdOps(s string) map[string]string {
+	ops := map[string]string{}
+	for _, op := range splitOps(s) {
+		code, val, _ := strings.Cut(strings.TrimSpace(op), " ")
+		if code != "" {
+			ops[code] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return ops
+}
+
+// split by ';' out of quoted strings
+func splitOps(s string) []string {
+	var list []string
+	quoted, start := false, 0
+	for i, ch := range s {
+		switch {
+		case ch == '"':
+			quoted = !quoted
+		case ch == ';' && !quoted:
+			list = append(list, s[start:i])
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		list = append(list, rest)
+	}
+	return list
+}
+
+func valueOr(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func WriteEPD(w io.Writer, list []Puzzle) error {
+	bw := bufio.NewWriter(w)
+	for _, p := range list {
+		san, err := p.SAN()
+		if err != nil {
+			return fmt.Errorf("puzzle %s: %v", p.ID, err)
+		}
+		fields := strings.Fields(p.FEN)
+		if len(fields) != 6 || len(san) == 0 {
+			return fmt.Errorf("puzzle %s: invalid puzzle", p.ID)
+		}
+		fmt.Fprintf(bw, "%s bm %s; pv %s; id %q; c0 %q; c1 \"%d\";",
+			strings.Join(fields[:4], " "), san[0], strings.Join(san, " "), p.ID, strings.Join(p.Themes, " "), p.Rating)
+		if p.Game != "" {
+			fmt.Fprintf(bw, " c2 %q;", strings.ReplaceAll(p.Game, `"`, "'"))
+		}
+		fmt.Fprintf(bw, " hmvc %s; fmvn %s;\n", fields[4], fields[5])
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,221 @@
+package puzzle
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// --------------------------------------------------
+// Solving of puzzles
+// --------------------------------------------------
+// the user plays moves of solver, replies of opponent are played by Reply,
+// a mistake, a hint or a shown solution fails puzzle for rating and streak
+// (a mate in one move other than solution is accepted)
+
+const (
+	DefaultRating = 1500
+	minRating     = 400
+	maxRating     = 3000
+	// puzzles are picked around rating of user
+	pickRange = 200
+	pickFrom  = 10
+)
+
+type MoveResult int
+
+const (
+	MoveWrong   MoveResult = iota
+	MoveRight              // opponent replies next
+	MoveSolved             // the last move of solution
+	MoveIllegal            // not a move of solver, it is not a mistake
+)
+
+type Attempt struct {
+	Puzzle Puzzle
+
+	board *base.Board
+	step  int // index of next move of solution
+	last  *base.Move
+	hints int
+	fail  bool
+}
+
+func NewAttempt(p Puzzle) (*Attempt, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	b, _ := p.Board()
+	return &Attempt{Puzzle: p, board: b}, nil
+}
+
+// current position (copy)
+func (a *Attempt) Board() *base.Board {
+	return moves.CloneBoard(a.board)
+}
+
+func (a *Attempt) SolverWhite() bool {
+	b, _ := a.Puzzle.Board()
+	return b.WhiteToMove
+}
+
+func (a *Attempt) SolverToMove() bool {
+	return !a.Done() && a.step%2 == 0
+}
+
+func (a *Attempt) Done() bool {
+	return a.step >= len(a.Puzzle.Moves)
+}
+
+// the last played move, nil at start
+func (a *Attempt) LastMove() *base.Move {
+	return a.last
+}
+
+// moves of solver are played without mistakes and hints
+func (a *Attempt) Clean() bool {
+	return !a.fail && a.hints == 0
+}
+
+// next move of solution
+func (a *Attempt) Expected() (base.Move, bool) {
+	if a.Done() {
+		return base.Move{}, false
+	}
+	mv, err := moves.UCIToMove(a.board, a.Puzzle.Moves[a.step])
+	return mv, err == nil
+}
+
+// move of solver: a wrong move is not played
+func (a *Attempt) Play(mv base.Move) MoveResult {
+	if !a.SolverToMove() || !rules.IsLegalMove(a.board, mv) {
+		return MoveIllegal
+	}
+	if moves.MoveToUCI(a.board, mv) != a.Puzzle.Moves[a.step] {
+		nb := moves.CloneBoard(a.board)
+		if moves.ApplyMove(nb, mv) != nil || rules.GameStatusOf(nb) != base.Checkmate {
+			a.fail = true
+			return MoveWrong
+		}
+		// other mate
+		a.apply(mv)
+		a.step = len(a.Puzzle.Moves)
+		return MoveSolved
+	}
+	a.apply(mv)
+	a.step++
+	if a.Done() {
+		return MoveSolved
+	}
+	return MoveRight
+}
+
+// reply of opponent or the next move of shown solution
+func (a *Attempt) Reply() (base.Move, bool) {
+	mv, ok := a.Expected()
+	if !ok {
+		return mv, false
+	}
+	a.apply(mv)
+	a.step++
+	return mv, true
+}
+
+// the first hint is the piece of expected move (to is -1), the next one is the square too
+func (a *Attempt) Hint() (from, to int, ok bool) {
+	mv, ok := a.Expected()
+	if !ok || !a.SolverToMove() {
+		return -1, -1, false
+	}
+	a.hints++
+	from, to = base.ConvPointToIndex(mv.From), base.ConvPointToIndex(mv.To)
+	if a.hints == 1 {
+		to = -1
+	}
+	return from, to, true
+}
+
+// solution is shown: the rest of moves are played by Reply
+func (a *Attempt) GiveUp() {
+	a.fail = true
+}
+
+func (a *Attempt) apply(mv base.Move) {
+	_ = moves.ApplyMove(a.board, mv)
+	a.last = &mv
+}
+
+// ---- Rating ----
+
+// rating and streaks of user
+type Stats struct {
+	Rating     int `json:"rating"`
+	Played     int `json:"played"`
+	Solved     int `json:"solved"`
+	Streak     int `json:"streak"`
+	BestStreak int `json:"best_streak"`
+}
+
+func NewStats() Stats {
+	return Stats{Rating: DefaultRating}
+}
+
+// Elo update by result of puzzle (K is bigger for the first puzzles), return change of rating
+func (s *Stats) Record(puzzleRating int, solved bool) int {
+	if s.Rating == 0 {
+		s.Rating = DefaultRating
+	}
+	k := 20.0
+	if s.Played < 20 {
+		k = 40
+	}
+	expected := 1 / (1 + math.Pow(10, float64(puzzleRating-s.Rating)/400))
+	score := 0.0
+	s.Played++
+	if solved {
+		score = 1
+		s.Solved++
+		s.Streak++
+		s.BestStreak = max(s.BestStreak, s.Streak)
+	} else {
+		s.Streak = 0
+	}
+	old := s.Rating
+	s.Rating = min(max(s.Rating+int(math.Round(k*(score-expected))), minRating), maxRating)
+	return s.Rating - old
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("rating %d, solved %d/%d, streak %d (best %d)", s.Rating, s.Solved, s.Played, s.Streak, s.BestStreak)
+}
+
+// index of random puzzle near rating, puzzles of done are skipped while possible
+func Pick(list []Puzzle, rating int, done map[string]bool) int {
+	if len(list) == 0 {
+		return -1
+	}
+	var idx []int
+	for i, p := range list {
+		if !done[p.ID] {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) == 0 {
+		return rand.IntN(len(list))
+	}
+	dist := func(i int) int {
+		return max(list[i].Rating-rating, rating-list[i].Rating)
+	}
+	slices.SortStableFunc(idx, func(a, b int) int {
+		return dist(a) - dist(b)
+	})
+	n := 1
+	for n < len(idx) && n < pickFrom && dist(idx[n]) <= pickRange {
+		n++
+	}
+	return idx[rand.IntN(n)]
+}
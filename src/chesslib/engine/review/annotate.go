@@ -0,0 +1,48 @@
+package review
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"fmt"
+)
+
+// --------------------------------------------------
+// Annotated PGN
+// --------------------------------------------------
+
+// annotator of PGN
+const Annotator = "evilchess"
+
+// insert NAGs, comments and best lines of bad moves into game of review
+func (r *Review) Annotate(pg *convpgn.PGNGame) {
+	if pg.Tags == nil {
+		pg.Tags = map[string]string{}
+	}
+	if fen := convfen.ConvertBoardToFEN(r.Start); fen != base.FEN_START_GAME {
+		pg.Tags["FEN"] = fen
+		pg.Tags["SetUp"] = "1"
+	}
+	pg.Tags["Annotator"] = Annotator
+	pg.Tags["WhiteAccuracy"] = fmt.Sprintf("%.1f", r.White.Accuracy)
+	pg.Tags["BlackAccuracy"] = fmt.Sprintf("%.1f", r.Black.Accuracy)
+
+	n := len(r.Moves)
+	pg.Moves = make([]string, n)
+	pg.Comments = make([]string, n)
+	pg.NAGs = make([]int, n)
+	pg.Variations = make([][]string, n)
+	for i, m := range r.Moves {
+		pg.Moves[i] = m.SAN
+		pg.NAGs[i] = m.Class.NAG()
+		if m.Class < ClassInaccuracy {
+			continue
+		}
+		// "Mistake (+0.35 -> -0.80). Nf3 was best."
+		pg.Comments[i] = fmt.Sprintf("%s (%s -> %s).", m.Class, FormatEval(m.Before), FormatEval(m.After))
+		if m.Best != "" {
+			pg.Comments[i] += fmt.Sprintf(" %s was best.", m.Best)
+			pg.Variations[i] = m.BestLine
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package review
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/history"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"math"
+	"time"
+)
+
+// --------------------------------------------------
+// Review: engine annotation of played game
+// --------------------------------------------------
+// every position of history is analyzed, move is classified by loss of win
+// probability of mover (lichess thresholds), accuracy of move is derived
+// from the same loss
+
+const (
+	// mate is a big score (engine MateIn is in plies)
+	mateScore = 10000
+	// evaluations are capped for centipawn loss and win probability
+	evalCap = 1000
+
+	// loss of win probability (%) of classes
+	inaccuracyLoss = 5
+	mistakeLoss    = 10
+	blunderLoss    = 15
+
+	// plies of best line in variation
+	bestLinePlies = 8
+)
+
+// limits of analysis of every position
+var DefaultParams = engine.SearchParams{MaxDepth: 10, MaxTimeMs: 1000}
+
+type Class int
+
+const (
+	ClassGood Class = iota
+	ClassBest       // move of engine
+	ClassInaccuracy
+	ClassMistake
+	ClassBlunder
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassBest:
+		return "Best move"
+	case ClassInaccuracy:
+		return "Inaccuracy"
+	case ClassMistake:
+		return "Mistake"
+	case ClassBlunder:
+		return "Blunder"
+	}
+	return "Good move"
+}
+
+// symbol of move suffix annotation
+func (c Class) Symbol() string {
+	switch c {
+	case ClassInaccuracy:
+		return "?!"
+	case ClassMistake:
+		return "?"
+	case ClassBlunder:
+		return "??"
+	}
+	return ""
+}
+
+// numeric annotation glyph of PGN (0 - none)
+func (c Class) NAG() int {
+	switch c {
+	case ClassInaccuracy:
+		return 6
+	case ClassMistake:
+		return 2
+	case ClassBlunder:
+		return 4
+	}
+	return 0
+}
+
+type Options struct {
+	Params   engine.SearchParams   // limits of every position (zero - DefaultParams)
+	Progress func(done, total int) // called after every analyzed position
+}
+
+type MoveReview struct {
+	Ply      int // from 1
+	White    bool
+	SAN      string
+	Best     string   // best move of engine (SAN)
+	BestLine []string // principal variation of engine before move (SAN)
+	Before   int      // evaluation before move (centipawns, white POV)
+	After    int      // evaluation after move
+	CPLoss   int      // centipawn loss of mover
+	WinLoss  float64  // loss of win probability of mover (%)
+	Accuracy float64  // 0..100
+	Class    Class
+}
+
+type SideStats struct {
+	Accuracy     float64
+	ACPL         int // average centipawn loss
+	Inaccuracies int
+	Mistakes     int
+	Blunders     int
+}
+
+func (s SideStats) String() string {
+	return fmt.Sprintf("accuracy %.1f%%, ACPL %d, %d inaccuracies, %d mistakes, %d blunders",
+		s.Accuracy, s.ACPL, s.Inaccuracies, s.Mistakes, s.Blunders)
+}
+
+type Review struct {
+	Start        base.Board
+	Evals        []int // evaluations of positions (white POV), Evals[0] - start position
+	Moves        []MoveReview
+	White, Black SideStats
+}
+
+// analyze all moves of history, engine must be initialized
+func ReviewHistory(ctx context.Context, e engine.Engine, h *history.History, opts Options) (*Review, error) {
+	return ReviewMoves(ctx, e, h.Moves(), opts)
+}
+
+// analyze moves of history entries (entries[0] - start position)
+func ReviewMoves(ctx context.Context, e engine.Engine, entries []history.MoveEntry, opts Options) (*Review, error) {
+	if len(entries) < 2 {
+		return nil, fmt.Errorf("no moves")
+	}
+	params := opts.Params
+	if params.MaxDepth == 0 && params.MaxTimeMs == 0 {
+		params = DefaultParams
+	}
+	params.Infinite, params.Ponder = false, false
+
+	r := &Review{Start: entries[0].Board}
+	infos := make([]engine.AnalysisInfo, len(entries))
+	for i := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		b := &entries[i].Board
+		cp, info, err := evaluate(ctx, e, b, params)
+		if err != nil {
+			return nil, fmt.Errorf("position %d: %v", i, err)
+		}
+		if !b.WhiteToMove {
+			cp = -cp
+		}
+		infos[i] = info
+		r.Evals = append(r.Evals, cp)
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(entries))
+		}
+	}
+
+	for i := 1; i < len(entries); i++ {
+		prev := &entries[i-1].Board
+		mv := entries[i].Move
+		m := MoveReview{
+			Ply:    i,
+			White:  prev.WhiteToMove,
+			SAN:    moves.MoveToSAN(prev, mv),
+			Before: r.Evals[i-1],
+			After:  r.Evals[i],
+		}
+		sign := 1
+		if !m.White {
+			sign = -1
+		}
+		before, after := clampEval(sign*m.Before), clampEval(sign*m.After)
+		m.CPLoss = max(before-after, 0)
+		m.WinLoss = max(WinPercent(before)-WinPercent(after), 0)
+		m.Accuracy = moveAccuracy(m.WinLoss)
+
+		line := bestLine(prev, infos[i-1])
+		if len(line) > 0 {
+			m.Best = line[0]
+			m.BestLine = line
+		}
+		switch {
+		case m.Best != "" && m.Best == m.SAN:
+			m.Class, m.CPLoss, m.WinLoss, m.Accuracy = ClassBest, 0, 0, 100
+		case m.WinLoss >= blunderLoss:
+			m.Class = ClassBlunder
+		case m.WinLoss >= mistakeLoss:
+			m.Class = ClassMistake
+		case m.WinLoss >= inaccuracyLoss:
+			m.Class = ClassInaccuracy
+		}
+		r.Moves = append(r.Moves, m)
+	}
+	r.White, r.Black = r.sideStats(true), r.sideStats(false)
+	return r, nil
+}
+
+// evaluation of position for side to move, terminal positions are not searched
+func evaluate(ctx context.Context, e engine.Engine, b *base.Board, params engine.SearchParams) (cp int, info engine.AnalysisInfo, err error) {
+	switch rules.GameStatusOf(b) {
+	case base.Checkmate:
+		return -mateScore, info, nil
+	case base.Stalemate, base.Draw:
+		return 0, info, nil
+	}
+	if info, err = Analyze(ctx, e, b, params); err != nil {
+		return 0, info, err
+	}
+	return Score(info), info, nil
+}
+
+// score of analysis for side to move (mate in N plies is mateScore-N)
+func Score(info engine.AnalysisInfo) int {
+	switch {
+	case info.MateIn > 0:
+		return mateScore - info.MateIn
+	case info.MateIn < 0:
+		return -mateScore - info.MateIn
+	}
+	return info.ScoreCP
+}
+
+// evaluation in pawns or mate in moves ("+0.35", "#3", "#-2")
+func FormatEval(cp int) string {
+	if abs := max(cp, -cp); abs > mateScore-500 {
+		n := (mateScore - abs + 1) / 2
+		if cp < 0 {
+			n = -n
+		}
+		return fmt.Sprintf("#%d", n)
+	}
+	return fmt.Sprintf("%+.2f", float64(cp)/100)
+}
+
+// one search, stopped after time limit if engine has a move
+// (internal engine checks time only between iterations)
+func Analyze(ctx context.Context, e engine.Engine, b *base.Board, params engine.SearchParams) (engine.AnalysisInfo, error) {
+	if err := e.SetPosition(moves.CloneBoard(b)); err != nil {
+		return engine.AnalysisInfo{}, err
+	}
+	if err := e.StartAnalysis(params); err != nil {
+		return engine.AnalysisInfo{}, err
+	}
+	done := make(chan struct{})
+	go func() {
+		e.WaitDone()
+		close(done)
+	}()
+	var limit <-chan time.Time
+	if params.MaxTimeMs > 0 {
+		limit = time.After(time.Duration(params.MaxTimeMs) * time.Millisecond)
+	}
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-limit:
+			if info := e.BestNow(); info.BestMove == nil && info.UCIBestMove == "" {
+				// no move yet: wait for the first iteration
+				limit = time.After(10 * time.Millisecond)
+				continue
+			}
+			_ = e.StopAnalysis()
+		case <-ctx.Done():
+			_ = e.StopAnalysis()
+			<-done
+			return engine.AnalysisInfo{}, ctx.Err()
+		}
+	}
+	info := e.BestNow()
+	if info.BestMove == nil && info.UCIBestMove == "" {
+		return info, fmt.Errorf("no move of engine")
+	}
+	return info, nil
+}
+
+// principal variation in SAN (UCI PV of external engines)
+func bestLine(b *base.Board, info engine.AnalysisInfo) []string {
+	pv := info.PV
+	nb := moves.CloneBoard(b)
+	if len(pv) == 0 {
+		list := info.UCIPV
+		if len(list) == 0 && info.UCIBestMove != "" {
+			list = []string{info.UCIBestMove}
+		}
+		for _, u := range list {
+			mv, err := moves.UCIToMove(nb, u)
+			if err != nil || moves.ApplyMove(nb, mv) != nil {
+				break
+			}
+			pv = append(pv, mv)
+		}
+		nb = moves.CloneBoard(b)
+	}
+	if len(pv) == 0 && info.BestMove != nil {
+		pv = []base.Move{*info.BestMove}
+	}
+	var line []string
+	for _, mv := range pv {
+		if len(line) == bestLinePlies || !rules.IsLegalMove(nb, mv) {
+			break
+		}
+		san := moves.MoveToSAN(nb, mv)
+		if moves.ApplyMove(nb, mv) != nil {
+			break
+		}
+		line = append(line, san)
+	}
+	return line
+}
+
+func clampEval(cp int) int {
+	return min(max(cp, -evalCap), evalCap)
+}
+
+// win probability (%) of side with evaluation cp
+func WinPercent(cp int) float64 {
+	return 50 + 50*(2/(1+math.Exp(-0.00368208*float64(clampEval(cp))))-1)
+}
+
+// accuracy of move by loss of win probability
+func moveAccuracy(loss float64) float64 {
+	return min(max(103.1668*math.Exp(-0.04354*loss)-3.1669+1, 0), 100)
+}
+
+// accuracy of side is mean of arithmetic and harmonic means of move accuracies
+// (harmonic mean punishes single blunders)
+func (r *Review) sideStats(white bool) SideStats {
+	var s SideStats
+	var sum, inv float64
+	n, cpl := 0, 0
+	for _, m := range r.Moves {
+		if m.White != white {
+			continue
+		}
+		n++
+		cpl += m.CPLoss
+		sum += m.Accuracy
+		inv += 1 / max(m.Accuracy, 1)
+		switch m.Class {
+		case ClassInaccuracy:
+			s.Inaccuracies++
+		case ClassMistake:
+			s.Mistakes++
+		case ClassBlunder:
+			s.Blunders++
+		}
+	}
+	if n == 0 {
+		return s
+	}
+	s.Accuracy = (sum/float64(n) + float64(n)/inv) / 2
+	s.ACPL = cpl / n
+	return s
+}
@@ -0,0 +1,190 @@
+package skill
+
+import (
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/aiengine"
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+// --------------------------------------------------
+// Human-like strength by target Elo
+// --------------------------------------------------
+// search engines look for several best lines (MultiPV) and play one of them,
+// the lower Elo the more often a worse line is chosen (softmax by score loss);
+// the model is conditioned by rating and samples its policy
+
+const (
+	MinElo     = 600
+	MaxElo     = 2800
+	DefaultElo = 1500
+
+	// scores of mate lines for comparison with centipawns
+	mateScore = 100000
+)
+
+type Level struct {
+	Elo         int
+	Depth       int     // max search depth
+	MoveTimeMs  int64   // max time per move
+	MultiPV     int     // candidate moves
+	Temperature float64 // centipawns: higher - worse moves are played more often
+	MaxLoss     int     // centipawns: candidates losing more are never played
+}
+
+func ClampElo(elo int) int {
+	return min(max(elo, MinElo), MaxElo)
+}
+
+// parameters interpolated between MinElo and MaxElo
+func LevelForElo(elo int) Level {
+	elo = ClampElo(elo)
+	t := float64(elo-MinElo) / float64(MaxElo-MinElo)
+	return Level{
+		Elo:         elo,
+		Depth:       1 + int(math.Round(t*9)),
+		MoveTimeMs:  300 + int64(t*2700),
+		MultiPV:     6 - int(math.Round(t*4)),
+		Temperature: 200 * math.Pow(0.04, t), // 200 .. 8
+		MaxLoss:     600 - int(t*550),
+	}
+}
+
+// comparable score of line (mates are far above any centipawn score)
+func lineScore(l engine.PVLine) int {
+	switch {
+	case l.MateIn > 0:
+		return mateScore - l.MateIn
+	case l.MateIn < 0:
+		return -mateScore - l.MateIn
+	}
+	return l.ScoreCP
+}
+
+// index of line chosen by random r (0..1), lines are sorted by score
+func Choose(lines []engine.PVLine, lvl Level, r float64) int {
+	if len(lines) < 2 {
+		return 0
+	}
+	best := lineScore(lines[0])
+	weights := make([]float64, len(lines))
+	sum := 0.0
+	for i, l := range lines {
+		if len(l.PV) == 0 && len(l.UCIPV) == 0 {
+			continue
+		}
+		loss := best - lineScore(l)
+		if i > 0 && loss > lvl.MaxLoss {
+			continue
+		}
+		weights[i] = math.Exp(-float64(max(loss, 0)) / lvl.Temperature)
+		sum += weights[i]
+	}
+	r *= sum
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return 0
+}
+
+// engine playing at target Elo
+type SkillEngine struct {
+	engine.Engine
+
+	mu     sync.Mutex
+	level  Level
+	chosen *engine.AnalysisInfo // move of the last search (after WaitDone)
+}
+
+func NewSkillEngine(inner engine.Engine, elo int) *SkillEngine {
+	return &SkillEngine{Engine: inner, level: LevelForElo(elo)}
+}
+
+func (e *SkillEngine) SetElo(elo int) {
+	e.mu.Lock()
+	e.level = LevelForElo(elo)
+	e.mu.Unlock()
+}
+
+func (e *SkillEngine) Level() Level {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.level
+}
+
+// inner engine with full strength
+func (e *SkillEngine) Unwrap() engine.Engine {
+	if m, ok := e.Engine.(*aiengine.AIEngine); ok {
+		m.SetSampling(false)
+		m.SetRating(aiengine.DefaultRating)
+	}
+	return e.Engine
+}
+
+// limits of the search are defined by level
+func (e *SkillEngine) StartAnalysis(params engine.SearchParams) error {
+	e.mu.Lock()
+	lvl := e.level
+	e.chosen = nil
+	e.mu.Unlock()
+
+	if m, ok := e.Engine.(*aiengine.AIEngine); ok {
+		m.SetRating(lvl.Elo)
+		m.SetSampling(true)
+		return m.StartAnalysis(params)
+	}
+	params.Infinite = false
+	params.MaxDepth = lvl.Depth
+	params.MaxTimeMs = lvl.MoveTimeMs
+	params.MultiPV = lvl.MultiPV
+	return e.Engine.StartAnalysis(params)
+}
+
+func (e *SkillEngine) WaitDone() {
+	e.Engine.WaitDone()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.chosen != nil {
+		return
+	}
+	info := e.Engine.BestNow()
+	if idx := Choose(info.Lines, e.level, rand.Float64()); idx > 0 {
+		l := info.Lines[idx]
+		info.ScoreCP, info.MateIn = l.ScoreCP, l.MateIn
+		info.PV, info.UCIPV = l.PV, l.UCIPV
+		info.BestMove, info.UCIBestMove, info.UCIPonder = nil, "", ""
+		if len(l.PV) > 0 {
+			info.BestMove = &info.PV[0]
+		}
+		if len(l.UCIPV) > 0 {
+			info.UCIBestMove = l.UCIPV[0]
+		}
+		if len(l.UCIPV) > 1 {
+			info.UCIPonder = l.UCIPV[1]
+		}
+	}
+	e.chosen = &info
+}
+
+// chosen move after search is done
+func (e *SkillEngine) BestNow() engine.AnalysisInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.chosen != nil {
+		return *e.chosen
+	}
+	return e.Engine.BestNow()
+}
+
+// wrap engine to play at elo (already wrapped engine is updated)
+func ForElo(e engine.Engine, elo int) engine.Engine {
+	if se, ok := e.(*SkillEngine); ok {
+		se.SetElo(elo)
+		return se
+	}
+	return NewSkillEngine(e, elo)
+}
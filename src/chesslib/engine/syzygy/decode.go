@@ -0,0 +1,580 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// --------------------------------------------------
+// Table files (.rtbw - WDL, .rtbz - DTZ)
+// --------------------------------------------------
+// values are compressed with canonical Huffman code of symbols,
+// every symbol is a value or a pair of symbols (recursive pairing),
+// blocks of symbols are located by sparse index of block lengths;
+// header of file (pieces, symbols, dtz maps) is read on first probe,
+// index and blocks are read by ReadAt on every probe (files are big)
+
+const (
+	flagSTM         = 1
+	flagMapped      = 2
+	flagWinPlies    = 4
+	flagLossPlies   = 8
+	flagWide        = 16
+	flagSingleValue = 128
+)
+
+var (
+	magicWDL = []byte{0x71, 0xE8, 0x23, 0x5D}
+	magicDTZ = []byte{0xD7, 0x66, 0x0C, 0xA5}
+
+	errCorrupted = errors.New("corrupted table")
+)
+
+// decoding data of one table of file (side to move, file of leading pawn)
+type pairsData struct {
+	flags           uint8
+	blockSize       int
+	span            uint64
+	numBlocks       int
+	maxSymLen       int
+	minSymLen       int // single value table: the value
+	lowestSym       int // offsets in file
+	btree           int
+	blockLength     int
+	blockLengthSize int
+	sparseIndex     int
+	sparseIndexSize int
+	data            int
+	base64          []uint64
+	symlen          []uint8
+	pieces          [MaxPieces]int
+	groupIdx        [MaxPieces + 1]uint64
+	groupLen        [MaxPieces + 1]int
+	mapIdx          [4]int // dtz maps: win, loss, cursed win, blessed loss
+}
+
+type table struct {
+	path string
+	dtz  bool
+
+	key, key2       string // material with white as stronger side and swapped
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	pawnCount       [2]int // leading color, other color
+
+	once   sync.Once
+	err    error
+	file   *os.File // kept open while table is used
+	size   int
+	head   []byte // header of file
+	mapOff int    // dtz maps
+	items  [2][4]pairsData
+}
+
+func newTable(name, path string, dtz bool) *table {
+	t := &table{path: path, dtz: dtz, key: name, key2: swapKey(name)}
+	w, b, _ := strings.Cut(name, "v")
+	t.pieceCount = len(w) + len(b)
+	for _, side := range []string{w, b} {
+		for _, l := range []string{"Q", "R", "B", "N", "P"} {
+			if strings.Count(side, l) == 1 {
+				t.hasUniquePieces = true
+			}
+		}
+	}
+	wp, bp := strings.Count(w, "P"), strings.Count(b, "P")
+	t.hasPawns = wp+bp > 0
+	// leading color has less pawns (better compression)
+	if bp == 0 || (wp > 0 && bp >= wp) {
+		t.pawnCount = [2]int{wp, bp}
+	} else {
+		t.pawnCount = [2]int{bp, wp}
+	}
+	return t
+}
+
+func (t *table) get(stm, f int) *pairsData {
+	sides := 2
+	if t.dtz {
+		sides = 1
+	}
+	if !t.hasPawns {
+		f = 0
+	}
+	return &t.items[stm%sides][f]
+}
+
+// file is opened and its header is parsed on first probe
+func (t *table) load() error {
+	t.once.Do(func() {
+		f, err := os.Open(t.path)
+		if err != nil {
+			t.err = err
+			return
+		}
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			t.err = err
+			return
+		}
+		t.file, t.size = f, int(st.Size())
+		if err := t.setup(); err != nil {
+			f.Close()
+			t.file, t.head = nil, nil
+			t.err = fmt.Errorf("%s: %w", t.path, err)
+		}
+	})
+	return t.err
+}
+
+// header is read up to n bytes
+func (t *table) need(n int) error {
+	if n <= len(t.head) {
+		return nil
+	}
+	if n < 0 || n > t.size {
+		return errCorrupted
+	}
+	n = min(max(n, 2*len(t.head), 1024), t.size)
+	buf := make([]byte, n)
+	copy(buf, t.head)
+	if _, err := t.file.ReadAt(buf[len(t.head):], int64(len(t.head))); err != nil {
+		return err
+	}
+	t.head = buf
+	return nil
+}
+
+// bytes of file at offset p
+func (t *table) read(p int, buf []byte) error {
+	if p < 0 || p+len(buf) > t.size {
+		return errCorrupted
+	}
+	_, err := t.file.ReadAt(buf, int64(p))
+	return err
+}
+
+func (t *table) setup() error {
+	magic := magicWDL
+	if t.dtz {
+		magic = magicDTZ
+	}
+	if err := t.need(6); err != nil || string(t.head[:4]) != string(magic) {
+		return errCorrupted
+	}
+	p := 4
+	if (t.head[p]&2 != 0) != t.hasPawns || (t.head[p]&1 != 0) != (t.key != t.key2) {
+		return errCorrupted
+	}
+	p++
+
+	sides := 1
+	if !t.dtz && t.key != t.key2 {
+		sides = 2
+	}
+	maxFile := 0
+	if t.hasPawns {
+		maxFile = 3
+	}
+	pp := t.hasPawns && t.pawnCount[1] > 0
+
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			*t.get(i, f) = pairsData{}
+		}
+		if err := t.need(p + 2 + t.pieceCount); err != nil {
+			return err
+		}
+		data := t.head
+		order := [2][2]int{{int(data[p] & 0xF), 0xF}, {int(data[p] >> 4), 0xF}}
+		if pp {
+			order[0][1], order[1][1] = int(data[p+1]&0xF), int(data[p+1]>>4)
+			p++
+		}
+		p++
+		for k := 0; k < t.pieceCount; k++ {
+			for i := 0; i < sides; i++ {
+				if i == 0 {
+					t.get(i, f).pieces[k] = int(data[p] & 0xF)
+				} else {
+					t.get(i, f).pieces[k] = int(data[p] >> 4)
+				}
+			}
+			p++
+		}
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			if !t.validPieces(d) {
+				return errCorrupted
+			}
+			t.setGroups(d, order[i], f)
+		}
+	}
+	p += p & 1
+
+	var err error
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			if p, err = t.setSizes(t.get(i, f), p); err != nil {
+				return err
+			}
+		}
+	}
+	if t.dtz {
+		if p, err = t.setDTZMap(p, maxFile); err != nil {
+			return err
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			d.sparseIndex = p
+			p += d.sparseIndexSize * 6
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			d.blockLength = p
+			p += d.blockLengthSize * 2
+		}
+	}
+	if p < 0 || p > t.size {
+		return errCorrupted
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			p = (p + 0x3F) &^ 0x3F // 64 byte alignment
+			d := t.get(i, f)
+			d.data = p
+			p += d.numBlocks * d.blockSize
+			if d.numBlocks > 0 && p > t.size {
+				return errCorrupted
+			}
+		}
+	}
+	return nil
+}
+
+// pieces of table are the material of its name (group sizes depend on them)
+func (t *table) validPieces(d *pairsData) bool {
+	var cnt [16]int
+	w, b, _ := strings.Cut(t.key, "v")
+	for i, side := range []string{w, b} {
+		for _, l := range []byte(side) {
+			cnt[strings.IndexByte(" PNBRQK", l)+8*i]++
+		}
+	}
+	for _, pc := range d.pieces[:t.pieceCount] {
+		cnt[pc]--
+	}
+	return cnt == [16]int{}
+}
+
+// groups of pieces encoded together: leading group (pawns or 2-3 pieces),
+// then pieces of the same type and color, order of groups is given by file
+func (t *table) setGroups(d *pairsData, order [2]int, f int) {
+	firstLen := 2
+	if t.hasPawns {
+		firstLen = 0
+	} else if t.hasUniquePieces {
+		firstLen = 3
+	}
+	n := 0
+	d.groupLen[n] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	if pp {
+		next = 2
+	}
+	free := 64 - d.groupLen[0]
+	if pp {
+		free -= d.groupLen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch {
+		case k == order[0]:
+			d.groupIdx[0] = idx
+			switch {
+			case t.hasPawns:
+				idx *= leadPawnsSize[d.groupLen[0]][f]
+			case t.hasUniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case k == order[1]:
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default:
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][free]
+			free -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+}
+
+func (t *table) setSizes(d *pairsData, p int) (int, error) {
+	if err := t.need(p + 2); err != nil {
+		return p, err
+	}
+	d.flags = t.head[p]
+	p++
+	if d.flags&flagSingleValue != 0 {
+		d.minSymLen = int(t.head[p])
+		return p + 1, nil
+	}
+	if err := t.need(p + 9); err != nil {
+		return p, err
+	}
+	data := t.head
+
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	tbSize := d.groupIdx[n]
+
+	if data[p] > 30 || data[p+1] > 62 || data[p+8] > data[p+7] || data[p+7] > 64 {
+		return p, errCorrupted
+	}
+	d.blockSize = 1 << data[p]
+	d.span = 1 << data[p+1]
+	d.sparseIndexSize = int((tbSize + d.span - 1) / d.span)
+	padding := int(data[p+2])
+	d.numBlocks = int(binary.LittleEndian.Uint32(data[p+3:]))
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen = int(data[p+7])
+	d.minSymLen = int(data[p+8])
+	p += 9
+	d.lowestSym = p
+	if err := t.need(p + 2*(d.maxSymLen-d.minSymLen+1) + 2); err != nil {
+		return p, err
+	}
+
+	// base64[l] is the lowest symbol of length l+minSymLen padded to 64 bits
+	d.base64 = make([]uint64, d.maxSymLen-d.minSymLen+1)
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(t.lowest(d, i)) - uint64(t.lowest(d, i+1))) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= 64 - i - d.minSymLen
+	}
+	p += len(d.base64) * 2
+
+	d.symlen = make([]uint8, binary.LittleEndian.Uint16(t.head[p:]))
+	p += 2
+	d.btree = p
+	if err := t.need(p + len(d.symlen)*3); err != nil {
+		return p, err
+	}
+	for s := range d.symlen {
+		if r := t.right(d, s); r != 0xFFF && (r >= len(d.symlen) || t.left(d, s) >= len(d.symlen)) {
+			return p, errCorrupted
+		}
+	}
+	visited := make([]bool, len(d.symlen))
+	for s := range d.symlen {
+		if !visited[s] {
+			d.symlen[s] = t.setSymlen(d, s, visited)
+		}
+	}
+	return p + len(d.symlen)*3 + len(d.symlen)&1, nil
+}
+
+// number of values (-1) of symbol
+func (t *table) setSymlen(d *pairsData, s int, visited []bool) uint8 {
+	visited[s] = true
+	sr := t.right(d, s)
+	if sr == 0xFFF {
+		return 0
+	}
+	sl := t.left(d, s)
+	if !visited[sl] {
+		d.symlen[sl] = t.setSymlen(d, sl, visited)
+	}
+	if !visited[sr] {
+		d.symlen[sr] = t.setSymlen(d, sr, visited)
+	}
+	return d.symlen[sl] + d.symlen[sr] + 1
+}
+
+// dtz values are remapped by frequency for every wdl result
+func (t *table) setDTZMap(p, maxFile int) (int, error) {
+	t.mapOff = p
+	for f := 0; f <= maxFile; f++ {
+		d := t.get(0, f)
+		if d.flags&flagMapped == 0 {
+			continue
+		}
+		if d.flags&flagWide != 0 {
+			p += p & 1
+			for i := 0; i < 4; i++ {
+				if err := t.need(p + 2); err != nil {
+					return p, err
+				}
+				d.mapIdx[i] = (p-t.mapOff)/2 + 1
+				p += 2*int(binary.LittleEndian.Uint16(t.head[p:])) + 2
+			}
+		} else {
+			for i := 0; i < 4; i++ {
+				if err := t.need(p + 1); err != nil {
+					return p, err
+				}
+				d.mapIdx[i] = p - t.mapOff + 1
+				p += int(t.head[p]) + 1
+			}
+		}
+	}
+	// maps are read on probe
+	return p + p&1, t.need(p)
+}
+
+func (t *table) lowest(d *pairsData, l int) int {
+	return int(binary.LittleEndian.Uint16(t.head[d.lowestSym+2*l:]))
+}
+
+// btree entry: 12 bits of left symbol, 12 bits of right symbol
+func (t *table) left(d *pairsData, s int) int {
+	lr := t.head[d.btree+3*s:]
+	return int(lr[1]&0xF)<<8 | int(lr[0])
+}
+
+func (t *table) right(d *pairsData, s int) int {
+	lr := t.head[d.btree+3*s:]
+	return int(lr[2])<<4 | int(lr[1]>>4)
+}
+
+// number of values (-1) of block
+func (t *table) blockLen(d *pairsData, block int) (int, error) {
+	if block < 0 || block >= d.blockLengthSize {
+		return 0, errCorrupted
+	}
+	var buf [2]byte
+	if err := t.read(d.blockLength+2*block, buf[:]); err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint16(buf[:])), nil
+}
+
+// big-endian 32 bits of block, zeros after its end
+func be32(data []byte, p int) uint32 {
+	if p+4 <= len(data) {
+		return binary.BigEndian.Uint32(data[p:])
+	}
+	var buf [4]byte
+	if p < len(data) {
+		copy(buf[:], data[p:])
+	}
+	return binary.BigEndian.Uint32(buf[:])
+}
+
+// value of index
+func (t *table) decompress(d *pairsData, idx uint64) (int, error) {
+	if d.flags&flagSingleValue != 0 {
+		return d.minSymLen, nil
+	}
+
+	// sparse entry k points to value k*span + span/2: block and offset in it
+	k := idx / d.span
+	if k >= uint64(d.sparseIndexSize) {
+		return 0, errCorrupted
+	}
+	var se [6]byte
+	if err := t.read(d.sparseIndex+6*int(k), se[:]); err != nil {
+		return 0, err
+	}
+	block := int(binary.LittleEndian.Uint32(se[:]))
+	offset := int(binary.LittleEndian.Uint16(se[4:]))
+	offset += int(idx%d.span) - int(d.span/2)
+	for offset < 0 {
+		block--
+		n, err := t.blockLen(d, block)
+		if err != nil {
+			return 0, err
+		}
+		offset += n + 1
+	}
+	for {
+		n, err := t.blockLen(d, block)
+		if err != nil {
+			return 0, err
+		}
+		if offset <= n {
+			break
+		}
+		offset -= n + 1
+		block++
+	}
+
+	// symbols of block
+	if block >= d.numBlocks {
+		return 0, errCorrupted
+	}
+	data := make([]byte, d.blockSize)
+	if err := t.read(d.data+block*d.blockSize, data); err != nil {
+		return 0, err
+	}
+	buf := uint64(be32(data, 0))<<32 | uint64(be32(data, 4))
+	ptr := 8
+	bufSize := 64
+	var sym int
+	for {
+		l := 0
+		for l < len(d.base64) && buf < d.base64[l] {
+			l++
+		}
+		if l == len(d.base64) {
+			return 0, errCorrupted
+		}
+		sym = int((buf-d.base64[l])>>(64-l-d.minSymLen)) + t.lowest(d, l)
+		if sym >= len(d.symlen) {
+			return 0, errCorrupted
+		}
+		if offset < int(d.symlen[sym])+1 {
+			break
+		}
+		offset -= int(d.symlen[sym]) + 1
+		l += d.minSymLen
+		buf <<= l
+		bufSize -= l
+		if bufSize <= 32 {
+			bufSize += 32
+			buf |= uint64(be32(data, ptr)) << (64 - bufSize)
+			ptr += 4
+		}
+	}
+
+	// expand pairs to the value
+	for d.symlen[sym] != 0 {
+		left := t.left(d, sym)
+		if offset < int(d.symlen[left])+1 {
+			sym = left
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			sym = t.right(d, sym)
+		}
+	}
+	return t.left(d, sym), nil
+}
@@ -0,0 +1,602 @@
+package syzygy
+
+import (
+	"errors"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// --------------------------------------------------
+// Syzygy endgame tablebases
+// --------------------------------------------------
+// WDL tables (.rtbw) give result of position, DTZ tables (.rtbz) give
+// distance to zeroing move (capture or pawn move) under 50-move rule.
+// Positions with castling rights are not in tables.
+
+// result of position for side to move
+type WDL int
+
+const (
+	Loss        WDL = -2
+	BlessedLoss WDL = -1 // loss, but draw by 50-move rule
+	Draw        WDL = 0
+	CursedWin   WDL = 1 // win, but draw by 50-move rule
+	Win         WDL = 2
+)
+
+func (w WDL) String() string {
+	switch w {
+	case Loss:
+		return "loss"
+	case BlessedLoss:
+		return "blessed loss"
+	case CursedWin:
+		return "cursed win"
+	case Win:
+		return "win"
+	}
+	return "draw"
+}
+
+var (
+	ErrNoTables = errors.New("no tablebase files")
+	ErrNotFound = errors.New("position is not in tablebase")
+)
+
+type probeState int
+
+const (
+	stateOK probeState = iota
+	stateFail
+	stateZeroingBest // best move is zeroing, dtz of table is not valid
+	stateChangeSTM   // dtz table stores other side to move
+)
+
+type Tablebase struct {
+	paths     []string
+	wdl       map[string]*table // by material of both colors
+	dtz       map[string]*table
+	maxPieces int
+}
+
+// open tables of directories, paths are separated by os.PathListSeparator
+// (as SyzygyPath option of UCI engines)
+func Open(paths string) (*Tablebase, error) {
+	tb := &Tablebase{wdl: make(map[string]*table), dtz: make(map[string]*table)}
+	for _, dir := range filepath.SplitList(paths) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		tb.paths = append(tb.paths, dir)
+		for _, en := range entries {
+			name := en.Name()
+			ext := filepath.Ext(name)
+			if en.IsDir() || (ext != ".rtbw" && ext != ".rtbz") {
+				continue
+			}
+			code := strings.TrimSuffix(name, ext)
+			if !validName(code) {
+				continue
+			}
+			tables := tb.wdl
+			if ext == ".rtbz" {
+				tables = tb.dtz
+			}
+			if _, ok := tables[code]; ok {
+				continue // first directory wins
+			}
+			t := newTable(code, filepath.Join(dir, name), ext == ".rtbz")
+			tables[t.key], tables[t.key2] = t, t
+			if ext == ".rtbw" {
+				tb.maxPieces = max(tb.maxPieces, t.pieceCount)
+			}
+		}
+	}
+	if tb.maxPieces == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoTables, paths)
+	}
+	return tb, nil
+}
+
+func (tb *Tablebase) Paths() string { return strings.Join(tb.paths, string(os.PathListSeparator)) }
+
+// max pieces of WDL tables
+func (tb *Tablebase) MaxPieces() int { return tb.maxPieces }
+
+// count of WDL and DTZ tables
+func (tb *Tablebase) Tables() (wdl, dtz int) {
+	count := func(m map[string]*table) int {
+		n := 0
+		for k, t := range m {
+			if k == t.key {
+				n++
+			}
+		}
+		return n
+	}
+	return count(tb.wdl), count(tb.dtz)
+}
+
+// position can be probed: pieces count and no castling rights
+func (tb *Tablebase) Covers(b *base.Board) bool {
+	c := b.Casting
+	return tb != nil && pieceCount(b) <= tb.maxPieces && !c.WK && !c.WQ && !c.BK && !c.BQ
+}
+
+// --------------------------------------------------
+// probe of table
+// --------------------------------------------------
+
+// raw value of table: wdl (WDL table) or dtz in plies (DTZ table)
+func (tb *Tablebase) probeTable(b *base.Board, dtz bool, wdl WDL) (int, probeState) {
+	if pieceCount(b) == 2 {
+		return 0, stateOK // KvK
+	}
+	tables := tb.wdl
+	if dtz {
+		tables = tb.dtz
+	}
+	key := materialKey(b)
+	t := tables[key]
+	if t == nil || t.load() != nil {
+		return 0, stateFail
+	}
+	return t.probe(b, key, wdl)
+}
+
+func (t *table) probe(b *base.Board, key string, wdl WDL) (int, probeState) {
+	d, tbFile, idx, st := t.encode(b, key)
+	if st != stateOK {
+		return 0, st
+	}
+	v, err := t.decompress(d, idx)
+	if err != nil {
+		return 0, stateFail
+	}
+	if !t.dtz {
+		return v - 2, stateOK
+	}
+	if v, ok := t.mapDTZ(tbFile, v, wdl); ok {
+		return v, stateOK
+	}
+	return 0, stateFail
+}
+
+// index of position in table
+func (t *table) encode(b *base.Board, key string) (*pairsData, int, uint64, probeState) {
+	side := 0
+	if !b.WhiteToMove {
+		side = 1
+	}
+	// tables are for white as stronger side and (symmetric material) white to move,
+	// otherwise colors are swapped and board is flipped vertically
+	flip := (t.key == t.key2 && side == 1) || key != t.key
+	flipColor, flipSquares, stm := 0, 0, side
+	if flip {
+		flipColor, flipSquares, stm = 8, 070, side^1
+	}
+
+	var squares, pieces [MaxPieces]int
+	size, leadCnt, tbFile := 0, 0, 0
+	var lead [64]bool
+
+	// leading pawns (color of the first piece of table)
+	if t.hasPawns {
+		pc := t.get(0, 0).pieces[0] ^ flipColor
+		for sq := 0; sq < 64; sq++ {
+			if pieceCode(b.Mailbox[sq]) == pc {
+				squares[size] = sq ^ flipSquares
+				size++
+				lead[sq] = true
+			}
+		}
+		leadCnt = size
+		best := 0
+		for i := 1; i < leadCnt; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[best]] {
+				best = i
+			}
+		}
+		squares[0], squares[best] = squares[best], squares[0]
+		tbFile = fileOf(squares[0])
+		if tbFile > 3 {
+			tbFile = fileOf(squares[0] ^ 7)
+		}
+	}
+
+	// dtz table stores only one side to move
+	if t.dtz {
+		if flags := t.get(stm, tbFile).flags; int(flags&flagSTM) != stm && !(t.key == t.key2 && !t.hasPawns) {
+			return nil, 0, 0, stateChangeSTM
+		}
+	}
+
+	for sq := 0; sq < 64; sq++ {
+		if b.Mailbox[sq] == base.EmptyPiece || lead[sq] {
+			continue
+		}
+		squares[size] = sq ^ flipSquares
+		pieces[size] = pieceCode(b.Mailbox[sq]) ^ flipColor
+		size++
+	}
+
+	d := t.get(stm, tbFile)
+
+	// order of pieces as in table
+	for i := leadCnt; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// leading piece to files a-d
+	if fileOf(squares[0]) > 3 {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+
+	var idx uint64
+	if t.hasPawns {
+		idx = leadPawnIdx[leadCnt][squares[0]]
+		rest := squares[1:leadCnt]
+		sort.SliceStable(rest, func(i, j int) bool { return mapPawns[rest[i]] < mapPawns[rest[j]] })
+		for i := 1; i < leadCnt; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		// leading piece to ranks 1-4
+		if rankOf(squares[0]) > 3 {
+			for i := 0; i < size; i++ {
+				squares[i] ^= 070
+			}
+		}
+		// the first piece of leading group not on a1-h8 diagonal is below it
+		for i := 0; i < d.groupLen[0]; i++ {
+			if offA1H8(squares[i]) == 0 {
+				continue
+			}
+			if offA1H8(squares[i]) > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+				}
+			}
+			break
+		}
+
+		if t.hasUniquePieces {
+			adjust1, adjust2 := 0, 0
+			if squares[1] > squares[0] {
+				adjust1 = 1
+			}
+			if squares[2] > squares[0] {
+				adjust2++
+			}
+			if squares[2] > squares[1] {
+				adjust2++
+			}
+			switch {
+			case offA1H8(squares[0]) != 0:
+				idx = uint64((mapA1D1D4[squares[0]]*63+(squares[1]-adjust1))*62 + squares[2] - adjust2)
+			case offA1H8(squares[1]) != 0:
+				idx = uint64((6*63+rankOf(squares[0])*28+mapB1H1H7[squares[1]])*62 + squares[2] - adjust2)
+			case offA1H8(squares[2]) != 0:
+				idx = uint64(6*63*62 + 4*28*62 + rankOf(squares[0])*7*28 + (rankOf(squares[1])-adjust1)*28 + mapB1H1H7[squares[2]])
+			default:
+				idx = uint64(6*63*62 + 4*28*62 + 4*7*28 + rankOf(squares[0])*7*6 + (rankOf(squares[1])-adjust1)*6 + (rankOf(squares[2]) - adjust2))
+			}
+		} else {
+			idx = uint64(mapKK[mapA1D1D4[squares[0]]][squares[1]])
+		}
+	}
+
+	// remaining groups: squares in ascending order without squares of previous groups
+	idx *= d.groupIdx[0]
+	g := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[g : g+d.groupLen[next]]
+		slices.Sort(group)
+		var n uint64
+		for i, sq := range group {
+			adjust := 0
+			for _, s := range squares[:g] {
+				if sq > s {
+					adjust++
+				}
+			}
+			pawnRanks := 0
+			if remainingPawns {
+				pawnRanks = 8
+			}
+			n += binomial[i+1][sq-adjust-pawnRanks]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		g += d.groupLen[next]
+	}
+
+	return d, tbFile, idx, stateOK
+}
+
+// dtz of table value in plies, false if map is out of header
+func (t *table) mapDTZ(f, v int, wdl WDL) (int, bool) {
+	d := t.get(0, f)
+	if d.flags&flagMapped != 0 {
+		m := d.mapIdx[[5]int{1, 3, 0, 2, 0}[wdl+2]]
+		if d.flags&flagWide != 0 {
+			p := t.mapOff + 2*(m+v)
+			if p+2 > len(t.head) {
+				return 0, false
+			}
+			v = int(t.head[p]) | int(t.head[p+1])<<8
+		} else {
+			p := t.mapOff + m + v
+			if p >= len(t.head) {
+				return 0, false
+			}
+			v = int(t.head[p])
+		}
+	}
+	if (wdl == Win && d.flags&flagWinPlies == 0) || (wdl == Loss && d.flags&flagLossPlies == 0) ||
+		wdl == CursedWin || wdl == BlessedLoss {
+		v *= 2
+	}
+	return v + 1, true
+}
+
+// --------------------------------------------------
+// probe of position
+// --------------------------------------------------
+// tables may store any value for positions with winning (drawing) capture,
+// so captures (and pawn moves for DTZ) are searched before the table
+
+func isZeroing(b *base.Board, mv base.Move) bool {
+	p := b.Mailbox[base.ConvPointToIndex(mv.From)]
+	return p == base.WPawn || p == base.BPawn || b.Mailbox[base.ConvPointToIndex(mv.To)] != base.EmptyPiece
+}
+
+func isCapture(b *base.Board, mv base.Move) bool {
+	p := b.Mailbox[base.ConvPointToIndex(mv.From)]
+	return b.Mailbox[base.ConvPointToIndex(mv.To)] != base.EmptyPiece ||
+		((p == base.WPawn || p == base.BPawn) && mv.From.W != mv.To.W)
+}
+
+func (tb *Tablebase) search(b *base.Board, pawnMoves bool) (WDL, probeState) {
+	best := Loss
+	legal := moves.GenerateLegalMoves(b)
+	searched := 0
+	for _, mv := range legal {
+		if !isCapture(b, mv) && (!pawnMoves || !isZeroing(b, mv)) {
+			continue
+		}
+		searched++
+		nb := moves.CloneBoard(b)
+		_ = moves.ApplyMove(nb, mv)
+		v, st := tb.search(nb, false)
+		if st == stateFail {
+			return Draw, stateFail
+		}
+		if -v > best {
+			best = -v
+			if best >= Win {
+				return best, stateZeroingBest
+			}
+		}
+	}
+
+	// all moves are searched: table value is not needed (may be wrong with en passant)
+	noMoreMoves := searched > 0 && searched == len(legal)
+	var v WDL
+	if noMoreMoves {
+		v = best
+	} else {
+		raw, st := tb.probeTable(b, false, Draw)
+		if st == stateFail {
+			return Draw, stateFail
+		}
+		v = WDL(raw)
+	}
+	if best >= v {
+		if best > Draw || noMoreMoves {
+			return best, stateZeroingBest
+		}
+		return best, stateOK
+	}
+	return v, stateOK
+}
+
+// result of position for side to move
+func (tb *Tablebase) ProbeWDL(b *base.Board) (WDL, error) {
+	if !tb.Covers(b) {
+		return Draw, ErrNotFound
+	}
+	v, st := tb.search(b, false)
+	if st == stateFail {
+		return Draw, ErrNotFound
+	}
+	return v, nil
+}
+
+// dtz of the move before zeroing move
+func dtzBeforeZeroing(wdl WDL) int {
+	switch wdl {
+	case Win:
+		return 1
+	case CursedWin:
+		return 101
+	case BlessedLoss:
+		return -101
+	case Loss:
+		return -1
+	}
+	return 0
+}
+
+func sign(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// distance to zeroing move in plies for side to move (with 50-move counter 0):
+// n > 0 - win, n < 0 - loss, |n| > 100 - cursed win or blessed loss, 0 - draw,
+// -1 - side to move is mated; value can be 1 ply more than exact
+func (tb *Tablebase) ProbeDTZ(b *base.Board) (int, error) {
+	if !tb.Covers(b) {
+		return 0, ErrNotFound
+	}
+	dtz, st := tb.probeDTZ(b)
+	if st == stateFail {
+		return 0, ErrNotFound
+	}
+	return dtz, nil
+}
+
+func (tb *Tablebase) probeDTZ(b *base.Board) (int, probeState) {
+	wdl, st := tb.search(b, true)
+	if st == stateFail || wdl == Draw {
+		return 0, st
+	}
+	if st == stateZeroingBest {
+		return dtzBeforeZeroing(wdl), stateOK
+	}
+	dtz, st := tb.probeTable(b, true, wdl)
+	if st == stateFail {
+		return 0, stateFail
+	}
+	if st != stateChangeSTM {
+		if wdl == BlessedLoss || wdl == CursedWin {
+			dtz += 100
+		}
+		return dtz * sign(int(wdl)), stateOK
+	}
+
+	// table of other side to move: minimal dtz of moves
+	minDTZ := 0xFFFF
+	for _, mv := range moves.GenerateLegalMoves(b) {
+		zeroing := isZeroing(b, mv)
+		nb := moves.CloneBoard(b)
+		_ = moves.ApplyMove(nb, mv)
+		var v int
+		if zeroing {
+			w, st := tb.search(nb, false)
+			if st == stateFail {
+				return 0, stateFail
+			}
+			v = -dtzBeforeZeroing(w)
+		} else {
+			d, st := tb.probeDTZ(nb)
+			if st == stateFail {
+				return 0, stateFail
+			}
+			v = -d
+		}
+		if v == 1 && rules.GameStatusOf(nb) == base.Checkmate {
+			minDTZ = 1
+		}
+		if !zeroing {
+			v += sign(v)
+		}
+		if v < minDTZ && sign(v) == sign(int(wdl)) {
+			minDTZ = v
+		}
+	}
+	if minDTZ == 0xFFFF {
+		return -1, stateOK
+	}
+	return minDTZ, stateOK
+}
+
+// --------------------------------------------------
+// root
+// --------------------------------------------------
+
+// legal move of root position with result after it (for side to move of root)
+type RootMove struct {
+	Move base.Move
+	WDL  WDL // with 50-move counter of position
+	DTZ  int // plies to zeroing move, counting from root
+}
+
+// all legal moves of position, better moves first:
+// wins by fastest zeroing, draws, losses by slowest zeroing
+func (tb *Tablebase) ProbeRoot(b *base.Board) ([]RootMove, error) {
+	if !tb.Covers(b) {
+		return nil, ErrNotFound
+	}
+	legal := moves.GenerateLegalMoves(b)
+	if len(legal) == 0 {
+		return nil, ErrNotFound
+	}
+	out := make([]RootMove, 0, len(legal))
+	for _, mv := range legal {
+		nb := moves.CloneBoard(b)
+		_ = moves.ApplyMove(nb, mv)
+		var dtz int
+		if isZeroing(b, mv) {
+			w, err := tb.ProbeWDL(nb)
+			if err != nil {
+				return nil, err
+			}
+			dtz = dtzBeforeZeroing(-w)
+		} else {
+			d, err := tb.ProbeDTZ(nb)
+			if err != nil {
+				return nil, err
+			}
+			dtz = -d
+			dtz += sign(dtz)
+		}
+		if dtz == 2 && rules.GameStatusOf(nb) == base.Checkmate {
+			dtz = 1
+		}
+		out = append(out, RootMove{Move: mv, DTZ: dtz, WDL: dtzToWDL(dtz, b.Halfmove)})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return rootRank(out[i]) > rootRank(out[j]) })
+	return out, nil
+}
+
+// result of move by dtz and 50-move counter
+func dtzToWDL(dtz, halfmove int) WDL {
+	switch {
+	case dtz > 0 && dtz+halfmove <= 100:
+		return Win
+	case dtz > 0:
+		return CursedWin
+	case dtz < 0 && -dtz+halfmove <= 100:
+		return Loss
+	case dtz < 0:
+		return BlessedLoss
+	}
+	return Draw
+}
+
+func rootRank(m RootMove) int {
+	switch {
+	case m.DTZ > 0:
+		return 2000 - m.DTZ
+	case m.DTZ < 0:
+		return -2000 - m.DTZ
+	}
+	return 0
+}
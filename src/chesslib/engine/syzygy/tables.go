@@ -0,0 +1,210 @@
+package syzygy
+
+import (
+	"evilchess/src/chesslib/base"
+	"strings"
+)
+
+// --------------------------------------------------
+// Index tables of Syzygy encoding
+// --------------------------------------------------
+// squares are numbered a1=0 ... h8=63 (the same as base.ConvPointToIndex),
+// pieces are coded as in table files: white 1..6 (P N B R Q K), black 9..14
+
+const MaxPieces = 7
+
+var (
+	mapPawns      [64]int     // a2-h7 to 0..47, the leading pawn has the highest value
+	mapB1H1H7     [64]int     // squares below a1-h8 diagonal to 0..27
+	mapA1D1D4     [64]int     // triangle a1-d1-d4 to 0..9 (diagonal last)
+	mapKK         [10][64]int // 462 legal placements of two kings
+	binomial      [MaxPieces][64]uint64
+	leadPawnIdx   [MaxPieces][64]uint64
+	leadPawnsSize [MaxPieces][4]uint64
+)
+
+func rankOf(sq int) int  { return sq >> 3 }
+func fileOf(sq int) int  { return sq & 7 }
+func offA1H8(sq int) int { return rankOf(sq) - fileOf(sq) }
+
+func init() {
+	code := 0
+	for s := 0; s < 64; s++ {
+		if offA1H8(s) < 0 {
+			mapB1H1H7[s] = code
+			code++
+		}
+	}
+
+	var diagonal []int
+	code = 0
+	for s := 0; s <= 27; s++ { // a1..d4
+		if offA1H8(s) < 0 && fileOf(s) <= 3 {
+			mapA1D1D4[s] = code
+			code++
+		} else if offA1H8(s) == 0 && fileOf(s) <= 3 {
+			diagonal = append(diagonal, s)
+		}
+	}
+	for _, s := range diagonal {
+		mapA1D1D4[s] = code
+		code++
+	}
+
+	// first king in a1-d1-d4, if it is on diagonal the second is not above it
+	type kk struct{ idx, sq int }
+	var bothOnDiagonal []kk
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for s1 := 0; s1 <= 27; s1++ {
+			if mapA1D1D4[s1] != idx || (idx == 0 && s1 != 1) { // b1 is mapped to 0
+				continue
+			}
+			for s2 := 0; s2 < 64; s2++ {
+				switch {
+				case abs(rankOf(s1)-rankOf(s2)) <= 1 && abs(fileOf(s1)-fileOf(s2)) <= 1:
+					// illegal
+				case offA1H8(s1) == 0 && offA1H8(s2) > 0:
+				case offA1H8(s1) == 0 && offA1H8(s2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, kk{idx, s2})
+				default:
+					mapKK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		mapKK[p.idx][p.sq] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < MaxPieces-1 && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+	for cnt := 1; cnt < MaxPieces-1; cnt++ {
+		for f := 0; f < 4; f++ {
+			var idx uint64
+			for r := 1; r <= 6; r++ {
+				sq := r*8 + f
+				if cnt == 1 {
+					mapPawns[sq] = available
+					available--
+					mapPawns[sq^7] = available
+					available--
+				}
+				leadPawnIdx[cnt][sq] = idx
+				idx += binomial[cnt-1][mapPawns[sq]]
+			}
+			leadPawnsSize[cnt][f] = idx
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// --------------------------------------------------
+// pieces and material
+// --------------------------------------------------
+
+// piece code of table files, 0 - empty square
+func pieceCode(p base.Piece) int {
+	switch p {
+	case base.WPawn:
+		return 1
+	case base.WKnight:
+		return 2
+	case base.WBishop:
+		return 3
+	case base.WRook:
+		return 4
+	case base.WQueen:
+		return 5
+	case base.WKing:
+		return 6
+	case base.BPawn:
+		return 9
+	case base.BKnight:
+		return 10
+	case base.BBishop:
+		return 11
+	case base.BRook:
+		return 12
+	case base.BQueen:
+		return 13
+	case base.BKing:
+		return 14
+	}
+	return 0
+}
+
+// letters of piece codes in order of table names
+const pieceOrder = "KQRBNP"
+
+// material of position as table name: white pieces, "v", black pieces (KRPvKR)
+func materialKey(b *base.Board) string {
+	var cnt [16]int
+	for _, p := range b.Mailbox {
+		cnt[pieceCode(p)]++
+	}
+	var w, bl strings.Builder
+	for _, l := range []byte(pieceOrder) {
+		c := strings.IndexByte(" PNBRQK", l)
+		w.WriteString(strings.Repeat(string(l), cnt[c]))
+		bl.WriteString(strings.Repeat(string(l), cnt[c+8]))
+	}
+	return w.String() + "v" + bl.String()
+}
+
+func pieceCount(b *base.Board) int {
+	n := 0
+	for _, p := range b.Mailbox {
+		if p != base.EmptyPiece {
+			n++
+		}
+	}
+	return n
+}
+
+// the same material with swapped colors (KRvK -> KvKR)
+func swapKey(key string) string {
+	w, b, _ := strings.Cut(key, "v")
+	return b + "v" + w
+}
+
+// table name is valid: both sides have one king, pieces are ordered
+func validName(name string) bool {
+	w, b, ok := strings.Cut(name, "v")
+	if !ok || len(w)+len(b) > MaxPieces || len(w)+len(b) < 3 {
+		return false
+	}
+	for _, side := range []string{w, b} {
+		if len(side) == 0 || side[0] != 'K' {
+			return false
+		}
+		last := 0
+		for i := 1; i < len(side); i++ {
+			o := strings.IndexByte(pieceOrder, side[i])
+			if o <= 0 || o < last {
+				return false
+			}
+			last = o
+		}
+	}
+	return true
+}
@@ -0,0 +1,433 @@
+package uci
+
+import (
+	"bufio"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------
+// UCI server: engine.Engine speaks UCI on stdin/stdout
+// --------------------------------------------------
+// so builds of EvilEngine can be run by UCIExecutor (matches, SPRT) or by other GUIs
+
+const (
+	// reserve of clock for answer
+	serverMoveOverhead = 50 * time.Millisecond
+)
+
+type UCIServer struct {
+	name   string
+	author string
+	eng    engine.Engine
+
+	outMu sync.Mutex
+	out   io.Writer
+
+	mu      sync.Mutex
+	board   *base.Board
+	threads int
+	multiPV int
+	running bool
+	ponder  bool          // current search is "go ponder"
+	hit     chan struct{} // closed on ponderhit
+	halt    chan struct{} // closed on stop
+	done    chan struct{} // closed after bestmove
+	unsub   func()
+}
+
+// engine with switchable search heuristics gets option Features
+// (e.g. "nolmr,nopvs" - disabled ones)
+type FeatureSwitcher interface {
+	SetFeatureList(list string) error
+}
+
+func NewUCIServer(e engine.Engine, name, author string) *UCIServer {
+	return &UCIServer{name: name, author: author, eng: e, threads: 1, multiPV: 1}
+}
+
+func (s *UCIServer) send(format string, args ...any) {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
+
+// read commands until "quit" or end of input
+func (s *UCIServer) Run(in io.Reader, out io.Writer) error {
+	s.out = out
+	if err := s.eng.Init(); err != nil {
+		return err
+	}
+	defer s.eng.Close()
+	b, _ := convfen.ConvertFENToBoard(base.FEN_START_GAME)
+	s.board = b
+
+	// banner: UCIExecutor waits for the first line
+	s.send("%s by %s", s.name, s.author)
+	sc := bufio.NewScanner(in)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			s.send("id name %s", s.name)
+			s.send("id author %s", s.author)
+			s.send("option name Threads type spin default 1 min 1 max 64")
+			s.send("option name MultiPV type spin default 1 min 1 max 10")
+			s.send("option name Ponder type check default false")
+			if _, ok := s.eng.(FeatureSwitcher); ok {
+				s.send("option name Features type string default <empty>")
+			}
+			s.send("uciok")
+		case "isready":
+			s.send("readyok")
+		case "setoption":
+			s.setOption(fields[1:])
+		case "ucinewgame":
+			s.stop()
+		case "position":
+			if err := s.position(fields[1:]); err != nil {
+				s.send("info string error position: %v", err)
+			}
+		case "go":
+			if err := s.goSearch(fields[1:]); err != nil {
+				s.send("info string error go: %v", err)
+			}
+		case "stop":
+			s.stop()
+		case "ponderhit":
+			s.ponderHit()
+		case "quit":
+			s.stop()
+			return nil
+		}
+	}
+	s.stop()
+	return sc.Err()
+}
+
+// setoption name <name> value <value>
+func (s *UCIServer) setOption(args []string) {
+	var name, value []string
+	cur := &name
+	for _, a := range args {
+		switch a {
+		case "name":
+			cur = &name
+		case "value":
+			cur = &value
+		default:
+			*cur = append(*cur, a)
+		}
+	}
+	n, _ := strconv.Atoi(strings.Join(value, " "))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "threads":
+		s.threads = max(n, 1)
+	case "multipv":
+		s.multiPV = max(n, 1)
+	case "features":
+		fs, ok := s.eng.(FeatureSwitcher)
+		if !ok {
+			return
+		}
+		list := strings.Join(value, " ")
+		if list == "<empty>" {
+			list = ""
+		}
+		if err := fs.SetFeatureList(list); err != nil {
+			s.send("info string error option: %v", err)
+		}
+	}
+}
+
+// position startpos|fen <fen> [moves ...]
+func (s *UCIServer) position(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no position")
+	}
+	fen := base.FEN_START_GAME
+	rest := args[1:]
+	if args[0] == "fen" {
+		end := len(args)
+		for i, a := range args {
+			if a == "moves" {
+				end = i
+				break
+			}
+		}
+		fen, rest = strings.Join(args[1:end], " "), args[end:]
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 && rest[0] == "moves" {
+		for _, u := range rest[1:] {
+			mv, err := moves.UCIToMove(b, u)
+			if err != nil {
+				return fmt.Errorf("move %s: %v", u, err)
+			}
+			if err := moves.ApplyMove(b, mv); err != nil {
+				return fmt.Errorf("move %s: %v", u, err)
+			}
+		}
+	}
+	s.stop()
+	s.mu.Lock()
+	s.board = b
+	s.mu.Unlock()
+	return nil
+}
+
+// go [ponder] [infinite] [depth N] [movetime MS] [wtime MS btime MS winc MS binc MS movestogo N]
+func (s *UCIServer) goSearch(args []string) error {
+	s.stop()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	params := engine.SearchParams{Threads: s.threads, MultiPV: s.multiPV}
+	var tc [2]int64 // time, increment of side to move
+	toGo := 0
+	for i := 0; i < len(args); i++ {
+		num := func() int64 {
+			if i+1 >= len(args) {
+				return 0
+			}
+			i++
+			n, _ := strconv.ParseInt(args[i], 10, 64)
+			return n
+		}
+		switch args[i] {
+		case "ponder":
+			params.Ponder = true
+		case "infinite":
+			params.Infinite = true
+		case "depth":
+			params.MaxDepth = int(num())
+		case "movetime":
+			params.MaxTimeMs = num()
+		case "movestogo":
+			toGo = int(num())
+		case "wtime", "btime", "winc", "binc":
+			key, n := args[i], num()
+			if (key[0] == 'w') == s.board.WhiteToMove {
+				if strings.HasSuffix(key, "time") {
+					tc[0] = n
+				} else {
+					tc[1] = n
+				}
+			}
+		}
+	}
+	if params.MaxTimeMs == 0 && tc[0] > 0 {
+		alloc := clock.Allocate(time.Duration(tc[0])*time.Millisecond, time.Duration(tc[1])*time.Millisecond, toGo, serverMoveOverhead)
+		params.MaxTimeMs = alloc.Milliseconds()
+	}
+
+	if err := s.eng.SetPosition(moves.CloneBoard(s.board)); err != nil {
+		return err
+	}
+	ch := make(chan engine.AnalysisInfo, 16)
+	s.unsub = s.eng.Subscribe(ch)
+	if err := s.eng.StartAnalysis(params); err != nil {
+		s.unsub()
+		return err
+	}
+	var moveTime time.Duration // applied after ponderhit
+	if !params.Infinite && params.MaxTimeMs > 0 {
+		moveTime = time.Duration(params.MaxTimeMs) * time.Millisecond
+	}
+	s.running = true
+	s.ponder = params.Ponder
+	s.hit = make(chan struct{})
+	s.halt = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.search(moves.CloneBoard(s.board), ch, s.hit, s.halt, s.done, params, moveTime)
+	return nil
+}
+
+// info lines and bestmove of one search,
+// bestmove of "go infinite" and "go ponder" waits for stop (ponderhit)
+// even if search is finished before
+func (s *UCIServer) search(b *base.Board, ch chan engine.AnalysisInfo, hit, halt, done chan struct{}, params engine.SearchParams, moveTime time.Duration) {
+	defer close(done)
+	finished := make(chan struct{})
+	go func() {
+		s.eng.WaitDone()
+		close(finished)
+	}()
+	ponder, stopped := params.Ponder, false
+	if !ponder {
+		hit = nil
+	}
+
+	// engine checks time between iterations only: search is stopped by timer
+	var timer <-chan time.Time
+	startTimer := func() {
+		if moveTime > 0 {
+			timer = time.After(moveTime)
+		}
+	}
+	if !ponder {
+		startTimer()
+	}
+loop:
+	for {
+		select {
+		case info := <-ch:
+			s.sendInfo(b, info)
+		case <-hit:
+			hit = nil
+			startTimer()
+			if finished == nil && !params.Infinite {
+				break loop
+			}
+		case <-timer:
+			timer = nil
+			if info := s.eng.BestNow(); info.BestMove != nil || info.UCIBestMove != "" {
+				_ = s.eng.StopAnalysis()
+			} else {
+				// no move yet: wait for the first iteration
+				timer = time.After(10 * time.Millisecond)
+			}
+		case <-finished:
+			finished = nil
+			if stopped || (hit == nil && !params.Infinite) {
+				break loop
+			}
+		case <-halt:
+			// engine is stopped by stop()
+			halt, stopped = nil, true
+			if finished == nil {
+				break loop
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.unsub()
+	s.running = false
+	s.mu.Unlock()
+
+	info := s.eng.BestNow()
+	best := info.UCIBestMove
+	if best == "" && info.BestMove != nil {
+		best = moves.MoveToUCI(b, *info.BestMove)
+	}
+	if best == "" {
+		// no search result: any legal move
+		if legal := moves.GenerateLegalMoves(b); len(legal) > 0 {
+			best = moves.MoveToUCI(b, legal[0])
+		} else {
+			best = "0000"
+		}
+	}
+	if reply := ponderMove(b, info, best); reply != "" {
+		s.send("bestmove %s ponder %s", best, reply)
+		return
+	}
+	s.send("bestmove %s", best)
+}
+
+// the second move of PV, only if PV starts with best move
+func ponderMove(b *base.Board, info engine.AnalysisInfo, best string) string {
+	if len(info.UCIPV) > 1 {
+		if info.UCIPV[0] == best {
+			return info.UCIPV[1]
+		}
+		return ""
+	}
+	if len(info.PV) < 2 || moves.MoveToUCI(b, info.PV[0]) != best {
+		return ""
+	}
+	nb := moves.CloneBoard(b)
+	if moves.ApplyMove(nb, info.PV[0]) != nil {
+		return ""
+	}
+	return moves.MoveToUCI(nb, info.PV[1])
+}
+
+func (s *UCIServer) sendInfo(b *base.Board, info engine.AnalysisInfo) {
+	if len(info.Lines) > 1 {
+		for i, l := range info.Lines {
+			s.send("info depth %d multipv %d %s nodes %d nps %d time %d pv %s", info.Depth, i+1,
+				uciScore(l.ScoreCP, l.MateIn), info.Nodes, info.NPS, info.TimeMs, uciPV(b, l.PV, l.UCIPV))
+		}
+		return
+	}
+	s.send("info depth %d %s nodes %d nps %d time %d pv %s", info.Depth,
+		uciScore(info.ScoreCP, info.MateIn), info.Nodes, info.NPS, info.TimeMs, uciPV(b, info.PV, info.UCIPV))
+}
+
+// mate of engine is in plies, UCI mate is in moves
+func uciScore(cp, mate int) string {
+	switch {
+	case mate > 0:
+		return fmt.Sprintf("score mate %d", (mate+1)/2)
+	case mate < 0:
+		return fmt.Sprintf("score mate %d", -(-mate+1)/2)
+	}
+	return fmt.Sprintf("score cp %d", cp)
+}
+
+func uciPV(b *base.Board, pv []base.Move, upv []string) string {
+	if len(upv) > 0 {
+		return strings.Join(upv, " ")
+	}
+	nb := moves.CloneBoard(b)
+	list := make([]string, 0, len(pv))
+	for _, mv := range pv {
+		list = append(list, moves.MoveToUCI(nb, mv))
+		if moves.ApplyMove(nb, mv) != nil {
+			break
+		}
+	}
+	return strings.Join(list, " ")
+}
+
+func (s *UCIServer) ponderHit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running || !s.ponder {
+		return
+	}
+	s.ponder = false
+	_ = s.eng.PonderHit()
+	close(s.hit)
+}
+
+// stop current search and wait for its bestmove
+func (s *UCIServer) stop() {
+	s.mu.Lock()
+	running, done := s.running, s.done
+	if running {
+		select {
+		case <-s.halt:
+		default:
+			close(s.halt)
+		}
+	}
+	s.mu.Unlock()
+	if !running {
+		if done != nil {
+			<-done
+		}
+		return
+	}
+	_ = s.eng.StopAnalysis()
+	<-done
+}
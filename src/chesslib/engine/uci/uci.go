@@ -7,10 +7,12 @@ import (
 	"evilchess/src/chesslib/base"
 	"evilchess/src/chesslib/engine"
 	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules/moves"
 	"evilchess/src/logx"
 	"fmt"
 	"io"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -47,6 +49,14 @@ type UCIExecutor struct {
 	bestMoveCh  chan struct{}
 	logx        logx.Logger
 
+	// ponder
+	pondering bool // "go ponder" sent, waiting for ponderhit/stop
+	ponderOpt bool // "setoption name Ponder" already sent
+	threads   int  // last "setoption name Threads" value
+	multiPV   int  // last "setoption name MultiPV" value
+
+	options [][2]string // "setoption" name and value, sent after handshake
+
 	lastBoard base.Board
 }
 
@@ -101,6 +111,12 @@ func (e *UCIExecutor) Init() error {
 		go e.Close()
 		return errors.New("error read uciok")
 	}
+	for _, o := range e.options {
+		if err := e.Exec(fmt.Sprintf("setoption name %s value %s", o[0], o[1])); err != nil {
+			go e.Close()
+			return err
+		}
+	}
 	if !e.checkReady() {
 		go e.Close()
 		return errors.New("error read readyok")
@@ -108,6 +124,22 @@ func (e *UCIExecutor) Init() error {
 	return nil
 }
 
+// engine option (SyzygyPath, Hash, ...): sent now if process is open, and after every Init
+func (e *UCIExecutor) SetOption(name, value string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	i := slices.IndexFunc(e.options, func(o [2]string) bool { return o[0] == name })
+	if i >= 0 {
+		e.options[i][1] = value
+	} else {
+		e.options = append(e.options, [2]string{name, value})
+	}
+	if e.cmd == nil {
+		return nil
+	}
+	return e.Exec(fmt.Sprintf("setoption name %s value %s", name, value))
+}
+
 // command executable
 func (e *UCIExecutor) Exec(cmd string) error {
 	if e.in == nil {
@@ -164,8 +196,32 @@ func (e *UCIExecutor) StartAnalysis(prm engine.SearchParams) error {
 		return errors.New("already running")
 	}
 
+	if prm.Ponder && !e.ponderOpt {
+		if err := e.Exec("setoption name Ponder value true"); err != nil {
+			return err
+		}
+		e.ponderOpt = true
+	}
+
+	if prm.Threads > 0 && prm.Threads != e.threads {
+		if err := e.Exec(fmt.Sprintf("setoption name Threads value %d", prm.Threads)); err != nil {
+			return err
+		}
+		e.threads = prm.Threads
+	}
+
+	if mpv := max(prm.MultiPV, 1); mpv != e.multiPV && (mpv > 1 || e.multiPV > 1) {
+		if err := e.Exec(fmt.Sprintf("setoption name MultiPV value %d", mpv)); err != nil {
+			return err
+		}
+		e.multiPV = mpv
+	}
+
 	var b strings.Builder
 	b.WriteString("go")
+	if prm.Ponder {
+		b.WriteString(" ponder")
+	}
 	if prm.Infinite {
 		b.WriteString(" infinite")
 	} else {
@@ -181,8 +237,15 @@ func (e *UCIExecutor) StartAnalysis(prm engine.SearchParams) error {
 	}
 	e.info = engine.AnalysisInfo{}
 	e.running = true
+	e.pondering = prm.Ponder
 	cmd := b.String()
 
+	// drop stale bestmove signal of the previous search
+	select {
+	case <-e.bestMoveCh:
+	default:
+	}
+
 	e.logx.Infof("start analyze: %s", cmd)
 	if err := e.Exec(cmd); err != nil {
 		e.running = false
@@ -204,9 +267,26 @@ func (e *UCIExecutor) StopAnalysis() error {
 	}
 
 	e.logx.Info("stop analyze")
+	e.pondering = false
 	return e.Exec("stop")
 }
 
+// the opponent played the expected move: continue search in normal mode
+func (e *UCIExecutor) PonderHit() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cmd == nil {
+		return errors.New("no running uci-process")
+	}
+	if !e.running || !e.pondering {
+		return errors.New("not pondering")
+	}
+
+	e.logx.Info("ponderhit")
+	e.pondering = false
+	return e.Exec("ponderhit")
+}
+
 // called if analysis is time-limited
 func (e *UCIExecutor) WaitDone() {
 	e.mu.RLock()
@@ -219,7 +299,10 @@ func (e *UCIExecutor) WaitDone() {
 	if !running {
 		return
 	}
-	timer := time.NewTimer(e.timeout)
+	if timeout <= 0 {
+		timeout = engine.UCIBestMoveTimeout
+	}
+	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 	select {
 	case <-e.bestMoveCh:
@@ -380,10 +463,16 @@ func (e *UCIExecutor) stdoutLoop(ctx context.Context) {
 
 func (e *UCIExecutor) saveInfo(info string) {
 	preinfo := engine.AnalysisInfo{}
+	multipv := 0
 	fld := strings.Fields(info)
 	n := len(fld)
 	for i := 0; i < n; i++ {
 		switch fld[i] {
+		case "multipv":
+			if i+1 < n {
+				multipv, _ = strconv.Atoi(fld[i+1])
+				i++
+			}
 		case "depth":
 			if i+1 < n {
 				preinfo.Depth, _ = strconv.Atoi(fld[i+1])
@@ -440,11 +529,11 @@ func (e *UCIExecutor) saveInfo(info string) {
 				if len(last.Mailbox) > 0 {
 					parsedPV := make([]base.Move, 0, len(pvStrs))
 					for _, s := range pvStrs {
-						if pm := parseUCIStringToMove(s, last.Mailbox); pm != nil {
-							parsedPV = append(parsedPV, *pm)
-						} else {
+						pm := parseUCIStringToMove(s, last.Mailbox)
+						if pm == nil || moves.ApplyMove(&last, *pm) != nil {
 							break // can't parse further — stop
 						}
+						parsedPV = append(parsedPV, *pm)
 					}
 					if len(parsedPV) > 0 {
 						preinfo.PV = parsedPV
@@ -463,6 +552,27 @@ func (e *UCIExecutor) saveInfo(info string) {
 
 	// write into shared e.info and publish
 	e.mu.Lock()
+	if multipv > 0 && len(preinfo.UCIPV) > 0 {
+		lines := append([]engine.PVLine(nil), e.info.Lines...)
+		for len(lines) < multipv {
+			lines = append(lines, engine.PVLine{})
+		}
+		lines[multipv-1] = engine.PVLine{
+			ScoreCP: preinfo.ScoreCP,
+			MateIn:  preinfo.MateIn,
+			PV:      preinfo.PV,
+			UCIPV:   preinfo.UCIPV,
+		}
+		if multipv > 1 {
+			// not main line: keep main info
+			e.info.Lines = lines
+			info := e.info
+			e.mu.Unlock()
+			e.publish(info)
+			return
+		}
+		preinfo.Lines = lines
+	}
 	e.info = preinfo
 	e.mu.Unlock()
 
@@ -478,33 +588,31 @@ func (e *UCIExecutor) saveBest(best string) {
 
 		e.mu.Lock()
 		e.running = false
+		e.pondering = false
 		// set UCIBestMove
 		e.info.UCIBestMove = bm
+		if len(f) >= 4 && f[2] == "ponder" {
+			e.info.UCIPonder = f[3]
+		}
 
 		// if PV empty, try to set PV/basic BestMove from bm using lastBoard
+		last := e.lastBoard
 		if len(e.info.PV) == 0 {
-			e.mu.RUnlock() // temporarily unlock to use parse util that takes lastBoard under RLock (we'll lock again below)
-			e.mu.RLock()
-			last := e.lastBoard
-			e.mu.RUnlock()
-
-			if len(last.Mailbox) > 0 {
-				if pm := parseUCIStringToMove(bm, last.Mailbox); pm != nil {
-					// put into e.info (we already have e.mu locked above, so relock)
-					e.mu.Lock()
-					e.info.PV = []base.Move{*pm}
-					mv0 := *pm
-					e.info.BestMove = &mv0
-					e.mu.Unlock()
-				} else {
-					e.mu.Unlock()
+			if pm := parseUCIStringToMove(bm, last.Mailbox); pm != nil {
+				e.info.PV = []base.Move{*pm}
+				mv0 := *pm
+				e.info.BestMove = &mv0
+			}
+		}
+		// PV without expected reply: complete it by ponder move
+		if len(e.info.PV) == 1 && e.info.UCIPonder != "" {
+			if moves.ApplyMove(&last, e.info.PV[0]) == nil {
+				if pm := parseUCIStringToMove(e.info.UCIPonder, last.Mailbox); pm != nil {
+					e.info.PV = append(e.info.PV, *pm)
 				}
-			} else {
-				e.mu.Unlock()
 			}
-		} else {
-			e.mu.Unlock()
 		}
+		e.mu.Unlock()
 
 		// notify WaitDone() (non-blocking)
 		select {
@@ -1,28 +1,60 @@
 package chesslib
 
 import (
+	"context"
 	"errors"
 	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
 	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/review"
 	"evilchess/src/chesslib/logic/convert/convfen"
 	"evilchess/src/chesslib/logic/convert/convpgn"
 	"evilchess/src/chesslib/logic/history"
 	"evilchess/src/chesslib/logic/rules"
 	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/chesslib/outcome"
 	"evilchess/src/logx"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 )
 
+const (
+	// reserve of clock for answer of engine
+	engineClockOverhead = 100 * time.Millisecond
+	// engine thinks over draw offer not longer
+	drawOfferTimeMs = 1000
+	// engine accepts draw if its score is not better (centipawns)
+	drawAcceptScore = 25
+	// before this ply draw is accepted only in lost positions
+	drawMinPly = 30
+	// engine accepts draw any time if its score is worse
+	drawLostScore = -200
+)
+
 // at firts use Create* methods
 type GameBuilder struct {
 	board   *base.Board
 	history *history.History
 	status  base.GameStatus
 	level   engine.LevelAnalyze
+	threads int
 	engine  engine.Engine
 	logger  logx.Logger
+
+	// engine lifecycle (ponder keeps engine alive between moves)
+	engineMu   sync.Mutex
+	engineOpen bool
+	ponder     bool
+	pondering  bool
+	ponderFEN  string // position after the expected reply
+
+	// clock of game (nil - without clock)
+	clock *clock.Clock
+
+	// outcome set by players or arbiter (resignation, agreement, flag-fall, ...)
+	outcome outcome.Outcome
 }
 
 func NewBuilderBoard(logger logx.Logger) *GameBuilder {
@@ -77,6 +109,7 @@ func (gb *GameBuilder) CreateFromFEN(fen string) (base.GameStatus, error) {
 
 	gb.board = board
 	gb.status = rules.GameStatusOf(gb.board)
+	gb.outcome = outcome.Outcome{}
 	return gb.status, nil
 }
 
@@ -101,10 +134,19 @@ func (gb *GameBuilder) IsWhiteToMove() bool {
 
 func (gb *GameBuilder) Move(move base.Move) base.GameStatus {
 	gb.logger.Infof("move from %d to %d", base.ConvPointToIndex(move.From), base.ConvPointToIndex(move.To))
+	// no moves after resignation, agreement, flag-fall, ... unless the move
+	// replaces moves after current one: the outcome is dropped with them
+	if gb.outcome.Over() && int(gb.history.CurrentMove())+1 < gb.history.Len() {
+		gb.outcome = outcome.Outcome{}
+	}
+	if _, fallen := gb.TimeForfeit(); fallen || gb.outcome.Over() {
+		return base.InvalidGame
+	}
 	if err := gb.history.PushMove(gb.board, move); err != nil {
 		return base.InvalidGame
 	}
 	gb.status = rules.GameStatusOf(gb.board)
+	gb.pressClock()
 	return gb.status
 }
 
@@ -121,6 +163,7 @@ func (gb *GameBuilder) Undo() base.GameStatus {
 	gb.logger.Debug("call undo")
 	gb.history.Undo(gb.board)
 	gb.status = rules.GameStatusOf(gb.board)
+	gb.syncClock()
 	return gb.status
 }
 
@@ -128,6 +171,7 @@ func (gb *GameBuilder) Redo() base.GameStatus {
 	gb.logger.Debug("call redo")
 	gb.history.Redo(gb.board)
 	gb.status = rules.GameStatusOf(gb.board)
+	gb.syncClock()
 	return gb.status
 }
 
@@ -136,6 +180,7 @@ func (gb *GameBuilder) CurrentMove(number uint) base.GameStatus {
 	// pass <some_number>: offset game to current move
 	gb.history.GotoMove(gb.board, number)
 	gb.status = rules.GameStatusOf(gb.board)
+	gb.syncClock()
 	return gb.status
 }
 
@@ -161,7 +206,26 @@ func (gb *GameBuilder) FEN() string {
 // return PGN of this game
 func (gb *GameBuilder) PGN(w io.Writer) error {
 	// gb.logger.Debug("get actual PGN")
-	return convpgn.WritePGN(w, *gb.history.ExportPGNGame())
+	return convpgn.WritePGN(w, *gb.exportPGN())
+}
+
+// moves with result, Termination and TimeControl tags
+func (gb *GameBuilder) exportPGN() *convpgn.PGNGame {
+	pg := gb.history.ExportPGNGame()
+	tag := func(name, value string) {
+		if pg.Tags == nil {
+			pg.Tags = map[string]string{}
+		}
+		pg.Tags[name] = value
+	}
+	if gb.clock != nil {
+		tag("TimeControl", gb.clock.Side(true).Control().String())
+	}
+	if o := gb.Outcome(); o.Over() {
+		pg.Result = o.Result
+		tag("Termination", o.Reason.Termination())
+	}
+	return pg
 }
 
 // ---- History ----
@@ -170,6 +234,16 @@ func (gb *GameBuilder) CountHalfMoves() int {
 	return gb.history.Len()
 }
 
+// copy of history: first entry is start position, then positions after moves
+func (gb *GameBuilder) HistoryMoves() []history.MoveEntry {
+	return gb.history.Moves()
+}
+
+// index of current position in history
+func (gb *GameBuilder) CurrentMoveIndex() uint {
+	return gb.history.CurrentMove()
+}
+
 // all SAN moves
 func (gb *GameBuilder) PGNBody() string {
 	// gb.logger.Debug("get actual moves")
@@ -180,6 +254,21 @@ func (gb *GameBuilder) InfoGame() *history.InfoGame {
 	return gb.history.InfoGame()
 }
 
+// ---- Review ----
+
+// analyze all moves of this game by initialized engine e (not engine of game)
+func (gb *GameBuilder) Review(ctx context.Context, e engine.Engine, opts review.Options) (*review.Review, error) {
+	gb.logger.Debug("review game")
+	return review.ReviewHistory(ctx, e, gb.history, opts)
+}
+
+// return PGN of this game with annotations of review
+func (gb *GameBuilder) AnnotatedPGN(w io.Writer, r *review.Review) error {
+	pgn := gb.exportPGN()
+	r.Annotate(pgn)
+	return convpgn.WritePGN(w, *pgn)
+}
+
 // ---- Engine ----
 
 func (gb *GameBuilder) EngineWorker() engine.Engine {
@@ -187,6 +276,7 @@ func (gb *GameBuilder) EngineWorker() engine.Engine {
 }
 
 func (gb *GameBuilder) SetEngineWorker(e engine.Engine) {
+	gb.CloseEngine()
 	gb.engine = e
 	gb.level = engine.LevelFive
 }
@@ -196,39 +286,408 @@ func (gb *GameBuilder) SetEngineLevel(lvl engine.LevelAnalyze) {
 	gb.level = lvl
 }
 
-func (gb *GameBuilder) EngineMove() base.GameStatus {
-	if gb.engine == nil || gb.level == engine.LevelInvalid {
-		return base.InvalidGame
-	}
+// number of search threads (0 = engine default)
+func (gb *GameBuilder) SetEngineThreads(n int) {
+	gb.logger.Debugf("set threads engine: %v", n)
+	gb.threads = n
+}
 
-	if err := gb.engine.Init(); err != nil {
-		gb.logger.Errorf("Error init engine: %v", err)
-		return base.InvalidGame
+// engine thinks on the opponent's time after own move
+func (gb *GameBuilder) SetEnginePonder(on bool) {
+	gb.logger.Debugf("set ponder engine: %v", on)
+	gb.engineMu.Lock()
+	defer gb.engineMu.Unlock()
+	gb.ponder = on
+	if !on {
+		gb.closeEngine()
 	}
-	defer gb.engine.Close()
+}
 
-	var err error
-	err = gb.engine.SetPosition(gb.board)
-	if err != nil {
+func (gb *GameBuilder) IsEnginePondering() bool {
+	gb.engineMu.Lock()
+	defer gb.engineMu.Unlock()
+	return gb.pondering
+}
+
+func (gb *GameBuilder) EngineMove() base.GameStatus {
+	gb.engineMu.Lock()
+	defer gb.engineMu.Unlock()
+
+	if !gb.openEngine() {
 		return base.InvalidGame
 	}
-	err = gb.engine.StartAnalysis(engine.LevelToParams(gb.level))
-	if err != nil {
-		return base.InvalidGame
+	if !gb.ponder {
+		defer gb.closeEngine()
 	}
 
-	if gb.level == engine.LevelLast {
-		time.Sleep(engine.StopAnalyzeTimeout)
-		gb.engine.StopAnalysis()
-	} else {
-		gb.engine.WaitDone()
+	white := gb.board.WhiteToMove
+	params := gb.engineParams(white)
+
+	// ponderhit: the engine already searches the current position
+	hit := false
+	if gb.pondering {
+		gb.pondering = false
+		if gb.ponderFEN == gb.FEN() && gb.engine.PonderHit() == nil {
+			gb.logger.Debug("ponderhit")
+			hit = true
+		} else {
+			gb.logger.Debug("ponder miss")
+			gb.engine.StopAnalysis()
+			gb.engine.WaitDone()
+		}
+	}
+
+	if !hit {
+		var err error
+		err = gb.engine.SetPosition(moves.CloneBoard(gb.board))
+		if err != nil {
+			return base.InvalidGame
+		}
+		err = gb.engine.StartAnalysis(params)
+		if err != nil {
+			return base.InvalidGame
+		}
 	}
 
+	gb.waitEngine(white, params)
+
 	info := gb.engine.BestNow()
 	mv := info.GetBestMove(gb.board.Mailbox)
 	if mv == nil {
 		return base.InvalidGame
 	}
 	gb.logger.Infof("best engine move: %v", mv)
-	return gb.Move(*mv)
+	status := gb.Move(*mv)
+	if gb.ponder && status != base.InvalidGame {
+		gb.startPonder(info, white)
+	}
+	return status
+}
+
+// analysis of current position by engine of game, not longer than maxTimeMs
+func (gb *GameBuilder) engineAnalysis(maxTimeMs int64) (engine.AnalysisInfo, bool) {
+	gb.engineMu.Lock()
+	defer gb.engineMu.Unlock()
+
+	if !gb.openEngine() {
+		return engine.AnalysisInfo{}, false
+	}
+	if !gb.ponder {
+		defer gb.closeEngine()
+	}
+	gb.stopPonder()
+
+	params := gb.engineParams(gb.board.WhiteToMove)
+	params.Infinite = false
+	if params.MaxTimeMs == 0 || params.MaxTimeMs > maxTimeMs {
+		params.MaxTimeMs = maxTimeMs
+	}
+	if err := gb.engine.SetPosition(moves.CloneBoard(gb.board)); err != nil {
+		return engine.AnalysisInfo{}, false
+	}
+	if err := gb.engine.StartAnalysis(params); err != nil {
+		gb.logger.Errorf("Error start analysis: %v", err)
+		return engine.AnalysisInfo{}, false
+	}
+	gb.engine.WaitDone()
+	return gb.engine.BestNow(), true
+}
+
+// stop thinking on the opponent's time
+func (gb *GameBuilder) StopPonder() {
+	gb.engineMu.Lock()
+	defer gb.engineMu.Unlock()
+	gb.stopPonder()
+}
+
+// terminate engine process (if it was kept alive for pondering)
+func (gb *GameBuilder) CloseEngine() {
+	gb.engineMu.Lock()
+	defer gb.engineMu.Unlock()
+	gb.closeEngine()
+}
+
+// engine of white (or black) thinks on the opponent's time, the budget is of its own clock
+func (gb *GameBuilder) startPonder(info engine.AnalysisInfo, white bool) {
+	pm := info.GetPonderMove()
+	if pm == nil {
+		return
+	}
+	pb := moves.CloneBoard(gb.board)
+	if err := moves.ApplyMove(pb, *pm); err != nil {
+		return
+	}
+	if st := rules.GameStatusOf(pb); st != base.Pass && st != base.Check {
+		return
+	}
+
+	params := gb.engineParams(white)
+	params.Ponder = true
+	if err := gb.engine.SetPosition(pb); err != nil {
+		return
+	}
+	if err := gb.engine.StartAnalysis(params); err != nil {
+		gb.logger.Errorf("Error start ponder: %v", err)
+		return
+	}
+	gb.logger.Infof("ponder move: %v", pm)
+	gb.pondering = true
+	gb.ponderFEN = convfen.ConvertBoardToFEN(*pb)
+}
+
+// search of engine playing white (or black)
+func (gb *GameBuilder) engineParams(white bool) engine.SearchParams {
+	params := engine.LevelToParams(gb.level)
+	params.Threads = gb.threads
+	// search is not longer than the clock allows
+	if gb.timed(white) {
+		budget := gb.clock.Budget(white, engineClockOverhead).Milliseconds()
+		if params.MaxTimeMs == 0 || params.MaxTimeMs > budget {
+			params.MaxTimeMs = budget
+		}
+	}
+	return params
+}
+
+// search is stopped after the budget if the engine has a move,
+// before flag-fall anyway
+func (gb *GameBuilder) waitEngine(white bool, params engine.SearchParams) {
+	if !gb.timed(white) {
+		if gb.level == engine.LevelLast {
+			time.Sleep(engine.StopAnalyzeTimeout)
+			gb.engine.StopAnalysis()
+		}
+		gb.engine.WaitDone()
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		gb.engine.WaitDone()
+		close(done)
+	}()
+	soft := time.After(time.Duration(params.MaxTimeMs) * time.Millisecond)
+	hard := time.After(max(gb.clock.Limit(white)-engineClockOverhead, 0))
+	for {
+		select {
+		case <-done:
+			return
+		case <-soft:
+			soft = nil
+			if best := gb.engine.BestNow(); best.BestMove == nil && best.UCIBestMove == "" {
+				// no move yet: wait for the first iteration
+				continue
+			}
+		case <-hard:
+		}
+		gb.engine.StopAnalysis()
+		<-done
+		return
+	}
+}
+
+// side plays on the clock
+func (gb *GameBuilder) timed(white bool) bool {
+	return gb.clock != nil && gb.clock.Side(white).Control().HasClock()
+}
+
+// engine is set and initialized
+func (gb *GameBuilder) openEngine() bool {
+	if gb.engine == nil || gb.level == engine.LevelInvalid {
+		return false
+	}
+	if !gb.engineOpen {
+		if err := gb.engine.Init(); err != nil {
+			gb.logger.Errorf("Error init engine: %v", err)
+			return false
+		}
+		gb.engineOpen = true
+	}
+	return true
+}
+
+func (gb *GameBuilder) stopPonder() {
+	if !gb.pondering {
+		return
+	}
+	gb.pondering = false
+	gb.engine.StopAnalysis()
+	gb.engine.WaitDone()
+}
+
+func (gb *GameBuilder) closeEngine() {
+	if !gb.engineOpen {
+		return
+	}
+	gb.stopPonder()
+	gb.engine.Close()
+	gb.engineOpen = false
+}
+
+// ---- Clock ----
+
+// clock of game (nil - without clock): it starts after the first move and is
+// pressed by every move, the engine plans time of search by it
+func (gb *GameBuilder) SetClock(c *clock.Clock) {
+	gb.clock = c
+}
+
+func (gb *GameBuilder) Clock() *clock.Clock {
+	return gb.clock
+}
+
+// side whose flag has fallen, the outcome is kept for PGN
+func (gb *GameBuilder) TimeForfeit() (white, fallen bool) {
+	if gb.clock == nil || gb.board == nil {
+		return false, false
+	}
+	white, fallen = gb.clock.Flagged()
+	if fallen && !gb.outcome.Over() {
+		gb.setOutcome(outcome.FlagFall(gb.board, white))
+	}
+	return white, fallen
+}
+
+func (gb *GameBuilder) pressClock() {
+	if gb.clock == nil {
+		return
+	}
+	switch {
+	case gb.status != base.Pass && gb.status != base.Check:
+		gb.clock.Stop()
+	case !gb.clock.Running():
+		// the first move (or the move after pause)
+		gb.clock.StartAfter(!gb.board.WhiteToMove)
+	default:
+		gb.clock.Press()
+	}
+}
+
+// navigation in history changes side to move: the running clock follows it,
+// time of the current move stays with the side which has spent it
+func (gb *GameBuilder) syncClock() {
+	if gb.clock == nil || !gb.clock.Running() {
+		return
+	}
+	if gb.status != base.Pass && gb.status != base.Check {
+		gb.clock.Stop()
+		return
+	}
+	if gb.clock.WhiteToMove() != gb.board.WhiteToMove {
+		gb.clock.Stop()
+		gb.clock.Start(gb.board.WhiteToMove)
+	}
+}
+
+// ---- Outcome ----
+
+// outcome of game: set by players or arbiter, otherwise by board
+func (gb *GameBuilder) Outcome() outcome.Outcome {
+	if gb.outcome.Over() || gb.board == nil {
+		return gb.outcome
+	}
+	return outcome.OfStatus(gb.status, gb.board.WhiteToMove)
+}
+
+// white (or black) resigns
+func (gb *GameBuilder) Resign(white bool) outcome.Outcome {
+	return gb.endBy(outcome.Resign(white))
+}
+
+// white (or black) left the game
+func (gb *GameBuilder) Abandon(white bool) outcome.Outcome {
+	return gb.endBy(outcome.Abandon(white))
+}
+
+// flag of white (or black) has fallen on the clock of server
+func (gb *GameBuilder) FlagFall(white bool) outcome.Outcome {
+	return gb.endBy(outcome.FlagFall(gb.board, white))
+}
+
+// draw offer is accepted by the opponent
+func (gb *GameBuilder) AgreeDraw() outcome.Outcome {
+	return gb.endBy(outcome.Agreed())
+}
+
+// result by arbiter (tablebase, scores of engines, ...)
+func (gb *GameBuilder) Adjudicate(result convpgn.PGNStatusGame, detail string) outcome.Outcome {
+	return gb.endBy(outcome.Adjudicate(result, detail))
+}
+
+// draw by threefold repetition or fifty-move rule, false - nothing to claim
+func (gb *GameBuilder) ClaimDraw() (outcome.Outcome, bool) {
+	if gb.Outcome().Over() {
+		return gb.Outcome(), false
+	}
+	entries := gb.history.Moves()
+	var positions []base.Board
+	if len(entries) == 0 {
+		positions = []base.Board{*gb.board}
+	} else {
+		for _, e := range entries[:min(int(gb.history.CurrentMove()), len(entries)-1)+1] {
+			positions = append(positions, e.Board)
+		}
+	}
+	o, ok := outcome.Claim(positions)
+	if ok {
+		gb.endBy(o)
+	}
+	return o, ok
+}
+
+// draw offer of white (or black) to engine: the engine analyzes the position
+// and accepts it if its score is not better than draw
+func (gb *GameBuilder) OfferDraw(white bool) bool {
+	if gb.Outcome().Over() {
+		return false
+	}
+	info, ok := gb.engineAnalysis(drawOfferTimeMs)
+	if !ok || !acceptDraw(info, !white, gb.board.WhiteToMove, int(gb.history.CurrentMove())) {
+		gb.logger.Info("draw offer is declined")
+		return false
+	}
+	gb.AgreeDraw()
+	return true
+}
+
+// draw offer to engine: info is its analysis of current position (score of
+// side to move), engineWhite is color of engine, ply is number of played plies
+func acceptDraw(info engine.AnalysisInfo, engineWhite, whiteToMove bool, ply int) bool {
+	score, mate := info.ScoreCP, info.MateIn
+	if engineWhite != whiteToMove {
+		score, mate = -score, -mate
+	}
+	switch {
+	case mate > 0:
+		return false
+	case mate < 0:
+		return true
+	case info.Tablebase && info.TBWinIn == 0:
+		// tablebase draw
+		return true
+	case score <= drawLostScore:
+		return true
+	}
+	return ply >= drawMinPly && score <= drawAcceptScore
+}
+
+// game ends by o (the first outcome is kept)
+func (gb *GameBuilder) endBy(o outcome.Outcome) outcome.Outcome {
+	if cur := gb.Outcome(); cur.Over() {
+		return cur
+	}
+	gb.setOutcome(o)
+	if gb.clock != nil {
+		gb.clock.Stop()
+	}
+	return o
+}
+
+// outcome set by players or arbiter is dropped (e.g. it is not confirmed by server)
+func (gb *GameBuilder) ClearOutcome() {
+	gb.outcome = outcome.Outcome{}
+}
+
+func (gb *GameBuilder) setOutcome(o outcome.Outcome) {
+	gb.outcome = o
+	gb.logger.Infof("game over: %s", o)
 }
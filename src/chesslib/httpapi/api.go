@@ -0,0 +1,157 @@
+package httpapi
+
+import (
+	"errors"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+)
+
+// --------------------------------------------------
+// HTTP game API: REST + streams (NDJSON or WebSocket)
+// --------------------------------------------------
+// games live on the server, moves are SAN or UCI and checked by the rules,
+// the engine plays moves at a level and analyzes positions for streams
+//
+//	POST   /api/games                 {"fen":"...","white":"Ann","black":"Bob"} -> Game
+//	GET    /api/games                 -> []Game
+//	GET    /api/games/{id}            -> Game
+//	DELETE /api/games/{id}
+//	POST   /api/games/{id}/moves      {"move":"e4"} -> Game
+//	POST   /api/games/{id}/engine     {"level":5} -> EngineMove
+//	GET    /api/games/{id}/analysis   ?movetime=1000&depth=0 -> Analysis
+//	GET    /api/games/{id}/fen        text
+//	GET    /api/games/{id}/pgn        text
+//	GET    /api/games/{id}/stream     ?analysis=1 -> Event per line (NDJSON)
+//	GET    /api/games/{id}/ws         ?analysis=1 -> Event per message, client sends Command
+
+const (
+	DefaultAddr = ":8080"
+
+	// levels of engine moves (engine.LevelOne..LevelTen)
+	MinLevel     = 1
+	MaxLevel     = 10
+	DefaultLevel = 5
+)
+
+// types of events
+const (
+	EventGame     = "game"     // the first event of stream: the whole game
+	EventMove     = "move"     // move is played: move, san, game
+	EventAnalysis = "analysis" // analysis of current position
+	EventError    = "error"    // error of websocket command
+)
+
+// types of websocket commands
+const (
+	CommandMove   = "move"   // move: SAN or UCI
+	CommandEngine = "engine" // engine move: level, movetime, depth
+)
+
+type CreateRequest struct {
+	FEN   string `json:"fen,omitempty"` // empty - classic start
+	White string `json:"white,omitempty"`
+	Black string `json:"black,omitempty"`
+}
+
+type MoveRequest struct {
+	Move string `json:"move"` // SAN or UCI
+}
+
+type EngineRequest struct {
+	Level      int   `json:"level,omitempty"`       // 1..10 (0 - default)
+	MoveTimeMs int64 `json:"movetime_ms,omitempty"` // limit of search (0 - by level)
+	Depth      int   `json:"depth,omitempty"`       // limit of search (0 - by level)
+}
+
+type Game struct {
+	ID     string   `json:"id"`
+	FEN    string   `json:"fen"`
+	Moves  []string `json:"moves"` // UCI
+	SAN    []string `json:"san"`
+	White  string   `json:"white,omitempty"`
+	Black  string   `json:"black,omitempty"`
+	Turn   string   `json:"turn"`   // white, black
+	Status string   `json:"status"` // pass, check, checkmate, stalemate, draw
+	Result string   `json:"result"` // "*" - game goes on
+	Reason string   `json:"reason,omitempty"`
+}
+
+// game goes on
+func (g *Game) Active() bool { return g.Result == "*" || g.Result == "" }
+
+type Analysis struct {
+	FEN      string   `json:"fen"` // analyzed position
+	Depth    int      `json:"depth"`
+	ScoreCP  int      `json:"score_cp"` // side to move POV
+	MateIn   int      `json:"mate_in,omitempty"`
+	BestMove string   `json:"best_move,omitempty"` // UCI
+	PV       []string `json:"pv,omitempty"`        // UCI
+	Nodes    int64    `json:"nodes"`
+	TimeMs   int64    `json:"time_ms"`
+	Done     bool     `json:"done"` // the last info of search
+}
+
+type EngineMove struct {
+	Move     string    `json:"move"` // UCI
+	SAN      string    `json:"san"`
+	Analysis *Analysis `json:"analysis,omitempty"`
+	Game     *Game     `json:"game"`
+}
+
+type Event struct {
+	Type     string    `json:"type"`
+	Move     string    `json:"move,omitempty"` // UCI
+	SAN      string    `json:"san,omitempty"`
+	Game     *Game     `json:"game,omitempty"`
+	Analysis *Analysis `json:"analysis,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// message of websocket client
+type Command struct {
+	Type string `json:"type"`
+	Move string `json:"move,omitempty"`
+	EngineRequest
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ---- Helpers ----
+
+// legal move by UCI or SAN
+func parseMove(b *base.Board, s string) (base.Move, error) {
+	mv, err := moves.UCIToMove(b, s)
+	if err != nil {
+		if mv, err = moves.SANToMove(b, s); err != nil {
+			return base.Move{}, errors.New("invalid move " + s)
+		}
+	}
+	if !rules.IsLegalMove(b, mv) {
+		return base.Move{}, errors.New("illegal move " + s)
+	}
+	return mv, nil
+}
+
+func analysisOf(fen string, b *base.Board, info engine.AnalysisInfo, done bool) *Analysis {
+	a := &Analysis{FEN: fen, Depth: info.Depth, ScoreCP: info.ScoreCP, MateIn: info.MateIn, Nodes: info.Nodes, TimeMs: info.TimeMs, Done: done}
+	if mv := info.GetBestMove(b.Mailbox); mv != nil {
+		a.BestMove = moves.MoveToUCI(b, *mv)
+	}
+	if len(info.UCIPV) > 0 {
+		a.PV = info.UCIPV
+		return a
+	}
+	// moves of PV are converted on copy of position
+	pb := moves.CloneBoard(b)
+	for _, mv := range info.PV {
+		a.PV = append(a.PV, moves.MoveToUCI(pb, mv))
+		if moves.ApplyMove(pb, mv) != nil {
+			break
+		}
+	}
+	return a
+}
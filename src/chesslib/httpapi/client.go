@@ -0,0 +1,191 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ---- Client ----
+// REST requests and NDJSON stream of net/http: works in WASM build too (fetch)
+
+type Client struct {
+	base string
+	hc   *http.Client
+}
+
+// "http://localhost:8080"
+func NewClient(baseURL string) *Client {
+	return &Client{base: strings.TrimRight(baseURL, "/"), hc: &http.Client{}}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if s, ok := out.(*string); ok {
+		data, err := io.ReadAll(resp.Body)
+		*s = string(data)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// error of server by status of response
+func responseError(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var e errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		return fmt.Errorf("http api: %s", resp.Status)
+	}
+	return errors.New(e.Error)
+}
+
+func gamePath(id string) string {
+	return "/api/games/" + url.PathEscape(id)
+}
+
+func (c *Client) CreateGame(ctx context.Context, req CreateRequest) (*Game, error) {
+	var g Game
+	if err := c.do(ctx, http.MethodPost, "/api/games", req, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (c *Client) Games(ctx context.Context) ([]Game, error) {
+	var list []Game
+	if err := c.do(ctx, http.MethodGet, "/api/games", nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *Client) Game(ctx context.Context, id string) (*Game, error) {
+	var g Game
+	if err := c.do(ctx, http.MethodGet, gamePath(id), nil, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (c *Client) DeleteGame(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, gamePath(id), nil, nil)
+}
+
+// move of SAN or UCI
+func (c *Client) Move(ctx context.Context, id, mv string) (*Game, error) {
+	var g Game
+	if err := c.do(ctx, http.MethodPost, gamePath(id)+"/moves", MoveRequest{Move: mv}, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (c *Client) EngineMove(ctx context.Context, id string, req EngineRequest) (*EngineMove, error) {
+	var res EngineMove
+	if err := c.do(ctx, http.MethodPost, gamePath(id)+"/engine", req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// analysis of current position (movetimeMs, depth 0 - defaults of server)
+func (c *Client) Analysis(ctx context.Context, id string, movetimeMs int64, depth int) (*Analysis, error) {
+	q := url.Values{}
+	if movetimeMs > 0 {
+		q.Set("movetime", strconv.FormatInt(movetimeMs, 10))
+	}
+	if depth > 0 {
+		q.Set("depth", strconv.Itoa(depth))
+	}
+	var a Analysis
+	if err := c.do(ctx, http.MethodGet, gamePath(id)+"/analysis?"+q.Encode(), nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (c *Client) FEN(ctx context.Context, id string) (string, error) {
+	var s string
+	err := c.do(ctx, http.MethodGet, gamePath(id)+"/fen", nil, &s)
+	return strings.TrimSpace(s), err
+}
+
+func (c *Client) PGN(ctx context.Context, id string) (string, error) {
+	var s string
+	err := c.do(ctx, http.MethodGet, gamePath(id)+"/pgn", nil, &s)
+	return s, err
+}
+
+// events of game until ctx is done or game is deleted (channel is closed)
+func (c *Client) Stream(ctx context.Context, id string, analysis bool) (<-chan Event, error) {
+	path := gamePath(id) + "/stream"
+	if analysis {
+		path += "?analysis=1"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	out := make(chan Event, streamQueue)
+	go func() {
+		defer close(out)
+		defer resp.Body.Close()
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 4096), maxBody)
+		for sc.Scan() {
+			var ev Event
+			if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+				continue
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,264 @@
+package httpapi
+
+import (
+	"errors"
+	"evilchess/src/chesslib"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"strings"
+	"sync"
+)
+
+// ---- Subscriber: stream of game ----
+
+type subscriber struct {
+	out      chan Event
+	done     chan struct{}
+	once     sync.Once
+	analysis bool // analysis events are sent too
+}
+
+func newSubscriber(analysis bool) *subscriber {
+	return &subscriber{out: make(chan Event, streamQueue), done: make(chan struct{}), analysis: analysis}
+}
+
+// event is queued, slow subscriber is dropped
+func (s *subscriber) send(ev Event) {
+	select {
+	case s.out <- ev:
+	case <-s.done:
+	default:
+		s.close()
+	}
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// ---- Game ----
+
+type game struct {
+	id  string
+	srv *Server
+
+	mu       sync.Mutex
+	gb       *chesslib.GameBuilder
+	subs     map[*subscriber]bool
+	thinking bool          // engine searches move
+	stop     chan struct{} // stops running analysis (nil - no analysis)
+}
+
+func newGame(id string, srv *Server, req CreateRequest) (*game, error) {
+	g := &game{id: id, srv: srv, gb: chesslib.NewBuilderBoard(srv.logger), subs: map[*subscriber]bool{}}
+	if req.FEN == "" {
+		g.gb.CreateClassic()
+	} else if _, err := g.gb.CreateFromFEN(req.FEN); err != nil {
+		return nil, err
+	}
+	if req.White != "" {
+		g.gb.InfoGame().SetWhitePlayer(req.White)
+	}
+	if req.Black != "" {
+		g.gb.InfoGame().SetBlackPlayer(req.Black)
+	}
+	return g, nil
+}
+
+func (g *game) over() bool {
+	return g.gb.Outcome().Over()
+}
+
+// game for response (g.mu is held)
+func (g *game) snapshot() *Game {
+	b := g.gb.CurrentPosition()
+	info := g.gb.InfoGame()
+	res := &Game{
+		ID:     g.id,
+		FEN:    g.gb.FEN(),
+		Moves:  []string{},
+		SAN:    []string{},
+		White:  info.GetWhitePlayer(),
+		Black:  info.GetBlackPlayer(),
+		Turn:   "white",
+		Status: g.gb.Status().String(),
+	}
+	if !b.WhiteToMove {
+		res.Turn = "black"
+	}
+	entries := g.gb.HistoryMoves()
+	for i := 1; i <= int(g.gb.CurrentMoveIndex()) && i < len(entries); i++ {
+		res.Moves = append(res.Moves, moves.MoveToUCI(&entries[i-1].Board, entries[i].Move))
+		res.SAN = append(res.SAN, moves.MoveToSAN(&entries[i-1].Board, entries[i].Move))
+	}
+	o := g.gb.Outcome()
+	res.Result = convpgn.ConvPGNStatusToString(o.Result)
+	if o.Over() {
+		res.Reason = o.Reason.String()
+	}
+	return res
+}
+
+// move of SAN or UCI is played and sent to streams (g.mu is held)
+func (g *game) play(s string) (Event, error) {
+	if g.over() {
+		return Event{}, errors.New("game is over")
+	}
+	b := g.gb.CurrentPosition()
+	mv, err := parseMove(&b, strings.TrimSpace(s))
+	if err != nil {
+		return Event{}, err
+	}
+	uci, san := moves.MoveToUCI(&b, mv), moves.MoveToSAN(&b, mv)
+	if g.gb.Move(mv) == base.InvalidGame {
+		return Event{}, errors.New("illegal move " + s)
+	}
+	ev := Event{Type: EventMove, Move: uci, SAN: san, Game: g.snapshot()}
+	g.broadcast(ev)
+	g.analyze()
+	return ev, nil
+}
+
+func (g *game) broadcast(ev Event) {
+	for sub := range g.subs {
+		if ev.Type == EventAnalysis && !sub.analysis {
+			continue
+		}
+		sub.send(ev)
+	}
+}
+
+// stream of game starts with the whole game
+func (g *game) subscribe(analysis bool) *subscriber {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sub := newSubscriber(analysis)
+	g.subs[sub] = true
+	sub.send(Event{Type: EventGame, Game: g.snapshot()})
+	if analysis && g.stop == nil {
+		g.analyze()
+	}
+	return sub
+}
+
+func (g *game) unsubscribe(sub *subscriber) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.subs, sub)
+	sub.close()
+	if !g.wantsAnalysis() {
+		g.stopAnalysis()
+	}
+}
+
+// game is deleted: streams are closed
+func (g *game) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for sub := range g.subs {
+		sub.close()
+	}
+	g.subs = map[*subscriber]bool{}
+	g.stopAnalysis()
+}
+
+func (g *game) wantsAnalysis() bool {
+	for sub := range g.subs {
+		if sub.analysis {
+			return true
+		}
+	}
+	return false
+}
+
+// ---- Analysis of streams ----
+
+// analysis of current position for subscribers, the previous one is stopped (g.mu is held);
+// the engine is created and initialized outside the lock
+func (g *game) analyze() {
+	g.stopAnalysis()
+	if !g.wantsAnalysis() || g.over() {
+		return
+	}
+	b := g.gb.CurrentPosition()
+	fen := g.gb.FEN()
+	stop := make(chan struct{})
+	g.stop = stop
+	go g.runAnalysis(fen, b, stop)
+}
+
+// analysis is sent until it's done or stop is closed
+func (g *game) runAnalysis(fen string, b base.Board, stop chan struct{}) {
+	e := g.srv.NewEngine()
+	defer e.Close()
+	if err := e.Init(); err != nil {
+		g.srv.logger.Errorf("error init engine: %v", err)
+		g.analysisDone(stop)
+		return
+	}
+	if err := e.SetPosition(moves.CloneBoard(&b)); err != nil {
+		g.analysisDone(stop)
+		return
+	}
+	infos := make(chan engine.AnalysisInfo, streamQueue)
+	defer e.Subscribe(infos)()
+	// stopped while the engine was initialized
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	if err := e.StartAnalysis(engine.SearchParams{MaxTimeMs: g.srv.analysisTime().Milliseconds()}); err != nil {
+		g.srv.logger.Errorf("error start analysis: %v", err)
+		g.analysisDone(stop)
+		return
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		e.WaitDone()
+		close(finished)
+	}()
+	for {
+		select {
+		case info := <-infos:
+			g.publish(fen, &b, info, false)
+		case <-stop:
+			_ = e.StopAnalysis()
+			<-finished
+			return
+		case <-finished:
+			g.publish(fen, &b, e.BestNow(), true)
+			g.analysisDone(stop)
+			return
+		}
+	}
+}
+
+// finished analysis is forgotten unless a new one has started
+func (g *game) analysisDone(stop chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stop == stop {
+		g.stop = nil
+	}
+}
+
+func (g *game) stopAnalysis() {
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
+}
+
+// analysis info is sent if its position is still current
+func (g *game) publish(fen string, b *base.Board, info engine.AnalysisInfo, done bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.gb.FEN() != fen || info.Depth == 0 && !done {
+		return
+	}
+	g.broadcast(Event{Type: EventAnalysis, Analysis: analysisOf(fen, b, info, done)})
+}
@@ -0,0 +1,499 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/logx"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// analysis of stream is not longer
+	DefaultAnalysisTime = 10 * time.Second
+	// search of engine move or analysis request is not longer
+	maxSearchTime = 60 * time.Second
+	// games of server (DELETE frees them)
+	maxGames = 1000
+	// events of slow stream are queued up to
+	streamQueue = 64
+	maxBody     = 64 * 1024
+)
+
+type Server struct {
+	NewEngine    func() engine.Engine // engine of moves and analysis
+	AnalysisTime time.Duration        // 0 - default
+	Static       string               // directory of static files ("/"), e.g. WASM build
+
+	logger logx.Logger
+	mu     sync.Mutex
+	games  map[string]*game
+	next   int
+}
+
+func NewServer(logger logx.Logger, newEngine func() engine.Engine) *Server {
+	return &Server{NewEngine: newEngine, logger: logger, games: map[string]*game{}}
+}
+
+func (s *Server) analysisTime() time.Duration {
+	if s.AnalysisTime <= 0 {
+		return DefaultAnalysisTime
+	}
+	return s.AnalysisTime
+}
+
+// listen on addr (":8080") until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	hs := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = hs.Shutdown(sctx)
+	}()
+	s.logger.Infof("http api on %s", addr)
+	if err := hs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/games", s.handleList)
+	mux.HandleFunc("POST /api/games", s.handleCreate)
+	mux.HandleFunc("GET /api/games/{id}", s.withGame(s.handleGet))
+	mux.HandleFunc("DELETE /api/games/{id}", s.handleDelete)
+	mux.HandleFunc("POST /api/games/{id}/moves", s.withGame(s.handleMove))
+	mux.HandleFunc("POST /api/games/{id}/engine", s.withGame(s.handleEngine))
+	mux.HandleFunc("GET /api/games/{id}/analysis", s.withGame(s.handleAnalysis))
+	mux.HandleFunc("GET /api/games/{id}/fen", s.withGame(s.handleFEN))
+	mux.HandleFunc("GET /api/games/{id}/pgn", s.withGame(s.handlePGN))
+	mux.HandleFunc("GET /api/games/{id}/stream", s.withGame(s.handleStream))
+	mux.HandleFunc("GET /api/games/{id}/ws", s.withGame(s.handleWS))
+	if s.Static != "" {
+		mux.Handle("GET /", http.FileServer(http.Dir(s.Static)))
+	}
+	return cors(mux)
+}
+
+// requests of other origins (WASM page of other server, scripts of browser)
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Content-Type")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ---- Responses ----
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// body of request (empty body - zero value)
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) withGame(h func(w http.ResponseWriter, r *http.Request, g *game)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		g := s.games[r.PathValue("id")]
+		s.mu.Unlock()
+		if g == nil {
+			writeError(w, http.StatusNotFound, errors.New("game not found"))
+			return
+		}
+		h(w, r, g)
+	}
+}
+
+// ---- Games ----
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	list := make([]*game, 0, len(s.games))
+	for _, g := range s.games {
+		list = append(list, g)
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.Atoi(list[i].id)
+		b, _ := strconv.Atoi(list[j].id)
+		return a < b
+	})
+	res := make([]*Game, 0, len(list))
+	for _, g := range list {
+		g.mu.Lock()
+		res = append(res, g.snapshot())
+		g.mu.Unlock()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req CreateRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.mu.Lock()
+	if len(s.games) >= maxGames {
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, errors.New("too many games"))
+		return
+	}
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.mu.Unlock()
+
+	g, err := newGame(id, s, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid FEN: %v", err))
+		return
+	}
+	s.mu.Lock()
+	s.games[id] = g
+	s.mu.Unlock()
+	s.logger.Infof("http api: game %s is created", id)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w.Header().Set("Location", "/api/games/"+id)
+	writeJSON(w, http.StatusCreated, g.snapshot())
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, g *game) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeJSON(w, http.StatusOK, g.snapshot())
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	g := s.games[id]
+	delete(s.games, id)
+	s.mu.Unlock()
+	if g == nil {
+		writeError(w, http.StatusNotFound, errors.New("game not found"))
+		return
+	}
+	g.close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request, g *game) {
+	var req MoveRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ev, err := g.play(req.Move)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ev.Game)
+}
+
+func (s *Server) handleFEN(w http.ResponseWriter, r *http.Request, g *game) {
+	g.mu.Lock()
+	fen := g.gb.FEN()
+	g.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, fen)
+}
+
+func (s *Server) handlePGN(w http.ResponseWriter, r *http.Request, g *game) {
+	var sb strings.Builder
+	g.mu.Lock()
+	err := g.gb.PGN(&sb)
+	g.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	fmt.Fprint(w, sb.String())
+}
+
+// ---- Engine ----
+
+// limits of search by level (and movetime, depth)
+func (req EngineRequest) params() (engine.SearchParams, error) {
+	level := req.Level
+	if level == 0 {
+		level = DefaultLevel
+	}
+	if level < MinLevel || level > MaxLevel {
+		return engine.SearchParams{}, fmt.Errorf("level must be %d..%d", MinLevel, MaxLevel)
+	}
+	p := engine.LevelToParams(engine.LevelAnalyze(level - 1))
+	if req.MoveTimeMs > 0 {
+		p.MaxTimeMs = min(req.MoveTimeMs, maxSearchTime.Milliseconds())
+	}
+	if req.Depth > 0 {
+		p.MaxDepth = req.Depth
+	}
+	return p, nil
+}
+
+// engine searches current position outside of lock, stopped if request is canceled
+func (s *Server) search(ctx context.Context, g *game, params engine.SearchParams) (engine.AnalysisInfo, string, error) {
+	g.mu.Lock()
+	if g.over() {
+		g.mu.Unlock()
+		return engine.AnalysisInfo{}, "", errors.New("game is over")
+	}
+	if g.thinking {
+		g.mu.Unlock()
+		return engine.AnalysisInfo{}, "", errors.New("engine is thinking")
+	}
+	g.thinking = true
+	b, fen := g.gb.CurrentPosition(), g.gb.FEN()
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.thinking = false
+		g.mu.Unlock()
+	}()
+
+	e := s.NewEngine()
+	if err := e.Init(); err != nil {
+		return engine.AnalysisInfo{}, "", err
+	}
+	defer e.Close()
+	if err := e.SetPosition(moves.CloneBoard(&b)); err != nil {
+		return engine.AnalysisInfo{}, "", err
+	}
+	params.Infinite = false
+	if params.MaxTimeMs == 0 || params.MaxTimeMs > maxSearchTime.Milliseconds() {
+		params.MaxTimeMs = maxSearchTime.Milliseconds()
+	}
+	if err := e.StartAnalysis(params); err != nil {
+		return engine.AnalysisInfo{}, "", err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = e.StopAnalysis()
+		case <-done:
+		}
+	}()
+	e.WaitDone()
+	close(done)
+	if ctx.Err() != nil {
+		return engine.AnalysisInfo{}, "", ctx.Err()
+	}
+	return e.BestNow(), fen, nil
+}
+
+func (s *Server) handleEngine(w http.ResponseWriter, r *http.Request, g *game) {
+	var req EngineRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	res, status, err := s.engineMove(r.Context(), g, req)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// engine plays move at level
+func (s *Server) engineMove(ctx context.Context, g *game, req EngineRequest) (*EngineMove, int, error) {
+	params, err := req.params()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	info, fen, err := s.search(ctx, g, params)
+	if err != nil {
+		return nil, http.StatusConflict, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.gb.FEN() != fen {
+		return nil, http.StatusConflict, errors.New("position is changed")
+	}
+	b := g.gb.CurrentPosition()
+	mv := info.GetBestMove(b.Mailbox)
+	if mv == nil {
+		return nil, http.StatusInternalServerError, errors.New("engine has no move")
+	}
+	a := analysisOf(fen, &b, info, true)
+	ev, err := g.play(moves.MoveToUCI(&b, *mv))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	s.logger.Infof("http api: engine move %s in game %s", ev.SAN, g.id)
+	return &EngineMove{Move: ev.Move, SAN: ev.SAN, Analysis: a, Game: ev.Game}, http.StatusOK, nil
+}
+
+// analysis of current position (movetime 1s by default)
+func (s *Server) handleAnalysis(w http.ResponseWriter, r *http.Request, g *game) {
+	params := engine.SearchParams{MaxTimeMs: 1000}
+	q := r.URL.Query()
+	if v := q.Get("movetime"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid movetime"))
+			return
+		}
+		params.MaxTimeMs = ms
+	}
+	if v := q.Get("depth"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid depth"))
+			return
+		}
+		params.MaxDepth = d
+	}
+	info, fen, err := s.search(r.Context(), g, params)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	// position of search is taken from FEN: game may go on
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, analysisOf(fen, b, info, true))
+}
+
+// ---- Streams ----
+
+func wantsAnalysis(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("analysis"))
+	return v
+}
+
+// events as JSON lines until game is deleted or client leaves
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, g *game) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	sub := g.subscribe(wantsAnalysis(r))
+	defer g.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev := <-sub.out:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sub.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// events as websocket messages, client sends moves and engine requests
+func (s *Server) handleWS(w http.ResponseWriter, r *http.Request, g *game) {
+	c, err := upgradeWS(w, r)
+	if err != nil {
+		s.logger.Errorf("http api: %v", err)
+		return
+	}
+	sub := g.subscribe(wantsAnalysis(r))
+	defer g.unsubscribe(sub)
+	defer c.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer sub.close()
+		defer cancel()
+		for {
+			data, err := c.readMessage()
+			if err != nil {
+				return
+			}
+			var cmd Command
+			if err := json.Unmarshal(data, &cmd); err != nil {
+				sub.send(Event{Type: EventError, Error: "invalid command: " + err.Error()})
+				continue
+			}
+			if err := s.command(ctx, g, sub, cmd); err != nil {
+				sub.send(Event{Type: EventError, Error: err.Error()})
+			}
+		}
+	}()
+	for {
+		select {
+		case ev := <-sub.out:
+			if err := c.writeJSON(ev); err != nil {
+				return
+			}
+		case <-sub.done:
+			c.closeWith(wsCloseNormal)
+			return
+		}
+	}
+}
+
+// command of websocket client, the result comes by events of stream
+func (s *Server) command(ctx context.Context, g *game, sub *subscriber, cmd Command) error {
+	switch cmd.Type {
+	case CommandMove:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		_, err := g.play(cmd.Move)
+		return err
+	case CommandEngine:
+		// search does not block reading of commands
+		go func() {
+			if _, _, err := s.engineMove(ctx, g, cmd.EngineRequest); err != nil && ctx.Err() == nil {
+				sub.send(Event{Type: EventError, Error: err.Error()})
+			}
+		}()
+		return nil
+	}
+	return errors.New("unknown command " + cmd.Type)
+}
@@ -0,0 +1,287 @@
+package lichess
+
+import (
+	"math"
+	"strings"
+)
+
+// --------------------------------------------------
+// Lichess Board/Bot API: client, bot runner and local mock server
+// --------------------------------------------------
+// accounts are authorized by tokens (Authorization: Bearer), events of account
+// and states of games come as NDJSON streams (empty lines are keep-alives),
+// moves and answers are POST requests; bot accounts use /api/bot/..., others
+// /api/board/...
+//
+//	GET  /api/account                          -> Account
+//	GET  /api/account/playing                  -> {"nowPlaying":[GameInfo]}
+//	POST /api/bot/account/upgrade
+//	GET  /api/stream/event                     -> Event per line
+//	POST /api/challenge/{username}             rated, clock.limit, clock.increment, days, color, fen -> Challenge
+//	POST /api/challenge/{id}/accept|decline|cancel
+//	GET  /api/board/game/stream/{id}           -> GameEvent per line (gameFull first)
+//	POST /api/board/game/{id}/move/{uci}       ?offeringDraw=true
+//	POST /api/board/game/{id}/resign|abort|claim-victory
+//	POST /api/board/game/{id}/draw/{yes|no}, takeback/{yes|no}
+//	POST /api/board/game/{id}/chat             room, text
+
+const DefaultURL = "https://lichess.org"
+
+// types of events of account stream
+const (
+	EventGameStart         = "gameStart"
+	EventGameFinish        = "gameFinish"
+	EventChallenge         = "challenge"
+	EventChallengeCanceled = "challengeCanceled"
+	EventChallengeDeclined = "challengeDeclined"
+)
+
+// types of events of game stream
+const (
+	EventGameFull     = "gameFull" // the first event: players, clock and state
+	EventGameState    = "gameState"
+	EventChatLine     = "chatLine"
+	EventOpponentGone = "opponentGone"
+)
+
+// statuses of game
+const (
+	StatusCreated       = "created"
+	StatusStarted       = "started"
+	StatusAborted       = "aborted"
+	StatusMate          = "mate"
+	StatusResign        = "resign"
+	StatusStalemate     = "stalemate"
+	StatusTimeout       = "timeout" // victory is claimed, the opponent left
+	StatusDraw          = "draw"
+	StatusOutOfTime     = "outoftime"
+	StatusCheat         = "cheat"
+	StatusNoStart       = "noStart"
+	StatusUnknownFinish = "unknownFinish"
+	StatusVariantEnd    = "variantEnd"
+)
+
+// ids of statuses (status of gameStart and gameFinish)
+var statusIDs = map[string]int{
+	StatusCreated: 10, StatusStarted: 20, StatusAborted: 25, StatusMate: 30, StatusResign: 31,
+	StatusStalemate: 32, StatusTimeout: 33, StatusDraw: 34, StatusOutOfTime: 35, StatusCheat: 36,
+	StatusNoStart: 37, StatusUnknownFinish: 38, StatusVariantEnd: 60,
+}
+
+const (
+	ColorWhite  = "white"
+	ColorBlack  = "black"
+	ColorRandom = "random"
+)
+
+const (
+	VariantStandard     = "standard"
+	VariantFromPosition = "fromPosition"
+
+	// initialFen of game from the start position
+	StartPos = "startpos"
+
+	// chat rooms
+	RoomPlayer    = "player"
+	RoomSpectator = "spectator"
+
+	TitleBot = "BOT"
+)
+
+// reasons of declined challenge
+const (
+	DeclineGeneric     = "generic"
+	DeclineLater       = "later"
+	DeclineTooFast     = "tooFast"
+	DeclineTooSlow     = "tooSlow"
+	DeclineTimeControl = "timeControl"
+	DeclineRated       = "rated"
+	DeclineCasual      = "casual"
+	DeclineStandard    = "standard"
+	DeclineVariant     = "variant"
+	DeclineNoBot       = "noBot"
+	DeclineOnlyBot     = "onlyBot"
+)
+
+// time of correspondence and unlimited games (wtime, btime)
+const NoClock = math.MaxInt32
+
+// ---- Types of API ----
+
+type Account struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Title    string `json:"title,omitempty"`
+}
+
+func (a *Account) IsBot() bool { return a.Title == TitleBot }
+
+// player of challenge or game
+type User struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Rating      int    `json:"rating,omitempty"`
+	Provisional bool   `json:"provisional,omitempty"`
+	AILevel     int    `json:"aiLevel,omitempty"` // Stockfish of Lichess
+}
+
+type Variant struct {
+	Key   string `json:"key"`
+	Name  string `json:"name,omitempty"`
+	Short string `json:"short,omitempty"`
+}
+
+type TimeControl struct {
+	Type        string `json:"type"` // clock, correspondence, unlimited
+	Limit       int    `json:"limit,omitempty"`
+	Increment   int    `json:"increment,omitempty"`
+	Show        string `json:"show,omitempty"`
+	DaysPerTurn int    `json:"daysPerTurn,omitempty"`
+}
+
+type Challenge struct {
+	ID               string      `json:"id"`
+	URL              string      `json:"url,omitempty"`
+	Status           string      `json:"status"` // created, offline, canceled, declined, accepted
+	Challenger       *User       `json:"challenger"`
+	DestUser         *User       `json:"destUser"`
+	Variant          Variant     `json:"variant"`
+	Rated            bool        `json:"rated"`
+	Speed            string      `json:"speed"`
+	TimeControl      TimeControl `json:"timeControl"`
+	Color            string      `json:"color"`                // color of challenger: white, black, random
+	FinalColor       string      `json:"finalColor,omitempty"` // color of challenger in game
+	InitialFEN       string      `json:"initialFen,omitempty"`
+	DeclineReason    string      `json:"declineReason,omitempty"`
+	DeclineReasonKey string      `json:"declineReasonKey,omitempty"`
+}
+
+// options of new challenge
+type ChallengeRequest struct {
+	Rated     bool
+	Limit     int    // seconds of clock (0 with Increment 0 - no clock)
+	Increment int    // seconds
+	Days      int    // correspondence: days per move
+	Color     string // white, black, random ("" - random)
+	FEN       string // position of start ("" - standard)
+}
+
+type GameStatus struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// game of account events and playing list
+type GameInfo struct {
+	GameID      string     `json:"gameId"`
+	FullID      string     `json:"fullId,omitempty"`
+	Color       string     `json:"color"` // color of account
+	FEN         string     `json:"fen"`
+	HasMoved    bool       `json:"hasMoved"`
+	IsMyTurn    bool       `json:"isMyTurn"`
+	LastMove    string     `json:"lastMove"`
+	Opponent    Opponent   `json:"opponent"`
+	Rated       bool       `json:"rated"`
+	Speed       string     `json:"speed"`
+	Source      string     `json:"source,omitempty"`
+	Variant     Variant    `json:"variant"`
+	SecondsLeft int        `json:"secondsLeft,omitempty"`
+	Status      GameStatus `json:"status"`
+	Winner      string     `json:"winner,omitempty"`
+}
+
+type Opponent struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating,omitempty"`
+	AI       int    `json:"ai,omitempty"`
+}
+
+// event of account stream
+type Event struct {
+	Type      string     `json:"type"`
+	Game      *GameInfo  `json:"game,omitempty"`      // gameStart, gameFinish
+	Challenge *Challenge `json:"challenge,omitempty"` // challenge*
+}
+
+// state of game: moves from the initial position and clocks
+type GameState struct {
+	Type      string `json:"type"`
+	Moves     string `json:"moves,omitempty"` // UCI separated by spaces
+	WTime     int64  `json:"wtime,omitempty"` // ms
+	BTime     int64  `json:"btime,omitempty"`
+	WInc      int64  `json:"winc,omitempty"`
+	BInc      int64  `json:"binc,omitempty"`
+	WDraw     bool   `json:"wdraw,omitempty"` // draw offer of white
+	BDraw     bool   `json:"bdraw,omitempty"`
+	WTakeback bool   `json:"wtakeback,omitempty"`
+	BTakeback bool   `json:"btakeback,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Winner    string `json:"winner,omitempty"` // white, black ("" - draw or game goes on)
+}
+
+func (s *GameState) MoveList() []string {
+	return strings.Fields(s.Moves)
+}
+
+func (s *GameState) Over() bool {
+	return s.Status != StatusCreated && s.Status != StatusStarted && s.Status != ""
+}
+
+type GameClock struct {
+	Initial   int64 `json:"initial"` // ms
+	Increment int64 `json:"increment"`
+}
+
+// event of game stream: fields by type
+type GameEvent struct {
+	GameState // gameState (Type is of event)
+
+	// gameFull
+	ID         string     `json:"id,omitempty"`
+	Variant    *Variant   `json:"variant,omitempty"`
+	Speed      string     `json:"speed,omitempty"`
+	Rated      bool       `json:"rated,omitempty"`
+	InitialFEN string     `json:"initialFen,omitempty"` // startpos or FEN
+	White      *User      `json:"white,omitempty"`
+	Black      *User      `json:"black,omitempty"`
+	Clock      *GameClock `json:"clock,omitempty"`
+	State      *GameState `json:"state,omitempty"`
+
+	// chatLine
+	Username string `json:"username,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Room     string `json:"room,omitempty"`
+
+	// opponentGone
+	Gone              bool `json:"gone,omitempty"`
+	ClaimWinInSeconds int  `json:"claimWinInSeconds,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type okResponse struct {
+	OK bool `json:"ok"`
+}
+
+// speed of time control: estimated time is limit + 40 increments
+func speedOf(limit, increment, days int) string {
+	if days > 0 || limit == 0 && increment == 0 {
+		return "correspondence"
+	}
+	switch est := limit + 40*increment; {
+	case est < 30:
+		return "ultraBullet"
+	case est < 180:
+		return "bullet"
+	case est < 480:
+		return "blitz"
+	case est < 1500:
+		return "rapid"
+	default:
+		return "classical"
+	}
+}
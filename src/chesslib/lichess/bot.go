@@ -0,0 +1,269 @@
+package lichess
+
+import (
+	"context"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/logx"
+	"sync"
+	"time"
+)
+
+const (
+	// games at the same time
+	DefaultMaxGames = 1
+	// event stream is opened again after
+	reconnectDelay = 5 * time.Second
+	// move is sent again after errors
+	moveRetries = 3
+)
+
+// ---- Bot: engine plays games of account ----
+// challenges are accepted by Accept while there are free games, every game
+// gets own engine on GameBuilder, draw offers are answered by the engine
+
+type Bot struct {
+	NewEngine func() engine.Engine      // engine of every game
+	Level     engine.LevelAnalyze       // limits of search (the clock limits it too)
+	Threads   int                       // 0 - engine default
+	MaxGames  int                       // 0 - DefaultMaxGames
+	Accept    func(c *Challenge) string // reason of decline ("" - accept), nil - AcceptStandard
+	Greeting  string                    // chat message at the start of game ("" - none)
+
+	client  *Client
+	logger  logx.Logger
+	account *Account
+	mu      sync.Mutex
+	games   map[string]bool // running games
+}
+
+func NewBot(logger logx.Logger, client *Client, newEngine func() engine.Engine) *Bot {
+	return &Bot{NewEngine: newEngine, Level: engine.LevelFive, client: client, logger: logger, games: map[string]bool{}}
+}
+
+// standard chess and positions of any time control
+func AcceptStandard(c *Challenge) string {
+	switch c.Variant.Key {
+	case VariantStandard, VariantFromPosition:
+		return ""
+	}
+	return DeclineVariant
+}
+
+// events of account are handled until ctx is done, the stream is opened again if it ends
+func (b *Bot) Run(ctx context.Context) error {
+	acc, err := b.client.Account(ctx)
+	if err != nil {
+		return err
+	}
+	b.account = acc
+	b.logger.Infof("lichess bot %s (bot account: %v)", acc.Username, acc.IsBot())
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for ctx.Err() == nil {
+		events, err := b.client.StreamEvents(ctx)
+		if err != nil {
+			b.logger.Errorf("error event stream: %v", err)
+		} else {
+			for ev := range events {
+				b.handle(ctx, &wg, ev)
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(reconnectDelay):
+		}
+	}
+	return nil
+}
+
+func (b *Bot) handle(ctx context.Context, wg *sync.WaitGroup, ev Event) {
+	switch ev.Type {
+	case EventChallenge:
+		c := ev.Challenge
+		// own challenges wait for the opponent
+		if c == nil || c.Challenger != nil && c.Challenger.ID == b.account.ID {
+			return
+		}
+		if reason := b.decline(c); reason != "" {
+			b.logger.Infof("decline challenge %s: %s", c.ID, reason)
+			if err := b.client.DeclineChallenge(ctx, c.ID, reason); err != nil {
+				b.logger.Errorf("error decline challenge %s: %v", c.ID, err)
+			}
+			return
+		}
+		b.logger.Infof("accept challenge %s", c.ID)
+		if err := b.client.AcceptChallenge(ctx, c.ID); err != nil {
+			b.logger.Errorf("error accept challenge %s: %v", c.ID, err)
+		}
+	case EventGameStart:
+		if ev.Game == nil {
+			return
+		}
+		id := ev.Game.GameID
+		b.mu.Lock()
+		running := b.games[id]
+		b.games[id] = true
+		b.mu.Unlock()
+		if running {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.play(ctx, id)
+			b.mu.Lock()
+			delete(b.games, id)
+			b.mu.Unlock()
+		}()
+	case EventGameFinish:
+		if ev.Game != nil {
+			b.logger.Infof("game %s finished: %s %s", ev.Game.GameID, ev.Game.Status.Name, ev.Game.Winner)
+		}
+	case EventChallengeDeclined, EventChallengeCanceled:
+		if ev.Challenge != nil {
+			b.logger.Infof("challenge %s %s", ev.Challenge.ID, ev.Challenge.Status)
+		}
+	}
+}
+
+// reason of decline ("" - accept)
+func (b *Bot) decline(c *Challenge) string {
+	maxGames := b.MaxGames
+	if maxGames <= 0 {
+		maxGames = DefaultMaxGames
+	}
+	b.mu.Lock()
+	busy := len(b.games) >= maxGames
+	b.mu.Unlock()
+	if busy {
+		return DeclineLater
+	}
+	if b.Accept != nil {
+		return b.Accept(c)
+	}
+	return AcceptStandard(c)
+}
+
+// ---- Game of bot ----
+
+// game stream is played until the end
+func (b *Bot) play(ctx context.Context, id string) {
+	events, err := b.client.StreamGame(ctx, id)
+	if err != nil {
+		b.logger.Errorf("error game stream %s: %v", id, err)
+		return
+	}
+	var g *Game
+	var claim *time.Timer
+	// offers of the opponent are answered once
+	var drawAnswered, takebackAnswered bool
+	// moves after own move: states sent before it don't ask for a move
+	sent := 0
+	defer func() {
+		if claim != nil {
+			claim.Stop()
+		}
+		if g != nil {
+			g.Builder.CloseEngine()
+		}
+	}()
+
+	for ev := range events {
+		switch ev.Type {
+		case EventGameFull:
+			if g, err = NewGame(b.logger, &ev, b.account.ID); err != nil {
+				b.logger.Errorf("error game %s: %v", id, err)
+				return
+			}
+			g.Builder.SetEngineWorker(b.NewEngine())
+			g.Builder.SetEngineLevel(b.Level)
+			g.Builder.SetEngineThreads(b.Threads)
+			b.logger.Infof("game %s: %s - %s", id, g.Builder.InfoGame().GetWhitePlayer(), g.Builder.InfoGame().GetBlackPlayer())
+			if b.Greeting != "" && len(g.State.MoveList()) < 2 {
+				_ = b.client.Chat(ctx, id, RoomPlayer, b.Greeting)
+			}
+		case EventGameState:
+			if g == nil {
+				continue
+			}
+			if err := g.Update(ev.GameState); err != nil {
+				b.logger.Errorf("error game %s: %v", id, err)
+				continue
+			}
+		case EventChatLine:
+			b.logger.Infof("game %s chat %s: %s", id, ev.Username, ev.Text)
+			continue
+		case EventOpponentGone:
+			if claim != nil {
+				claim.Stop()
+				claim = nil
+			}
+			if ev.Gone {
+				claim = time.AfterFunc(time.Duration(ev.ClaimWinInSeconds)*time.Second, func() {
+					if err := b.client.ClaimVictory(ctx, id); err != nil {
+						b.logger.Errorf("error claim victory %s: %v", id, err)
+					}
+				})
+			}
+			continue
+		default:
+			continue
+		}
+
+		if g.Over() {
+			b.logger.Infof("game %s over: %s", id, g.Builder.Outcome())
+			return
+		}
+		if !g.OpponentOffersDraw() {
+			drawAnswered = false
+		} else if !drawAnswered {
+			drawAnswered = true
+			b.answerDraw(ctx, g)
+		}
+		if !g.OpponentProposesTakeback() {
+			takebackAnswered = false
+		} else if !takebackAnswered {
+			takebackAnswered = true
+			if err := b.client.Takeback(ctx, id, false); err != nil {
+				b.logger.Errorf("error takeback %s: %v", id, err)
+			}
+		}
+		if g.MyTurn() && len(g.State.MoveList()) >= sent && b.move(ctx, g) {
+			sent = len(g.State.MoveList()) + 1
+		}
+	}
+}
+
+// the engine accepts draw if its score is not better than draw
+func (b *Bot) answerDraw(ctx context.Context, g *Game) {
+	accept := g.Builder.OfferDraw(!g.White)
+	b.logger.Infof("game %s draw offer, accept: %v", g.ID, accept)
+	if err := b.client.Draw(ctx, g.ID, accept); err != nil {
+		b.logger.Errorf("error draw %s: %v", g.ID, err)
+	}
+}
+
+// move of engine is sent (again after errors), rejected move is taken back
+// from builder
+func (b *Bot) move(ctx context.Context, g *Game) bool {
+	uci, err := g.EngineMove()
+	if err != nil {
+		b.logger.Errorf("error engine move %s: %v", g.ID, err)
+		return false
+	}
+	for i := 0; i < moveRetries; i++ {
+		if err = b.client.Move(ctx, g.ID, uci, false); err == nil {
+			b.logger.Debugf("game %s move %s", g.ID, uci)
+			return true
+		}
+		b.logger.Errorf("error move %s %s: %v", g.ID, uci, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Duration(i+1) * time.Second):
+		}
+	}
+	_ = g.Update(g.State)
+	return false
+}
@@ -0,0 +1,273 @@
+package lichess
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// lines of streams are not longer
+const maxLine = 1 << 20
+
+// events of streams are queued up to
+const streamQueue = 64
+
+// ---- Client ----
+// requests of account by token, games of bot accounts go to /api/bot/...
+
+type Client struct {
+	Bot bool // bot account (set by Account)
+
+	base  string
+	token string
+	hc    *http.Client
+}
+
+// "https://lichess.org" (DefaultURL) or address of mock server
+func NewClient(baseURL, token string) *Client {
+	return &Client{base: strings.TrimRight(baseURL, "/"), token: token, hc: &http.Client{}}
+}
+
+func (c *Client) request(ctx context.Context, method, path string, form url.Values) (*http.Response, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// request with JSON answer (out nil - answer is skipped)
+func (c *Client) do(ctx context.Context, method, path string, form url.Values, out any) error {
+	resp, err := c.request(ctx, method, path, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// error of server by status of response
+func responseError(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var e errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		return fmt.Errorf("lichess: %s", resp.Status)
+	}
+	return fmt.Errorf("lichess: %s", e.Error)
+}
+
+// lines of NDJSON stream are decoded to T until ctx is done or stream ends (channel is closed)
+func stream[T any](ctx context.Context, c *Client, path string) (<-chan T, error) {
+	resp, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan T, streamQueue)
+	go func() {
+		defer close(out)
+		defer resp.Body.Close()
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 4096), maxLine)
+		for sc.Scan() {
+			line := sc.Bytes()
+			// keep-alive
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var ev T
+			if err := json.Unmarshal(line, &ev); err != nil {
+				continue
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (c *Client) gamePath(id string) string {
+	if c.Bot {
+		return "/api/bot/game/" + url.PathEscape(id)
+	}
+	return "/api/board/game/" + url.PathEscape(id)
+}
+
+// ---- Account ----
+
+// account of token, Bot is set by its title
+func (c *Client) Account(ctx context.Context) (*Account, error) {
+	var a Account
+	if err := c.do(ctx, http.MethodGet, "/api/account", nil, &a); err != nil {
+		return nil, err
+	}
+	c.Bot = a.IsBot()
+	return &a, nil
+}
+
+// ongoing games of account
+func (c *Client) Playing(ctx context.Context) ([]GameInfo, error) {
+	var res struct {
+		NowPlaying []GameInfo `json:"nowPlaying"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/account/playing", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.NowPlaying, nil
+}
+
+// account without games becomes bot account (forever)
+func (c *Client) UpgradeToBot(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodPost, "/api/bot/account/upgrade", nil, nil); err != nil {
+		return err
+	}
+	c.Bot = true
+	return nil
+}
+
+// events of account: ongoing games and open challenges come first
+func (c *Client) StreamEvents(ctx context.Context) (<-chan Event, error) {
+	return stream[Event](ctx, c, "/api/stream/event")
+}
+
+// ---- Challenges ----
+
+func (c *Client) Challenge(ctx context.Context, username string, req ChallengeRequest) (*Challenge, error) {
+	form := url.Values{}
+	form.Set("rated", strconv.FormatBool(req.Rated))
+	if req.Days > 0 {
+		form.Set("days", strconv.Itoa(req.Days))
+	} else if req.Limit > 0 || req.Increment > 0 {
+		form.Set("clock.limit", strconv.Itoa(req.Limit))
+		form.Set("clock.increment", strconv.Itoa(req.Increment))
+	}
+	if req.Color != "" {
+		form.Set("color", req.Color)
+	}
+	if req.FEN != "" {
+		form.Set("variant", VariantFromPosition)
+		form.Set("fen", req.FEN)
+	}
+	// challenge is the answer or its field "challenge" (older servers)
+	var res struct {
+		Challenge
+		Inner *Challenge `json:"challenge"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/challenge/"+url.PathEscape(username), form, &res); err != nil {
+		return nil, err
+	}
+	if res.Inner != nil {
+		return res.Inner, nil
+	}
+	if res.ID == "" {
+		return nil, errors.New("lichess: empty challenge")
+	}
+	return &res.Challenge, nil
+}
+
+func (c *Client) AcceptChallenge(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/challenge/"+url.PathEscape(id)+"/accept", nil, nil)
+}
+
+// reason: Decline* ("" - generic)
+func (c *Client) DeclineChallenge(ctx context.Context, id, reason string) error {
+	var form url.Values
+	if reason != "" {
+		form = url.Values{"reason": {reason}}
+	}
+	return c.do(ctx, http.MethodPost, "/api/challenge/"+url.PathEscape(id)+"/decline", form, nil)
+}
+
+func (c *Client) CancelChallenge(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/challenge/"+url.PathEscape(id)+"/cancel", nil, nil)
+}
+
+// ---- Games ----
+
+// events of game: gameFull first, then gameState of every move until the end
+func (c *Client) StreamGame(ctx context.Context, id string) (<-chan GameEvent, error) {
+	if c.Bot {
+		return stream[GameEvent](ctx, c, "/api/bot/game/stream/"+url.PathEscape(id))
+	}
+	return stream[GameEvent](ctx, c, "/api/board/game/stream/"+url.PathEscape(id))
+}
+
+// move of UCI, draw is offered (or accepted) with it
+func (c *Client) Move(ctx context.Context, id, uci string, offerDraw bool) error {
+	path := c.gamePath(id) + "/move/" + url.PathEscape(uci)
+	if offerDraw {
+		path += "?offeringDraw=true"
+	}
+	return c.do(ctx, http.MethodPost, path, nil, nil)
+}
+
+func (c *Client) Resign(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, c.gamePath(id)+"/resign", nil, nil)
+}
+
+// game without moves of both players is ended without result
+func (c *Client) Abort(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, c.gamePath(id)+"/abort", nil, nil)
+}
+
+// victory after the opponent left the game (claimWinInSeconds of opponentGone)
+func (c *Client) ClaimVictory(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, c.gamePath(id)+"/claim-victory", nil, nil)
+}
+
+// draw is offered (or offer of the opponent is accepted) or declined
+func (c *Client) Draw(ctx context.Context, id string, accept bool) error {
+	return c.do(ctx, http.MethodPost, c.gamePath(id)+"/draw/"+yesNo(accept), nil, nil)
+}
+
+// takeback is proposed (or proposal of the opponent is accepted) or declined
+func (c *Client) Takeback(ctx context.Context, id string, accept bool) error {
+	return c.do(ctx, http.MethodPost, c.gamePath(id)+"/takeback/"+yesNo(accept), nil, nil)
+}
+
+// room: player or spectator
+func (c *Client) Chat(ctx context.Context, id, room, text string) error {
+	form := url.Values{"room": {room}, "text": {text}}
+	return c.do(ctx, http.MethodPost, c.gamePath(id)+"/chat", form, nil)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,225 @@
+package lichess
+
+import (
+	"errors"
+	"evilchess/src/chesslib"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/logx"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Game: stream of game on GameBuilder ----
+// moves of states are played on the builder (takebacks undo them), the status
+// of server ends the game by outcome of builder
+
+type Game struct {
+	ID      string
+	Full    GameEvent // gameFull: players, clock, initial position
+	State   GameState // the last state
+	White   bool      // account plays white
+	Builder *chesslib.GameBuilder
+
+	played  []string  // UCI moves on builder
+	stateAt time.Time // state is received at (clocks run since)
+}
+
+// game of gameFull event, color of account by its id
+func NewGame(logger logx.Logger, full *GameEvent, accountID string) (*Game, error) {
+	if full.Type != EventGameFull {
+		return nil, fmt.Errorf("%s instead of %s", full.Type, EventGameFull)
+	}
+	if full.Variant != nil && full.Variant.Key != VariantStandard && full.Variant.Key != VariantFromPosition {
+		return nil, errors.New("unsupported variant " + full.Variant.Key)
+	}
+	g := &Game{ID: full.ID, Full: *full, Builder: chesslib.NewBuilderBoard(logger)}
+	g.White = full.White != nil && strings.EqualFold(full.White.ID, accountID)
+	if full.InitialFEN == "" || full.InitialFEN == StartPos {
+		g.Builder.CreateClassic()
+	} else if _, err := g.Builder.CreateFromFEN(full.InitialFEN); err != nil {
+		return nil, err
+	}
+
+	info := g.Builder.InfoGame()
+	mode := "Casual"
+	if full.Rated {
+		mode = "Rated"
+	}
+	info.SetEvent(strings.TrimSpace(mode + " " + full.Speed + " game"))
+	info.SetSite(full.ID)
+	info.SetDate(time.Now().Format("2006.01.02"))
+	if full.White != nil {
+		info.SetWhitePlayer(playerName(full.White))
+		info.SetWhiteElo(strconv.Itoa(full.White.Rating))
+	}
+	if full.Black != nil {
+		info.SetBlackPlayer(playerName(full.Black))
+		info.SetBlackElo(strconv.Itoa(full.Black.Rating))
+	}
+	if full.State != nil {
+		if err := g.Update(*full.State); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func playerName(u *User) string {
+	switch {
+	case u.AILevel > 0:
+		return "Stockfish level " + strconv.Itoa(u.AILevel)
+	case u.Name != "":
+		return u.Name
+	}
+	return u.ID
+}
+
+// moves of state are synced with builder, status ends game
+func (g *Game) Update(st GameState) error {
+	list := st.MoveList()
+	common := 0
+	for common < len(g.played) && common < len(list) && g.played[common] == list[common] {
+		common++
+	}
+	// outcome of builder is set by server only (e.g. draw accepted locally)
+	if !st.Over() {
+		g.Builder.ClearOutcome()
+	}
+	for len(g.played) > common {
+		g.Builder.Undo()
+		g.played = g.played[:len(g.played)-1]
+	}
+	for _, s := range list[common:] {
+		b := g.Builder.CurrentPosition()
+		mv, err := moves.UCIToMove(&b, s)
+		if err != nil {
+			return err
+		}
+		if g.Builder.Move(mv) == base.InvalidGame {
+			return errors.New("illegal move " + s)
+		}
+		g.played = append(g.played, s)
+	}
+	g.State, g.stateAt = st, time.Now()
+	g.applyStatus()
+	return nil
+}
+
+// outcome of builder by status and winner of state
+func (g *Game) applyStatus() {
+	gb := g.Builder
+	st := g.State
+	b := gb.CurrentPosition()
+	// loser: the opposite of winner, side to move without winner
+	loserWhite := st.Winner == ColorBlack || st.Winner == "" && b.WhiteToMove
+	switch st.Status {
+	case StatusResign:
+		gb.Resign(loserWhite)
+	case StatusOutOfTime:
+		gb.FlagFall(loserWhite)
+	case StatusTimeout:
+		gb.Abandon(loserWhite)
+	case StatusDraw:
+		if _, ok := gb.ClaimDraw(); !ok && !gb.Outcome().Over() {
+			gb.AgreeDraw()
+		}
+	case StatusCheat, StatusNoStart, StatusUnknownFinish, StatusVariantEnd:
+		result := convpgn.PGNStatusDraw
+		switch st.Winner {
+		case ColorWhite:
+			result = convpgn.PGNStatusWW
+		case ColorBlack:
+			result = convpgn.PGNStatusBW
+		}
+		gb.Adjudicate(result, st.Status)
+	}
+	// mate and stalemate are of board, aborted game has no result
+}
+
+func (g *Game) Over() bool {
+	return g.State.Over()
+}
+
+// account is to move in running game
+func (g *Game) MyTurn() bool {
+	return !g.Over() && g.Builder.IsWhiteToMove() == g.White
+}
+
+func (g *Game) OpponentOffersDraw() bool {
+	if g.White {
+		return g.State.BDraw
+	}
+	return g.State.WDraw
+}
+
+func (g *Game) OpponentProposesTakeback() bool {
+	if g.White {
+		return g.State.BTakeback
+	}
+	return g.State.WTakeback
+}
+
+// UCI of move (SAN or UCI) in current position
+func (g *Game) ParseMove(s string) (string, error) {
+	b := g.Builder.CurrentPosition()
+	s = strings.TrimSpace(s)
+	mv, err := moves.UCIToMove(&b, s)
+	if err != nil {
+		if mv, err = moves.SANToMove(&b, s); err != nil {
+			return "", errors.New("invalid move " + s)
+		}
+	}
+	if !rules.IsLegalMove(&b, mv) {
+		return "", errors.New("illegal move " + s)
+	}
+	return moves.MoveToUCI(&b, mv), nil
+}
+
+// clocks of state at now (nil - correspondence or unlimited)
+func (g *Game) Clock() *clock.Clock {
+	st := g.State
+	if g.Full.Clock == nil || st.WTime >= NoClock || st.BTime >= NoClock {
+		return nil
+	}
+	wtime := time.Duration(st.WTime) * time.Millisecond
+	btime := time.Duration(st.BTime) * time.Millisecond
+	// clock of side to move runs since the state
+	if len(g.played) >= 2 {
+		if elapsed := time.Since(g.stateAt); g.Builder.IsWhiteToMove() {
+			wtime -= elapsed
+		} else {
+			btime -= elapsed
+		}
+	}
+	return clock.NewOdds(
+		clock.Sudden(max(wtime, 0), time.Duration(st.WInc)*time.Millisecond),
+		clock.Sudden(max(btime, 0), time.Duration(st.BInc)*time.Millisecond),
+	)
+}
+
+// move of engine of builder (search is limited by clocks), it is played on
+// builder and has to be sent to server
+func (g *Game) EngineMove() (string, error) {
+	b := g.Builder.CurrentPosition()
+	g.Builder.SetClock(g.Clock())
+	status := g.Builder.EngineMove()
+	// clocks are of server
+	g.Builder.SetClock(nil)
+	if status == base.InvalidGame {
+		return "", errors.New("engine has no move")
+	}
+	entries := g.Builder.HistoryMoves()
+	idx := int(g.Builder.CurrentMoveIndex())
+	if idx <= 0 || idx >= len(entries) {
+		return "", errors.New("engine has no move")
+	}
+	uci := moves.MoveToUCI(&b, entries[idx].Move)
+	g.played = append(g.played, uci)
+	return uci, nil
+}
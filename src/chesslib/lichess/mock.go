@@ -0,0 +1,506 @@
+package lichess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/logx"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMockAddr = ":9090"
+	// empty lines of streams are sent every
+	DefaultKeepAlive = 7 * time.Second
+	// victory is claimed after the opponent left the game for
+	DefaultClaimWin = 30 * time.Second
+	// rating of new accounts
+	mockRating = 1500
+	maxForm    = 64 * 1024
+)
+
+// ---- Mock server ----
+// stand-in of Lichess for offline games of clients and bots: accounts of
+// tokens, challenges, games checked by the rules with clocks, streams of
+// events and games like the Board/Bot API
+
+type MockServer struct {
+	KeepAlive time.Duration // 0 - default
+	ClaimWin  time.Duration // 0 - default
+
+	logger     logx.Logger
+	mu         sync.Mutex
+	users      map[string]*mockUser // by id
+	tokens     map[string]*mockUser
+	challenges map[string]*Challenge
+	games      map[string]*mockGame
+}
+
+type mockUser struct {
+	account Account
+	rating  int
+	streams map[*mockStream[Event]]bool
+}
+
+func (u *mockUser) user() *User {
+	return &User{ID: u.account.ID, Name: u.account.Username, Title: u.account.Title, Rating: u.rating}
+}
+
+func (u *mockUser) send(ev Event) {
+	for st := range u.streams {
+		st.send(ev)
+	}
+}
+
+func NewMockServer(logger logx.Logger) *MockServer {
+	return &MockServer{
+		logger:     logger,
+		users:      map[string]*mockUser{},
+		tokens:     map[string]*mockUser{},
+		challenges: map[string]*Challenge{},
+		games:      map[string]*mockGame{},
+	}
+}
+
+// account of token (id is lowercase name)
+func (s *MockServer) AddUser(name, token string, bot bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := strings.ToLower(name)
+	if name == "" || token == "" {
+		return errors.New("empty name or token")
+	}
+	if _, ok := s.users[id]; ok {
+		return errors.New("user exists " + name)
+	}
+	if _, ok := s.tokens[token]; ok {
+		return errors.New("token exists")
+	}
+	u := &mockUser{account: Account{ID: id, Username: name}, rating: mockRating, streams: map[*mockStream[Event]]bool{}}
+	if bot {
+		u.account.Title = TitleBot
+	}
+	s.users[id], s.tokens[token] = u, u
+	return nil
+}
+
+func (s *MockServer) keepAlive() time.Duration {
+	if s.KeepAlive <= 0 {
+		return DefaultKeepAlive
+	}
+	return s.KeepAlive
+}
+
+func (s *MockServer) claimWin() time.Duration {
+	if s.ClaimWin <= 0 {
+		return DefaultClaimWin
+	}
+	return s.ClaimWin
+}
+
+// listen on addr (":9090") until ctx is done
+func (s *MockServer) ListenAndServe(ctx context.Context, addr string) error {
+	hs := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = hs.Shutdown(sctx)
+	}()
+	s.logger.Infof("lichess mock on %s", addr)
+	if err := hs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *MockServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/account", s.withUser(s.handleAccount))
+	mux.HandleFunc("GET /api/account/playing", s.withUser(s.handlePlaying))
+	mux.HandleFunc("POST /api/bot/account/upgrade", s.withUser(s.handleUpgrade))
+	mux.HandleFunc("GET /api/stream/event", s.withUser(s.handleEvents))
+	mux.HandleFunc("POST /api/challenge/{username}", s.withUser(s.handleChallenge))
+	mux.HandleFunc("POST /api/challenge/{id}/{action}", s.withUser(s.handleChallengeAction))
+	mux.HandleFunc("GET /api/{api}/game/stream/{id}", s.withGame(s.handleGameStream))
+	mux.HandleFunc("POST /api/{api}/game/{id}/{action}", s.withGame(s.handleGameAction))
+	mux.HandleFunc("POST /api/{api}/game/{id}/{action}/{arg}", s.withGame(s.handleGameAction))
+	return mux
+}
+
+// ---- Responses ----
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+func writeOK(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, okResponse{OK: true})
+}
+
+// user of token
+func (s *MockServer) withUser(h func(w http.ResponseWriter, r *http.Request, u *mockUser)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		u := s.tokens[strings.TrimSpace(token)]
+		s.mu.Unlock()
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "No such token")
+			return
+		}
+		h(w, r, u)
+	}
+}
+
+// game of player by API of account: bot accounts use /api/bot/..., others /api/board/...
+func (s *MockServer) withGame(h func(w http.ResponseWriter, r *http.Request, u *mockUser, g *mockGame)) http.HandlerFunc {
+	return s.withUser(func(w http.ResponseWriter, r *http.Request, u *mockUser) {
+		s.mu.Lock()
+		bot := u.account.IsBot()
+		g := s.games[r.PathValue("id")]
+		s.mu.Unlock()
+		switch api := r.PathValue("api"); {
+		case api == "bot" && !bot:
+			writeError(w, http.StatusBadRequest, "This endpoint can only be used with a Bot account")
+			return
+		case api == "board" && bot:
+			writeError(w, http.StatusBadRequest, "This endpoint cannot be used with a Bot account")
+			return
+		case api != "bot" && api != "board":
+			writeError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		if g == nil || g.color(u) < 0 {
+			writeError(w, http.StatusNotFound, "No such game")
+			return
+		}
+		h(w, r, u, g)
+	})
+}
+
+// ---- Streams ----
+
+type mockStream[T any] struct {
+	out  chan T
+	done chan struct{}
+	once sync.Once
+}
+
+func newMockStream[T any]() *mockStream[T] {
+	return &mockStream[T]{out: make(chan T, streamQueue), done: make(chan struct{})}
+}
+
+// event is queued, slow stream is dropped
+func (st *mockStream[T]) send(v T) {
+	select {
+	case st.out <- v:
+	case <-st.done:
+	default:
+		st.close()
+	}
+}
+
+func (st *mockStream[T]) close() {
+	st.once.Do(func() { close(st.done) })
+}
+
+// NDJSON of stream with keep-alive lines until it is closed (queued events
+// are written) or client leaves
+func serveStream[T any](w http.ResponseWriter, r *http.Request, st *mockStream[T], keepAlive time.Duration) {
+	fl, _ := w.(http.Flusher)
+	flush := func() {
+		if fl != nil {
+			fl.Flush()
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flush()
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case v := <-st.out:
+			if enc.Encode(v) != nil {
+				return
+			}
+			flush()
+		case <-ticker.C:
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+			flush()
+		case <-st.done:
+			for {
+				select {
+				case v := <-st.out:
+					_ = enc.Encode(v)
+				default:
+					flush()
+					return
+				}
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// ---- Account ----
+
+func (s *MockServer) handleAccount(w http.ResponseWriter, r *http.Request, u *mockUser) {
+	s.mu.Lock()
+	a := u.account
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *MockServer) handlePlaying(w http.ResponseWriter, r *http.Request, u *mockUser) {
+	s.mu.Lock()
+	list := []GameInfo{}
+	for _, g := range s.sortedGames() {
+		if c := g.color(u); c >= 0 && !g.over() {
+			list = append(list, g.info(c))
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string][]GameInfo{"nowPlaying": list})
+}
+
+func (s *MockServer) handleUpgrade(w http.ResponseWriter, r *http.Request, u *mockUser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.games {
+		if g.color(u) >= 0 {
+			writeError(w, http.StatusBadRequest, "This account has already played games")
+			return
+		}
+	}
+	u.account.Title = TitleBot
+	writeOK(w)
+}
+
+// events of account: ongoing games and open challenges first
+func (s *MockServer) handleEvents(w http.ResponseWriter, r *http.Request, u *mockUser) {
+	st := newMockStream[Event]()
+	s.mu.Lock()
+	for _, g := range s.sortedGames() {
+		if c := g.color(u); c >= 0 && !g.over() {
+			info := g.info(c)
+			st.send(Event{Type: EventGameStart, Game: &info})
+		}
+	}
+	for _, c := range s.sortedChallenges() {
+		if c.Challenger.ID == u.account.ID || c.DestUser.ID == u.account.ID {
+			cc := *c
+			st.send(Event{Type: EventChallenge, Challenge: &cc})
+		}
+	}
+	u.streams[st] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(u.streams, st)
+		s.mu.Unlock()
+		st.close()
+	}()
+	serveStream(w, r, st, s.keepAlive())
+}
+
+// ---- Challenges ----
+
+// new id of game or challenge (s.mu is held)
+func (s *MockServer) newID() string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	for {
+		b := make([]byte, 8)
+		for i := range b {
+			b[i] = alphabet[rand.IntN(len(alphabet))]
+		}
+		id := string(b)
+		if _, ok := s.games[id]; ok {
+			continue
+		}
+		if _, ok := s.challenges[id]; ok {
+			continue
+		}
+		return id
+	}
+}
+
+func (s *MockServer) sortedGames() []*mockGame {
+	list := make([]*mockGame, 0, len(s.games))
+	for _, g := range s.games {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].created.Before(list[j].created) })
+	return list
+}
+
+func (s *MockServer) sortedChallenges() []*Challenge {
+	list := make([]*Challenge, 0, len(s.challenges))
+	for _, c := range s.challenges {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func formInt(r *http.Request, key string) (int, error) {
+	v := r.PostFormValue(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid " + key)
+	}
+	return n, nil
+}
+
+func (s *MockServer) handleChallenge(w http.ResponseWriter, r *http.Request, u *mockUser) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxForm)
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := formInt(r, "clock.limit")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	inc, err := formInt(r, "clock.increment")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	days, err := formInt(r, "days")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	color := r.PostFormValue("color")
+	switch color {
+	case "":
+		color = ColorRandom
+	case ColorWhite, ColorBlack, ColorRandom:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid color")
+		return
+	}
+	variant := Variant{Key: VariantStandard, Name: "Standard", Short: "Std"}
+	fen := r.PostFormValue("fen")
+	if fen != "" {
+		if _, err := convfen.ConvertFENToBoard(fen); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid fen")
+			return
+		}
+		variant = Variant{Key: VariantFromPosition, Name: "From Position", Short: "FEN"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dest := s.users[strings.ToLower(r.PathValue("username"))]
+	if dest == nil {
+		writeError(w, http.StatusNotFound, "No such user")
+		return
+	}
+	if dest == u {
+		writeError(w, http.StatusBadRequest, "You cannot challenge yourself")
+		return
+	}
+	tc := TimeControl{Type: "unlimited"}
+	switch {
+	case days > 0:
+		tc = TimeControl{Type: "correspondence", DaysPerTurn: days}
+	case limit > 0 || inc > 0:
+		tc = TimeControl{Type: "clock", Limit: limit, Increment: inc, Show: strconv.Itoa(limit/60) + "+" + strconv.Itoa(inc)}
+	}
+	c := &Challenge{
+		ID:          s.newID(),
+		Status:      "created",
+		Challenger:  u.user(),
+		DestUser:    dest.user(),
+		Variant:     variant,
+		Rated:       r.PostFormValue("rated") == "true",
+		Speed:       speedOf(limit, inc, days),
+		TimeControl: tc,
+		Color:       color,
+		InitialFEN:  fen,
+	}
+	c.URL = "/" + c.ID
+	s.challenges[c.ID] = c
+	s.logger.Infof("lichess mock: challenge %s %s -> %s", c.ID, u.account.ID, dest.account.ID)
+	for _, to := range []*mockUser{u, dest} {
+		cc := *c
+		to.send(Event{Type: EventChallenge, Challenge: &cc})
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *MockServer) handleChallengeAction(w http.ResponseWriter, r *http.Request, u *mockUser) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxForm)
+	_ = r.ParseForm()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.challenges[r.PathValue("id")]
+	if c == nil {
+		writeError(w, http.StatusNotFound, "No such challenge")
+		return
+	}
+	challenger, dest := s.users[c.Challenger.ID], s.users[c.DestUser.ID]
+	switch r.PathValue("action") {
+	case "accept":
+		if u != dest {
+			writeError(w, http.StatusBadRequest, "Not your challenge")
+			return
+		}
+		delete(s.challenges, c.ID)
+		c.Status = "accepted"
+		s.startGame(c, challenger, dest)
+	case "decline":
+		if u != dest {
+			writeError(w, http.StatusBadRequest, "Not your challenge")
+			return
+		}
+		delete(s.challenges, c.ID)
+		c.Status = "declined"
+		c.DeclineReasonKey = r.PostFormValue("reason")
+		if c.DeclineReasonKey == "" {
+			c.DeclineReasonKey = DeclineGeneric
+		}
+		c.DeclineReason = "I'm not accepting challenges at the moment."
+		if c.DeclineReasonKey != DeclineGeneric {
+			c.DeclineReason = "Declined: " + c.DeclineReasonKey
+		}
+		challenger.send(Event{Type: EventChallengeDeclined, Challenge: c})
+	case "cancel":
+		if u != challenger {
+			writeError(w, http.StatusBadRequest, "Not your challenge")
+			return
+		}
+		delete(s.challenges, c.ID)
+		c.Status = "canceled"
+		dest.send(Event{Type: EventChallengeCanceled, Challenge: c})
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeOK(w)
+}
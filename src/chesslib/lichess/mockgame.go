@@ -0,0 +1,481 @@
+package lichess
+
+import (
+	"errors"
+	"evilchess/src/chesslib"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/chesslib/outcome"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---- Game of mock server ----
+// fields are guarded by mu of server
+
+type mockGame struct {
+	id      string
+	srv     *MockServer
+	created time.Time
+
+	players    [2]*mockUser // white, black
+	rated      bool
+	speed      string
+	variant    Variant
+	initialFEN string     // "" - start position
+	clock      *GameClock // nil - correspondence or unlimited
+
+	gb       *chesslib.GameBuilder
+	moves    []string // UCI
+	status   string
+	winner   string
+	draw     [2]bool // offers of white, black
+	takeback [2]bool
+	streams  map[*mockStream[GameEvent]]int // color of player
+	gone     [2]time.Time                   // player left the game at (zero - connected or not yet)
+	flag     *time.Timer
+}
+
+func colorName(c int) string {
+	if c == 0 {
+		return ColorWhite
+	}
+	return ColorBlack
+}
+
+// game of accepted challenge (s.mu is held)
+func (s *MockServer) startGame(c *Challenge, challenger, dest *mockUser) {
+	ci := 0
+	switch c.Color {
+	case ColorBlack:
+		ci = 1
+	case ColorRandom:
+		ci = rand.IntN(2)
+	}
+	c.FinalColor = colorName(ci)
+	g := &mockGame{
+		id:         s.newID(),
+		srv:        s,
+		created:    time.Now(),
+		rated:      c.Rated,
+		speed:      c.Speed,
+		variant:    c.Variant,
+		initialFEN: c.InitialFEN,
+		gb:         chesslib.NewBuilderBoard(s.logger),
+		status:     StatusStarted,
+		streams:    map[*mockStream[GameEvent]]int{},
+	}
+	g.players[ci], g.players[1-ci] = challenger, dest
+	if c.InitialFEN == "" {
+		g.gb.CreateClassic()
+	} else if _, err := g.gb.CreateFromFEN(c.InitialFEN); err != nil {
+		g.gb.CreateClassic()
+		g.initialFEN = ""
+	}
+	if tc := c.TimeControl; tc.Type == "clock" {
+		limit, inc := time.Duration(tc.Limit)*time.Second, time.Duration(tc.Increment)*time.Second
+		g.gb.SetClock(clock.New(clock.Sudden(limit, inc)))
+		g.clock = &GameClock{Initial: limit.Milliseconds(), Increment: inc.Milliseconds()}
+	}
+	s.games[g.id] = g
+	s.logger.Infof("lichess mock: game %s %s - %s", g.id, g.players[0].account.ID, g.players[1].account.ID)
+	for i, p := range g.players {
+		info := g.info(i)
+		p.send(Event{Type: EventGameStart, Game: &info})
+	}
+}
+
+// color of player (-1 - not a player)
+func (g *mockGame) color(u *mockUser) int {
+	for i, p := range g.players {
+		if p == u {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *mockGame) over() bool {
+	return g.status != StatusStarted
+}
+
+// ---- Views ----
+
+func (g *mockGame) info(c int) GameInfo {
+	opp := g.players[1-c]
+	info := GameInfo{
+		GameID:   g.id,
+		Color:    colorName(c),
+		FEN:      g.gb.FEN(),
+		HasMoved: len(g.moves) > c,
+		IsMyTurn: !g.over() && g.gb.IsWhiteToMove() == (c == 0),
+		Opponent: Opponent{ID: opp.account.ID, Username: opp.account.Username, Rating: opp.rating},
+		Rated:    g.rated,
+		Speed:    g.speed,
+		Source:   "friend",
+		Variant:  g.variant,
+		Status:   GameStatus{ID: statusIDs[g.status], Name: g.status},
+		Winner:   g.winner,
+	}
+	if len(g.moves) > 0 {
+		info.LastMove = g.moves[len(g.moves)-1]
+	}
+	if ck := g.gb.Clock(); ck != nil {
+		info.SecondsLeft = int(max(ck.Left(c == 0), 0).Seconds())
+	}
+	return info
+}
+
+func (g *mockGame) state() GameState {
+	st := GameState{
+		Type:      EventGameState,
+		Moves:     strings.Join(g.moves, " "),
+		WTime:     NoClock,
+		BTime:     NoClock,
+		WDraw:     g.draw[0],
+		BDraw:     g.draw[1],
+		WTakeback: g.takeback[0],
+		BTakeback: g.takeback[1],
+		Status:    g.status,
+		Winner:    g.winner,
+	}
+	if c := g.gb.Clock(); c != nil {
+		st.WTime = max(c.Left(true), 0).Milliseconds()
+		st.BTime = max(c.Left(false), 0).Milliseconds()
+		st.WInc, st.BInc = g.clock.Increment, g.clock.Increment
+	}
+	return st
+}
+
+func (g *mockGame) full() GameEvent {
+	st := g.state()
+	ev := GameEvent{
+		GameState:  GameState{Type: EventGameFull},
+		ID:         g.id,
+		Variant:    &g.variant,
+		Speed:      g.speed,
+		Rated:      g.rated,
+		InitialFEN: StartPos,
+		White:      g.players[0].user(),
+		Black:      g.players[1].user(),
+		Clock:      g.clock,
+		State:      &st,
+	}
+	if g.initialFEN != "" {
+		ev.InitialFEN = g.initialFEN
+	}
+	return ev
+}
+
+func (g *mockGame) broadcast(ev GameEvent) {
+	for st := range g.streams {
+		st.send(ev)
+	}
+}
+
+func (g *mockGame) sendTo(c int, ev GameEvent) {
+	for st, color := range g.streams {
+		if color == c {
+			st.send(ev)
+		}
+	}
+}
+
+func (g *mockGame) connected(c int) bool {
+	for _, color := range g.streams {
+		if color == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *mockGame) goneEvent(c int) GameEvent {
+	ev := GameEvent{GameState: GameState{Type: EventOpponentGone}}
+	if !g.gone[c].IsZero() {
+		ev.Gone = true
+		left := g.srv.claimWin() - time.Since(g.gone[c])
+		// rounded up: claim at the given second is not early
+		ev.ClaimWinInSeconds = int((max(left, 0) + time.Second - 1) / time.Second)
+	}
+	return ev
+}
+
+// ---- End of game ----
+
+func statusOf(o outcome.Outcome) string {
+	switch o.Reason {
+	case outcome.Checkmate:
+		return StatusMate
+	case outcome.Stalemate:
+		return StatusStalemate
+	case outcome.Resignation:
+		return StatusResign
+	case outcome.Timeout, outcome.TimeoutVsInsufficient:
+		return StatusOutOfTime
+	case outcome.Abandonment:
+		return StatusTimeout
+	case outcome.Adjudication:
+		return StatusUnknownFinish
+	}
+	return StatusDraw
+}
+
+func winnerOf(result convpgn.PGNStatusGame) string {
+	switch result {
+	case convpgn.PGNStatusWW:
+		return ColorWhite
+	case convpgn.PGNStatusBW:
+		return ColorBlack
+	}
+	return ""
+}
+
+// outcome of builder ends game, true - game is over
+func (g *mockGame) checkEnd() bool {
+	if g.over() {
+		return true
+	}
+	o := g.gb.Outcome()
+	if !o.Over() {
+		return false
+	}
+	g.finish(statusOf(o), winnerOf(o.Result))
+	return true
+}
+
+// the last state is sent, streams are closed
+func (g *mockGame) finish(status, winner string) {
+	g.status, g.winner = status, winner
+	g.draw, g.takeback = [2]bool{}, [2]bool{}
+	if g.flag != nil {
+		g.flag.Stop()
+	}
+	if c := g.gb.Clock(); c != nil {
+		c.Stop()
+	}
+	g.broadcast(GameEvent{GameState: g.state()})
+	for st := range g.streams {
+		st.close()
+	}
+	g.streams = map[*mockStream[GameEvent]]int{}
+	for i, p := range g.players {
+		info := g.info(i)
+		p.send(Event{Type: EventGameFinish, Game: &info})
+	}
+	g.srv.logger.Infof("lichess mock: game %s %s %s", g.id, status, winner)
+}
+
+// flag-fall of side to move is checked when its time is over
+func (g *mockGame) armFlag() {
+	if g.flag != nil {
+		g.flag.Stop()
+	}
+	c := g.gb.Clock()
+	if c == nil || g.over() || !c.Running() {
+		return
+	}
+	g.flag = time.AfterFunc(max(c.Left(g.gb.IsWhiteToMove()), 0)+100*time.Millisecond, func() {
+		g.srv.mu.Lock()
+		defer g.srv.mu.Unlock()
+		if g.over() {
+			return
+		}
+		if _, fallen := g.gb.TimeForfeit(); fallen {
+			g.checkEnd()
+		} else {
+			g.armFlag()
+		}
+	})
+}
+
+// ---- Actions of players ----
+
+func (g *mockGame) move(c int, uci string, offeringDraw bool) error {
+	if g.gb.IsWhiteToMove() != (c == 0) {
+		return errors.New("Not your turn, or game already over")
+	}
+	b := g.gb.CurrentPosition()
+	mv, err := moves.UCIToMove(&b, uci)
+	if err != nil || !rules.IsLegalMove(&b, mv) {
+		return errors.New("Piece on " + uci + " cannot move")
+	}
+	if g.gb.Move(mv) == base.InvalidGame {
+		return errors.New("Not your turn, or game already over")
+	}
+	g.moves = append(g.moves, moves.MoveToUCI(&b, mv))
+	// move declines offers of the opponent
+	agree := offeringDraw && g.draw[1-c]
+	g.draw[1-c] = false
+	g.takeback = [2]bool{}
+	if offeringDraw {
+		g.draw[c] = true
+	}
+	if agree {
+		g.gb.AgreeDraw()
+	}
+	// threefold repetition and fifty-move rule end game at once
+	g.gb.ClaimDraw()
+	return nil
+}
+
+func (g *mockGame) answerDraw(c int, yes bool) {
+	switch {
+	case yes && g.draw[1-c]:
+		g.gb.AgreeDraw()
+	case yes:
+		g.draw[c] = true
+	default:
+		g.draw[1-c] = false
+	}
+}
+
+func (g *mockGame) answerTakeback(c int, yes bool) error {
+	switch {
+	case yes && g.takeback[1-c]:
+		g.takeBack(1 - c)
+	case yes:
+		// own move has to be played
+		if len(g.moves) <= c {
+			return errors.New("No move to take back")
+		}
+		g.takeback[c] = true
+	default:
+		g.takeback[1-c] = false
+	}
+	return nil
+}
+
+// the last move of player is taken back (with the reply of the opponent)
+func (g *mockGame) takeBack(c int) {
+	plies := 1
+	if g.gb.IsWhiteToMove() == (c == 0) {
+		plies = 2
+	}
+	for i := 0; i < plies && len(g.moves) > 0; i++ {
+		g.gb.Undo()
+		g.moves = g.moves[:len(g.moves)-1]
+	}
+	g.takeback, g.draw = [2]bool{}, [2]bool{}
+	// clock of side to move runs again
+	if ck := g.gb.Clock(); ck != nil {
+		ck.Stop()
+		if len(g.moves) > 0 {
+			ck.Start(g.gb.IsWhiteToMove())
+		}
+	}
+}
+
+// ---- Handlers of games ----
+
+// gameFull, then states until the end; the opponent learns when player leaves
+func (s *MockServer) handleGameStream(w http.ResponseWriter, r *http.Request, u *mockUser, g *mockGame) {
+	st := newMockStream[GameEvent]()
+	s.mu.Lock()
+	c := g.color(u)
+	st.send(g.full())
+	if g.over() {
+		st.close()
+	} else {
+		if !g.gone[c].IsZero() {
+			g.gone[c] = time.Time{}
+			g.sendTo(1-c, g.goneEvent(c))
+		}
+		if !g.gone[1-c].IsZero() {
+			st.send(g.goneEvent(1 - c))
+		}
+		g.streams[st] = c
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if _, ok := g.streams[st]; ok {
+			delete(g.streams, st)
+			if !g.over() && !g.connected(c) {
+				g.gone[c] = time.Now()
+				g.sendTo(1-c, g.goneEvent(c))
+			}
+		}
+		s.mu.Unlock()
+		st.close()
+	}()
+	serveStream(w, r, st, s.keepAlive())
+}
+
+func (s *MockServer) handleGameAction(w http.ResponseWriter, r *http.Request, u *mockUser, g *mockGame) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxForm)
+	_ = r.ParseForm()
+	action, arg := r.PathValue("action"), r.PathValue("arg")
+	if needArg := action == "move" || action == "draw" || action == "takeback"; needArg != (arg != "") {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := g.color(u)
+	if action == "chat" {
+		text := strings.TrimSpace(r.PostFormValue("text"))
+		room := r.PostFormValue("room")
+		if text == "" || room != RoomPlayer && room != RoomSpectator {
+			writeError(w, http.StatusBadRequest, "invalid chat message")
+			return
+		}
+		g.broadcast(GameEvent{GameState: GameState{Type: EventChatLine}, Username: u.account.Username, Text: text, Room: room})
+		writeOK(w)
+		return
+	}
+	if g.over() {
+		writeError(w, http.StatusBadRequest, "This game is already finished")
+		return
+	}
+
+	var err error
+	switch action {
+	case "move":
+		err = g.move(c, arg, r.URL.Query().Get("offeringDraw") == "true")
+	case "resign":
+		g.gb.Resign(c == 0)
+	case "abort":
+		if len(g.moves) >= 2 {
+			err = errors.New("This game cannot be aborted")
+		} else {
+			g.finish(StatusAborted, "")
+		}
+	case "claim-victory":
+		if gone := g.gone[1-c]; gone.IsZero() || time.Since(gone) < s.claimWin() {
+			err = errors.New("You cannot claim the win on this game")
+		} else {
+			g.gb.Abandon(c != 0)
+		}
+	case "draw", "takeback":
+		if arg != "yes" && arg != "no" {
+			writeError(w, http.StatusBadRequest, "invalid answer "+arg)
+			return
+		}
+		if action == "draw" {
+			g.answerDraw(c, arg == "yes")
+		} else {
+			err = g.answerTakeback(c, arg == "yes")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	// flag can fall with the move
+	if !g.checkEnd() && err == nil {
+		g.broadcast(GameEvent{GameState: g.state()})
+		g.armFlag()
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeOK(w)
+}
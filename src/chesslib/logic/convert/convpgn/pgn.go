@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -168,9 +170,14 @@ var reMoveNum = regexp.MustCompile(`^\d+\.{1,3}$`)
 var reNAG = regexp.MustCompile(`^\$\d+$`)
 
 type PGNGame struct {
-	Headers map[PGNHeader]string
-	Moves   []string
-	Result  PGNStatusGame
+	Headers  map[PGNHeader]string
+	Tags     map[string]string // all tags as is (TimeControl, Termination, ...)
+	Moves    []string
+	Comments []string // comment after move with the same index ("" - none), only for writing
+	NAGs     []int    // numeric annotation glyph of move ($2 - "?", 0 - none), only for writing
+	// alternative line to move with the same index (nil - none), only for writing
+	Variations [][]string
+	Result     PGNStatusGame
 }
 
 type PGNParser struct {
@@ -207,6 +214,7 @@ func (p *PGNParser) pushBackLine(ln string) {
 
 func (p *PGNParser) Next() (*PGNGame, error) {
 	headers := make(map[PGNHeader]string)
+	tags := make(map[string]string)
 	var line string
 	var err error
 	found := false
@@ -233,6 +241,7 @@ func (p *PGNParser) Next() (*PGNGame, error) {
 			found = true
 			m := reTag.FindStringSubmatch(trim)
 			if len(m) >= 3 {
+				tags[m[1]] = m[2]
 				if header := ConvStringToPGNHeader(m[1]); header != PGNHeaderUndefined {
 					headers[header] = m[2]
 				}
@@ -290,7 +299,7 @@ func (p *PGNParser) Next() (*PGNGame, error) {
 		moves = append(moves, str)
 	}
 
-	return &PGNGame{Headers: headers, Moves: moves, Result: ConvStringToPGNStatus(result)}, nil
+	return &PGNGame{Headers: headers, Tags: tags, Moves: moves, Result: ConvStringToPGNStatus(result)}, nil
 }
 
 func ParseOne(r io.Reader) (*PGNGame, error) {
@@ -397,7 +406,8 @@ func WritePGN(w io.Writer, game PGNGame) error {
 	}
 
 	for hh, v := range game.Headers {
-		if printed[hh] {
+		// result is written by game.Result (outcome of game)
+		if printed[hh] || hh == PGNHeaderResult {
 			continue
 		}
 		if strings.TrimSpace(v) == "" {
@@ -410,45 +420,94 @@ func WritePGN(w io.Writer, game PGNGame) error {
 	}
 
 	resStr := ConvPGNStatusToString(game.Result)
-	if _, err := fmt.Fprintf(bw, "[Result \"%s\"]\n\n", resStr); err != nil {
+	if _, err := fmt.Fprintf(bw, "[Result \"%s\"]\n", resStr); err != nil {
 		return err
 	}
 
-	// body moves
-	moves := []string(game.Moves)
-	if len(moves) > 0 {
-		moveNum := 1
-		for i := 0; i < len(moves); i += 2 {
-			white := strings.TrimSpace(moves[i])
-			if white == "" {
-				continue
-			}
-			if _, err := fmt.Fprintf(bw, "%d. %s", moveNum, white); err != nil {
-				return err
-			}
-			if i+1 < len(moves) {
-				black := strings.TrimSpace(moves[i+1])
-				if black != "" {
-					if _, err := fmt.Fprintf(bw, " %s", black); err != nil {
-						return err
-					}
-				}
-			}
-			if i+2 < len(moves) {
-				if _, err := bw.WriteString(" "); err != nil {
-					return err
-				}
-			}
-			moveNum++
+	// other tags (FEN, TimeControl, Termination, ...)
+	names := make([]string, 0, len(game.Tags))
+	for name := range game.Tags {
+		if hh := ConvStringToPGNHeader(name); (hh != PGNHeaderUndefined && printed[hh]) || name == "Result" {
+			continue
 		}
-		if _, err := bw.WriteString(" "); err != nil {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(bw, "[%s \"%s\"]\n", name, escape(game.Tags[name])); err != nil {
 			return err
 		}
 	}
+	if _, err := bw.WriteString("\n"); err != nil {
+		return err
+	}
 
-	if _, err := fmt.Fprintf(bw, "%s\n", resStr); err != nil {
+	// body moves: numbers from FEN (black can move first)
+	moveNum, black := 1, false
+	if fen := strings.Fields(game.Tags["FEN"]); len(fen) >= 2 {
+		black = fen[1] == "b"
+		if len(fen) >= 6 {
+			if n, err := strconv.Atoi(fen[5]); err == nil && n > 0 {
+				moveNum = n
+			}
+		}
+	}
+	var body []string
+	numbered := false // black move after comment or variation needs number too
+	for i, mv := range game.Moves {
+		mv = strings.TrimSpace(mv)
+		if mv == "" {
+			continue
+		}
+		body = append(body, numberMove(mv, moveNum, black, numbered))
+		numbered = true
+		if i < len(game.NAGs) && game.NAGs[i] > 0 {
+			body = append(body, fmt.Sprintf("$%d", game.NAGs[i]))
+		}
+		if i < len(game.Comments) && game.Comments[i] != "" {
+			body = append(body, "{"+game.Comments[i]+"}")
+			numbered = false
+		}
+		if i < len(game.Variations) && len(game.Variations[i]) > 0 {
+			body = append(body, "("+variation(game.Variations[i], moveNum, black)+")")
+			numbered = false
+		}
+		if black {
+			moveNum++
+		}
+		black = !black
+	}
+	body = append(body, resStr)
+	if _, err := bw.WriteString(strings.Join(body, " ")); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString("\n"); err != nil {
 		return err
 	}
 
 	return bw.Flush()
 }
+
+// move with number: "12. e4", "12... e5" (black move after white move: "e5")
+func numberMove(mv string, moveNum int, black, numbered bool) string {
+	switch {
+	case !black:
+		return fmt.Sprintf("%d. %s", moveNum, mv)
+	case !numbered:
+		return fmt.Sprintf("%d... %s", moveNum, mv)
+	}
+	return mv
+}
+
+// moves of variation from move number
+func variation(line []string, moveNum int, black bool) string {
+	list := make([]string, 0, len(line))
+	for i, mv := range line {
+		list = append(list, numberMove(mv, moveNum, black, i > 0))
+		if black {
+			moveNum++
+		}
+		black = !black
+	}
+	return strings.Join(list, " ")
+}
@@ -0,0 +1,343 @@
+package endgame
+
+import (
+	"evilchess/src/chesslib/base"
+	"math/bits"
+)
+
+// --------------------------------------------------
+// Moves of few pieces (bitboards, faster than full board generator)
+// --------------------------------------------------
+
+const (
+	kindKing = iota
+	kindQueen
+	kindRook
+	kindBishop
+	kindKnight
+	kindPawn
+)
+
+var (
+	kingAtt   [64]uint64
+	knightAtt [64]uint64
+	pawnAtt   [2][64]uint64 // [0 - white, 1 - black]
+	between   [64][64]uint64
+	straight  [64][64]bool // the same rank or file
+	diagonal  [64][64]bool
+	rays      [64][8][]int8 // 0..3 - straight, 4..7 - diagonal
+)
+
+var directions = [8][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+
+func onBoard(r, f int) bool { return r >= 0 && r < 8 && f >= 0 && f < 8 }
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		r, f := rankOf(sq), fileOf(sq)
+		for dr := -1; dr <= 1; dr++ {
+			for df := -1; df <= 1; df++ {
+				if (dr != 0 || df != 0) && onBoard(r+dr, f+df) {
+					kingAtt[sq] |= 1 << ((r+dr)*8 + f + df)
+				}
+			}
+		}
+		for _, d := range [8][2]int{{1, 2}, {2, 1}, {-1, 2}, {-2, 1}, {1, -2}, {2, -1}, {-1, -2}, {-2, -1}} {
+			if onBoard(r+d[0], f+d[1]) {
+				knightAtt[sq] |= 1 << ((r+d[0])*8 + f + d[1])
+			}
+		}
+		for _, df := range []int{-1, 1} {
+			if onBoard(r+1, f+df) {
+				pawnAtt[0][sq] |= 1 << ((r+1)*8 + f + df)
+			}
+			if onBoard(r-1, f+df) {
+				pawnAtt[1][sq] |= 1 << ((r-1)*8 + f + df)
+			}
+		}
+		for d, dir := range directions {
+			var path uint64
+			for i := 1; onBoard(r+dir[0]*i, f+dir[1]*i); i++ {
+				to := (r+dir[0]*i)*8 + f + dir[1]*i
+				rays[sq][d] = append(rays[sq][d], int8(to))
+				between[sq][to] = path
+				if d < 4 {
+					straight[sq][to] = true
+				} else {
+					diagonal[sq][to] = true
+				}
+				path |= 1 << to
+			}
+		}
+	}
+}
+
+// kind of piece is its place in pieceOrder
+func kindOf(p base.Piece) int {
+	for i := range whitePieces {
+		if p == whitePieces[i] || p == blackPieces[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// pieces of layout for move generation
+type movePieces struct {
+	n     int
+	kind  [MaxPieces]int
+	white [MaxPieces]bool
+	kings [2]int // slots of white and black king
+}
+
+func newMovePieces(pieces []base.Piece) movePieces {
+	var mp movePieces
+	mp.n = len(pieces)
+	for i, p := range pieces {
+		mp.kind[i], mp.white[i] = kindOf(p), isWhite(p)
+		if mp.kind[i] == kindKing {
+			if mp.white[i] {
+				mp.kings[0] = i
+			} else {
+				mp.kings[1] = i
+			}
+		}
+	}
+	return mp
+}
+
+func (mp *movePieces) occupancy(p *position) uint64 {
+	var occ uint64
+	for i := 0; i < mp.n; i++ {
+		if p.sq[i] >= 0 {
+			occ |= 1 << p.sq[i]
+		}
+	}
+	return occ
+}
+
+// square is attacked by pieces of color (removed pieces have square -1)
+func (mp *movePieces) attacked(p *position, occ uint64, sq int8, byWhite bool) bool {
+	for i := 0; i < mp.n; i++ {
+		s := p.sq[i]
+		if s < 0 || mp.white[i] != byWhite {
+			continue
+		}
+		switch mp.kind[i] {
+		case kindKing:
+			if kingAtt[s]&(1<<sq) != 0 {
+				return true
+			}
+		case kindKnight:
+			if knightAtt[s]&(1<<sq) != 0 {
+				return true
+			}
+		case kindPawn:
+			c := 0
+			if !byWhite {
+				c = 1
+			}
+			if pawnAtt[c][s]&(1<<sq) != 0 {
+				return true
+			}
+		default:
+			k := mp.kind[i]
+			line := (k != kindBishop && straight[s][sq]) || (k != kindRook && diagonal[s][sq])
+			if line && between[s][sq]&occ == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// side is in check
+func (mp *movePieces) inCheck(p *position, white bool) bool {
+	k := mp.kings[1]
+	if white {
+		k = mp.kings[0]
+	}
+	return mp.attacked(p, mp.occupancy(p), p.sq[k], !white)
+}
+
+// position is legal: free squares, kings apart, pawns inside, no check of waiting side
+func (mp *movePieces) legal(p *position) bool {
+	var occ uint64
+	for i := 0; i < mp.n; i++ {
+		bit := uint64(1) << p.sq[i]
+		if occ&bit != 0 {
+			return false
+		}
+		occ |= bit
+		if r := rankOf(int(p.sq[i])); mp.kind[i] == kindPawn && (r == 0 || r == 7) {
+			return false
+		}
+	}
+	if kingAtt[p.sq[mp.kings[0]]]&(1<<p.sq[mp.kings[1]]) != 0 {
+		return false
+	}
+	return !mp.inCheck(p, !p.white)
+}
+
+// move of table position: captured slot or -1, promotion kind or -1
+type tmove struct {
+	slot, to int8
+	capture  int8
+	promo    int8
+}
+
+// legal moves of side to move
+func (mp *movePieces) generate(p *position, fn func(m tmove, next *position)) {
+	occ := mp.occupancy(p)
+	var own uint64
+	for i := 0; i < mp.n; i++ {
+		if mp.white[i] == p.white {
+			own |= 1 << p.sq[i]
+		}
+	}
+	slotAt := func(sq int8) int8 {
+		for i := 0; i < mp.n; i++ {
+			if p.sq[i] == sq {
+				return int8(i)
+			}
+		}
+		return -1
+	}
+	try := func(slot int, to int8, promo int8) {
+		next := *p
+		capt := int8(-1)
+		if occ&(1<<to) != 0 {
+			capt = slotAt(to)
+			next.sq[capt] = -1
+		}
+		next.sq[slot] = to
+		k := mp.kings[1]
+		if p.white {
+			k = mp.kings[0]
+		}
+		if mp.attacked(&next, mp.occupancy(&next), next.sq[k], !p.white) {
+			return
+		}
+		next.white = !p.white
+		fn(tmove{slot: int8(slot), to: to, capture: capt, promo: promo}, &next)
+	}
+	targets := func(slot int, mask uint64) {
+		mask &^= own
+		for mask != 0 {
+			to := int8(bits.TrailingZeros64(mask))
+			mask &= mask - 1
+			try(slot, to, -1)
+		}
+	}
+	for i := 0; i < mp.n; i++ {
+		if mp.white[i] != p.white {
+			continue
+		}
+		s := p.sq[i]
+		switch mp.kind[i] {
+		case kindKing:
+			targets(i, kingAtt[s])
+		case kindKnight:
+			targets(i, knightAtt[s])
+		case kindPawn:
+			dir, start, last, c := int8(8), 1, 7, 0
+			if !p.white {
+				dir, start, last, c = -8, 6, 0, 1
+			}
+			var mask uint64
+			if to := s + dir; occ&(1<<to) == 0 {
+				mask |= 1 << to
+				if to2 := to + dir; rankOf(int(s)) == start && occ&(1<<to2) == 0 {
+					mask |= 1 << to2
+				}
+			}
+			mask |= pawnAtt[c][s] & occ &^ own
+			for mask != 0 {
+				to := int8(bits.TrailingZeros64(mask))
+				mask &= mask - 1
+				if rankOf(int(to)) == last {
+					for _, k := range []int8{kindQueen, kindRook, kindBishop, kindKnight} {
+						try(i, to, k)
+					}
+				} else {
+					try(i, to, -1)
+				}
+			}
+		default:
+			var mask uint64
+			for d := 0; d < 8; d++ {
+				if (d < 4 && mp.kind[i] == kindBishop) || (d >= 4 && mp.kind[i] == kindRook) {
+					continue
+				}
+				for _, to := range rays[s][d] {
+					mask |= 1 << to
+					if occ&(1<<to) != 0 {
+						break
+					}
+				}
+			}
+			targets(i, mask)
+		}
+	}
+}
+
+// positions of the same table before quiet move of the side not to move
+// (predecessors are not checked for legality)
+func (mp *movePieces) unmoves(p *position, fn func(prev *position)) {
+	occ := mp.occupancy(p)
+	moved := !p.white
+	emit := func(slot int, from int8) {
+		prev := *p
+		prev.sq[slot] = from
+		prev.white = moved
+		fn(&prev)
+	}
+	steps := func(slot int, mask uint64) {
+		mask &^= occ
+		for mask != 0 {
+			from := int8(bits.TrailingZeros64(mask))
+			mask &= mask - 1
+			emit(slot, from)
+		}
+	}
+	for i := 0; i < mp.n; i++ {
+		if mp.white[i] != moved {
+			continue
+		}
+		s := p.sq[i]
+		switch mp.kind[i] {
+		case kindKing:
+			steps(i, kingAtt[s])
+		case kindKnight:
+			steps(i, knightAtt[s])
+		case kindPawn:
+			dir, first, double := int8(-8), 1, 3
+			if !moved {
+				dir, first, double = 8, 6, 4
+			}
+			r := rankOf(int(s))
+			from := s + dir
+			if from < 0 || from > 63 || occ&(1<<from) != 0 {
+				continue
+			}
+			if rf := rankOf(int(from)); (moved && rf >= first) || (!moved && rf <= first) {
+				emit(i, from)
+			}
+			if from2 := from + dir; r == double && occ&(1<<from2) == 0 {
+				emit(i, from2)
+			}
+		default:
+			for d := 0; d < 8; d++ {
+				if (d < 4 && mp.kind[i] == kindBishop) || (d >= 4 && mp.kind[i] == kindRook) {
+					continue
+				}
+				for _, from := range rays[s][d] {
+					if occ&(1<<from) != 0 {
+						break
+					}
+					emit(i, from)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package endgame
+
+import (
+	"evilchess/src/chesslib/base"
+	"fmt"
+	"strings"
+)
+
+// --------------------------------------------------
+// Material and positions of tables
+// --------------------------------------------------
+// squares are numbered a1=0 ... h8=63 (the same as base.ConvPointToIndex),
+// pieces of table are ordered: white K Q R B N P, then black K Q R B N P
+
+const MaxPieces = 4
+
+// letters of pieces in order of table names
+const pieceOrder = "KQRBNP"
+
+var (
+	whitePieces = [...]base.Piece{base.WKing, base.WQueen, base.WRook, base.WBishop, base.WKnight, base.WPawn}
+	blackPieces = [...]base.Piece{base.BKing, base.BQueen, base.BRook, base.BBishop, base.BKnight, base.BPawn}
+)
+
+func isWhite(p base.Piece) bool {
+	for _, w := range whitePieces {
+		if p == w {
+			return true
+		}
+	}
+	return false
+}
+
+// piece of the other color
+func swapColor(p base.Piece) base.Piece {
+	for i := range whitePieces {
+		if p == whitePieces[i] {
+			return blackPieces[i]
+		}
+		if p == blackPieces[i] {
+			return whitePieces[i]
+		}
+	}
+	return p
+}
+
+func pieceValue(l byte) int {
+	switch l {
+	case 'Q':
+		return 9
+	case 'R':
+		return 5
+	case 'B', 'N':
+		return 3
+	case 'P':
+		return 1
+	}
+	return 0
+}
+
+// material of position as table name: white pieces, "v", black pieces (KRvKN)
+func materialKey(pieces []base.Piece) string {
+	var w, b strings.Builder
+	for i := range pieceOrder {
+		for _, p := range pieces {
+			if p == whitePieces[i] {
+				w.WriteByte(pieceOrder[i])
+			} else if p == blackPieces[i] {
+				b.WriteByte(pieceOrder[i])
+			}
+		}
+	}
+	return w.String() + "v" + b.String()
+}
+
+// the same material with swapped colors (KRvK -> KvKR)
+func swapKey(key string) string {
+	w, b, _ := strings.Cut(key, "v")
+	return b + "v" + w
+}
+
+// stored key of material: the stronger side is white
+func canonicalKey(key string) string {
+	w, b, _ := strings.Cut(key, "v")
+	vw, vb := 0, 0
+	for i := range w {
+		vw += pieceValue(w[i])
+	}
+	for i := range b {
+		vb += pieceValue(b[i])
+	}
+	if vw > vb || (vw == vb && w >= b) {
+		return key
+	}
+	return swapKey(key)
+}
+
+// pieces of table name, error if name is not valid
+func parseKey(key string) ([]base.Piece, error) {
+	w, b, ok := strings.Cut(key, "v")
+	if !ok || len(w)+len(b) > MaxPieces {
+		return nil, fmt.Errorf("bad material %q", key)
+	}
+	var pieces []base.Piece
+	for side, s := range []string{w, b} {
+		if len(s) == 0 || s[0] != 'K' {
+			return nil, fmt.Errorf("bad material %q", key)
+		}
+		last := 0
+		for i := 0; i < len(s); i++ {
+			o := strings.IndexByte(pieceOrder, s[i])
+			if o < 0 || (i > 0 && (o == 0 || o < last)) {
+				return nil, fmt.Errorf("bad material %q", key)
+			}
+			last = o
+			if side == 0 {
+				pieces = append(pieces, whitePieces[o])
+			} else {
+				pieces = append(pieces, blackPieces[o])
+			}
+		}
+	}
+	return pieces, nil
+}
+
+// --------------------------------------------------
+// symmetry
+// --------------------------------------------------
+
+func rankOf(sq int) int { return sq >> 3 }
+func fileOf(sq int) int { return sq & 7 }
+
+var (
+	// transforms of board: bit 0 - flip files, bit 1 - flip ranks, bit 2 - a1-h8 diagonal
+	transform [8][64]int8
+	// first king in a1-d1-d4 (no pawns) or on files a-d (pawns) to code
+	kingCode       [2][64]int
+	kingSquares    [2][]int
+	kingTransforms [2][64][]int // transforms moving king to its area
+)
+
+func init() {
+	for t := 0; t < 8; t++ {
+		for sq := 0; sq < 64; sq++ {
+			r, f := rankOf(sq), fileOf(sq)
+			if t&1 != 0 {
+				f = 7 - f
+			}
+			if t&2 != 0 {
+				r = 7 - r
+			}
+			if t&4 != 0 {
+				r, f = f, r
+			}
+			transform[t][sq] = int8(r*8 + f)
+		}
+	}
+	for sq := 0; sq < 64; sq++ {
+		kingCode[0][sq], kingCode[1][sq] = -1, -1
+		if r, f := rankOf(sq), fileOf(sq); f <= 3 && r <= f {
+			kingCode[0][sq] = len(kingSquares[0])
+			kingSquares[0] = append(kingSquares[0], sq)
+		}
+		if fileOf(sq) <= 3 {
+			kingCode[1][sq] = len(kingSquares[1])
+			kingSquares[1] = append(kingSquares[1], sq)
+		}
+	}
+	for sq := 0; sq < 64; sq++ {
+		for t := 0; t < 8; t++ {
+			if kingCode[0][transform[t][sq]] >= 0 {
+				kingTransforms[0][sq] = append(kingTransforms[0][sq], t)
+			}
+		}
+		t := 0
+		if fileOf(sq) > 3 {
+			t = 1
+		}
+		kingTransforms[1][sq] = []int{t}
+	}
+}
+
+// --------------------------------------------------
+// position of table
+// --------------------------------------------------
+
+type position struct {
+	sq    [MaxPieces]int8 // squares in order of table pieces
+	white bool            // white to move
+}
+
+// material of table with layout of index
+type layout struct {
+	key    string
+	pieces []base.Piece
+	pawns  int     // 1 - table with pawns (symmetry by files only)
+	same   [][]int // groups of identical pieces (their squares are sorted)
+	size   int
+}
+
+func newLayout(key string) (*layout, error) {
+	pieces, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	l := &layout{key: key, pieces: pieces}
+	for i, p := range pieces {
+		if p == base.WPawn || p == base.BPawn {
+			l.pawns = 1
+		}
+		if i > 0 && p == pieces[i-1] {
+			if g := len(l.same) - 1; g >= 0 && l.same[g][len(l.same[g])-1] == i-1 {
+				l.same[g] = append(l.same[g], i)
+			} else {
+				l.same = append(l.same, []int{i - 1, i})
+			}
+		}
+	}
+	l.size = len(kingSquares[l.pawns]) * 2
+	for range pieces[1:] {
+		l.size *= 64
+	}
+	return l, nil
+}
+
+// index of position after transform t (identical pieces sorted)
+func (l *layout) indexOf(p *position, t int) int {
+	var sq [MaxPieces]int8
+	n := len(l.pieces)
+	for i := 0; i < n; i++ {
+		sq[i] = transform[t][p.sq[i]]
+	}
+	for _, g := range l.same {
+		for i := 1; i < len(g); i++ {
+			for j := i; j > 0 && sq[g[j]] < sq[g[j-1]]; j-- {
+				sq[g[j]], sq[g[j-1]] = sq[g[j-1]], sq[g[j]]
+			}
+		}
+	}
+	idx := kingCode[l.pawns][sq[0]]
+	for i := 1; i < n; i++ {
+		idx = idx*64 + int(sq[i])
+	}
+	idx *= 2
+	if !p.white {
+		idx++
+	}
+	return idx
+}
+
+// index of position, the same for all symmetric positions
+func (l *layout) index(p *position) int {
+	best := -1
+	for _, t := range kingTransforms[l.pawns][p.sq[0]] {
+		if idx := l.indexOf(p, t); best < 0 || idx < best {
+			best = idx
+		}
+	}
+	return best
+}
+
+func (l *layout) decode(idx int, p *position) {
+	p.white = idx&1 == 0
+	idx >>= 1
+	for i := len(l.pieces) - 1; i > 0; i-- {
+		p.sq[i] = int8(idx & 63)
+		idx >>= 6
+	}
+	p.sq[0] = int8(kingSquares[l.pawns][idx])
+}
+
+// position of board by pieces of table (colors are swapped if flip)
+func (l *layout) fromBoard(b *base.Board, flip bool) (position, bool) {
+	var p position
+	used := [MaxPieces]bool{}
+	for sq, pc := range b.Mailbox {
+		if pc == base.EmptyPiece {
+			continue
+		}
+		s := sq
+		if flip {
+			pc, s = swapColor(pc), sq^56
+		}
+		found := false
+		for i, lp := range l.pieces {
+			if lp == pc && !used[i] {
+				used[i], found = true, true
+				p.sq[i] = int8(s)
+				break
+			}
+		}
+		if !found {
+			return p, false
+		}
+	}
+	for i := range l.pieces {
+		if !used[i] {
+			return p, false
+		}
+	}
+	p.white = b.WhiteToMove != flip
+	return p, true
+}
@@ -0,0 +1,255 @@
+package endgame
+
+import (
+	"evilchess/src/chesslib/base"
+	"fmt"
+	"slices"
+)
+
+// --------------------------------------------------
+// Retrograde analysis
+// --------------------------------------------------
+// value of position (side to move): 0 - draw, 1..254 - mate distance in plies + 1
+// (odd distance - side to move mates, even - side to move is mated), 255 - illegal
+
+const (
+	valDraw    = 0
+	valIllegal = 255
+	maxPlies   = 253
+)
+
+type Table struct {
+	*layout
+	mp   movePieces
+	data []uint8
+}
+
+func newTable(key string) (*Table, error) {
+	l, err := newLayout(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Table{layout: l, mp: newMovePieces(l.pieces)}, nil
+}
+
+func (t *Table) Key() string { return t.key }
+
+func (t *Table) value(p *position) uint8 { return t.data[t.index(p)] }
+
+// move leaving the table: capture or promotion
+type exit struct {
+	t    *Table
+	flip bool            // colors are swapped in sub-table
+	from [MaxPieces]int8 // slot of source position for every piece of sub-table
+}
+
+// materials reached by captures and promotions (canonical keys)
+func (t *Table) subKeys() []string {
+	var keys []string
+	add := func(pieces []base.Piece) {
+		k := canonicalKey(materialKey(pieces))
+		if !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	n := len(t.pieces)
+	for c := 0; c < n; c++ {
+		if t.mp.kind[c] == kindKing {
+			continue
+		}
+		add(slices.Delete(slices.Clone(t.pieces), c, c+1))
+	}
+	for s := 0; s < n; s++ {
+		if t.mp.kind[s] != kindPawn {
+			continue
+		}
+		for _, k := range []int{kindQueen, kindRook, kindBishop, kindKnight} {
+			promoted := slices.Clone(t.pieces)
+			promoted[s] = pieceOf(k, t.mp.white[s])
+			add(promoted)
+			for c := 0; c < n; c++ {
+				if t.mp.kind[c] != kindKing && t.mp.white[c] != t.mp.white[s] {
+					add(slices.Delete(slices.Clone(promoted), c, c+1))
+				}
+			}
+		}
+	}
+	return keys
+}
+
+func pieceOf(kind int, white bool) base.Piece {
+	if white {
+		return whitePieces[kind]
+	}
+	return blackPieces[kind]
+}
+
+// sub-table of move with mapping of pieces
+func (t *Table) newExit(m tmove, tables map[string]*Table) (*exit, error) {
+	type src struct {
+		slot int8
+		p    base.Piece
+	}
+	var pieces []src
+	for i, p := range t.pieces {
+		if int8(i) == m.capture {
+			continue
+		}
+		if int8(i) == m.slot && m.promo >= 0 {
+			p = pieceOf(int(m.promo), t.mp.white[i])
+		}
+		pieces = append(pieces, src{int8(i), p})
+	}
+	list := make([]base.Piece, len(pieces))
+	for i := range pieces {
+		list[i] = pieces[i].p
+	}
+	key := materialKey(list)
+	ck := canonicalKey(key)
+	sub := tables[ck]
+	if sub == nil {
+		return nil, fmt.Errorf("no table %s", ck)
+	}
+	e := &exit{t: sub, flip: ck != key}
+	used := make([]bool, len(pieces))
+	for j, p := range sub.pieces {
+		if e.flip {
+			p = swapColor(p)
+		}
+		for i := range pieces {
+			if !used[i] && pieces[i].p == p {
+				used[i] = true
+				e.from[j] = pieces[i].slot
+				break
+			}
+		}
+	}
+	return e, nil
+}
+
+func (e *exit) value(next *position) uint8 {
+	var q position
+	for j := range e.t.pieces {
+		q.sq[j] = next.sq[e.from[j]]
+		if e.flip {
+			q.sq[j] ^= 56
+		}
+	}
+	q.white = next.white != e.flip
+	return e.t.value(&q)
+}
+
+// generate table, sub-tables must be solved
+func (t *Table) solve(tables map[string]*Table) error {
+	size := t.size
+	t.data = make([]uint8, size)
+	count := make([]uint8, size)    // quiet moves to unsolved positions, 255 - can't lose
+	exitLoss := make([]uint8, size) // longest mate of opponent after exit + 1
+	buckets := make([][]int32, maxPlies+2)
+
+	exits := map[[3]int8]*exit{}
+	var exitErr error
+	var succ []int
+	var p position
+	for idx := 0; idx < size; idx++ {
+		t.decode(idx, &p)
+		if !t.mp.legal(&p) || t.index(&p) != idx {
+			t.data[idx] = valIllegal
+			continue
+		}
+		succ = succ[:0]
+		moves, win, noLoss := 0, -1, false
+		t.mp.generate(&p, func(m tmove, next *position) {
+			moves++
+			if m.capture < 0 && m.promo < 0 {
+				if si := t.index(next); !slices.Contains(succ, si) {
+					succ = append(succ, si)
+				}
+				return
+			}
+			mk := [3]int8{m.slot, m.capture, m.promo}
+			e := exits[mk]
+			if e == nil {
+				var err error
+				if e, err = t.newExit(m, tables); err != nil {
+					exitErr = err
+					return
+				}
+				exits[mk] = e
+			}
+			v := e.value(next)
+			switch {
+			case v == valDraw:
+				noLoss = true
+			case (v-1)%2 == 0: // opponent is mated
+				noLoss = true
+				if d := int(v); win < 0 || d < win {
+					win = d
+				}
+			default:
+				exitLoss[idx] = max(exitLoss[idx], v)
+			}
+		})
+		if exitErr != nil {
+			return exitErr
+		}
+		switch {
+		case moves == 0:
+			if t.mp.inCheck(&p, p.white) {
+				buckets[0] = append(buckets[0], int32(idx))
+			}
+			// stalemate is draw
+		case noLoss:
+			count[idx] = 255
+		default:
+			count[idx] = uint8(len(succ))
+			if len(succ) == 0 {
+				d := int(exitLoss[idx])
+				buckets[d] = append(buckets[d], int32(idx))
+			}
+		}
+		if win >= 0 {
+			buckets[win] = append(buckets[win], int32(idx))
+		}
+	}
+
+	var prev []int
+	for d := 0; d <= maxPlies; d++ {
+		for i := 0; i < len(buckets[d]); i++ {
+			idx := int(buckets[d][i])
+			if t.data[idx] != valDraw {
+				continue
+			}
+			t.data[idx] = uint8(d + 1)
+			if d == maxPlies {
+				continue
+			}
+			t.decode(idx, &p)
+			prev = prev[:0]
+			t.mp.unmoves(&p, func(q *position) {
+				if pi := t.index(q); !slices.Contains(prev, pi) {
+					prev = append(prev, pi)
+				}
+			})
+			for _, pi := range prev {
+				if t.data[pi] != valDraw {
+					continue
+				}
+				if d%2 == 0 {
+					// position is lost: mate from predecessor
+					buckets[d+1] = append(buckets[d+1], int32(pi))
+					continue
+				}
+				if count[pi] == 255 {
+					continue
+				}
+				if count[pi]--; count[pi] == 0 {
+					l := max(d+1, int(exitLoss[pi]))
+					buckets[l] = append(buckets[l], int32(pi))
+				}
+			}
+		}
+		buckets[d] = nil
+	}
+	return nil
+}
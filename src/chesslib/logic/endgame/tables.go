@@ -0,0 +1,290 @@
+package endgame
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// --------------------------------------------------
+// Endgame tables of own generation (distance to mate)
+// --------------------------------------------------
+// tables are generated by retrograde analysis for up to 4 pieces
+// and stored as <material>.egtb files (gzip), 50-move rule is not used
+
+const (
+	DefaultDir = "endgame"
+	fileExt    = ".egtb"
+	fileMagic  = "EVTB\x01"
+)
+
+var (
+	ErrNotCovered  = errors.New("position is not covered by endgame tables")
+	ErrNotFound    = errors.New("endgame table not found")
+	ErrUnsupported = errors.New("material is not supported (pawns of both sides)")
+	ErrIllegal     = errors.New("illegal position")
+	ErrCorrupted   = errors.New("corrupted endgame table")
+)
+
+// materials of trainer and default build (stronger side is white)
+var Basic = []string{"KQvK", "KRvK", "KPvK", "KBBvK", "KBNvK", "KQvKR"}
+
+// result of position with perfect play
+type Result struct {
+	WDL   int // 1 - side to move mates, 0 - draw, -1 - side to move is mated
+	Plies int // plies to mate (0 - checkmate on board or draw)
+}
+
+// full moves to mate
+func (r Result) MateIn() int { return (r.Plies + 1) / 2 }
+
+func (r Result) String() string {
+	switch r.WDL {
+	case 1:
+		return fmt.Sprintf("win, mate in %d (%d plies)", r.MateIn(), r.Plies)
+	case -1:
+		if r.Plies == 0 {
+			return "checkmate"
+		}
+		return fmt.Sprintf("loss, mated in %d (%d plies)", r.MateIn(), r.Plies)
+	}
+	return "draw"
+}
+
+// comparable score of result (the higher the better for side to move)
+func (r Result) score() int {
+	switch r.WDL {
+	case 1:
+		return 1000 - r.Plies
+	case -1:
+		return -1000 + r.Plies
+	}
+	return 0
+}
+
+type Tables struct {
+	dir     string            // "" - tables are kept in memory only
+	mu      sync.RWMutex      // probes take read lock only
+	tables  map[string]*Table // nil value - file is missing
+	buildMu sync.Mutex
+}
+
+func NewTables(dir string) *Tables {
+	return &Tables{dir: dir, tables: map[string]*Table{}}
+}
+
+func (ts *Tables) Dir() string { return ts.dir }
+
+func (ts *Tables) path(key string) string { return filepath.Join(ts.dir, key+fileExt) }
+
+// loaded table by canonical key, nil if it is not generated
+func (ts *Tables) table(key string) *Table {
+	ts.mu.RLock()
+	t, ok := ts.tables[key]
+	ts.mu.RUnlock()
+	if ok {
+		return t
+	}
+	// file is read without lock, the first stored table wins
+	if ts.dir != "" {
+		if data, err := os.ReadFile(ts.path(key)); err == nil {
+			t, _ = readTable(key, data)
+		}
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if cur, ok := ts.tables[key]; ok {
+		return cur
+	}
+	ts.tables[key] = t
+	return t
+}
+
+// table of material is generated (any color order: KvKR is KRvK)
+func (ts *Tables) Has(key string) bool {
+	return ts.table(canonicalKey(key)) != nil
+}
+
+// generate table of material with missing sub-tables and save them in dir,
+// progress is called before generation of every table
+func (ts *Tables) Build(key string, progress func(key string)) error {
+	if _, err := parseKey(key); err != nil {
+		return err
+	}
+	ts.buildMu.Lock()
+	defer ts.buildMu.Unlock()
+	return ts.build(canonicalKey(key), progress)
+}
+
+func (ts *Tables) build(key string, progress func(key string)) error {
+	if ts.table(key) != nil {
+		return nil
+	}
+	t, err := newTable(key)
+	if err != nil {
+		return err
+	}
+	if bothPawns(t) {
+		return ErrUnsupported
+	}
+	subs := map[string]*Table{}
+	for _, sk := range t.subKeys() {
+		if err := ts.build(sk, progress); err != nil {
+			return err
+		}
+		subs[sk] = ts.table(sk)
+	}
+	if progress != nil {
+		progress(key)
+	}
+	if err := t.solve(subs); err != nil {
+		return err
+	}
+	if ts.dir != "" {
+		if err := ts.save(t); err != nil {
+			return err
+		}
+	}
+	ts.mu.Lock()
+	ts.tables[key] = t
+	ts.mu.Unlock()
+	return nil
+}
+
+func bothPawns(t *Table) bool {
+	var pawns [2]bool
+	for i := 0; i < t.mp.n; i++ {
+		if t.mp.kind[i] == kindPawn {
+			if t.mp.white[i] {
+				pawns[0] = true
+			} else {
+				pawns[1] = true
+			}
+		}
+	}
+	return pawns[0] && pawns[1]
+}
+
+func (ts *Tables) save(t *Table) error {
+	if err := os.MkdirAll(ts.dir, 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(fileMagic))
+	zw.Write(t.data)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(ts.path(t.key), buf.Bytes(), 0644)
+}
+
+func readTable(key string, data []byte) (*Table, error) {
+	t, err := newTable(key)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != len(fileMagic)+t.size || string(raw[:len(fileMagic)]) != fileMagic {
+		return nil, ErrCorrupted
+	}
+	t.data = raw[len(fileMagic):]
+	return t, nil
+}
+
+// --------------------------------------------------
+// probing
+// --------------------------------------------------
+
+// position has few pieces and no castling rights
+func Covers(b *base.Board) bool {
+	if b.Casting.WK || b.Casting.WQ || b.Casting.BK || b.Casting.BQ {
+		return false
+	}
+	n := 0
+	for _, p := range b.Mailbox {
+		if p != base.EmptyPiece {
+			if n++; n > MaxPieces {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// result of position for side to move
+func (ts *Tables) Probe(b *base.Board) (Result, error) {
+	if !Covers(b) {
+		return Result{}, ErrNotCovered
+	}
+	var pieces []base.Piece
+	for _, p := range b.Mailbox {
+		if p != base.EmptyPiece {
+			pieces = append(pieces, p)
+		}
+	}
+	if len(pieces) == 2 {
+		return Result{}, nil
+	}
+	key := materialKey(pieces)
+	ck := canonicalKey(key)
+	t := ts.table(ck)
+	if t == nil {
+		return Result{}, ErrNotFound
+	}
+	p, ok := t.fromBoard(b, ck != key)
+	if !ok || !t.mp.legal(&p) {
+		return Result{}, ErrIllegal
+	}
+	v := t.value(&p)
+	switch {
+	case v == valDraw:
+		return Result{}, nil
+	case v == valIllegal:
+		return Result{}, ErrIllegal
+	case (v-1)%2 == 1:
+		return Result{WDL: 1, Plies: int(v) - 1}, nil
+	}
+	return Result{WDL: -1, Plies: int(v) - 1}, nil
+}
+
+// moves keeping the best result (the fastest mate, draw, the longest defense)
+func (ts *Tables) BestMoves(b *base.Board) ([]base.Move, Result, error) {
+	res, err := ts.Probe(b)
+	if err != nil {
+		return nil, res, err
+	}
+	var best []base.Move
+	bestScore := 0
+	for _, mv := range moves.GenerateLegalMoves(b) {
+		nb := moves.CloneBoard(b)
+		if err := moves.ApplyMove(nb, mv); err != nil {
+			continue
+		}
+		r, err := ts.Probe(nb)
+		if err != nil {
+			return nil, res, err
+		}
+		s := -r.score()
+		if len(best) == 0 || s > bestScore {
+			best, bestScore = []base.Move{mv}, s
+		} else if s == bestScore {
+			best = append(best, mv)
+		}
+	}
+	return best, res, nil
+}
@@ -51,7 +51,7 @@ func (h *History) PushMove(b *base.Board, mv base.Move) error {
 
 	// Truncate future moves if we are in the middle (truncate behavior).
 	if h.current+1 < uint(h.Len()) {
-		h.moves = h.moves[:h.current]
+		h.moves = h.moves[:h.current+1]
 	}
 
 	// Apply move to the board
@@ -142,9 +142,10 @@ func (h *History) SAN() []string {
 func (h *History) ImportPGNGame(pgn *convpgn.PGNGame, b *base.Board) error {
 	h.info.headers = pgn.Headers
 	len := len(pgn.Moves)
-	h.moves = make([]MoveEntry, len)
+	// first entry is start position
+	h.moves = make([]MoveEntry, len+1)
 	h.moves[0].Board = *b
-	for i := 1; i < len; i++ {
+	for i := 1; i <= len; i++ {
 		mv, err := moves.SANToMove(&h.moves[i-1].Board, pgn.Moves[i-1])
 		if err != nil {
 			h.moves = nil
@@ -160,6 +161,7 @@ func (h *History) ImportPGNGame(pgn *convpgn.PGNGame, b *base.Board) error {
 		}
 		h.moves[i].Board = *b
 		h.moves[i].Move = mv
+		h.moves[i].SAN = pgn.Moves[i-1]
 	}
 	h.current = uint(len)
 
@@ -0,0 +1,440 @@
+package motifs
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"strings"
+)
+
+// --------------------------------------------------
+// Tactical motifs
+// --------------------------------------------------
+// Detect finds motifs created by a move: forks, pins, skewers, discovered
+// attacks/checks, overloaded defenders, back-rank mates and captures of
+// hanging pieces. Position finds pins and hanging pieces which already exist.
+// Squares are indexes of mailbox (0 - a1, 63 - h8).
+
+type Kind int
+
+const (
+	Fork Kind = iota
+	Pin
+	Skewer
+	DiscoveredAttack
+	DiscoveredCheck
+	DoubleCheck
+	Overloaded
+	BackRankMate
+	Hanging
+)
+
+// theme names (as in puzzle sets)
+var kindNames = [...]string{
+	Fork:             "fork",
+	Pin:              "pin",
+	Skewer:           "skewer",
+	DiscoveredAttack: "discoveredAttack",
+	DiscoveredCheck:  "discoveredCheck",
+	DoubleCheck:      "doubleCheck",
+	Overloaded:       "overloading",
+	BackRankMate:     "backRankMate",
+	Hanging:          "hangingPiece",
+}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+type Motif struct {
+	Kind     Kind
+	Ply      int    // index of move in line, -1 for motifs of position
+	Square   int    // acting piece: forking, pinning, moved, overloaded...
+	Targets  []int  // attacked, pinned or defended pieces
+	Behind   int    // piece behind pinned or skewered one, -1 if none
+	Absolute bool   // pin to king
+	Text     string // "Nf7 forks Ke8, Qd8"
+}
+
+func (m Motif) String() string {
+	return m.Text
+}
+
+// motifs created by move mv on board b (b is not changed)
+func Detect(b *base.Board, mv base.Move) []Motif {
+	nb := moves.CloneBoard(b)
+	if err := moves.ApplyMove(nb, mv); err != nil {
+		return nil
+	}
+	from := base.ConvPointToIndex(mv.From)
+	to := base.ConvPointToIndex(mv.To)
+	white := base.PieceIsWhite(b.Mailbox[from])
+
+	var list []Motif
+	if m, ok := hangingCapture(b, from, to, white); ok {
+		list = append(list, m)
+	}
+	if m, ok := fork(nb, to, white); ok {
+		list = append(list, m)
+	}
+	list = append(list, rays(nb, to, white, false)...)
+	list = append(list, discovered(b, nb, from, to, white)...)
+	if m, ok := overloaded(nb, to, white); ok {
+		list = append(list, m)
+	}
+	if m, ok := backRank(nb, white); ok {
+		list = append(list, m)
+	}
+	return list
+}
+
+// motifs of moves of line (Ply is index of move), line must be legal
+func DetectLine(b *base.Board, line []base.Move) ([]Motif, error) {
+	nb := moves.CloneBoard(b)
+	var list []Motif
+	for i, mv := range line {
+		if !rules.IsLegalMove(nb, mv) {
+			return list, fmt.Errorf("illegal move %s", moves.MoveToUCI(nb, mv))
+		}
+		for _, m := range Detect(nb, mv) {
+			m.Ply = i
+			list = append(list, m)
+		}
+		_ = moves.ApplyMove(nb, mv)
+	}
+	return list, nil
+}
+
+// pins and hanging pieces of both colors in position
+func Position(b *base.Board) []Motif {
+	var list []Motif
+	for sq, p := range b.Mailbox {
+		if p != base.EmptyPiece && p != base.InvalidPiece {
+			list = append(list, rays(b, sq, base.PieceIsWhite(p), true)...)
+		}
+	}
+	for _, white := range []bool{true, false} {
+		for _, sq := range rules.HangingPieces(b, white) {
+			list = append(list, Motif{Kind: Hanging, Ply: -1, Square: sq, Behind: -1,
+				Text: fmt.Sprintf("%s is hanging", label(&b.Mailbox, sq))})
+		}
+	}
+	return list
+}
+
+// theme names of motifs without repeats
+func Themes(list []Motif) []string {
+	var out []string
+	seen := map[Kind]bool{}
+	for _, m := range list {
+		if !seen[m.Kind] {
+			seen[m.Kind] = true
+			out = append(out, m.Kind.String())
+		}
+	}
+	return out
+}
+
+// ---- Motifs ----
+
+// moved piece attacks two or more pieces which it can win: the king, more valuable or hanging ones
+func fork(nb *base.Board, sq int, white bool) (Motif, bool) {
+	if isHanging(nb, sq, white) {
+		return Motif{}, false
+	}
+	var targets []int
+	for _, t := range attacks(&nb.Mailbox, sq) {
+		p := nb.Mailbox[t]
+		if p == base.EmptyPiece || base.PieceIsWhite(p) == white {
+			continue
+		}
+		if isKing(p) || worth(p) > worth(nb.Mailbox[sq]) || isHanging(nb, t, !white) {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) < 2 {
+		return Motif{}, false
+	}
+	return Motif{Kind: Fork, Ply: -1, Square: sq, Targets: targets, Behind: -1,
+		Text: fmt.Sprintf("%s forks %s", label(&nb.Mailbox, sq), labels(&nb.Mailbox, targets))}, true
+}
+
+// pins and skewers along rays of slider on sq (only pins for position)
+func rays(b *base.Board, sq int, white, onlyPins bool) []Motif {
+	mb := &b.Mailbox
+	var list []Motif
+	for _, d := range sliderDirs(mb[sq]) {
+		first := firstOnRay(mb, sq, d)
+		if first < 0 || base.PieceIsWhite(mb[first]) == white {
+			continue
+		}
+		second := firstOnRay(mb, first, d)
+		if second < 0 || base.PieceIsWhite(mb[second]) == white {
+			continue
+		}
+		p1, p2 := mb[first], mb[second]
+		switch {
+		case !isKing(p1) && (isKing(p2) || worth(p2) > worth(p1) &&
+			(worth(p2) > worth(mb[sq]) || !defendedWithout(mb, second, first, !white))):
+			m := Motif{Kind: Pin, Ply: -1, Square: sq, Targets: []int{first}, Behind: second, Absolute: isKing(p2)}
+			m.Text = fmt.Sprintf("%s pins %s to %s", label(mb, sq), label(mb, first), label(mb, second))
+			if !m.Absolute {
+				m.Text += " (relative)"
+			}
+			list = append(list, m)
+		case !onlyPins && (isKing(p1) || worth(p1) > worth(p2)) && worth(p2) >= 3 &&
+			(worth(p2) >= worth(mb[sq]) || !defendedWithout(mb, second, first, !white)):
+			list = append(list, Motif{Kind: Skewer, Ply: -1, Square: sq, Targets: []int{first}, Behind: second,
+				Text: fmt.Sprintf("%s skewers %s to %s", label(mb, sq), label(mb, first), label(mb, second))})
+		}
+	}
+	return list
+}
+
+// lines of sliders opened by the moved piece
+func discovered(b, nb *base.Board, from, to int, white bool) []Motif {
+	mb := &nb.Mailbox
+	var list []Motif
+	for _, d := range queenDirs {
+		back := [2]int{-d[0], -d[1]}
+		slider := firstOnRay(&b.Mailbox, from, back)
+		if slider < 0 || slider == to || base.PieceIsWhite(mb[slider]) != white || !slides(mb[slider], d) {
+			continue
+		}
+		// moved piece stays on the line between slider and from
+		if firstOnRay(mb, from, back) != slider {
+			continue
+		}
+		target := firstOnRay(mb, from, d)
+		if target < 0 || target == to || base.PieceIsWhite(mb[target]) == white {
+			continue
+		}
+		switch {
+		case isKing(mb[target]):
+			list = append(list, Motif{Kind: DiscoveredCheck, Ply: -1, Square: slider, Targets: []int{target}, Behind: -1,
+				Text: fmt.Sprintf("discovered check by %s (%s moved)", label(mb, slider), label(mb, to))})
+			if attacksSquare(mb, to, target) {
+				list = append(list, Motif{Kind: DoubleCheck, Ply: -1, Square: to, Targets: []int{target}, Behind: -1,
+					Text: fmt.Sprintf("double check by %s and %s", label(mb, slider), label(mb, to))})
+			}
+		case worth(mb[target]) > worth(mb[slider]) || isHanging(nb, target, !white):
+			list = append(list, Motif{Kind: DiscoveredAttack, Ply: -1, Square: slider, Targets: []int{target}, Behind: -1,
+				Text: fmt.Sprintf("%s discovers attack on %s (%s moved)", label(mb, slider), label(mb, target), label(mb, to))})
+		}
+	}
+	return list
+}
+
+// a defender is the only one of two or more attacked pieces, one of them is attacked by the moved piece
+func overloaded(nb *base.Board, to int, white bool) (Motif, bool) {
+	mb := &nb.Mailbox
+	byDefender := map[int][]int{}
+	var order []int
+	for sq, p := range mb {
+		if p == base.EmptyPiece || p == base.InvalidPiece || isKing(p) || base.PieceIsWhite(p) == white {
+			continue
+		}
+		if len(moves.AttackersOf(mb, sq, white)) == 0 {
+			continue
+		}
+		defenders := moves.AttackersOf(mb, sq, !white)
+		if len(defenders) != 1 || isHanging(nb, sq, !white) {
+			continue
+		}
+		// the piece hangs without its defender
+		d := defenders[0]
+		without := *nb
+		without.Mailbox[d] = base.EmptyPiece
+		if !isHanging(&without, sq, !white) {
+			continue
+		}
+		if _, ok := byDefender[d]; !ok {
+			order = append(order, d)
+		}
+		byDefender[d] = append(byDefender[d], sq)
+	}
+	for _, d := range order {
+		targets := byDefender[d]
+		if len(targets) < 2 {
+			continue
+		}
+		for _, t := range targets {
+			if attacksSquare(mb, to, t) {
+				return Motif{Kind: Overloaded, Ply: -1, Square: d, Targets: targets, Behind: -1,
+					Text: fmt.Sprintf("%s is overloaded: defends %s", label(mb, d), labels(mb, targets))}, true
+			}
+		}
+	}
+	return Motif{}, false
+}
+
+// mate by rook or queen on the first rank of king, the king is locked by own pieces
+func backRank(nb *base.Board, white bool) (Motif, bool) {
+	if rules.GameStatusOf(nb) != base.Checkmate {
+		return Motif{}, false
+	}
+	mb := &nb.Mailbox
+	king := findKing(mb, !white)
+	rank, forward := 0, 1
+	if white {
+		rank, forward = 7, -1
+	}
+	if king < 0 || king/8 != rank {
+		return Motif{}, false
+	}
+	checker := -1
+	for _, a := range moves.AttackersOf(mb, king, white) {
+		if p := mb[a]; a/8 == rank && (p == base.WRook || p == base.BRook || p == base.WQueen || p == base.BQueen) {
+			checker = a
+		}
+	}
+	if checker < 0 {
+		return Motif{}, false
+	}
+	own := 0
+	for df := -1; df <= 1; df++ {
+		f := king%8 + df
+		if f < 0 || f > 7 {
+			continue
+		}
+		sq := (rank+forward)*8 + f
+		switch p := mb[sq]; {
+		case p != base.EmptyPiece && base.PieceIsWhite(p) != white:
+			own++
+		case len(moves.AttackersOf(mb, sq, white)) == 0:
+			return Motif{}, false
+		}
+	}
+	if own == 0 {
+		return Motif{}, false
+	}
+	return Motif{Kind: BackRankMate, Ply: -1, Square: checker, Targets: []int{king}, Behind: -1,
+		Text: fmt.Sprintf("%s mates %s on the back rank", label(mb, checker), label(mb, king))}, true
+}
+
+// capture of a piece (not pawn) without defenders
+func hangingCapture(b *base.Board, from, to int, white bool) (Motif, bool) {
+	p := b.Mailbox[to]
+	if p == base.EmptyPiece || worth(p) < 3 || len(moves.AttackersOf(&b.Mailbox, to, !white)) > 0 {
+		return Motif{}, false
+	}
+	return Motif{Kind: Hanging, Ply: -1, Square: from, Targets: []int{to}, Behind: -1,
+		Text: fmt.Sprintf("%s captures hanging %s", label(&b.Mailbox, from), label(&b.Mailbox, to))}, true
+}
+
+// ---- Helpers ----
+
+var queenDirs = [8][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+
+// value in pawns, king is the most valuable
+func worth(p base.Piece) int {
+	return rules.PieceValue(p) / 100
+}
+
+func isKing(p base.Piece) bool {
+	return p == base.WKing || p == base.BKing
+}
+
+// the opponent wins piece on sq by capture
+func isHanging(b *base.Board, sq int, white bool) bool {
+	for _, h := range rules.HangingPieces(b, white) {
+		if h == sq {
+			return true
+		}
+	}
+	return false
+}
+
+// sq is defended by color even if piece on skip is removed
+func defendedWithout(mb *base.Mailbox, sq, skip int, white bool) bool {
+	m := *mb
+	m[skip] = base.EmptyPiece
+	return len(moves.AttackersOf(&m, sq, white)) > 0
+}
+
+func findKing(mb *base.Mailbox, white bool) int {
+	k := base.BKing
+	if white {
+		k = base.WKing
+	}
+	for sq, p := range mb {
+		if p == k {
+			return sq
+		}
+	}
+	return -1
+}
+
+// directions of rank/file deltas of slider
+func sliderDirs(p base.Piece) [][2]int {
+	switch p {
+	case base.WRook, base.BRook:
+		return queenDirs[:4]
+	case base.WBishop, base.BBishop:
+		return queenDirs[4:]
+	case base.WQueen, base.BQueen:
+		return queenDirs[:]
+	}
+	return nil
+}
+
+func slides(p base.Piece, d [2]int) bool {
+	for _, sd := range sliderDirs(p) {
+		if sd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// the first piece from sq (not included) in direction d, -1 if none
+func firstOnRay(mb *base.Mailbox, sq int, d [2]int) int {
+	r, f := sq/8, sq%8
+	for {
+		r, f = r+d[0], f+d[1]
+		if r < 0 || r > 7 || f < 0 || f > 7 {
+			return -1
+		}
+		if mb[r*8+f] != base.EmptyPiece {
+			return r*8 + f
+		}
+	}
+}
+
+func attacksSquare(mb *base.Mailbox, from, sq int) bool {
+	for _, a := range moves.AttackersOf(mb, sq, base.PieceIsWhite(mb[from])) {
+		if a == from {
+			return true
+		}
+	}
+	return false
+}
+
+// occupied squares attacked by piece on sq
+func attacks(mb *base.Mailbox, sq int) []int {
+	var out []int
+	for t, p := range mb {
+		if p != base.EmptyPiece && t != sq && attacksSquare(mb, sq, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// "Nf7", "Pe5"
+func label(mb *base.Mailbox, sq int) string {
+	name, _ := base.AlgebraicFromSquare(sq)
+	return string(base.ConvertUpperRuneFromPiece(mb[sq])) + name
+}
+
+func labels(mb *base.Mailbox, list []int) string {
+	out := make([]string, len(list))
+	for i, sq := range list {
+		out[i] = label(mb, sq)
+	}
+	return strings.Join(out, ", ")
+}
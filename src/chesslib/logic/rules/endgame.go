@@ -0,0 +1,43 @@
+package rules
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/chesslib/logic/rules/moves"
+)
+
+// result of position with perfect play by endgame tables (false - not in tables)
+func EndgameResult(t *endgame.Tables, b *base.Board) (endgame.Result, bool) {
+	if t == nil || b == nil {
+		return endgame.Result{}, false
+	}
+	res, err := t.Probe(b)
+	return res, err == nil
+}
+
+// moves of perfect play: the fastest mate, keeping draw or the longest defense
+func PerfectMoves(t *endgame.Tables, b *base.Board) []base.Move {
+	if t == nil || b == nil {
+		return nil
+	}
+	mvs, _, err := t.BestMoves(b)
+	if err != nil {
+		return nil
+	}
+	return mvs
+}
+
+// move keeps the result of position: win is not lost and draw is not spoiled
+// (a slower mate is still accepted)
+func KeepsEndgameResult(t *endgame.Tables, b *base.Board, mv base.Move) bool {
+	before, ok := EndgameResult(t, b)
+	if !ok {
+		return true
+	}
+	nb := moves.CloneBoard(b)
+	if err := moves.ApplyMove(nb, mv); err != nil {
+		return false
+	}
+	after, ok := EndgameResult(t, nb)
+	return !ok || -after.WDL >= before.WDL
+}
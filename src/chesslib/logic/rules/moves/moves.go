@@ -566,3 +566,70 @@ func GenerateLegalMoves(b *base.Board) []base.Move {
 	}
 	return legal
 }
+
+// all pieces of one color that attack the field (index) in current mailbox;
+// for x-rays remove the attacker from mailbox and call again
+func AttackersOf(mb *base.Mailbox, idx int, byWhite bool) []int {
+	var out []int
+	h := idx / 8
+	w := idx % 8
+	own := func(p, wp, bp base.Piece) bool {
+		return (byWhite && p == wp) || (!byWhite && p == bp)
+	}
+
+	// for pawn
+	dh := -1
+	if !byWhite {
+		dh = 1
+	}
+	for _, dw := range []int{-1, 1} {
+		ht, wt := h+dh, w+dw
+		if ht >= 0 && ht < 8 && wt >= 0 && wt < 8 && own(mb[ht*8+wt], base.WPawn, base.BPawn) {
+			out = append(out, ht*8+wt)
+		}
+	}
+
+	// for knights
+	nOffsets := [8][2]int{{2, 1}, {1, 2}, {-1, 2}, {-2, 1}, {-2, -1}, {-1, -2}, {1, -2}, {2, -1}}
+	for _, o := range nOffsets {
+		ht, wt := h+o[0], w+o[1]
+		if ht >= 0 && ht < 8 && wt >= 0 && wt < 8 && own(mb[ht*8+wt], base.WKnight, base.BKnight) {
+			out = append(out, ht*8+wt)
+		}
+	}
+
+	// for bishops/rooks/queens: first piece on the ray
+	dirs := [8][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	for di, d := range dirs {
+		for step := 1; ; step++ {
+			ht, wt := h+d[0]*step, w+d[1]*step
+			if ht < 0 || ht >= 8 || wt < 0 || wt >= 8 {
+				break
+			}
+			p := mb[ht*8+wt]
+			if p == base.EmptyPiece {
+				continue
+			}
+			if own(p, base.WQueen, base.BQueen) ||
+				(di <= 3 && own(p, base.WRook, base.BRook)) ||
+				(di > 3 && own(p, base.WBishop, base.BBishop)) {
+				out = append(out, ht*8+wt)
+			}
+			break
+		}
+	}
+
+	// for king (adjacent)
+	for dh := -1; dh <= 1; dh++ {
+		for dw := -1; dw <= 1; dw++ {
+			if dh == 0 && dw == 0 {
+				continue
+			}
+			ht, wt := h+dh, w+dw
+			if ht >= 0 && ht < 8 && wt >= 0 && wt < 8 && own(mb[ht*8+wt], base.WKing, base.BKing) {
+				out = append(out, ht*8+wt)
+			}
+		}
+	}
+	return out
+}
@@ -58,6 +58,9 @@ func SANToMove(b *base.Board, san string) (base.Move, error) {
 			}
 			tsan = tsan[1:]
 		}
+		if tsan == "" {
+			return base.Move{}, fmt.Errorf("invalid SAN: %s", san)
+		}
 
 		// if last != base.InvalidPiece then mb Pawn to up to a new piece (Q,R,B,N)
 		last := base.ConvertWPieceFromRune(rune(tsan[len(tsan)-1]))
@@ -199,3 +202,126 @@ func MoveToShortSAN(mv base.Move) string {
 	}
 	return fmt.Sprintf("%c%s", base.ConvertUpperRuneFromPiece(mv.Piece), to)
 }
+
+// full SAN of legal move for position b (before the move):
+// disambiguation, captures, promotion and check/mate suffix
+func MoveToSAN(b *base.Board, mv base.Move) string {
+	fromIdx := base.ConvPointToIndex(mv.From)
+	toIdx := base.ConvPointToIndex(mv.To)
+	pc := b.Mailbox[fromIdx]
+	to, _ := base.AlgebraicFromSquare(toIdx)
+	isPawn := pc == base.WPawn || pc == base.BPawn
+	isKing := pc == base.WKing || pc == base.BKing
+
+	var sb strings.Builder
+	switch {
+	case isKing && mv.From.W == 4 && mv.To.W == 6:
+		sb.WriteString("O-O")
+	case isKing && mv.From.W == 4 && mv.To.W == 2:
+		sb.WriteString("O-O-O")
+	default:
+		capture := b.Mailbox[toIdx] != base.EmptyPiece ||
+			(isPawn && mv.From.W != mv.To.W)
+		if isPawn {
+			if capture {
+				sb.WriteByte('a' + mv.From.W)
+			}
+		} else {
+			sb.WriteRune(base.ConvertUpperRuneFromPiece(pc))
+			// other pieces of the same kind reaching the same square
+			sameFile, sameRank, ambiguous := false, false, false
+			for _, o := range GenerateLegalMoves(b) {
+				if o.To != mv.To || o.From == mv.From || b.Mailbox[base.ConvPointToIndex(o.From)] != pc {
+					continue
+				}
+				ambiguous = true
+				if o.From.W == mv.From.W {
+					sameFile = true
+				}
+				if o.From.H == mv.From.H {
+					sameRank = true
+				}
+			}
+			if ambiguous {
+				if !sameFile {
+					sb.WriteByte('a' + mv.From.W)
+				} else if !sameRank {
+					sb.WriteByte('1' + mv.From.H)
+				} else {
+					from, _ := base.AlgebraicFromSquare(fromIdx)
+					sb.WriteString(from)
+				}
+			}
+		}
+		if capture {
+			sb.WriteByte('x')
+		}
+		sb.WriteString(to)
+		if isPawn && mv.Piece != pc {
+			sb.WriteByte('=')
+			sb.WriteRune(base.ConvertUpperRuneFromPiece(mv.Piece))
+		}
+	}
+
+	nb := CloneBoard(b)
+	if err := ApplyMove(nb, mv); err == nil {
+		king := FindKing(&nb.Mailbox, nb.WhiteToMove)
+		if king >= 0 && IsSquareAttacked(nb, king, !nb.WhiteToMove) {
+			if len(GenerateLegalMoves(nb)) == 0 {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('+')
+			}
+		}
+	}
+	return sb.String()
+}
+
+// UCI notation of move: e2e4, e7e8q
+func MoveToUCI(b *base.Board, mv base.Move) string {
+	from, _ := base.AlgebraicFromSquare(base.ConvPointToIndex(mv.From))
+	to, _ := base.AlgebraicFromSquare(base.ConvPointToIndex(mv.To))
+	s := from + to
+	if pc := b.Mailbox[base.ConvPointToIndex(mv.From)]; (pc == base.WPawn || pc == base.BPawn) && mv.Piece != pc {
+		s += strings.ToLower(string(base.ConvertUpperRuneFromPiece(mv.Piece)))
+	}
+	return s
+}
+
+// legal move by UCI notation (promotion to queen if piece is not given)
+func UCIToMove(b *base.Board, uci string) (base.Move, error) {
+	if len(uci) < 4 {
+		return base.Move{}, fmt.Errorf("invalid UCI move: %s", uci)
+	}
+	fromIdx, err := base.SquareFromAlgebraic(uci[0:2])
+	if err != nil {
+		return base.Move{}, err
+	}
+	toIdx, err := base.SquareFromAlgebraic(uci[2:4])
+	if err != nil {
+		return base.Move{}, err
+	}
+	promo := byte('q')
+	if len(uci) > 4 {
+		promo = uci[4] | 0x20
+	}
+	var found *base.Move
+	for _, mv := range GenerateLegalMoves(b) {
+		if base.ConvPointToIndex(mv.From) != fromIdx || base.ConvPointToIndex(mv.To) != toIdx {
+			continue
+		}
+		pc := b.Mailbox[fromIdx]
+		if (pc == base.WPawn || pc == base.BPawn) && mv.Piece != pc {
+			if byte(base.ConvertUpperRuneFromPiece(mv.Piece))|0x20 != promo {
+				continue
+			}
+		}
+		m := mv
+		found = &m
+		break
+	}
+	if found == nil {
+		return base.Move{}, fmt.Errorf("illegal UCI move: %s", uci)
+	}
+	return *found, nil
+}
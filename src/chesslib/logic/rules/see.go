@@ -0,0 +1,134 @@
+package rules
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/rules/moves"
+)
+
+// piece values for exchange evaluation (centipawns)
+func PieceValue(p base.Piece) int {
+	switch p {
+	case base.WPawn, base.BPawn:
+		return 100
+	case base.WKnight, base.BKnight:
+		return 320
+	case base.WBishop, base.BBishop:
+		return 330
+	case base.WRook, base.BRook:
+		return 500
+	case base.WQueen, base.BQueen:
+		return 900
+	case base.WKing, base.BKing:
+		return 20000
+	default:
+		return 0
+	}
+}
+
+// static exchange evaluation: material balance (centipawns, for the moving side)
+// of the capture sequence on the destination square of mv, both sides recapture
+// with the least valuable attacker and can stop when it is not profitable.
+// Sliders behind the exchanged pieces (x-rays) join the sequence.
+func SEE(b *base.Board, mv base.Move) int {
+	from := base.ConvPointToIndex(mv.From)
+	to := base.ConvPointToIndex(mv.To)
+	mb := b.Mailbox // copy
+	attacker := mb[from]
+	if attacker == base.EmptyPiece || attacker == base.InvalidPiece {
+		return 0
+	}
+	white := base.PieceIsWhite(attacker)
+
+	var gain [32]int
+	gain[0] = PieceValue(mb[to])
+	// en passant: captured pawn is not on destination square
+	if (attacker == base.WPawn || attacker == base.BPawn) && to == b.EnPassant && mb[to] == base.EmptyPiece {
+		gain[0] = PieceValue(base.WPawn)
+		if white {
+			mb[to-8] = base.EmptyPiece
+		} else {
+			mb[to+8] = base.EmptyPiece
+		}
+	}
+	onSquare := attacker
+	// promotion: piece on square is the promoted one
+	if (attacker == base.WPawn || attacker == base.BPawn) && mv.Piece != attacker && mv.Piece != base.EmptyPiece {
+		gain[0] += PieceValue(mv.Piece) - PieceValue(attacker)
+		onSquare = mv.Piece
+	}
+	mb[from] = base.EmptyPiece
+	mb[to] = onSquare
+
+	d := 0
+	side := !white
+	for d < len(gain)-1 {
+		idx := leastValuableAttacker(&mb, to, side)
+		if idx < 0 {
+			break
+		}
+		// king can't capture into a defended square
+		if p := mb[idx]; p == base.WKing || p == base.BKing {
+			mb[idx] = base.EmptyPiece
+			defended := len(moves.AttackersOf(&mb, to, !side)) > 0
+			mb[idx] = p
+			if defended {
+				break
+			}
+		}
+		d++
+		gain[d] = PieceValue(mb[to]) - gain[d-1]
+		if max(-gain[d-1], gain[d]) < 0 {
+			break // nobody wants to continue
+		}
+		// pawn recapture on the last rank promotes
+		p := mb[idx]
+		if p == base.WPawn && to/8 == 7 {
+			p = base.WQueen
+			gain[d] += PieceValue(base.WQueen) - PieceValue(base.WPawn)
+		} else if p == base.BPawn && to/8 == 0 {
+			p = base.BQueen
+			gain[d] += PieceValue(base.BQueen) - PieceValue(base.BPawn)
+		}
+		mb[idx] = base.EmptyPiece
+		mb[to] = p
+		side = !side
+	}
+	for d > 0 {
+		gain[d-1] = -max(-gain[d-1], gain[d])
+		d--
+	}
+	return gain[0]
+}
+
+// pieces of the given color that the opponent can win by capture:
+// best opponent capture on their square has positive SEE
+func HangingPieces(b *base.Board, white bool) []int {
+	var out []int
+	for idx := 0; idx < 64; idx++ {
+		p := b.Mailbox[idx]
+		if p == base.EmptyPiece || p == base.WKing || p == base.BKing {
+			continue
+		}
+		if (white && !base.PieceIsWhite(p)) || (!white && !base.PieceIsBlack(p)) {
+			continue
+		}
+		for _, from := range moves.AttackersOf(&b.Mailbox, idx, !white) {
+			mv := base.Move{From: base.ConvIndexToPoint(from), To: base.ConvIndexToPoint(idx), Piece: b.Mailbox[from]}
+			if SEE(b, mv) > 0 {
+				out = append(out, idx)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func leastValuableAttacker(mb *base.Mailbox, to int, white bool) int {
+	best, bestVal := -1, 1<<30
+	for _, idx := range moves.AttackersOf(mb, to, white) {
+		if v := PieceValue(mb[idx]); v < bestVal {
+			best, bestVal = idx, v
+		}
+	}
+	return best
+}
@@ -0,0 +1,107 @@
+package netplay
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Client ----
+
+const dialTimeout = 5 * time.Second
+
+// connection to server: messages of server are read to Incoming until disconnect
+type Client struct {
+	nc  net.Conn
+	enc *json.Encoder
+	mu  sync.Mutex
+	in  chan Message
+	err error
+}
+
+// "host:port", port is default if it is not set
+func Dial(addr string) (*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), DefaultPort)
+	}
+	nc, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{nc: nc, enc: json.NewEncoder(nc), in: make(chan Message, sendQueue)}
+	go c.read()
+	return c, nil
+}
+
+func (c *Client) read() {
+	defer close(c.in)
+	sc := bufio.NewScanner(c.nc)
+	sc.Buffer(make([]byte, 4096), maxLine)
+	for sc.Scan() {
+		var m Message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			continue
+		}
+		c.in <- m
+	}
+	c.mu.Lock()
+	c.err = sc.Err()
+	c.mu.Unlock()
+}
+
+// messages of server, closed on disconnect
+func (c *Client) Incoming() <-chan Message { return c.in }
+
+// error of disconnect (nil - closed by server)
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) Send(m Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Encode(m)
+}
+
+func (c *Client) Close() error {
+	return c.nc.Close()
+}
+
+func (c *Client) Host(name, color string, timeControl string) error {
+	return c.Send(Message{Type: TypeHost, Name: name, Color: color, TimeControl: timeControl})
+}
+
+// game "" - any open game
+func (c *Client) Join(game, name string) error {
+	return c.Send(Message{Type: TypeJoin, Game: game, Name: name})
+}
+
+// game "" - any running game
+func (c *Client) Watch(game string) error {
+	return c.Send(Message{Type: TypeWatch, Game: game})
+}
+
+func (c *Client) Resume(game, token string) error {
+	return c.Send(Message{Type: TypeResume, Game: game, Token: token})
+}
+
+func (c *Client) List() error             { return c.Send(Message{Type: TypeList}) }
+func (c *Client) Move(mv string) error    { return c.Send(Message{Type: TypeMove, Move: mv}) }
+func (c *Client) Chat(text string) error  { return c.Send(Message{Type: TypeChat, Text: text}) }
+func (c *Client) Offer(kind string) error { return c.Send(Message{Type: TypeOffer, Offer: kind}) }
+func (c *Client) Resign() error           { return c.Send(Message{Type: TypeResign}) }
+func (c *Client) Claim() error            { return c.Send(Message{Type: TypeClaim}) }
+
+// answer to offer of the opponent
+func (c *Client) Answer(kind string, accept bool) error {
+	typ := TypeDecline
+	if accept {
+		typ = TypeAccept
+	}
+	return c.Send(Message{Type: typ, Offer: kind})
+}
@@ -0,0 +1,113 @@
+package netplay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// --------------------------------------------------
+// Network play: JSON lines over TCP
+// --------------------------------------------------
+// every line is one Message, a client hosts, joins, resumes or watches a game
+// and then sends moves and requests, the server answers by state of game
+//
+//	-> {"type":"host","name":"Ann","color":"white","time_control":"300+2"}
+//	<- {"type":"joined","game":"1","color":"white","token":"9f2c..."}
+//	<- {"type":"state","game":"1","state":{"fen":"...","moves":[],...}}
+//	-> {"type":"move","move":"e2e4"}
+//	-> {"type":"offer","offer":"draw"}
+
+const DefaultPort = "7777"
+
+// types of messages
+const (
+	// client -> server
+	TypeHost    = "host"    // new game: name, color (white, black, random), time_control
+	TypeJoin    = "join"    // free seat of game (any open game if empty): name
+	TypeWatch   = "watch"   // read-only spectator (any running game if empty)
+	TypeResume  = "resume"  // seat of game after reconnect: game, token
+	TypeList    = "list"    // games of server
+	TypeMove    = "move"    // UCI or SAN
+	TypeChat    = "chat"    // text
+	TypeOffer   = "offer"   // draw or takeback request to the opponent
+	TypeAccept  = "accept"  // offer of the opponent is accepted
+	TypeDecline = "decline" // offer of the opponent is declined
+	TypeResign  = "resign"
+	TypeClaim   = "claim" // draw by threefold repetition or fifty-move rule
+
+	// server -> client
+	TypeJoined   = "joined"   // seat: game, color, token
+	TypeWatching = "watching" // spectator of game
+	TypeState    = "state"    // position, clocks and result
+	TypeGames    = "games"    // answer to list
+	TypeError    = "error"
+	// chat, offer and decline are sent to the opponent and spectators as is
+)
+
+// offers
+const (
+	OfferDraw     = "draw"
+	OfferTakeback = "takeback"
+)
+
+const (
+	ColorWhite  = "white"
+	ColorBlack  = "black"
+	ColorRandom = "random"
+)
+
+type Message struct {
+	Type        string     `json:"type"`
+	Game        string     `json:"game,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Color       string     `json:"color,omitempty"`
+	Token       string     `json:"token,omitempty"`
+	TimeControl string     `json:"time_control,omitempty"` // PGN TimeControl ("" or "-" - no clock)
+	Move        string     `json:"move,omitempty"`
+	Text        string     `json:"text,omitempty"`
+	Offer       string     `json:"offer,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	State       *State     `json:"state,omitempty"`
+	Games       []GameInfo `json:"games,omitempty"`
+}
+
+// state of game after every change
+type State struct {
+	FEN         string   `json:"fen"`
+	Moves       []string `json:"moves"` // UCI
+	SAN         []string `json:"san"`
+	White       string   `json:"white"`
+	Black       string   `json:"black"`
+	WhiteOnline bool     `json:"white_online"`
+	BlackOnline bool     `json:"black_online"`
+	Spectators  int      `json:"spectators"`
+	TimeControl string   `json:"time_control,omitempty"`
+	WhiteMs     int64    `json:"white_ms,omitempty"` // left time at sending
+	BlackMs     int64    `json:"black_ms,omitempty"`
+	Running     string   `json:"running,omitempty"` // color of running clock
+	Result      string   `json:"result"`            // "*" - game goes on
+	Reason      string   `json:"reason,omitempty"`
+	Termination string   `json:"termination,omitempty"`
+	Offer       string   `json:"offer,omitempty"` // pending offer
+	OfferBy     string   `json:"offer_by,omitempty"`
+}
+
+// game goes on
+func (s *State) Active() bool { return s.Result == "*" || s.Result == "" }
+
+// short info of game of server
+type GameInfo struct {
+	ID          string `json:"id"`
+	White       string `json:"white"`
+	Black       string `json:"black"`
+	TimeControl string `json:"time_control,omitempty"`
+	Result      string `json:"result"`
+	Open        bool   `json:"open"` // seat is free
+}
+
+// secret of seat for resume
+func newToken() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
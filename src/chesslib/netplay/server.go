@@ -0,0 +1,428 @@
+package netplay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/logx"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// seat of disconnected player is kept for resume
+	DefaultAbandonTimeout = 60 * time.Second
+	// games without connections are removed
+	idleTimeout = 10 * time.Minute
+	// flag-fall and abandonment are checked
+	checkInterval = 100 * time.Millisecond
+	// messages of slow client are queued up to
+	sendQueue = 64
+	maxLine   = 64 * 1024
+)
+
+type Server struct {
+	Abandon time.Duration // 0 - default
+
+	logger logx.Logger
+	mu     sync.Mutex
+	tables map[string]*table
+	next   int
+}
+
+func NewServer(logger logx.Logger) *Server {
+	return &Server{logger: logger, tables: map[string]*table{}}
+}
+
+// listen on addr (":7777") until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	s.logger.Infof("netplay server on %s", ln.Addr())
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go s.watch(ctx)
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		c := &conn{nc: nc, out: make(chan Message, sendQueue), done: make(chan struct{}), color: -1}
+		go c.write()
+		go s.handle(c)
+	}
+}
+
+// flag-fall, abandonment and removal of idle games
+func (s *Server) watch(ctx context.Context) {
+	abandon := s.Abandon
+	if abandon <= 0 {
+		abandon = DefaultAbandonTimeout
+	}
+	tick := time.NewTicker(checkInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		s.mu.Lock()
+		for id, t := range s.tables {
+			t.mu.Lock()
+			if t.check(abandon) {
+				s.logger.Infof("game %s is over: %s\n%s", id, t.gb.Outcome(), t.pgn())
+				t.broadcastState()
+			}
+			if !t.empty() {
+				t.idle = time.Now()
+			} else if time.Since(t.idle) > idleTimeout || (!t.started() && time.Since(t.idle) > abandon) {
+				delete(s.tables, id)
+			}
+			t.mu.Unlock()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// ---- Connection ----
+
+type conn struct {
+	nc   net.Conn
+	out  chan Message
+	done chan struct{}
+	once sync.Once
+
+	// set by host, join, resume, watch
+	table *table
+	color int // -1 - spectator
+}
+
+// message is queued, slow client is disconnected
+func (c *conn) send(m Message) {
+	select {
+	case c.out <- m:
+	case <-c.done:
+	default:
+		c.close()
+	}
+}
+
+func (c *conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.nc.Close()
+	})
+}
+
+func (c *conn) write() {
+	enc := json.NewEncoder(c.nc)
+	for {
+		select {
+		case m := <-c.out:
+			if err := enc.Encode(m); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (s *Server) handle(c *conn) {
+	defer s.leave(c)
+	defer c.close()
+	sc := bufio.NewScanner(c.nc)
+	sc.Buffer(make([]byte, 4096), maxLine)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var m Message
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			c.send(Message{Type: TypeError, Error: fmt.Sprintf("invalid message: %v", err)})
+			continue
+		}
+		if err := s.dispatch(c, m); err != nil {
+			c.send(Message{Type: TypeError, Error: err.Error()})
+		}
+	}
+}
+
+func (s *Server) dispatch(c *conn, m Message) error {
+	switch m.Type {
+	case TypeList:
+		c.send(Message{Type: TypeGames, Games: s.list()})
+		return nil
+	case TypeHost, TypeJoin, TypeWatch, TypeResume:
+		if c.table != nil {
+			return errors.New("already in game " + c.table.id)
+		}
+	}
+	switch m.Type {
+	case TypeHost:
+		return s.host(c, m)
+	case TypeJoin:
+		return s.join(c, m)
+	case TypeWatch:
+		return s.watchGame(c, m)
+	case TypeResume:
+		return s.resume(c, m)
+	}
+
+	t := c.table
+	if t == nil {
+		return errors.New("host, join or watch a game first")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m.Type == TypeChat {
+		// spectators chat too
+		text := strings.TrimSpace(m.Text)
+		if text == "" {
+			return nil
+		}
+		from := "spectator"
+		if c.color >= 0 {
+			from = t.seats[c.color].name
+		}
+		t.broadcast(Message{Type: TypeChat, Game: t.id, Name: from, Color: playerColor(c.color), Text: text})
+		return nil
+	}
+	if c.color < 0 {
+		return errors.New("spectators can't play")
+	}
+	switch m.Type {
+	case TypeMove:
+		if err := t.move(c.color, m.Move); err != nil {
+			return err
+		}
+	case TypeOffer:
+		if err := t.makeOffer(c.color, m.Offer); err != nil {
+			return err
+		}
+		t.broadcast(Message{Type: TypeOffer, Game: t.id, Offer: m.Offer, Color: colorName(c.color)})
+	case TypeAccept, TypeDecline:
+		if err := t.answer(c.color, m.Offer, m.Type == TypeAccept); err != nil {
+			return err
+		}
+		if m.Type == TypeDecline {
+			t.broadcast(Message{Type: TypeDecline, Game: t.id, Offer: m.Offer, Color: colorName(c.color)})
+		}
+	case TypeResign:
+		if !t.full() || t.over() {
+			return errors.New("no game")
+		}
+		t.gb.Resign(c.color == 0)
+	case TypeClaim:
+		if !t.full() || t.over() {
+			return errors.New("no game")
+		}
+		if _, ok := t.gb.ClaimDraw(); !ok {
+			return errors.New("no draw to claim")
+		}
+	default:
+		return errors.New("unknown message " + m.Type)
+	}
+	if t.gb.Outcome().Over() {
+		s.logger.Infof("game %s is over: %s\n%s", t.id, t.gb.Outcome(), t.pgn())
+	}
+	t.broadcastState()
+	return nil
+}
+
+func playerColor(color int) string {
+	if color < 0 {
+		return ""
+	}
+	return colorName(color)
+}
+
+// new game with the first seat
+func (s *Server) host(c *conn, m Message) error {
+	var tc clock.Control
+	if m.TimeControl != "" {
+		var err error
+		if tc, err = clock.Parse(m.TimeControl); err != nil {
+			return fmt.Errorf("invalid time control: %v", err)
+		}
+	}
+	color := colorIndex(m.Color)
+	if color < 0 {
+		color = rand.Intn(2)
+	}
+	s.mu.Lock()
+	s.next++
+	t := newTable(strconv.Itoa(s.next), tc, s.logger)
+	s.tables[t.id] = t
+	s.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return s.seat(c, t, m.Name, color)
+}
+
+// free seat of game (the oldest open game if it is not set)
+func (s *Server) join(c *conn, m Message) error {
+	t := s.find(m.Game, func(t *table) bool { return !t.full() })
+	if t == nil {
+		return errors.New("no open game")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return s.seat(c, t, m.Name, -1)
+}
+
+func (s *Server) seat(c *conn, t *table, name string, color int) error {
+	if name = strings.TrimSpace(name); name == "" {
+		name = "Player"
+	}
+	color, st, err := t.sit(name, color, c)
+	if err != nil {
+		return err
+	}
+	c.table, c.color = t, color
+	s.logger.Infof("%s plays %s in game %s", name, colorName(color), t.id)
+	c.send(Message{Type: TypeJoined, Game: t.id, Color: colorName(color), Token: st.token})
+	t.broadcastState()
+	return nil
+}
+
+// spectator of game (the oldest running game if it is not set)
+func (s *Server) watchGame(c *conn, m Message) error {
+	t := s.find(m.Game, func(t *table) bool { return t.full() })
+	if t == nil {
+		return errors.New("no game to watch")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c.table, c.color = t, -1
+	t.watchers[c] = true
+	c.send(Message{Type: TypeWatching, Game: t.id})
+	t.broadcastState()
+	return nil
+}
+
+// seat after reconnect by token
+func (s *Server) resume(c *conn, m Message) error {
+	s.mu.Lock()
+	t := s.tables[m.Game]
+	s.mu.Unlock()
+	if t == nil {
+		return errors.New("game not found")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for color, st := range t.seats {
+		if st == nil || m.Token == "" || st.token != m.Token {
+			continue
+		}
+		if st.conn != nil {
+			// old connection is replaced
+			st.conn.close()
+		}
+		st.conn = c
+		c.table, c.color = t, color
+		s.logger.Infof("%s resumes game %s", st.name, t.id)
+		c.send(Message{Type: TypeJoined, Game: t.id, Color: colorName(color), Token: st.token})
+		t.broadcastState()
+		return nil
+	}
+	return errors.New("invalid token")
+}
+
+// disconnect: seat waits for resume, spectator leaves
+func (s *Server) leave(c *conn) {
+	t := c.table
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c.color < 0 {
+		delete(t.watchers, c)
+	} else if st := t.seats[c.color]; st != nil && st.conn == c {
+		st.conn = nil
+		st.left = time.Now()
+		s.logger.Infof("%s left game %s", st.name, t.id)
+	} else {
+		// replaced by resume
+		return
+	}
+	t.broadcastState()
+}
+
+// game by id or the first one (by id) which matches
+func (s *Server) find(id string, match func(t *table) bool) *table {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != "" {
+		t := s.tables[id]
+		if t == nil {
+			return nil
+		}
+		t.mu.Lock()
+		ok := match(t)
+		t.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		return t
+	}
+	for _, t := range s.sorted() {
+		t.mu.Lock()
+		ok := match(t) && !t.over()
+		t.mu.Unlock()
+		if ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// games by id
+func (s *Server) sorted() []*table {
+	list := make([]*table, 0, len(s.tables))
+	for _, t := range s.tables {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.Atoi(list[i].id)
+		b, _ := strconv.Atoi(list[j].id)
+		return a < b
+	})
+	return list
+}
+
+func (s *Server) list() []GameInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []GameInfo
+	for _, t := range s.sorted() {
+		t.mu.Lock()
+		list = append(list, t.info())
+		t.mu.Unlock()
+	}
+	return list
+}
@@ -0,0 +1,299 @@
+package netplay
+
+import (
+	"errors"
+	"evilchess/src/chesslib"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/logx"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Table: one game of server ----
+
+// player of game
+type seat struct {
+	name  string
+	token string
+	conn  *conn     // nil - disconnected
+	left  time.Time // time of disconnect
+}
+
+type table struct {
+	id string
+
+	mu       sync.Mutex
+	gb       *chesslib.GameBuilder
+	tc       clock.Control
+	seats    [2]*seat // white, black (nil - free)
+	watchers map[*conn]bool
+	offer    string // pending offer
+	offerBy  int    // color of offer
+	idle     time.Time
+}
+
+func newTable(id string, tc clock.Control, logger logx.Logger) *table {
+	t := &table{id: id, tc: tc, gb: chesslib.NewBuilderBoard(logger), watchers: map[*conn]bool{}, idle: time.Now()}
+	t.gb.CreateClassic()
+	if tc.HasClock() {
+		t.gb.SetClock(clock.New(tc))
+	}
+	return t
+}
+
+func colorName(color int) string {
+	if color == 0 {
+		return ColorWhite
+	}
+	return ColorBlack
+}
+
+// 0 - white, 1 - black, -1 - unknown
+func colorIndex(name string) int {
+	switch name {
+	case ColorWhite:
+		return 0
+	case ColorBlack:
+		return 1
+	}
+	return -1
+}
+
+// game has moves
+func (t *table) started() bool {
+	return t.gb.CurrentMoveIndex() > 0
+}
+
+// both seats are taken
+func (t *table) full() bool {
+	return t.seats[0] != nil && t.seats[1] != nil
+}
+
+func (t *table) over() bool {
+	t.gb.TimeForfeit()
+	return t.gb.Outcome().Over()
+}
+
+// seat of new player: the first free one if color is not set
+func (t *table) sit(name string, color int, c *conn) (int, *seat, error) {
+	if color < 0 {
+		color = 0
+		if t.seats[0] != nil {
+			color = 1
+		}
+	}
+	if t.seats[color] != nil {
+		return color, nil, errors.New("seat is taken")
+	}
+	s := &seat{name: name, token: newToken(), conn: c}
+	t.seats[color] = s
+	if color == 0 {
+		t.gb.InfoGame().SetWhitePlayer(name)
+	} else {
+		t.gb.InfoGame().SetBlackPlayer(name)
+	}
+	return color, s, nil
+}
+
+// move of player: UCI or SAN, it is checked by rules on server
+func (t *table) move(color int, s string) error {
+	if !t.full() {
+		return errors.New("waiting for opponent")
+	}
+	if t.over() {
+		return errors.New("game is over")
+	}
+	b := t.gb.CurrentPosition()
+	if b.WhiteToMove != (color == 0) {
+		return errors.New("not your move")
+	}
+	mv, err := moves.UCIToMove(&b, s)
+	if err != nil {
+		if mv, err = moves.SANToMove(&b, s); err != nil {
+			return errors.New("invalid move " + s)
+		}
+	}
+	if !rules.IsLegalMove(&b, mv) {
+		return errors.New("illegal move " + s)
+	}
+	if t.gb.Move(mv) == base.InvalidGame {
+		return errors.New("illegal move " + s)
+	}
+	// move of mover cancels offers
+	t.offer = ""
+	return nil
+}
+
+// offer of player to the opponent
+func (t *table) makeOffer(color int, kind string) error {
+	if !t.full() || t.over() {
+		return errors.New("no game")
+	}
+	switch kind {
+	case OfferDraw:
+	case OfferTakeback:
+		if !t.started() {
+			return errors.New("no moves to take back")
+		}
+	default:
+		return errors.New("unknown offer " + kind)
+	}
+	if t.offer != "" && t.offerBy != color {
+		return errors.New("answer offer of opponent")
+	}
+	t.offer, t.offerBy = kind, color
+	return nil
+}
+
+// answer of player to offer of the opponent
+func (t *table) answer(color int, kind string, accept bool) error {
+	if t.offer == "" || t.offer != kind || t.offerBy == color {
+		return errors.New("no offer " + kind)
+	}
+	t.offer = ""
+	if !accept || t.over() {
+		return nil
+	}
+	switch kind {
+	case OfferDraw:
+		t.gb.AgreeDraw()
+	case OfferTakeback:
+		t.takeback(t.offerBy)
+	}
+	return nil
+}
+
+// the last move of player is taken back (with the reply of the opponent)
+func (t *table) takeback(color int) {
+	plies := 1
+	if b := t.gb.CurrentPosition(); b.WhiteToMove == (color == 0) {
+		plies = 2
+	}
+	for i := 0; i < plies && t.started(); i++ {
+		t.gb.Undo()
+	}
+	// clock of side to move runs again
+	if c := t.gb.Clock(); c != nil {
+		c.Stop()
+		if t.started() {
+			c.Start(t.gb.IsWhiteToMove())
+		}
+	}
+}
+
+// flag-fall and abandonment of seats left longer than timeout, true - game is ended now
+func (t *table) check(abandon time.Duration) bool {
+	if !t.full() || t.gb.Outcome().Over() {
+		return false
+	}
+	if _, fallen := t.gb.TimeForfeit(); fallen {
+		return true
+	}
+	if !t.started() {
+		return false
+	}
+	for color, s := range t.seats {
+		if s.conn == nil && time.Since(s.left) > abandon {
+			t.gb.Abandon(color == 0)
+			return true
+		}
+	}
+	return false
+}
+
+// ---- State ----
+
+func (t *table) state() *State {
+	b := t.gb.CurrentPosition()
+	st := &State{FEN: t.gb.FEN(), Moves: []string{}, SAN: []string{}, Spectators: len(t.watchers)}
+	entries := t.gb.HistoryMoves()
+	for i := 1; i <= int(t.gb.CurrentMoveIndex()) && i < len(entries); i++ {
+		st.Moves = append(st.Moves, moves.MoveToUCI(&entries[i-1].Board, entries[i].Move))
+		st.SAN = append(st.SAN, moves.MoveToSAN(&entries[i-1].Board, entries[i].Move))
+	}
+	if s := t.seats[0]; s != nil {
+		st.White, st.WhiteOnline = s.name, s.conn != nil
+	}
+	if s := t.seats[1]; s != nil {
+		st.Black, st.BlackOnline = s.name, s.conn != nil
+	}
+	if c := t.gb.Clock(); c != nil {
+		st.TimeControl = t.tc.String()
+		st.WhiteMs, st.BlackMs = max(c.Left(true).Milliseconds(), 0), max(c.Left(false).Milliseconds(), 0)
+		if c.Running() {
+			st.Running = colorName(index(b.WhiteToMove))
+		}
+	}
+	t.gb.TimeForfeit()
+	o := t.gb.Outcome()
+	st.Result = convpgn.ConvPGNStatusToString(o.Result)
+	if o.Over() {
+		st.Reason, st.Termination = o.Reason.String(), o.Reason.Termination()
+	}
+	if t.offer != "" {
+		st.Offer, st.OfferBy = t.offer, colorName(t.offerBy)
+	}
+	return st
+}
+
+func index(white bool) int {
+	if white {
+		return 0
+	}
+	return 1
+}
+
+func (t *table) info() GameInfo {
+	gi := GameInfo{ID: t.id, Result: "*", Open: !t.full()}
+	if s := t.seats[0]; s != nil {
+		gi.White = s.name
+	}
+	if s := t.seats[1]; s != nil {
+		gi.Black = s.name
+	}
+	if t.tc.HasClock() {
+		gi.TimeControl = t.tc.String()
+	}
+	if o := t.gb.Outcome(); o.Over() {
+		gi.Result = convpgn.ConvPGNStatusToString(o.Result)
+	}
+	return gi
+}
+
+// PGN of game (for log of server)
+func (t *table) pgn() string {
+	var sb strings.Builder
+	_ = t.gb.PGN(&sb)
+	return sb.String()
+}
+
+// message to players and spectators
+func (t *table) broadcast(m Message) {
+	for _, s := range t.seats {
+		if s != nil && s.conn != nil {
+			s.conn.send(m)
+		}
+	}
+	for c := range t.watchers {
+		c.send(m)
+	}
+}
+
+func (t *table) broadcastState() {
+	t.broadcast(Message{Type: TypeState, Game: t.id, State: t.state()})
+}
+
+// nobody is connected
+func (t *table) empty() bool {
+	for _, s := range t.seats {
+		if s != nil && s.conn != nil {
+			return false
+		}
+	}
+	return len(t.watchers) == 0
+}
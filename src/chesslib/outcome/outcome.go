@@ -0,0 +1,245 @@
+package outcome
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/rules/moves"
+)
+
+// --------------------------------------------------
+// Outcome of game
+// --------------------------------------------------
+// result of game with its reason: the board ends game by mate, stalemate and
+// insufficient material, players end it by resignation, agreement, claims,
+// flag-fall and abandonment, arbiters by adjudication
+
+type Reason int
+
+const (
+	None                  Reason = iota // game goes on
+	Checkmate                           // board
+	Stalemate                           // board
+	InsufficientMaterial                // board
+	Repetition                          // claim of threefold repetition
+	FiftyMoves                          // claim of fifty-move rule
+	Resignation                         // loser resigns
+	Timeout                             // flag-fall
+	TimeoutVsInsufficient               // flag-fall, the opponent can't mate
+	Agreement                           // draw offer is accepted
+	Abandonment                         // loser left the game
+	Adjudication                        // arbiter, tablebase or scores of engines
+)
+
+// PGN Termination tag
+const (
+	TerminationNormal       = "normal"
+	TerminationAdjudication = "adjudication"
+	TerminationTimeForfeit  = "time forfeit"
+	TerminationAbandoned    = "abandoned"
+	TerminationInfraction   = "rules infraction"
+)
+
+func (r Reason) String() string {
+	switch r {
+	case None:
+		return "none"
+	case Checkmate:
+		return "checkmate"
+	case Stalemate:
+		return "stalemate"
+	case InsufficientMaterial:
+		return "insufficient material"
+	case Repetition:
+		return "threefold repetition"
+	case FiftyMoves:
+		return "fifty-move rule"
+	case Resignation:
+		return "resignation"
+	case Timeout:
+		return "time forfeit"
+	case TimeoutVsInsufficient:
+		return "timeout vs insufficient material"
+	case Agreement:
+		return "agreement"
+	case Abandonment:
+		return "abandonment"
+	case Adjudication:
+		return "adjudication"
+	}
+	return "unknown"
+}
+
+// PGN Termination of reason ("" - game goes on)
+func (r Reason) Termination() string {
+	switch r {
+	case None:
+		return ""
+	case Timeout, TimeoutVsInsufficient:
+		return TerminationTimeForfeit
+	case Abandonment:
+		return TerminationAbandoned
+	case Adjudication:
+		return TerminationAdjudication
+	}
+	return TerminationNormal
+}
+
+type Outcome struct {
+	Result convpgn.PGNStatusGame
+	Reason Reason
+	Detail string // reason of adjudication, ...
+}
+
+// game is over
+func (o Outcome) Over() bool { return o.Reason != None }
+
+// "1-0 resignation", "1/2-1/2 agreement"
+func (o Outcome) String() string {
+	if !o.Over() {
+		return convpgn.ConvPGNStatusToString(convpgn.PGNStatusActive)
+	}
+	s := convpgn.ConvPGNStatusToString(o.Result) + " " + o.Reason.String()
+	if o.Detail != "" {
+		s += " (" + o.Detail + ")"
+	}
+	return s
+}
+
+// white (or black) wins
+func win(white bool) convpgn.PGNStatusGame {
+	if white {
+		return convpgn.PGNStatusWW
+	}
+	return convpgn.PGNStatusBW
+}
+
+// ---- Constructors ----
+
+// outcome by status of board (None - game goes on)
+func OfStatus(status base.GameStatus, whiteToMove bool) Outcome {
+	switch status {
+	case base.Checkmate:
+		return Outcome{Result: win(!whiteToMove), Reason: Checkmate}
+	case base.Stalemate:
+		return Outcome{Result: convpgn.PGNStatusDraw, Reason: Stalemate}
+	case base.Draw:
+		return Outcome{Result: convpgn.PGNStatusDraw, Reason: InsufficientMaterial}
+	}
+	return Outcome{Result: convpgn.PGNStatusActive}
+}
+
+// white (or black) resigns
+func Resign(white bool) Outcome {
+	return Outcome{Result: win(!white), Reason: Resignation}
+}
+
+// white (or black) left the game
+func Abandon(white bool) Outcome {
+	return Outcome{Result: win(!white), Reason: Abandonment}
+}
+
+func Agreed() Outcome {
+	return Outcome{Result: convpgn.PGNStatusDraw, Reason: Agreement}
+}
+
+func Adjudicate(result convpgn.PGNStatusGame, detail string) Outcome {
+	return Outcome{Result: result, Reason: Adjudication, Detail: detail}
+}
+
+// flag of white (or black) has fallen in position: draw if the opponent
+// can't mate by any sequence of moves
+func FlagFall(b *base.Board, white bool) Outcome {
+	if !canMate(&b.Mailbox, !white) {
+		return Outcome{Result: convpgn.PGNStatusDraw, Reason: TimeoutVsInsufficient}
+	}
+	return Outcome{Result: win(!white), Reason: Timeout}
+}
+
+// pawn, rook, queen or two minor pieces mate (not bishops of one square color),
+// one minor piece mates only if the other side has pieces to block its king
+func canMate(mb *base.Mailbox, white bool) bool {
+	knights, others := 0, 0
+	var bishops, otherBishops [2]int // by square color
+	for i, p := range mb {
+		color := (i/8 + i%8) % 2
+		isBishop := p == base.WBishop || p == base.BBishop
+		switch {
+		case p == base.EmptyPiece || p == base.WKing || p == base.BKing:
+		case base.PieceIsWhite(p) != white && isBishop:
+			otherBishops[color]++
+		case base.PieceIsWhite(p) != white:
+			others++
+		case p == base.WKnight || p == base.BKnight:
+			knights++
+		case isBishop:
+			bishops[color]++
+		default:
+			return true
+		}
+	}
+	minors := knights + bishops[0] + bishops[1]
+	if knights == 0 && (bishops[0] == 0 || bishops[1] == 0) {
+		// bishops of one color: the king is blocked on the other color
+		color := 0
+		if bishops[1] > 0 {
+			color = 1
+		}
+		return minors > 0 && (others > 0 || otherBishops[1-color] > 0)
+	}
+	if minors >= 2 {
+		return true
+	}
+	return minors == 1 && others+otherBishops[0]+otherBishops[1] > 0
+}
+
+// ---- Draw claims ----
+
+// position of repetition (counters are ignored)
+type positionKey struct {
+	mailbox   base.Mailbox
+	white     bool
+	casting   base.StatusCasting
+	enPassant int
+}
+
+func keyOf(b *base.Board) positionKey {
+	return positionKey{mailbox: b.Mailbox, white: b.WhiteToMove, casting: b.Casting, enPassant: EnPassant(b)}
+}
+
+// en passant square if the capture is legal (-1 - none): positions differ
+// by it only then
+func EnPassant(b *base.Board) int {
+	if b.EnPassant == -1 {
+		return -1
+	}
+	for _, mv := range moves.GenerateLegalMoves(b) {
+		if base.ConvPointToIndex(mv.To) == b.EnPassant && mv.From.W != mv.To.W {
+			if p := b.Mailbox[base.ConvPointToIndex(mv.From)]; p == base.WPawn || p == base.BPawn {
+				return b.EnPassant
+			}
+		}
+	}
+	return -1
+}
+
+// draw which side to move can claim after positions of game (the last one
+// is current): threefold repetition or fifty moves without capture and pawn move
+func Claim(positions []base.Board) (Outcome, bool) {
+	if len(positions) == 0 {
+		return Outcome{}, false
+	}
+	last := &positions[len(positions)-1]
+	if last.Halfmove >= 100 {
+		return Outcome{Result: convpgn.PGNStatusDraw, Reason: FiftyMoves}, true
+	}
+	key, seen := keyOf(last), 0
+	for i := range positions {
+		if keyOf(&positions[i]) == key {
+			seen++
+		}
+	}
+	if seen >= 3 {
+		return Outcome{Result: convpgn.PGNStatusDraw, Reason: Repetition}, true
+	}
+	return Outcome{}, false
+}
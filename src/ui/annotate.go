@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/arena"
+	"evilchess/src/chesslib/engine/review"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/history"
+	"evilchess/src/logx"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/urfave/cli/v3"
+)
+
+// review games of PGN file by engine and write annotated PGN
+func RunAnnotate(ctx context.Context, c *cli.Command) error {
+	path := c.Args().First()
+	if path == "" {
+		return fmt.Errorf("PGN file is not set")
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	games, err := convpgn.ParseAll(in)
+	if err != nil {
+		return fmt.Errorf("error read PGN: %v", err)
+	}
+
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	e, params, err := analysisEngine(c, GetLogger(file, c))
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	var out io.Writer = os.Stdout
+	if name := c.String("out"); name != "" {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	for i, pg := range games {
+		// progress and summary go to stderr: annotated PGN can be on stdout
+		label := fmt.Sprintf("game %d/%d", i+1, len(games))
+		r, err := reviewGame(ctx, e, pg, review.Options{
+			Params: params,
+			Progress: func(done, total int) {
+				fmt.Fprintf(os.Stderr, "\r%s: %d/%d positions", label, done, total)
+			},
+		})
+		fmt.Fprintln(os.Stderr)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: error %v\n", label, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: white %s\n", label, r.White)
+		fmt.Fprintf(os.Stderr, "%s: black %s\n", label, r.Black)
+		r.Annotate(pg)
+		if err := convpgn.WritePGN(out, *pg); err != nil {
+			return err
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+// engine of --engine spec with limits of every position from --depth and --movetime
+// (depth and threads of spec are preferred)
+func analysisEngine(c *cli.Command, logger logx.Logger) (engine.Engine, engine.SearchParams, error) {
+	var params engine.SearchParams
+	spec, err := parseEngineSpec(c.String("engine"))
+	if err != nil {
+		return nil, params, err
+	}
+	p, err := newMatchResources(logger).player(spec, arena.TimeControl{})
+	if err != nil {
+		return nil, params, err
+	}
+	e, err := p.New()
+	if err != nil {
+		return nil, params, fmt.Errorf("%s: %v", p.Name, err)
+	}
+	params = engine.SearchParams{
+		MaxDepth:  int(c.Int("depth")),
+		MaxTimeMs: int64(c.Int("movetime")),
+		Threads:   p.Params.Threads,
+	}
+	if p.Params.MaxDepth > 0 {
+		params.MaxDepth = p.Params.MaxDepth
+	}
+	return e, params, nil
+}
+
+// history of PGN game from its FEN tag
+func gameHistory(pg *convpgn.PGNGame) (*history.History, error) {
+	fen := pg.Tags["FEN"]
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return nil, err
+	}
+	h := history.NewHistory()
+	if err := h.ImportPGNGame(pg, b); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// review of PGN game from its FEN tag
+func reviewGame(ctx context.Context, e engine.Engine, pg *convpgn.PGNGame, opts review.Options) (*review.Review, error) {
+	h, err := gameHistory(pg)
+	if err != nil {
+		return nil, err
+	}
+	return review.ReviewHistory(ctx, e, h, opts)
+}
@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine/book"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+func loadBookKeys(c *cli.Command) error {
+	if path := c.String("keys"); path != "" {
+		return book.LoadKeys(path)
+	}
+	return nil
+}
+
+// create Polyglot book from PGN games
+func RunBookBuild(c *cli.Command) error {
+	if err := loadBookKeys(c); err != nil {
+		return err
+	}
+	bd := book.NewBuilder(book.BuildOptions{
+		MaxPly:   int(c.Int("max-ply")),
+		MinGames: int(c.Int("min-games")),
+	})
+	for _, path := range c.StringSlice("pgn") {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = bd.AddPGN(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("error read PGN %s: %v", path, err)
+		}
+	}
+
+	out, err := os.Create(c.String("out"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	n, err := bd.Write(out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("games: %d, book entries: %d, written to %s\n", bd.Games(), n, c.String("out"))
+	return nil
+}
+
+// print book moves of position
+func RunBookProbe(c *cli.Command) error {
+	if err := loadBookKeys(c); err != nil {
+		return err
+	}
+	bk, err := book.Open(c.String("book"))
+	if err != nil {
+		return err
+	}
+	fen := c.String("fen")
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("key: %016x\n", book.Hash(b))
+	list := bk.Probe(b)
+	if len(list) == 0 {
+		fmt.Println("position is not in book")
+		return nil
+	}
+	sum := 0
+	for _, m := range list {
+		sum += m.Weight
+	}
+	for _, m := range list {
+		share := 0.0
+		if sum > 0 {
+			share = float64(m.Weight) / float64(sum) * 100
+		}
+		fmt.Printf("%-8s %-6s weight %5d (%.1f%%)\n", moves.MoveToSAN(b, m.Move), moves.MoveToUCI(b, m.Move), m.Weight, share)
+	}
+	return nil
+}
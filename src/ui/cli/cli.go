@@ -6,7 +6,9 @@ import (
 	"bufio"
 	"evilchess/src/chesslib"
 	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
 	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/skill"
 	"fmt"
 	"io"
 	"os"
@@ -32,6 +34,7 @@ func NewCLI(b *chesslib.GameBuilder, draw DrawFunc) *CLIProcessing {
 // raw processing
 // - enter SAN move
 // - left/right arrow keys to undo/redo
+// - 'resign', 'draw' (claim or offer to engine) to end game
 // - q or Ctrl+C to exit
 // - redraw board every move
 func (c *CLIProcessing) Run() error {
@@ -49,7 +52,7 @@ func (c *CLIProcessing) Run() error {
 	// initial draw
 	c.draw(c.builder.CurrentBoard())
 	c.printStatus()
-	fmt.Fprint(c.out, "\nType SAN and press Enter, or use left/right arrows to undo/redo, 'i' to PGN, 'm' to moves, 'l' 'q' to quit.\n")
+	fmt.Fprint(c.out, "\nType SAN and press Enter, or use left/right arrows to undo/redo, 'i' to PGN, 'm' to moves, 'elo N' to human-like engine, 'resign', 'draw' to claim or offer draw, 'l' 'q' to quit.\n")
 
 	for {
 		b, err := r.ReadByte()
@@ -78,14 +81,14 @@ func (c *CLIProcessing) Run() error {
 					c.builder.Undo()
 					c.draw(c.builder.CurrentBoard())
 					c.printStatus()
-					if terminalFinished(c.builder.Status()) {
+					if c.gameOver() {
 						return nil
 					}
 				case 'C': // right arrow
 					c.builder.Redo()
 					c.draw(c.builder.CurrentBoard())
 					c.printStatus()
-					if terminalFinished(c.builder.Status()) {
+					if c.gameOver() {
 						return nil
 					}
 				}
@@ -105,12 +108,26 @@ func (c *CLIProcessing) Run() error {
 				fmt.Fprintln(c.out, "\nQuitting")
 				return nil
 			}
+			if c.gameOver() {
+				return nil
+			}
+			if s == "resign" || s == "draw" {
+				c.endGame(s)
+				if c.gameOver() {
+					return nil
+				}
+				continue
+			}
 			if s >= "1" && s <= "9" {
 				lvl, _ := strconv.Atoi(s)
 				fmt.Fprintf(c.out, "\nSet level engine %d\n", lvl)
 				c.builder.SetEngineLevel(engine.LevelAnalyze(lvl))
 				continue
 			}
+			if arg, ok := strings.CutPrefix(s, "elo "); ok {
+				c.setElo(arg)
+				continue
+			}
 			if s == "m" {
 				fmt.Fprintf(c.out, "\nMoves: %s\n", c.builder.PGNBody())
 				continue
@@ -127,6 +144,9 @@ func (c *CLIProcessing) Run() error {
 				}
 				c.draw(c.builder.CurrentBoard())
 				c.printStatus()
+				if c.gameOver() {
+					return nil
+				}
 				continue
 			} else {
 				// try SAN move
@@ -141,7 +161,7 @@ func (c *CLIProcessing) Run() error {
 				// success
 				c.draw(c.builder.CurrentBoard())
 				c.printStatus()
-				if terminalFinished(status) {
+				if c.gameOver() {
 					return nil
 				}
 			}
@@ -165,7 +185,7 @@ func (c *CLIProcessing) RunLineMode() error {
 	scanner := bufio.NewScanner(c.in)
 	c.draw(c.builder.CurrentBoard())
 	c.printStatus()
-	fmt.Fprintln(c.out, "Enter SAN and press Enter. Use 'undo'/'redo' to navigate, 'q' to quit.")
+	fmt.Fprintln(c.out, "Enter SAN and press Enter. Use 'undo'/'redo' to navigate, 'resign'/'draw' to end game, 'q' to quit.")
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
@@ -174,6 +194,16 @@ func (c *CLIProcessing) RunLineMode() error {
 		if line == "q" || line == "Q" {
 			return nil
 		}
+		if c.gameOver() {
+			return nil
+		}
+		if line == "resign" || line == "draw" {
+			c.endGame(line)
+			if c.gameOver() {
+				return nil
+			}
+			continue
+		}
 		if line == "undo" {
 			c.builder.Undo()
 			c.draw(c.builder.CurrentBoard())
@@ -186,6 +216,10 @@ func (c *CLIProcessing) RunLineMode() error {
 			c.printStatus()
 			continue
 		}
+		if arg, ok := strings.CutPrefix(line, "elo "); ok {
+			c.setElo(arg)
+			continue
+		}
 		if line == "moves" {
 			fmt.Fprintln(c.out, c.builder.PGNBody())
 			continue
@@ -204,7 +238,7 @@ func (c *CLIProcessing) RunLineMode() error {
 		} else {
 			c.draw(c.builder.CurrentBoard())
 			c.printStatus()
-			if terminalFinished(status) {
+			if c.gameOver() {
 				return nil
 			}
 		}
@@ -212,12 +246,71 @@ func (c *CLIProcessing) RunLineMode() error {
 	return scanner.Err()
 }
 
+// "elo N": engine plays human-like moves at N Elo, "elo 0": full strength
+func (c *CLIProcessing) setElo(arg string) {
+	elo, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil {
+		fmt.Fprintf(c.out, "\nInvalid Elo: %s\n", arg)
+		return
+	}
+	e := c.builder.EngineWorker()
+	if e == nil {
+		fmt.Fprintln(c.out, "\nEngine not set")
+		return
+	}
+	if elo <= 0 {
+		if se, ok := e.(*skill.SkillEngine); ok {
+			c.builder.SetEngineWorker(se.Unwrap())
+		}
+		fmt.Fprintln(c.out, "\nEngine plays at full strength")
+		return
+	}
+	c.builder.SetEngineWorker(skill.ForElo(e, elo))
+	fmt.Fprintf(c.out, "\nEngine plays at ~%d Elo\n", skill.ClampElo(elo))
+}
+
 func (c *CLIProcessing) printStatus() {
 	status := c.builder.Status()
 	fmt.Fprintln(c.out)
 	fmt.Fprintf(c.out, "FEN: %s\n", c.builder.FEN())
 	fmt.Fprintf(c.out, "Moves: %s\n", c.builder.PGNBody())
 	fmt.Fprintf(c.out, "Status: %s\n", statusString(status))
+	if cl := c.builder.Clock(); cl != nil {
+		fmt.Fprintf(c.out, "Clock: White %s, Black %s (%s)\n", clock.Format(cl.Left(true)), clock.Format(cl.Left(false)), cl.Side(true).Control())
+	}
+}
+
+// "resign": side to move resigns, "draw": claim of repetition or fifty-move
+// rule, otherwise offer to engine
+func (c *CLIProcessing) endGame(cmd string) {
+	white := c.builder.IsWhiteToMove()
+	switch cmd {
+	case "resign":
+		c.builder.Resign(white)
+	case "draw":
+		if _, ok := c.builder.ClaimDraw(); ok {
+			return
+		}
+		if c.builder.EngineWorker() == nil {
+			fmt.Fprintln(c.out, "\nNo draw to claim")
+			return
+		}
+		fmt.Fprintln(c.out, "\nDraw offered to engine...")
+		if !c.builder.OfferDraw(white) {
+			fmt.Fprintln(c.out, "Draw offer is declined")
+		}
+	}
+}
+
+// outcome is printed when game is over (checkmate, resignation, flag-fall, ...)
+func (c *CLIProcessing) gameOver() bool {
+	c.builder.TimeForfeit()
+	o := c.builder.Outcome()
+	if !o.Over() {
+		return false
+	}
+	fmt.Fprintf(c.out, "\nGame over: %s\n", o)
+	return true
 }
 
 func statusString(s base.GameStatus) string {
@@ -228,6 +321,8 @@ func statusString(s base.GameStatus) string {
 		return "Checkmate"
 	case base.Stalemate:
 		return "Stalemate"
+	case base.Draw:
+		return "Draw"
 	case base.Pass:
 		return "Normal"
 	case base.InvalidGame:
@@ -236,7 +331,3 @@ func statusString(s base.GameStatus) string {
 		return fmt.Sprintf("Unknown(%d)", s)
 	}
 }
-
-func terminalFinished(s base.GameStatus) bool {
-	return s == base.Checkmate || s == base.Stalemate
-}
@@ -3,6 +3,8 @@ package cli
 import (
 	"evilchess/src/chesslib/base"
 	"fmt"
+	"io"
+	"os"
 )
 
 // func EnableANSI() {
@@ -20,6 +22,11 @@ import (
 // }
 
 func PrintMailbox(m base.Mailbox) {
+	FprintMailbox(os.Stdout, m, false)
+}
+
+// board from side of black if flipped
+func FprintMailbox(w io.Writer, m base.Mailbox, flipped bool) {
 	// ANSI-code
 	const (
 		reset   = "\033[0m"
@@ -71,11 +78,18 @@ func PrintMailbox(m base.Mailbox) {
 		return p == base.BKing || p == base.BQueen || p == base.BRook || p == base.BBishop || p == base.BKnight || p == base.BPawn
 	}
 
-	fmt.Println()
-	fmt.Println("   a  b  c  d  e  f  g  h")
-	for rank := 7; rank >= 0; rank-- {
-		fmt.Printf("%d ", rank+1)
-		for file := 0; file < 8; file++ {
+	files := "   a  b  c  d  e  f  g  h"
+	ranks := []int{7, 6, 5, 4, 3, 2, 1, 0}
+	order := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	if flipped {
+		files = "   h  g  f  e  d  c  b  a"
+		ranks, order = order, ranks
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, files)
+	for _, rank := range ranks {
+		fmt.Fprintf(w, "%d ", rank+1)
+		for _, file := range order {
 			idx := rank*8 + file
 			p := m[idx]
 			g := pieceGlyph(p)
@@ -101,10 +115,10 @@ func PrintMailbox(m base.Mailbox) {
 				}
 			}
 
-			fmt.Printf("%s%s %s %s", bg, fg, g, reset)
+			fmt.Fprintf(w, "%s%s %s %s", bg, fg, g, reset)
 		}
-		fmt.Printf(" %d\n", rank+1)
+		fmt.Fprintf(w, " %d\n", rank+1)
 	}
-	fmt.Println("   a  b  c  d  e  f  g  h")
-	fmt.Println()
+	fmt.Fprintln(w, files)
+	fmt.Fprintln(w)
 }
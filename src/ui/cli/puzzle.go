@@ -0,0 +1,262 @@
+//go:build linux || windows
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine/puzzle"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// puzzle trainer in terminal: the user enters moves of solver (SAN or UCI),
+// replies of opponent are played automatically
+type PuzzleCLI struct {
+	list  []puzzle.Puzzle
+	stats *puzzle.Stats
+	save  func() error // called after every change of stats
+	in    *os.File
+	out   io.Writer
+
+	attempt  *puzzle.Attempt
+	done     map[string]bool
+	recorded bool
+}
+
+func NewPuzzleCLI(list []puzzle.Puzzle, stats *puzzle.Stats, save func() error) *PuzzleCLI {
+	return &PuzzleCLI{list: list, stats: stats, save: save, in: os.Stdin, out: os.Stdout, done: map[string]bool{}}
+}
+
+// raw processing
+// - enter move and press Enter
+// - 'h' hint (piece, then square), 's' solution, 'r' retry, 'n' next puzzle
+// - q or Ctrl+C to exit
+func (pc *PuzzleCLI) Run() error {
+	fd := int(pc.in.Fd())
+	var readLine func() (string, error)
+	if oldState, err := term.MakeRaw(fd); err == nil {
+		defer term.Restore(fd, oldState) //nolint:errcheck
+		// raw terminal does not return carriage
+		pc.out = crlfWriter{pc.out}
+		r := bufio.NewReader(pc.in)
+		readLine = func() (string, error) {
+			return pc.rawLine(r)
+		}
+	} else {
+		sc := bufio.NewScanner(pc.in)
+		readLine = func() (string, error) {
+			if !sc.Scan() {
+				if err := sc.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return sc.Text(), nil
+		}
+	}
+
+	fmt.Fprint(pc.out, "Enter moves (SAN or UCI), 'h' to hint, 's' to solution, 'r' to retry, 'n' to next puzzle, 'q' to quit.\n")
+	pc.next()
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch s := strings.TrimSpace(line); s {
+		case "":
+		case "q", "Q", "quit":
+			pc.skip()
+			fmt.Fprintf(pc.out, "\n%s\n", pc.stats)
+			return nil
+		case "n":
+			pc.next()
+		case "r":
+			if pc.attempt != nil {
+				pc.skip()
+				pc.start(pc.attempt.Puzzle)
+			}
+		case "h":
+			pc.hint()
+		case "s":
+			pc.solution()
+		default:
+			pc.move(s)
+		}
+	}
+}
+
+// line of raw terminal: Enter ends it, Ctrl+C is end of input
+func (pc *PuzzleCLI) rawLine(r *bufio.Reader) (string, error) {
+	var buf []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case b == 3: // Ctrl+C
+			fmt.Fprintln(pc.out, "\nInterrupted")
+			return "q", nil
+		case b == '\r' || b == '\n':
+			fmt.Fprintln(pc.out)
+			return string(buf), nil
+		case (b == 127 || b == 8) && len(buf) > 0: // backspace
+			buf = buf[:len(buf)-1]
+			fmt.Fprint(pc.out, "\b \b")
+		case b == 0x1b: // escape sequences are ignored
+			_, _ = r.ReadByte()
+			_, _ = r.ReadByte()
+		case b >= 32 && b <= 126:
+			buf = append(buf, b)
+			fmt.Fprintf(pc.out, "%c", b)
+		}
+	}
+}
+
+func (pc *PuzzleCLI) next() {
+	pc.skip()
+	idx := puzzle.Pick(pc.list, pc.stats.Rating, pc.done)
+	if idx < 0 {
+		return
+	}
+	pc.done[pc.list[idx].ID] = true
+	pc.recorded = false
+	pc.start(pc.list[idx])
+}
+
+// puzzle left after hints fails
+func (pc *PuzzleCLI) skip() {
+	if pc.attempt != nil && !pc.attempt.Clean() {
+		pc.record(false)
+	}
+}
+
+func (pc *PuzzleCLI) start(p puzzle.Puzzle) {
+	a, err := puzzle.NewAttempt(p)
+	if err != nil {
+		fmt.Fprintf(pc.out, "Invalid puzzle: %v\n", err)
+		return
+	}
+	pc.attempt = a
+	side := "White"
+	if !a.SolverWhite() {
+		side = "Black"
+	}
+	fmt.Fprintf(pc.out, "\nPuzzle %s. Your rating: %d\n", p.ID, pc.stats.Rating)
+	pc.draw()
+	fmt.Fprintf(pc.out, "%s to move: find the best move\n", side)
+}
+
+func (pc *PuzzleCLI) draw() {
+	FprintMailbox(pc.out, pc.attempt.Board().Mailbox, !pc.attempt.SolverWhite())
+}
+
+func (pc *PuzzleCLI) record(solved bool) {
+	if pc.recorded {
+		return
+	}
+	pc.recorded = true
+	delta := pc.stats.Record(pc.attempt.Puzzle.Rating, solved)
+	fmt.Fprintf(pc.out, "Rating: %d (%+d), streak %d (best %d)\n", pc.stats.Rating, delta, pc.stats.Streak, pc.stats.BestStreak)
+	if err := pc.save(); err != nil {
+		fmt.Fprintf(pc.out, "error save rating: %v\n", err)
+	}
+}
+
+// move of solver: SAN or UCI
+func (pc *PuzzleCLI) move(s string) {
+	if pc.attempt == nil || !pc.attempt.SolverToMove() {
+		fmt.Fprintln(pc.out, "Puzzle is finished: 'n' to next puzzle, 'r' to retry")
+		return
+	}
+	b := pc.attempt.Board()
+	mv, err := moves.SANToMove(b, s)
+	if err != nil {
+		if mv, err = moves.UCIToMove(b, s); err != nil {
+			fmt.Fprintf(pc.out, "Invalid move: %s\n", s)
+			return
+		}
+	}
+	switch pc.attempt.Play(mv) {
+	case puzzle.MoveIllegal:
+		fmt.Fprintf(pc.out, "Illegal move: %s\n", s)
+	case puzzle.MoveWrong:
+		fmt.Fprintln(pc.out, "That is not the move! Try again")
+		pc.record(false)
+	case puzzle.MoveRight:
+		fmt.Fprintln(pc.out, "Best move! Keep going")
+		pc.reply()
+	case puzzle.MoveSolved:
+		pc.draw()
+		fmt.Fprintf(pc.out, "Solved! Puzzle rating %d, themes: %s\n", pc.attempt.Puzzle.Rating, strings.Join(pc.attempt.Puzzle.Themes, ", "))
+		pc.record(pc.attempt.Clean())
+	}
+}
+
+// reply of opponent
+func (pc *PuzzleCLI) reply() {
+	b := pc.attempt.Board()
+	mv, ok := pc.attempt.Reply()
+	if !ok {
+		return
+	}
+	pc.draw()
+	fmt.Fprintf(pc.out, "Opponent: %s\n", moves.MoveToSAN(b, mv))
+}
+
+func (pc *PuzzleCLI) hint() {
+	if pc.attempt == nil {
+		return
+	}
+	from, to, ok := pc.attempt.Hint()
+	if !ok {
+		return
+	}
+	sq, _ := base.AlgebraicFromSquare(from)
+	if to < 0 {
+		fmt.Fprintf(pc.out, "Hint: piece on %s\n", sq)
+		return
+	}
+	target, _ := base.AlgebraicFromSquare(to)
+	fmt.Fprintf(pc.out, "Hint: %s to %s\n", sq, target)
+}
+
+func (pc *PuzzleCLI) solution() {
+	if pc.attempt == nil || pc.attempt.Done() {
+		return
+	}
+	pc.attempt.GiveUp()
+	var list []string
+	for !pc.attempt.Done() {
+		b := pc.attempt.Board()
+		mv, ok := pc.attempt.Reply()
+		if !ok {
+			break
+		}
+		list = append(list, moves.MoveToSAN(b, mv))
+	}
+	pc.draw()
+	fmt.Fprintf(pc.out, "Solution: %s\n", strings.Join(list, " "))
+	pc.record(false)
+}
+
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
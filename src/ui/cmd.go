@@ -3,14 +3,28 @@ package ui
 import (
 	"context"
 	"evilchess/src/chesslib"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
 	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/aiengine"
+	"evilchess/src/chesslib/engine/aiengine/dataset"
+	"evilchess/src/chesslib/engine/book"
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/engine/skill"
 	"evilchess/src/chesslib/engine/uci"
+	"evilchess/src/chesslib/httpapi"
+	"evilchess/src/chesslib/lichess"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/chesslib/netplay"
 	"evilchess/src/logx"
 	clic "evilchess/src/ui/cli"
 	"evilchess/src/ui/gui"
 	"evilchess/src/ui/gui/gbase"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/urfave/cli/v3"
 )
@@ -67,7 +81,115 @@ func RunEvilChess() error {
 		Aliases: []string{"c"},
 		Usage:   "console log",
 	}
-	cliff := []cli.Flag{ff, pf, df, lf, cf}
+	tf := &cli.IntFlag{
+		Name:  "threads",
+		Usage: "engine search threads",
+		Value: 1,
+	}
+	wf := &cli.StringFlag{
+		Name:  "weights",
+		Usage: "path to evaluation weights file of internal engine",
+	}
+	ef := &cli.IntFlag{
+		Name:  "elo",
+		Usage: "engine plays human-like moves at Elo (0 - full strength)",
+		Value: 0,
+	}
+	bkf := &cli.StringFlag{
+		Name:  "keys",
+		Usage: "path to table of 781 big-endian keys replacing Polyglot Random64",
+	}
+	szf := &cli.StringFlag{
+		Name:  "syzygy",
+		Usage: "directories of Syzygy tablebases (SyzygyPath of engine)",
+	}
+	lichessff := []cli.Flag{
+		df, lf, cf, ff,
+		&cli.StringFlag{
+			Name:  "url",
+			Usage: "Lichess server (e.g. http://localhost" + lichess.DefaultMockAddr + " of mock)",
+			Value: lichess.DefaultURL,
+		},
+		&cli.StringFlag{
+			Name:    "token",
+			Usage:   "API token of account",
+			Sources: cli.EnvVars("LICHESS_TOKEN"),
+		},
+		&cli.BoolFlag{
+			Name:  "rated",
+			Usage: "rated challenge",
+		},
+		&cli.StringFlag{
+			Name:  "tc",
+			Usage: "time control of challenge: base+increment in seconds",
+			Value: "300+3",
+		},
+		&cli.IntFlag{
+			Name:  "days",
+			Usage: "correspondence challenge: days per move (instead of tc)",
+		},
+		&cli.StringFlag{
+			Name:  "color",
+			Usage: "color of challenge: white, black, random",
+			Value: lichess.ColorRandom,
+		},
+	}
+	matchff := []cli.Flag{
+		df, lf, cf,
+		&cli.StringSliceFlag{
+			Name:  "engine",
+			Usage: "engine options separated by spaces, e.g. \"name=SF type=uci cmd=./stockfish option.Hash=64\" (type: internal, uci, model, hybrid; keys: tc, depth, threads, elo, weights, features, model, rating, blend, leaf-plies, syzygy, endgame, arg)",
+		},
+		&cli.StringFlag{
+			Name:  "tc",
+			Usage: "time control: [moves/]seconds[+increment], st=seconds per move or depth=N",
+			Value: "10+0.1",
+		},
+		&cli.StringFlag{
+			Name:  "openings",
+			Usage: "opening suite (.pgn or .epd)",
+		},
+		&cli.IntFlag{
+			Name:  "plies",
+			Usage: "plies of PGN openings (0 - all moves)",
+			Value: 8,
+		},
+		&cli.BoolFlag{
+			Name:  "shuffle",
+			Usage: "random order of openings",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Usage: "games at the same time",
+			Value: 1,
+		},
+		&cli.IntFlag{
+			Name:  "maxplies",
+			Usage: "draw after N plies (0 - default)",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "draw",
+			Usage: "draw adjudication, e.g. movenumber=40,movecount=8,score=10",
+		},
+		&cli.StringFlag{
+			Name:  "resign",
+			Usage: "resign adjudication, e.g. movecount=3,score=600",
+		},
+		&cli.StringFlag{
+			Name:  "syzygy",
+			Usage: "directories of Syzygy tablebases for adjudication",
+		},
+		&cli.StringFlag{
+			Name:  "endgame",
+			Usage: "directory of own endgame tables for adjudication",
+		},
+	}
+	clf := &cli.StringFlag{
+		Name:  "clock",
+		Usage: "time control of clock (PGN TimeControl: \"300+2\", \"40/5400+30:1800+30\", \"300d3\")",
+	}
+	cliff := []cli.Flag{ff, pf, df, lf, cf, tf, ef, szf, clf}
 	guiff := []cli.Flag{df, lf, cf}
 
 	return (&cli.Command{
@@ -107,12 +229,31 @@ func RunEvilChess() error {
 						// for my engine
 						// gb.SetEngineWorker(myengine.NewEvilEngine())
 						// for UCI engine
-						gb.SetEngineWorker(uci.NewUCIExec(logger, "materials/engine/stockfish/stockfish"))
+						ue := uci.NewUCIExec(logger, "materials/engine/stockfish/stockfish")
+						if path := c.String("syzygy"); path != "" {
+							_ = ue.SetOption("SyzygyPath", path)
+						}
+						gb.SetEngineWorker(ue)
 						// set level
 						gb.SetEngineLevel(engine.LevelFive)
+						gb.SetEngineThreads(int(c.Int("threads")))
+						if elo := int(c.Int("elo")); elo > 0 {
+							gb.SetEngineWorker(skill.ForElo(gb.EngineWorker(), elo))
+						}
 						gb.CreateClassic()
 					}
 
+					if tc := c.String("clock"); tc != "" {
+						control, err := clock.Parse(tc)
+						if err != nil {
+							fmt.Printf("error parse clock: %v\n", err)
+							return nil
+						}
+						if control.HasClock() {
+							gb.SetClock(clock.New(control))
+						}
+					}
+
 					// clic.EnableANSI()
 					cl := clic.NewCLI(gb, clic.PrintMailbox)
 					// if err := cl.RunLineMode(); err != nil {
@@ -122,6 +263,747 @@ func RunEvilChess() error {
 					return nil
 				},
 			},
+			{
+				Name:  "eval",
+				Usage: "print static evaluation of position by terms",
+				Flags: []cli.Flag{ff, wf},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					fen := c.String("fen")
+					if fen == "" {
+						fen = base.FEN_START_GAME
+					}
+					b, err := convfen.ConvertFENToBoard(fen)
+					if err != nil {
+						fmt.Printf("error parse FEN: %v\n", err)
+						return nil
+					}
+					w := myengine.DefaultWeights()
+					if path := c.String("weights"); path != "" {
+						if w, err = myengine.LoadWeights(path); err != nil {
+							fmt.Printf("error load weights: %v\n", err)
+							return nil
+						}
+					}
+					fmt.Print(myengine.EvaluateBreakdown(b, &w))
+					return nil
+				},
+			},
+			{
+				Name:  "motifs",
+				Usage: "print tactical motifs of position and of moves played from it",
+				Flags: []cli.Flag{
+					ff,
+					&cli.StringFlag{
+						Name:  "move",
+						Usage: "move or line of moves (SAN or UCI, space separated)",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunMotifs(c); err != nil {
+						fmt.Printf("error motifs: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "tune",
+				Usage: "tune evaluation weights of internal engine by PGN games (Texel tuning)",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "pgn",
+						Usage:    "path to PGN file (can be repeated)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "output weights file",
+						Value: myengine.DefaultWeightsFile,
+					},
+					wf,
+					&cli.IntFlag{
+						Name:  "iterations",
+						Usage: "max passes over all parameters",
+						Value: 10,
+					},
+					&cli.IntFlag{
+						Name:  "positions",
+						Usage: "max quiet positions (0 - unlimited)",
+						Value: 200000,
+					},
+					&cli.IntFlag{
+						Name:  "per-game",
+						Usage: "max positions per game (0 - unlimited)",
+						Value: 0,
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunTune(c); err != nil {
+						fmt.Printf("error tune: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "dataset",
+				Usage: "export positions of filtered PGN games for training of the model (CSV or NPY)",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "pgn",
+						Usage:    "path to PGN file (can be repeated)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "output file",
+						Value: "positions.csv",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "output format: csv (columns of pgn2csv.py) or npy (13-plane tensors)",
+						Value: "csv",
+					},
+					&cli.StringFlag{
+						Name:  "exclude",
+						Usage: "comma-separated CSV columns to skip (id,gid,rating,side,result,halfmove,move,fen)",
+					},
+					&cli.IntFlag{
+						Name:  "min-white",
+						Usage: "min rating of white (0 - any)",
+					},
+					&cli.IntFlag{
+						Name:  "min-black",
+						Usage: "min rating of black (0 - any)",
+					},
+					&cli.IntFlag{
+						Name:  "max-elo",
+						Usage: "max rating of both players (0 - any)",
+					},
+					&cli.IntFlag{
+						Name:  "max-rating-diff",
+						Usage: "max rating change of player (-1 - any)",
+						Value: dataset.DefaultFilterOptions().MaxRatingDiff,
+					},
+					&cli.IntFlag{
+						Name:  "min-moves",
+						Usage: "min full moves",
+					},
+					&cli.StringFlag{
+						Name:  "timecontrol",
+						Usage: "exact time control (e.g. 600+0)",
+					},
+					&cli.IntFlag{
+						Name:  "time-min",
+						Usage: "min base time in seconds (-1 - any)",
+						Value: -1,
+					},
+					&cli.IntFlag{
+						Name:  "time-max",
+						Usage: "max base time in seconds (-1 - any)",
+						Value: -1,
+					},
+					&cli.IntFlag{
+						Name:  "max-increment",
+						Usage: "skip games with increment >= value in seconds (-1 - any)",
+						Value: dataset.DefaultFilterOptions().MaxIncrement,
+					},
+					&cli.StringFlag{
+						Name:  "modes",
+						Usage: "comma-separated game types in Event (e.g. blitz,rapid)",
+					},
+					&cli.BoolFlag{Name: "allow-incomplete", Usage: "keep games without result"},
+					&cli.BoolFlag{Name: "allow-termination", Usage: "keep games with not normal termination"},
+					&cli.BoolFlag{Name: "allow-bots", Usage: "keep games of bots"},
+					&cli.BoolFlag{Name: "allow-anonymous", Usage: "keep games of anonymous players"},
+					&cli.BoolFlag{Name: "allow-nonrated", Usage: "keep non-rated games"},
+					&cli.BoolFlag{Name: "dedupe", Usage: "skip duplicate games (hashes are kept in memory)"},
+					&cli.IntFlag{
+						Name:  "status",
+						Usage: "print progress every N games (0 - never)",
+						Value: 100000,
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunDataset(c); err != nil {
+						fmt.Printf("error dataset: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "book",
+				Usage: "Polyglot opening book",
+				Commands: []*cli.Command{
+					{
+						Name:  "build",
+						Usage: "create book from PGN games",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:     "pgn",
+								Usage:    "path to PGN file (can be repeated)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "out",
+								Usage: "output book file",
+								Value: book.DefaultBookFile,
+							},
+							&cli.IntFlag{
+								Name:  "max-ply",
+								Usage: "moves of first N plies of games (0 - all)",
+								Value: book.DefaultBuildOptions().MaxPly,
+							},
+							&cli.IntFlag{
+								Name:  "min-games",
+								Usage: "move must be played in at least N games",
+								Value: book.DefaultBuildOptions().MinGames,
+							},
+							bkf,
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunBookBuild(c); err != nil {
+								fmt.Printf("error book: %v\n", err)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "probe",
+						Usage: "print book moves of position",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "book",
+								Usage: "path to book file",
+								Value: book.DefaultBookFile,
+							},
+							ff,
+							bkf,
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunBookProbe(c); err != nil {
+								fmt.Printf("error book: %v\n", err)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "syzygy",
+				Usage: "probe Syzygy endgame tablebases",
+				Flags: []cli.Flag{
+					ff,
+					&cli.StringFlag{
+						Name:     "path",
+						Usage:    "directories of tables (.rtbw, .rtbz)",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunSyzygyProbe(c); err != nil {
+						fmt.Printf("error syzygy: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "endgame",
+				Usage: "own endgame tables (distance to mate) for up to 4 pieces",
+				Commands: []*cli.Command{
+					{
+						Name:  "build",
+						Usage: "generate tables by retrograde analysis",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "dir",
+								Usage: "directory of tables",
+								Value: endgame.DefaultDir,
+							},
+							&cli.StringSliceFlag{
+								Name:  "material",
+								Usage: "material of table, e.g. KRvK (can be repeated, default: " + strings.Join(endgame.Basic, ",") + ")",
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunEndgameBuild(c); err != nil {
+								fmt.Printf("error endgame: %v\n", err)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "probe",
+						Usage: "print result of position and moves of perfect play",
+						Flags: []cli.Flag{
+							ff,
+							&cli.StringFlag{
+								Name:  "dir",
+								Usage: "directory of tables",
+								Value: endgame.DefaultDir,
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunEndgameProbe(c); err != nil {
+								fmt.Printf("error endgame: %v\n", err)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "match",
+				Usage: "tournament of engines (internal, UCI, model, hybrid) with PGN and crosstable",
+				Flags: append(slices.Clone(matchff),
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "round-robin or gauntlet (first engine against others)",
+						Value: "round-robin",
+					},
+					&cli.IntFlag{
+						Name:  "games",
+						Usage: "games of every pair of engines",
+						Value: 2,
+					},
+					&cli.BoolFlag{
+						Name:  "repeat",
+						Usage: "every opening is played twice with swapped colors",
+						Value: true,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "PGN file of games (appended)",
+						Value: "match.pgn",
+					},
+					&cli.StringFlag{
+						Name:  "event",
+						Usage: "event of PGN",
+						Value: "evilchess match",
+					},
+					&cli.IntFlag{
+						Name:  "ratinginterval",
+						Usage: "print crosstable every N games (0 - only at the end)",
+						Value: 0,
+					},
+				),
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunMatch(ctx, c); err != nil {
+						fmt.Printf("error match: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "sprt",
+				Usage: "sequential probability ratio test of test engine (first) against base engine (second)",
+				Flags: append(slices.Clone(matchff),
+					&cli.FloatFlag{
+						Name:  "elo0",
+						Usage: "Elo of H0",
+						Value: 0,
+					},
+					&cli.FloatFlag{
+						Name:  "elo1",
+						Usage: "Elo of H1",
+						Value: 5,
+					},
+					&cli.FloatFlag{
+						Name:  "alpha",
+						Usage: "false positive rate",
+						Value: 0.05,
+					},
+					&cli.FloatFlag{
+						Name:  "beta",
+						Usage: "false negative rate",
+						Value: 0.05,
+					},
+					&cli.IntFlag{
+						Name:  "max-games",
+						Usage: "stop without decision after N games",
+						Value: 20000,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "PGN file of games (appended, empty - not saved)",
+					},
+					&cli.StringFlag{
+						Name:  "event",
+						Usage: "event of PGN",
+						Value: "evilchess sprt",
+					},
+				),
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunSPRT(ctx, c); err != nil {
+						fmt.Printf("error sprt: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "annotate",
+				Usage:     "review games of PGN file by engine: NAGs, best lines of mistakes and accuracy",
+				ArgsUsage: "game.pgn",
+				Flags: []cli.Flag{
+					df, lf, cf,
+					&cli.StringFlag{
+						Name:  "engine",
+						Usage: "engine options separated by spaces like in match, e.g. \"type=uci cmd=./stockfish\"",
+						Value: "type=internal",
+					},
+					&cli.IntFlag{
+						Name:  "depth",
+						Usage: "depth of analysis of every position",
+						Value: 10,
+					},
+					&cli.IntFlag{
+						Name:  "movetime",
+						Usage: "time of analysis of every position in ms (0 - only depth)",
+						Value: 1000,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "annotated PGN file (empty - stdout)",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunAnnotate(ctx, c); err != nil {
+						fmt.Fprintf(os.Stderr, "error annotate: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "puzzles",
+				Usage: "puzzle sets",
+				Commands: []*cli.Command{
+					{
+						Name:      "extract",
+						Usage:     "find tactics with the only winning line in games of PGN files",
+						ArgsUsage: "games.pgn [more.pgn ...]",
+						Flags: []cli.Flag{
+							df, lf, cf,
+							&cli.StringFlag{
+								Name:  "engine",
+								Usage: "engine options separated by spaces like in match, e.g. \"type=uci cmd=./stockfish\"",
+								Value: "type=internal",
+							},
+							&cli.IntFlag{
+								Name:  "depth",
+								Usage: "depth of analysis of every position",
+								Value: 10,
+							},
+							&cli.IntFlag{
+								Name:  "movetime",
+								Usage: "time of analysis of every position in ms (0 - only depth)",
+								Value: 1000,
+							},
+							&cli.IntFlag{
+								Name:  "max-moves",
+								Usage: "moves of solver in solution",
+								Value: 5,
+							},
+							&cli.IntFlag{
+								Name:  "min-ply",
+								Usage: "skip positions of the first plies of games",
+								Value: 10,
+							},
+							&cli.StringFlag{
+								Name:  "out",
+								Usage: "puzzle set: .json or .epd",
+								Value: "puzzles.json",
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunPuzzlesExtract(ctx, c); err != nil {
+								fmt.Fprintf(os.Stderr, "error puzzles: %v\n", err)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "puzzle",
+				Usage: "solve puzzles in terminal (rating is shared with GUI)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "set",
+						Usage: "puzzle set: .json or .epd (empty - built-in set)",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunPuzzle(c); err != nil {
+						fmt.Printf("error puzzle: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "uci",
+				Usage: "internal engine speaks UCI on stdin/stdout",
+				Flags: []cli.Flag{
+					wf,
+					&cli.StringFlag{
+						Name:  "syzygy",
+						Usage: "directories of Syzygy tablebases",
+					},
+					&cli.StringFlag{
+						Name:  "endgame",
+						Usage: "directory of own endgame tables",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunUCI(c); err != nil {
+						fmt.Fprintf(os.Stderr, "error uci: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "server of network games: host/join, spectators, chat (JSON lines over TCP)",
+				Flags: []cli.Flag{
+					df, lf, cf,
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "listen address",
+						Value: ":" + netplay.DefaultPort,
+					},
+					&cli.DurationFlag{
+						Name:  "abandon",
+						Usage: "disconnected player loses the game after",
+						Value: netplay.DefaultAbandonTimeout,
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunServe(ctx, c); err != nil {
+						fmt.Printf("error serve: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "http",
+				Usage: "HTTP/WebSocket game API: games, engine moves, analysis streams",
+				Flags: []cli.Flag{
+					df, lf, cf, wf,
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "listen address",
+						Value: httpapi.DefaultAddr,
+					},
+					&cli.StringFlag{
+						Name:  "static",
+						Usage: "directory of static files served on \"/\" (e.g. src/ui/wasm)",
+					},
+					&cli.DurationFlag{
+						Name:  "analysis-time",
+						Usage: "analysis of streams is not longer",
+						Value: httpapi.DefaultAnalysisTime,
+					},
+					&cli.StringFlag{
+						Name:  "syzygy",
+						Usage: "directories of Syzygy tablebases",
+					},
+					&cli.StringFlag{
+						Name:  "endgame",
+						Usage: "directory of own endgame tables",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunHTTP(ctx, c); err != nil {
+						fmt.Printf("error http: %v\n", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "lichess",
+				Usage: "Lichess Board/Bot API: engine bot, challenges, moves and local mock server",
+				Commands: []*cli.Command{
+					{
+						Name:  "bot",
+						Usage: "internal engine plays games of bot account, accepts challenges",
+						Flags: append(slices.Clone(lichessff),
+							wf, tf,
+							&cli.IntFlag{
+								Name:  "strength",
+								Usage: "engine level (0 - weakest)",
+								Value: int(engine.LevelFive),
+							},
+							&cli.IntFlag{
+								Name:  "max-games",
+								Usage: "games at the same time",
+								Value: lichess.DefaultMaxGames,
+							},
+							&cli.StringFlag{
+								Name:  "greeting",
+								Usage: "chat message at the start of games",
+							},
+							&cli.BoolFlag{
+								Name:  "upgrade",
+								Usage: "upgrade account to bot account (irreversible, account without games)",
+							},
+							&cli.StringFlag{
+								Name:  "challenge",
+								Usage: "challenge user before playing (flags of challenge)",
+							},
+							&cli.StringFlag{
+								Name:  "syzygy",
+								Usage: "directories of Syzygy tablebases",
+							},
+							&cli.StringFlag{
+								Name:  "endgame",
+								Usage: "directory of own endgame tables",
+							},
+						),
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunLichessBot(ctx, c); err != nil {
+								fmt.Printf("error lichess: %v\n", err)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "challenge",
+						Usage:     "challenge user",
+						ArgsUsage: "username",
+						Flags:     slices.Clone(lichessff),
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunLichessChallenge(ctx, c); err != nil {
+								fmt.Printf("error lichess: %v\n", err)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "games",
+						Usage: "running games of account",
+						Flags: slices.Clone(lichessff),
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunLichessGames(ctx, c); err != nil {
+								fmt.Printf("error lichess: %v\n", err)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "move",
+						Usage:     "play move (SAN or UCI) in game",
+						ArgsUsage: "gameId move",
+						Flags: append(slices.Clone(lichessff),
+							&cli.BoolFlag{
+								Name:  "offer-draw",
+								Usage: "offer draw with move",
+							},
+						),
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunLichessMove(ctx, c); err != nil {
+								fmt.Printf("error lichess: %v\n", err)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "mock",
+						Usage: "local server of Lichess API for bots and clients without network",
+						Flags: []cli.Flag{
+							df, lf, cf,
+							&cli.StringFlag{
+								Name:  "addr",
+								Usage: "listen address",
+								Value: lichess.DefaultMockAddr,
+							},
+							&cli.StringSliceFlag{
+								Name:  "user",
+								Usage: "account name:token[:bot] (can be repeated)",
+							},
+							&cli.DurationFlag{
+								Name:  "claim-win",
+								Usage: "player wins if the opponent left the game for",
+								Value: lichess.DefaultClaimWin,
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if err := RunLichessMock(ctx, c); err != nil {
+								fmt.Printf("error lichess: %v\n", err)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "hybrid",
+				Usage: "play hybrid engine (search + model) against search only and model only engines",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "model",
+						Usage: "path to exported model",
+						Value: aiengine.DefaultModelFile,
+					},
+					wf,
+					&cli.IntFlag{
+						Name:  "games",
+						Usage: "games against every opponent",
+						Value: 10,
+					},
+					&cli.IntFlag{
+						Name:  "depth",
+						Usage: "max search depth (0 - by time)",
+						Value: 0,
+					},
+					&cli.IntFlag{
+						Name:  "movetime",
+						Usage: "time per move in ms",
+						Value: 1000,
+					},
+					tf,
+					&cli.FloatFlag{
+						Name:  "blend",
+						Usage: "weight of model value in scores of root moves and leaves (0..1)",
+						Value: myengine.DefaultHybridOptions().ValueBlend,
+					},
+					&cli.IntFlag{
+						Name:  "leaf-plies",
+						Usage: "blend model value into evaluation of leaves on first N plies (0 - root moves only)",
+						Value: myengine.DefaultHybridOptions().LeafPlies,
+					},
+					&cli.IntFlag{
+						Name:  "policy-plies",
+						Usage: "order moves by model policy on first N plies",
+						Value: myengine.DefaultHybridOptions().PolicyPlies,
+					},
+					&cli.IntFlag{
+						Name:  "topn",
+						Usage: "search only N best root moves by policy (0 - all)",
+						Value: 0,
+					},
+					&cli.StringFlag{
+						Name:  "openings",
+						Usage: "opening suite (.pgn or .epd), every opening is played with both colors",
+					},
+					&cli.IntFlag{
+						Name:  "plies",
+						Usage: "plies of PGN openings (0 - all moves)",
+						Value: 8,
+					},
+					&cli.IntFlag{
+						Name:  "rating",
+						Usage: "rating of player the model imitates",
+						Value: aiengine.DefaultRating,
+					},
+					&cli.BoolFlag{
+						Name:  "moves",
+						Usage: "print moves of games",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if err := RunHybridBench(ctx, c); err != nil {
+						fmt.Printf("error hybrid: %v\n", err)
+					}
+					return nil
+				},
+			},
 			{
 				Name:  "gui",
 				Flags: guiff,
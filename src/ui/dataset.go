@@ -0,0 +1,104 @@
+package ui
+
+import (
+	"evilchess/src/chesslib/engine/aiengine/dataset"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// export positions of PGN games to CSV or NPY for training of the model
+func RunDataset(c *cli.Command) error {
+	opts := dataset.DefaultFilterOptions()
+	opts.MinWhite = int(c.Int("min-white"))
+	opts.MinBlack = int(c.Int("min-black"))
+	opts.MaxElo = int(c.Int("max-elo"))
+	opts.MaxRatingDiff = int(c.Int("max-rating-diff"))
+	opts.MinMoves = int(c.Int("min-moves"))
+	opts.TimeControl = c.String("timecontrol")
+	opts.TimeMin = int(c.Int("time-min"))
+	opts.TimeMax = int(c.Int("time-max"))
+	opts.MaxIncrement = int(c.Int("max-increment"))
+	opts.Modes = splitList(c.String("modes"))
+	opts.SkipIncomplete = !c.Bool("allow-incomplete")
+	opts.SkipTermination = !c.Bool("allow-termination")
+	opts.SkipBots = !c.Bool("allow-bots")
+	opts.SkipAnonymous = !c.Bool("allow-anonymous")
+	opts.SkipNonRated = !c.Bool("allow-nonrated")
+	opts.Dedupe = c.Bool("dedupe")
+
+	out, err := os.Create(c.String("out"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var w dataset.Writer
+	switch format := c.String("format"); format {
+	case "csv":
+		cols, err := dataset.SelectColumns(splitList(c.String("exclude")))
+		if err != nil {
+			return err
+		}
+		if w, err = dataset.NewCSVWriter(out, cols); err != nil {
+			return err
+		}
+	case "npy":
+		if w, err = dataset.NewNPYWriter(out); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	ex := dataset.NewExporter(dataset.NewFilter(opts), w)
+	status := int(c.Int("status"))
+	start := time.Now()
+	progress := func(s dataset.Stats) {
+		if status > 0 && s.Games%status == 0 {
+			fmt.Printf("processed %d games, exported %d, positions %d (%s)\n",
+				s.Games, s.Exported, s.Positions, time.Since(start).Truncate(time.Second))
+		}
+	}
+	for _, path := range c.StringSlice("pgn") {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = ex.ReadPGN(file, progress)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("error read PGN %s: %v", path, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	s := ex.Stats()
+	fmt.Printf("games: %d, exported: %d, positions: %d\n", s.Games, s.Exported, s.Positions)
+	reasons := make([]string, 0, len(s.Skipped))
+	for r := range s.Skipped {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Printf("  skipped (%s): %d\n", r, s.Skipped[r])
+	}
+	fmt.Printf("written to %s\n", c.String("out"))
+	return nil
+}
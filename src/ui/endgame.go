@@ -0,0 +1,54 @@
+package ui
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// generate endgame tables by retrograde analysis
+func RunEndgameBuild(c *cli.Command) error {
+	ts := endgame.NewTables(c.String("dir"))
+	materials := c.StringSlice("material")
+	if len(materials) == 0 {
+		materials = endgame.Basic
+	}
+	for _, key := range materials {
+		start := time.Now()
+		err := ts.Build(key, func(k string) {
+			fmt.Printf("generate %s...\n", k)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		fmt.Printf("%s ready (%s)\n", key, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// print result of position and moves of perfect play
+func RunEndgameProbe(c *cli.Command) error {
+	ts := endgame.NewTables(c.String("dir"))
+	fen := c.String("fen")
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return err
+	}
+	list, res, err := ts.BestMoves(b)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("result: %s\n", res)
+	for _, mv := range list {
+		fmt.Printf("%-8s %s\n", moves.MoveToSAN(b, mv), moves.MoveToUCI(b, mv))
+	}
+	return nil
+}
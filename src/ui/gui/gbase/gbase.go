@@ -51,6 +51,7 @@ type Palette struct {
 	ModalBg      color.RGBA
 	SquareLight  color.RGBA
 	SquareDark   color.RGBA
+	Warning      color.RGBA
 }
 
 func (p Palette) String() string {
@@ -87,6 +88,7 @@ var LightPalette = Palette{
 	ModalBg:      color.RGBA{0x00, 0x00, 0x00, 0x88},
 	SquareLight:  color.RGBA{0x88, 0x88, 0x88, 0xff},
 	SquareDark:   color.RGBA{0xf7, 0xf7, 0xf7, 0xff},
+	Warning:      color.RGBA{0xd0, 0x30, 0x30, 0xff},
 }
 
 var DarkPalette = Palette{
@@ -100,4 +102,5 @@ var DarkPalette = Palette{
 	ModalBg:      color.RGBA{0x00, 0x00, 0x00, 0x99},
 	SquareLight:  color.RGBA{0x88, 0x88, 0x88, 0xff},
 	SquareDark:   color.RGBA{0xf7, 0xf7, 0xf7, 0xff},
+	Warning:      color.RGBA{0xe0, 0x50, 0x50, 0xff},
 }
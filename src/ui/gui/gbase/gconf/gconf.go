@@ -2,41 +2,76 @@ package gconf
 
 import (
 	"encoding/json"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/engine/puzzle"
 	"evilchess/src/ui/gui/gbase/gos"
 	"fmt"
+	"runtime"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Theme     string `json:"theme"`           // light/dark
-	Engine    string `json:"engine"`          // internal/external
-	Lang      string `json:"language"`        // en/ru
-	UCIPath   string `json:"uci_path"`        // path to external engine
-	Strength  int    `json:"engine_strength"` // strength engine
-	UseClock  bool   `json:"use_clock"`       // true/false
-	UseEngine bool   `json:"use_engine"`      // true/false
-	Clock     int    `json:"clock"`           // chess clock time
-	PlayAs    string `json:"play_as"`         // white/random/black
-	Training  bool   `json:"training_mode"`   // true/false
-	WindowH   int    `json:"window_h"`        // window height
-	WindowW   int    `json:"window_w"`        // window width
-	Debug     bool   `json:"debug"`           // true/false
+	Theme      string       `json:"theme"`           // light/dark
+	Engine     string       `json:"engine"`          // internal/external/model
+	Lang       string       `json:"language"`        // en/ru
+	UCIPath    string       `json:"uci_path"`        // path to external engine
+	ModelPath  string       `json:"model_path"`      // path to exported AI model
+	Strength   int          `json:"engine_strength"` // strength engine
+	Ponder     bool         `json:"ponder"`          // engine thinks on the opponent's time
+	Threads    int          `json:"engine_threads"`  // search threads of internal engine
+	Weights    string       `json:"engine_weights"`  // tuned evaluation weights of internal engine
+	HumanLike  bool         `json:"human_like"`      // engine plays human-like moves at Elo
+	Elo        int          `json:"engine_elo"`      // target Elo of human-like engine
+	UseBook    bool         `json:"use_book"`        // internal engine plays moves of opening book
+	BookPath   string       `json:"book_path"`       // path to Polyglot book
+	SyzygyPath string       `json:"syzygy_path"`     // directories of Syzygy tablebases (empty - not used)
+	UseClock   bool         `json:"use_clock"`       // true/false
+	UseEngine  bool         `json:"use_engine"`      // true/false
+	Clock      int          `json:"clock"`           // chess clock time
+	ClockTC    string       `json:"time_control"`    // PGN TimeControl of clock ("180+2", "40/5400+30:1800+30"), empty - Clock minutes
+	PlayAs     string       `json:"play_as"`         // white/random/black
+	Training   bool         `json:"training_mode"`   // true/false
+	NetAddress string       `json:"net_address"`     // server of network game ("host:port")
+	NetName    string       `json:"net_name"`        // name of player in network game
+	ServerURL  string       `json:"server_url"`      // HTTP game API ("http://host:port"), empty - origin of WASM page or localhost:8080
+	PuzzlePath string       `json:"puzzle_path"`     // puzzle set (empty - built-in set)
+	Puzzles    puzzle.Stats `json:"puzzle_stats"`    // puzzle rating and streaks
+	WindowH    int          `json:"window_h"`        // window height
+	WindowW    int          `json:"window_w"`        // window width
+	Debug      bool         `json:"debug"`           // true/false
 }
 
 func defaultConfig() Config {
 	return Config{
-		Theme:     "light",
-		Engine:    "internal",
-		Lang:      "en",
-		UCIPath:   "",
-		Strength:  4,
-		UseClock:  true,
-		UseEngine: true,
-		Clock:     3,
-		PlayAs:    "random",
-		Training:  false,
-		WindowH:   800,
-		WindowW:   1000,
-		Debug:     false,
+		Theme:      "light",
+		Engine:     "internal",
+		Lang:       "en",
+		UCIPath:    "",
+		ModelPath:  "",
+		Strength:   4,
+		Ponder:     false,
+		Threads:    runtime.NumCPU(),
+		Weights:    "",
+		HumanLike:  false,
+		Elo:        1500,
+		UseBook:    false,
+		BookPath:   "",
+		SyzygyPath: "",
+		UseClock:   true,
+		UseEngine:  true,
+		Clock:      3,
+		ClockTC:    "",
+		PlayAs:     "random",
+		Training:   false,
+		NetAddress: "localhost:7777",
+		NetName:    "Player",
+		ServerURL:  "",
+		PuzzlePath: "",
+		Puzzles:    puzzle.NewStats(),
+		WindowH:    800,
+		WindowW:    1000,
+		Debug:      false,
 	}
 }
 
@@ -86,9 +121,14 @@ func correctableConfig(c *Config) {
 		c.Theme = def.Theme
 	}
 	if (c.Engine == "external" && c.UCIPath == "") ||
-		(c.Engine == "" || (c.Engine != "internal" && c.Engine != "external")) {
+		(c.Engine == "model" && c.ModelPath == "") ||
+		(c.Engine == "" || (c.Engine != "internal" && c.Engine != "external" && c.Engine != "model")) {
 		c.Engine = def.Engine
 		c.UCIPath = ""
+		c.ModelPath = ""
+	}
+	if c.UseBook && c.BookPath == "" {
+		c.UseBook = false
 	}
 	if c.Lang != "en" && c.Lang != "ru" {
 		c.Lang = "en"
@@ -96,9 +136,27 @@ func correctableConfig(c *Config) {
 	if c.Strength < 0 || c.Strength > 10 {
 		c.Strength = def.Strength
 	}
+	if c.Elo < 600 || c.Elo > 2800 {
+		c.Elo = def.Elo
+	}
+	if c.Puzzles.Rating == 0 {
+		c.Puzzles = def.Puzzles
+	}
+	if c.Threads < 1 || c.Threads > 64 {
+		c.Threads = def.Threads
+	}
 	if c.Clock < 0 || c.Clock > 60 {
 		c.Clock = def.Clock
 	}
+	if tc, err := clock.Parse(c.ClockTC); c.ClockTC != "" && (err != nil || !tc.HasClock()) {
+		c.ClockTC = def.ClockTC
+	}
+	if strings.TrimSpace(c.NetAddress) == "" {
+		c.NetAddress = def.NetAddress
+	}
+	if strings.TrimSpace(c.NetName) == "" {
+		c.NetName = def.NetName
+	}
 	if c.PlayAs != "white" && c.PlayAs != "random" && c.PlayAs != "black" {
 		c.PlayAs = def.PlayAs
 	}
@@ -107,3 +165,14 @@ func correctableConfig(c *Config) {
 		c.WindowW = def.WindowW
 	}
 }
+
+// time control of play scene (Clock 0 - unlimited)
+func (c *Config) ClockControl() clock.Control {
+	if tc, err := clock.Parse(c.ClockTC); err == nil && tc.HasClock() {
+		return tc
+	}
+	if c.Clock == 0 {
+		return clock.Control{}
+	}
+	return clock.Sudden(time.Duration(c.Clock)*time.Minute, 0)
+}
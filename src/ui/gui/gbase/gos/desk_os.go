@@ -43,3 +43,8 @@ func Remove(name string) error {
 func IsNotExist(err error) bool {
 	return os.IsNotExist(err)
 }
+
+// origin of page: there is no page on desktop
+func Origin() string {
+	return ""
+}
@@ -25,3 +25,4 @@ type ReadCloser = io.ReadCloser
 // WriteFile(name []byte, perm os.FileMode) error
 // Remove(name) error
 // IsNotExist(err error) bool
+// Origin() string
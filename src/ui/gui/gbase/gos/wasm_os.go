@@ -123,3 +123,12 @@ func Remove(name string) error {
 func IsNotExist(err error) bool {
 	return errors.Is(err, ErrNotExist)
 }
+
+// origin of page ("http://host:port"), server of page is used by default
+func Origin() string {
+	loc := js.Global().Get("location")
+	if !loc.Truthy() {
+		return ""
+	}
+	return loc.Get("origin").String()
+}
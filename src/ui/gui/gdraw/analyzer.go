@@ -1,13 +1,18 @@
 package gdraw
 
 import (
+	"context"
 	"errors"
 	"evilchess/src/chesslib/base"
 	"evilchess/src/chesslib/engine"
-	"evilchess/src/chesslib/engine/myengine"
-	"evilchess/src/chesslib/engine/uci"
+	"evilchess/src/chesslib/engine/review"
+	"evilchess/src/chesslib/logic/history"
+	"evilchess/src/chesslib/logic/motifs"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
 	"evilchess/src/ui/gui/ghelper"
 	"fmt"
+	"image/color"
 	"math"
 	"path/filepath"
 	"sort"
@@ -19,6 +24,20 @@ import (
 	"github.com/hajimehoshi/ebiten/v2/text"
 )
 
+const (
+	analyzerTopMoves = 5  // rows of candidates
+	moveRowH         = 22 // row of move list
+	analyzerMotifs   = 4  // rows of tactical motifs
+)
+
+// limits of background evaluation of all positions (graph)
+var graphParams = engine.SearchParams{MaxDepth: 6, MaxTimeMs: 300}
+
+var (
+	evalWhite = color.RGBA{236, 236, 236, 255}
+	evalBlack = color.RGBA{48, 48, 48, 255}
+)
+
 type TypeCandidate struct {
 	Move    base.Move
 	MoveStr string
@@ -72,6 +91,35 @@ type GUIAnalyzeDrawer struct {
 	// message box (promotion etc)
 	msg *ghelper.MessageBox
 
+	// hanging pieces (by SEE) of current position
+	hangingPos base.Board
+	hanging    []int
+
+	// tactical motifs of position and best line (recalculated on change)
+	motifsY   int
+	motifPos  base.Board
+	motifPV   string // moves of best line
+	motifText []string
+
+	// game overview: move list, evaluation bar and graph
+	barX                  int
+	graphX, graphY        int
+	graphW, graphH        int
+	movesX, movesY        int
+	movesRows             int
+	moveKey               historyKey
+	moveStart             base.Board
+	moveList              []string // SAN of moves of history
+	listScroll            int      // first visible row of move list
+	lastPly               int
+	graphMu               sync.Mutex
+	graphKey              historyKey
+	graph                 *review.Review // evaluations of all positions (nil - not ready)
+	graphDone, graphTotal int
+	graphCancel           context.CancelFunc
+	graphImg              *ebiten.Image
+	graphImgOf            *review.Review
+
 	// drag/select state (copied from Play scene)
 	selectedSq    int
 	dragging      bool
@@ -109,6 +157,9 @@ func NewGUIAnalyzeDrawer(ctx *ghelper.GUIGameContext) *GUIAnalyzeDrawer {
 	} else if ctx.Config.Engine == "external" {
 		textBrowse := filepath.Base(ctx.Config.UCIPath)
 		ad.labelEngine = fmt.Sprintf("%s: %s", ctx.AssetsWorker.Lang().T("analyzer.engine.title"), textBrowse)
+	} else if ctx.Config.Engine == "model" {
+		textBrowse := filepath.Base(ctx.Config.ModelPath)
+		ad.labelEngine = fmt.Sprintf("%s: %s", ctx.AssetsWorker.Lang().T("analyzer.engine.title"), textBrowse)
 	} else {
 		ad.labelEngine = fmt.Sprintf("%s: %s", ctx.AssetsWorker.Lang().T("analyzer.engine.title"), ctx.AssetsWorker.Lang().T("analyzer.engine.empty"))
 	}
@@ -116,15 +167,15 @@ func NewGUIAnalyzeDrawer(ctx *ghelper.GUIGameContext) *GUIAnalyzeDrawer {
 	ad.recalcLayout(ctx)
 	ad.prepareCache(ctx)
 
-	// buttons
-	x := ctx.Config.WindowW - 300
-	y := ctx.Config.WindowH - 320
-	w, h := 200, 48
+	// buttons in a row under the right panel
+	x := ctx.Config.WindowW - 370
+	y := ctx.Config.WindowH - 70
+	w, h := 110, 48
 	ad.buttons = []*ghelper.Button{}
 	ad.btnStartIdx, ad.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.start"), x, y, w, h, ad.buttons)
-	y += h + 12
+	x += w + 10
 	ad.btnStopIdx, ad.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.stop"), x, y, w, h, ad.buttons)
-	y += h + 12
+	x += w + 10
 	ad.btnBackIdx, ad.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.back"), x, y, w, h, ad.buttons)
 
 	// Undo/Redo under the board in center
@@ -139,6 +190,15 @@ func NewGUIAnalyzeDrawer(ctx *ghelper.GUIGameContext) *GUIAnalyzeDrawer {
 	ad.listOffset = 100
 	ad.listY = ad.listOffset + 28*5 + 12 // same spacing as in Draw
 
+	// evaluation bar left of the board, graph under undo/redo, move list under candidates
+	ad.barX = ad.boardX - 32
+	ad.graphX, ad.graphY = ad.boardX, uy+h+14
+	ad.graphW, ad.graphH = ad.boardSize, max(ctx.Config.WindowH-ad.graphY-16, 40)
+	ad.motifsY = ad.listY + analyzerTopMoves*28 + 12
+	ad.movesX = ad.listX
+	ad.movesY = ad.motifsY + 20 + analyzerMotifs*18 + 20
+	ad.movesRows = max((y-16-ad.movesY)/moveRowH, 1)
+
 	ad.loader = ghelper.NewCircularLoader(
 		ctx.Config.WindowW-60, 60, // x, y
 		30,  // radius
@@ -152,7 +212,8 @@ func NewGUIAnalyzeDrawer(ctx *ghelper.GUIGameContext) *GUIAnalyzeDrawer {
 }
 
 func (ad *GUIAnalyzeDrawer) recalcLayout(ctx *ghelper.GUIGameContext) {
-	ad.boardSize = ctx.Config.WindowW - 420
+	// room for graph under the board
+	ad.boardSize = min(ctx.Config.WindowW-420, ctx.Config.WindowH-260)
 	if ad.boardSize < 320 {
 		ad.boardSize = 320
 	}
@@ -210,9 +271,15 @@ func (ad *GUIAnalyzeDrawer) StartAnalysis(ctx *ghelper.GUIGameContext, level eng
 
 	var e engine.Engine
 	if ctx.Config.Engine == "internal" {
-		e = myengine.NewEvilEngine()
+		e = NewInternalEngine(ctx)
 	} else if ctx.Config.Engine == "external" {
-		e = uci.NewUCIExec(ctx.Logx, ctx.Config.UCIPath)
+		e = NewExternalEngine(ctx)
+	} else if ctx.Config.Engine == "model" {
+		me := NewModelEngine(ctx)
+		if me == nil {
+			return errors.New("model not loaded")
+		}
+		e = me
 	} else {
 		return errors.New("unsupported engine")
 	}
@@ -235,7 +302,9 @@ func (ad *GUIAnalyzeDrawer) StartAnalysis(ctx *ghelper.GUIGameContext, level eng
 		return fmt.Errorf("engine setposition failed: %w", err)
 	}
 
-	if err := ctx.Builder.EngineWorker().StartAnalysis(engine.LevelToParams(level)); err != nil {
+	params := engine.LevelToParams(level)
+	params.Threads = ctx.Config.Threads
+	if err := ctx.Builder.EngineWorker().StartAnalysis(params); err != nil {
 		unsub()
 		ctx.Builder.EngineWorker().Close()
 		return fmt.Errorf("engine start analysis failed: %w", err)
@@ -396,6 +465,7 @@ func (ad *GUIAnalyzeDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, erro
 				ad.StopAnalysis(ctx)
 			case ad.btnBackIdx:
 				ad.StopAnalysis(ctx)
+				ad.stopGraph()
 				return SceneMenu, nil
 			case ad.btnUndoIdx:
 				// Undo/Redo like in Play
@@ -549,6 +619,22 @@ func (ad *GUIAnalyzeDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, erro
 		}
 	}
 
+	// move list, graph and scroll of move list
+	ad.refreshGame(ctx)
+	if justReleased && !ad.msg.Open {
+		if ply, ok := ad.moveAt(mx, my); ok {
+			ad.gotoPly(ctx, ply)
+		} else if ply, ok := ad.graphPlyAt(mx, my); ok {
+			ad.gotoPly(ctx, ply)
+		}
+	}
+	if ghelper.PointInRect(mx, my, ad.movesX, ad.movesY, 340, ad.movesRows*moveRowH) {
+		if _, dy := ebiten.Wheel(); dy != 0 {
+			ad.listScroll -= int(math.Copysign(1, dy))
+		}
+	}
+	ad.clampScroll(int(ctx.Builder.CurrentMoveIndex()))
+
 	// clicking on candidate list (right panel)
 	if justReleased {
 		// candidate list params must match Draw layout
@@ -563,7 +649,7 @@ func (ad *GUIAnalyzeDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, erro
 		cands := make([]TypeCandidate, len(ad.candidates))
 		copy(cands, ad.candidates)
 		ad.mu.Unlock()
-		for i := 0; i < len(cands); i++ {
+		for i := 0; i < len(cands) && i < analyzerTopMoves; i++ {
 			rx := listX
 			ry := listY + i*(lineH+6) - 4
 			// bounding box width
@@ -578,6 +664,7 @@ func (ad *GUIAnalyzeDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, erro
 	// escape -> back
 	if ebiten.IsKeyPressed(ebiten.KeyEscape) {
 		ad.StopAnalysis(ctx)
+		ad.stopGraph()
 		return SceneMenu, nil
 	}
 
@@ -666,6 +753,15 @@ func (ad *GUIAnalyzeDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Ima
 		ghelper.EbitenutilDrawRectStroke(screen, float64(sx)+2, float64(sy)+2, float64(ad.sqSize)-4, float64(ad.sqSize)-4, 2, ctx.Theme.Accent)
 	}
 
+	// hanging pieces highlight
+	for _, idx := range ad.hangingPieces(ctx) {
+		if ad.dragging && ad.dragFrom == idx {
+			continue
+		}
+		sx, sy := ad.indexToScreenXY(idx)
+		ghelper.EbitenutilDrawRectStroke(screen, float64(sx)+5, float64(sy)+5, float64(ad.sqSize)-10, float64(ad.sqSize)-10, 2, ctx.Theme.Warning)
+	}
+
 	// right panel: analysis numbers and candidates
 	ad.mu.Lock()
 	info := ad.lastInfo
@@ -691,7 +787,16 @@ func (ad *GUIAnalyzeDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Ima
 	y += 28
 
 	scoreText := "+0.00"
-	if info.MateIn != 0 {
+	if info.Tablebase && info.MateIn == 0 {
+		switch {
+		case info.TBWinIn > 0:
+			scoreText = fmt.Sprintf("%s %d", ctx.AssetsWorker.Lang().T("analyzer.tb_win"), info.TBWinIn)
+		case info.TBWinIn < 0:
+			scoreText = fmt.Sprintf("%s %d", ctx.AssetsWorker.Lang().T("analyzer.tb_loss"), -info.TBWinIn)
+		default:
+			scoreText = ctx.AssetsWorker.Lang().T("analyzer.tb_draw")
+		}
+	} else if info.MateIn != 0 {
 		scoreText = fmt.Sprintf("%s %d", ctx.AssetsWorker.Lang().T("analyzer.mate_in"), info.MateIn)
 	} else {
 		scoreText = fmt.Sprintf("%+.2f", float64(info.ScoreCP)/100.0)
@@ -706,7 +811,7 @@ func (ad *GUIAnalyzeDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Ima
 	rowX := x
 	rowY := y
 	rowH := 22
-	maxRows := 12
+	maxRows := analyzerTopMoves
 	cx, cy := ebiten.CursorPosition()
 	for i, c := range cands {
 		if i >= maxRows {
@@ -722,7 +827,9 @@ func (ad *GUIAnalyzeDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Ima
 		text.Draw(screen, fmt.Sprintf("%2d. %s", i+1, c.MoveStr), ctx.AssetsWorker.Fonts().Pixel, rx+2, ry+14, ctx.Theme.MenuText)
 
 		scoreS := "+0.00"
-		if c.Info.MateIn != 0 {
+		if c.Info.Tablebase && c.Info.MateIn == 0 {
+			scoreS = fmt.Sprintf("DTZ %+d", c.Info.TBWinIn)
+		} else if c.Info.MateIn != 0 {
 			scoreS = fmt.Sprintf("%s %d", ctx.AssetsWorker.Lang().T("analyzer.mate"), c.Info.MateIn)
 		} else {
 			scoreS = fmt.Sprintf("%+.2f", float64(c.Info.ScoreCP)/100.0)
@@ -733,6 +840,11 @@ func (ad *GUIAnalyzeDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Ima
 		text.Draw(screen, meta, ctx.AssetsWorker.Fonts().Pixel, rx+220, ry+14, ctx.Theme.MenuText)
 	}
 
+	ad.drawMotifs(ctx, screen, info)
+	ad.drawEvalBar(ctx, screen, info)
+	ad.drawGraph(ctx, screen)
+	ad.drawMoveList(ctx, screen)
+
 	// draw buttons
 	for _, b := range ad.buttons {
 		b.DrawAnimated(screen, ctx.AssetsWorker.Fonts().PixelLow, ctx.Theme)
@@ -747,6 +859,19 @@ func (ad *GUIAnalyzeDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Ima
 }
 
 // indexToScreenXY
+// pieces of both colors which can be won by the opponent (recalculated on position change)
+func (ad *GUIAnalyzeDrawer) hangingPieces(ctx *ghelper.GUIGameContext) []int {
+	pos := ctx.Builder.CurrentPosition()
+	if pos != ad.hangingPos || ad.hanging == nil {
+		ad.hangingPos = pos
+		ad.hanging = append(rules.HangingPieces(&pos, true), rules.HangingPieces(&pos, false)...)
+		if ad.hanging == nil {
+			ad.hanging = []int{}
+		}
+	}
+	return ad.hanging
+}
+
 func (ad *GUIAnalyzeDrawer) indexToScreenXY(idx int) (int, int) {
 	f, r := indexToFileRank(idx)
 	file := f
@@ -764,3 +889,319 @@ func (ad *GUIAnalyzeDrawer) maybeRestartAnalysisAfterChange(ctx *ghelper.GUIGame
 		_ = ad.StartAnalysis(ctx, engine.LevelLast)
 	}
 }
+
+// ---- Game overview ----
+
+// history is changed if its length or ends are changed
+type historyKey struct {
+	n           int
+	first, last base.Board
+}
+
+func keyOfHistory(entries []history.MoveEntry) historyKey {
+	if len(entries) == 0 {
+		return historyKey{}
+	}
+	return historyKey{n: len(entries), first: entries[0].Board, last: entries[len(entries)-1].Board}
+}
+
+// move list of changed history and evaluation of all its positions in background
+func (ad *GUIAnalyzeDrawer) refreshGame(ctx *ghelper.GUIGameContext) {
+	entries := ctx.Builder.HistoryMoves()
+	key := keyOfHistory(entries)
+	if key == ad.moveKey && ad.moveList != nil {
+		return
+	}
+	ad.moveKey = key
+	ad.moveList = []string{}
+	if len(entries) > 0 {
+		ad.moveStart = entries[0].Board
+	}
+	for i := 1; i < len(entries); i++ {
+		ad.moveList = append(ad.moveList, moves.MoveToSAN(&entries[i-1].Board, entries[i].Move))
+	}
+	ad.startGraph(ctx, entries, key)
+}
+
+func (ad *GUIAnalyzeDrawer) startGraph(ctx *ghelper.GUIGameContext, entries []history.MoveEntry, key historyKey) {
+	ad.stopGraph()
+	ad.graphMu.Lock()
+	ad.graphKey, ad.graph = key, nil
+	ad.graphDone, ad.graphTotal = 0, len(entries)
+	ad.graphMu.Unlock()
+	if len(entries) < 2 {
+		return
+	}
+	gctx, cancel := context.WithCancel(context.Background())
+	ad.graphCancel = cancel
+
+	go func() {
+		e := NewInternalEngine(ctx)
+		if err := e.Init(); err != nil {
+			ctx.Logx.Errorf("error init engine of graph: %v", err)
+			return
+		}
+		defer e.Close()
+		r, err := review.ReviewMoves(gctx, e, entries, review.Options{
+			Params: graphParams,
+			Progress: func(done, total int) {
+				ad.graphMu.Lock()
+				if ad.graphKey == key {
+					ad.graphDone = done
+				}
+				ad.graphMu.Unlock()
+			},
+		})
+		if err != nil {
+			if gctx.Err() == nil {
+				ctx.Logx.Errorf("error evaluate game: %v", err)
+			}
+			return
+		}
+		ad.graphMu.Lock()
+		if ad.graphKey == key {
+			ad.graph = r
+		}
+		ad.graphMu.Unlock()
+	}()
+}
+
+func (ad *GUIAnalyzeDrawer) stopGraph() {
+	if ad.graphCancel != nil {
+		ad.graphCancel()
+		ad.graphCancel = nil
+	}
+}
+
+func (ad *GUIAnalyzeDrawer) graphReview() *review.Review {
+	ad.graphMu.Lock()
+	defer ad.graphMu.Unlock()
+	return ad.graph
+}
+
+// go to position of history (0 - start position)
+func (ad *GUIAnalyzeDrawer) gotoPly(ctx *ghelper.GUIGameContext, ply int) {
+	if ply == int(ctx.Builder.CurrentMoveIndex()) {
+		return
+	}
+	ctx.Builder.CurrentMove(uint(ply))
+	ad.mu.Lock()
+	ad.candidates = nil
+	ad.history = nil
+	ad.lastInfo = engine.AnalysisInfo{}
+	ad.mu.Unlock()
+	ad.maybeRestartAnalysisAfterChange(ctx)
+}
+
+// cell of move i (from 0) in move list: row and column (0 - white, 1 - black)
+func (ad *GUIAnalyzeDrawer) moveCell(i int) (row, col int) {
+	if !ad.moveStart.WhiteToMove {
+		i++
+	}
+	return i / 2, i % 2
+}
+
+func (ad *GUIAnalyzeDrawer) moveRect(i int) (x, y, w, h int, visible bool) {
+	row, col := ad.moveCell(i)
+	row -= ad.listScroll
+	if row < 0 || row >= ad.movesRows {
+		return 0, 0, 0, 0, false
+	}
+	return ad.movesX + 44 + col*140, ad.movesY + row*moveRowH, 130, moveRowH, true
+}
+
+// ply of clicked move
+func (ad *GUIAnalyzeDrawer) moveAt(mx, my int) (int, bool) {
+	for i := range ad.moveList {
+		if x, y, w, h, ok := ad.moveRect(i); ok && ghelper.PointInRect(mx, my, x, y, w, h) {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// ply of clicked point of graph
+func (ad *GUIAnalyzeDrawer) graphPlyAt(mx, my int) (int, bool) {
+	n := len(ad.moveList)
+	if n == 0 || !ghelper.PointInRect(mx, my, ad.graphX, ad.graphY, ad.graphW, ad.graphH) {
+		return 0, false
+	}
+	return int(math.Round(float64(mx-ad.graphX) * float64(n) / float64(ad.graphW))), true
+}
+
+// keep current move visible when it is changed
+func (ad *GUIAnalyzeDrawer) clampScroll(ply int) {
+	rows := 0
+	if n := len(ad.moveList); n > 0 {
+		last, _ := ad.moveCell(n - 1)
+		rows = last + 1
+	}
+	if ply != ad.lastPly {
+		ad.lastPly = ply
+		if ply > 0 {
+			row, _ := ad.moveCell(ply - 1)
+			if row < ad.listScroll {
+				ad.listScroll = row
+			} else if row >= ad.listScroll+ad.movesRows {
+				ad.listScroll = row - ad.movesRows + 1
+			}
+		}
+	}
+	ad.listScroll = max(min(ad.listScroll, rows-ad.movesRows), 0)
+}
+
+// evaluation of current position (white POV): running analysis or graph
+func (ad *GUIAnalyzeDrawer) currentEval(ctx *ghelper.GUIGameContext, info engine.AnalysisInfo) (int, bool) {
+	if ad.running && info.Depth > 0 {
+		cp := review.Score(info)
+		if !ctx.Builder.IsWhiteToMove() {
+			cp = -cp
+		}
+		return cp, true
+	}
+	if r := ad.graphReview(); r != nil {
+		if ply := int(ctx.Builder.CurrentMoveIndex()); ply < len(r.Evals) {
+			return r.Evals[ply], true
+		}
+	}
+	return 0, false
+}
+
+func (ad *GUIAnalyzeDrawer) drawEvalBar(ctx *ghelper.GUIGameContext, screen *ebiten.Image, info engine.AnalysisInfo) {
+	cp, ok := ad.currentEval(ctx, info)
+	h := float64(ad.boardSize)
+	whiteH := math.Round(h * review.WinPercent(cp) / 100)
+	ghelper.EbitenutilDrawRect(screen, float64(ad.barX), float64(ad.boardY), 20, h, evalBlack)
+	if whiteH >= 1 {
+		ghelper.EbitenutilDrawRect(screen, float64(ad.barX), float64(ad.boardY)+h-whiteH, 20, whiteH, evalWhite)
+	}
+	ghelper.EbitenutilDrawRectStroke(screen, float64(ad.barX), float64(ad.boardY), 20, h, 1, ctx.Theme.ButtonStroke)
+	if ok {
+		text.Draw(screen, review.FormatEval(cp), ctx.AssetsWorker.Fonts().PixelLow, ad.barX-4, ad.boardY+ad.boardSize+14, ctx.Theme.MenuText)
+	}
+}
+
+// graph of win probability of white, mistakes are marked, current move is a line
+func (ad *GUIAnalyzeDrawer) drawGraph(ctx *ghelper.GUIGameContext, screen *ebiten.Image) {
+	n := len(ad.moveList)
+	if n == 0 {
+		return
+	}
+	ad.graphMu.Lock()
+	r, done, total := ad.graph, ad.graphDone, ad.graphTotal
+	ad.graphMu.Unlock()
+	if r == nil {
+		ghelper.EbitenutilDrawRectStroke(screen, float64(ad.graphX), float64(ad.graphY), float64(ad.graphW), float64(ad.graphH), 1, ctx.Theme.ButtonStroke)
+		text.Draw(screen, fmt.Sprintf("%s %d/%d", ctx.AssetsWorker.Lang().T("analyzer.graph.progress"), done, total),
+			ctx.AssetsWorker.Fonts().Pixel, ad.graphX+12, ad.graphY+ad.graphH/2+6, ctx.Theme.MenuText)
+		return
+	}
+	if ad.graphImg == nil || ad.graphImgOf != r {
+		values := make([]float64, len(r.Evals))
+		for i, cp := range r.Evals {
+			values[i] = review.WinPercent(cp)
+		}
+		ad.graphImg = ghelper.RenderEvalGraph(ad.graphW, ad.graphH, values, evalWhite, evalBlack, ctx.Theme.ButtonStroke)
+		ad.graphImgOf = r
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(ad.graphX), float64(ad.graphY))
+	screen.DrawImage(ad.graphImg, op)
+
+	plyX := func(ply int) float64 {
+		return float64(ad.graphX) + float64(ply)*float64(ad.graphW)/float64(len(r.Evals)-1)
+	}
+	for _, m := range r.Moves {
+		if m.Class >= review.ClassMistake {
+			ghelper.EbitenutilDrawRect(screen, plyX(m.Ply)-2, float64(ad.graphY), 4, 6, ctx.Theme.Warning)
+		}
+	}
+	if ply := int(ctx.Builder.CurrentMoveIndex()); ply < len(r.Evals) {
+		ghelper.EbitenutilDrawRect(screen, plyX(ply)-1, float64(ad.graphY), 2, float64(ad.graphH), ctx.Theme.Accent)
+	}
+	ghelper.EbitenutilDrawRectStroke(screen, float64(ad.graphX), float64(ad.graphY), float64(ad.graphW), float64(ad.graphH), 1, ctx.Theme.ButtonStroke)
+}
+
+// numbered moves in two columns, classes of moves from graph evaluation
+func (ad *GUIAnalyzeDrawer) drawMoveList(ctx *ghelper.GUIGameContext, screen *ebiten.Image) {
+	face := ctx.AssetsWorker.Fonts().Pixel
+	text.Draw(screen, ctx.AssetsWorker.Lang().T("analyzer.moves"), face, ad.movesX, ad.movesY-8, ctx.Theme.MenuText)
+	r := ad.graphReview()
+	ply := int(ctx.Builder.CurrentMoveIndex())
+	cx, cy := ebiten.CursorPosition()
+	for i, san := range ad.moveList {
+		x, y, w, h, ok := ad.moveRect(i)
+		if !ok {
+			continue
+		}
+		row, col := ad.moveCell(i)
+		if col == 0 || i == 0 {
+			num := fmt.Sprintf("%d.", ad.moveStart.Fullmove+row)
+			if col == 1 {
+				num = fmt.Sprintf("%d...", ad.moveStart.Fullmove+row)
+			}
+			text.Draw(screen, num, face, ad.movesX, y+15, ctx.Theme.MenuText)
+		}
+		if r != nil && i < len(r.Moves) {
+			san += r.Moves[i].Class.Symbol()
+		}
+		switch {
+		case i+1 == ply:
+			ghelper.EbitenutilDrawRectStroke(screen, float64(x)-2, float64(y), float64(w), float64(h), 2, ctx.Theme.Accent)
+		case ghelper.PointInRect(cx, cy, x, y, w, h):
+			ghelper.EbitenutilDrawRectStroke(screen, float64(x)-2, float64(y), float64(w), float64(h), 1, ctx.Theme.ButtonStroke)
+		}
+		text.Draw(screen, san, face, x+4, y+15, ctx.Theme.MenuText)
+	}
+}
+
+// ---- Tactical motifs ----
+
+// motifs of the first moves of best line, then pins and hanging pieces of position
+func (ad *GUIAnalyzeDrawer) motifLines(ctx *ghelper.GUIGameContext, info engine.AnalysisInfo) []string {
+	pos := ctx.Builder.CurrentPosition()
+	pv := info.PV[:min(len(info.PV), 4)]
+	key := fmt.Sprint(pv)
+	if pos == ad.motifPos && key == ad.motifPV && ad.motifText != nil {
+		return ad.motifText
+	}
+	ad.motifPos, ad.motifPV = pos, key
+	ad.motifText = []string{}
+
+	// PV of previous position is not legal here
+	found, _ := motifs.DetectLine(&pos, pv)
+	nb := moves.CloneBoard(&pos)
+	for i, mv := range pv {
+		san := moves.MoveToSAN(nb, mv)
+		for _, m := range found {
+			if m.Ply == i {
+				ad.motifText = append(ad.motifText, fmt.Sprintf("%s: %s", san, m))
+			}
+		}
+		if moves.ApplyMove(nb, mv) != nil {
+			break
+		}
+	}
+	for _, m := range motifs.Position(&pos) {
+		ad.motifText = append(ad.motifText, m.String())
+	}
+	return ad.motifText
+}
+
+func (ad *GUIAnalyzeDrawer) drawMotifs(ctx *ghelper.GUIGameContext, screen *ebiten.Image, info engine.AnalysisInfo) {
+	face := ctx.AssetsWorker.Fonts().Pixel
+	text.Draw(screen, ctx.AssetsWorker.Lang().T("analyzer.motifs"), face, ad.listX, ad.motifsY, ctx.Theme.MenuText)
+	lines := ad.motifLines(ctx, info)
+	if len(lines) == 0 {
+		text.Draw(screen, "-", face, ad.listX+2, ad.motifsY+20, ctx.Theme.MenuText)
+	}
+	for i, line := range lines {
+		if i >= analyzerMotifs {
+			break
+		}
+		if len(line) > 40 {
+			line = line[:38] + ".."
+		}
+		text.Draw(screen, line, face, ad.listX+2, ad.motifsY+20+i*18, ctx.Theme.MenuText)
+	}
+}
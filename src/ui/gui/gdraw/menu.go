@@ -15,14 +15,16 @@ import (
 )
 
 type GUIMenuDrawer struct {
-	msg        *ghelper.MessageBox
-	buttons    []*ghelper.Button
-	btnPlayIdx int
-	btnEditIdx int
-	btnStgsIdx int
-	btnExitIdx int
-	btnLangIdx int
-	btnInfoIdx int
+	msg         *ghelper.MessageBox
+	buttons     []*ghelper.Button
+	btnPlayIdx  int
+	btnEditIdx  int
+	btnTrainIdx int
+	btnPuzzlIdx int
+	btnStgsIdx  int
+	btnExitIdx  int
+	btnLangIdx  int
+	btnInfoIdx  int
 
 	// click tracking
 	prevMouseDown bool
@@ -44,16 +46,18 @@ func NewGUIMenuDrawer(ctx *ghelper.GUIGameContext) *GUIMenuDrawer {
 
 	// buttons
 	md.buttons = []*ghelper.Button{}
-	btnW, btnH := 320, 64
-	gap := 18
-	n := 4
+	btnW, btnH := 320, 58
+	gap := 16
+	n := 6
 	totalH := n*btnH + (n-1)*gap
 	startY := (ctx.Config.WindowH - totalH) / 2
 	cx := ctx.Config.WindowW / 2
 	md.btnPlayIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.play"), cx-btnW/2, startY, btnW, btnH, md.buttons)
 	md.btnEditIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.editor"), cx-btnW/2, startY+(btnH+gap), btnW, btnH, md.buttons)
-	md.btnStgsIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.settings"), cx-btnW/2, startY+2*(btnH+gap), btnW, btnH, md.buttons)
-	md.btnExitIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.exit"), cx-btnW/2, startY+3*(btnH+gap), btnW, btnH, md.buttons)
+	md.btnTrainIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.trainer"), cx-btnW/2, startY+2*(btnH+gap), btnW, btnH, md.buttons)
+	md.btnPuzzlIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.puzzles"), cx-btnW/2, startY+3*(btnH+gap), btnW, btnH, md.buttons)
+	md.btnStgsIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.settings"), cx-btnW/2, startY+4*(btnH+gap), btnW, btnH, md.buttons)
+	md.btnExitIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.exit"), cx-btnW/2, startY+5*(btnH+gap), btnW, btnH, md.buttons)
 	// left-down buttons
 	md.btnLangIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("lang.type"), 20, ctx.Config.WindowH-76, 56, 56, md.buttons)
 	md.btnInfoIdx, md.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("about.title"), 90, ctx.Config.WindowH-76, 56, 56, md.buttons)
@@ -97,6 +101,10 @@ func (md *GUIMenuDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error)
 						return ScenePlayMenu, nil
 					case md.btnEditIdx:
 						return SceneEditor, nil
+					case md.btnTrainIdx:
+						return SceneTrainer, nil
+					case md.btnPuzzlIdx:
+						return ScenePuzzle, nil
 					case md.btnStgsIdx:
 						return SceneSettings, nil
 					case md.btnExitIdx:
@@ -158,6 +166,8 @@ func (md *GUIMenuDrawer) refreshButtons(ctx *ghelper.GUIGameContext) {
 	labels := []string{
 		ctx.AssetsWorker.Lang().T("button.play"),
 		ctx.AssetsWorker.Lang().T("button.editor"),
+		ctx.AssetsWorker.Lang().T("button.trainer"),
+		ctx.AssetsWorker.Lang().T("button.puzzles"),
 		ctx.AssetsWorker.Lang().T("button.settings"),
 		ctx.AssetsWorker.Lang().T("button.exit"),
 		ctx.AssetsWorker.Lang().T("lang.type"),
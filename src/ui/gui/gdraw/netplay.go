@@ -0,0 +1,724 @@
+package gdraw
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/chesslib/netplay"
+	"evilchess/src/chesslib/outcome"
+	"evilchess/src/ui/gui/ghelper"
+	"fmt"
+	"image/color"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// network game: the scene hosts game on embedded server (or joins game on
+// server of config), the board shows state of server which checks moves,
+// lost connection is resumed by token of seat
+
+const (
+	netReconnect = 2 * time.Second // pause between reconnects
+	netChatLines = 50              // kept lines of chat
+	netChatInput = 200             // max runes of chat message
+)
+
+// reasons of game end -> lang keys
+var netOutcomeKeys = map[string]string{
+	outcome.Checkmate.String():             "play.checkmate",
+	outcome.Stalemate.String():             "play.stalemate",
+	outcome.InsufficientMaterial.String():  "play.draw",
+	outcome.Repetition.String():            "play.outcome.repetition",
+	outcome.FiftyMoves.String():            "play.outcome.fifty",
+	outcome.Resignation.String():           "play.outcome.resignation",
+	outcome.Timeout.String():               "play.timeisup",
+	outcome.TimeoutVsInsufficient.String(): "play.outcome.timeout_draw",
+	outcome.Agreement.String():             "play.outcome.agreement",
+	outcome.Abandonment.String():           "net.outcome.abandoned",
+}
+
+type netDial struct {
+	client *netplay.Client
+	err    error
+}
+
+type GUINetPlayDrawer struct {
+	// layout
+	boardX, boardY int
+	boardSize      int
+	sqSize         int
+	flipped        bool // player is black
+
+	selectedSq       int // -1 (index 0..63)
+	lastFrom, lastTo int // last move, -1
+
+	// connection
+	addr       string
+	client     *netplay.Client
+	dialCh     chan netDial
+	dialing    bool
+	left       bool               // scene is left
+	retryAt    time.Time          // reconnect after lost connection
+	stopServer context.CancelFunc // embedded server of host
+	pending    string             // host, join, watch or resume waits for answer
+
+	// seat
+	game  string
+	color string // "" - spectator
+	token string
+
+	// game
+	state     *netplay.State
+	stateAt   time.Time // clocks run from receive time of state
+	board     *base.Board
+	shownOver bool
+	errText   string // the last error of server
+
+	// chat
+	chat  []string
+	input string
+
+	// buttons
+	msg            *ghelper.MessageBox
+	buttons        []*ghelper.Button
+	btnResignIdx   int
+	btnDrawIdx     int
+	btnTakebackIdx int
+	btnLeaveIdx    int
+
+	prevMouseDown bool
+	lastTick      time.Time
+
+	// cache
+	sqLightImg   *ebiten.Image
+	sqDarkImg    *ebiten.Image
+	borderImg    *ebiten.Image
+	scaledPieces map[base.Piece]*ebiten.Image
+}
+
+func NewGUINetPlayDrawer(ctx *ghelper.GUIGameContext) *GUINetPlayDrawer {
+	np := &GUINetPlayDrawer{
+		selectedSq: -1,
+		lastFrom:   -1,
+		lastTo:     -1,
+		addr:       ctx.Config.NetAddress,
+		dialCh:     make(chan netDial, 1),
+		lastTick:   time.Now(),
+		msg:        &ghelper.MessageBox{},
+	}
+	np.boardSize = max(min(ctx.Config.WindowW-460, ctx.Config.WindowH-140), 320)
+	np.sqSize = np.boardSize / 8
+	np.boardX = 200
+	np.boardY = (ctx.Config.WindowH - np.boardSize) / 2
+	np.prepareCache(ctx)
+
+	lang := ctx.AssetsWorker.Lang()
+	x, y := 20, np.boardY
+	w, h := 160, 44
+	np.btnResignIdx, np.buttons = ghelper.AppendButton(ctx, lang.T("play.resign"), x, y, w, h, np.buttons)
+	y += h + 10
+	np.btnDrawIdx, np.buttons = ghelper.AppendButton(ctx, lang.T("play.offer_draw"), x, y, w, h, np.buttons)
+	y += h + 10
+	np.btnTakebackIdx, np.buttons = ghelper.AppendButton(ctx, lang.T("net.takeback"), x, y, w, h, np.buttons)
+	y += h + 30
+	np.btnLeaveIdx, np.buttons = ghelper.AppendButton(ctx, lang.T("net.leave"), x, y, w, h, np.buttons)
+
+	if ctx.NetHost {
+		if err := np.startServer(ctx); err != nil {
+			// server of this port may already run (evilchess serve), the game is hosted there
+			ctx.Logx.Errorf("error start netplay server: %v", err)
+		}
+	}
+	np.dial()
+	return np
+}
+
+// embedded server on port of config
+func (np *GUINetPlayDrawer) startServer(ctx *ghelper.GUIGameContext) error {
+	port := netplay.DefaultPort
+	if _, p, err := net.SplitHostPort(np.addr); err == nil {
+		port = p
+	}
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	sctx, cancel := context.WithCancel(context.Background())
+	np.stopServer = cancel
+	srv := netplay.NewServer(ctx.Logx)
+	go func() {
+		if err := srv.Serve(sctx, ln); err != nil {
+			ctx.Logx.Errorf("error netplay server: %v", err)
+		}
+	}()
+	np.addr = net.JoinHostPort("localhost", port)
+	return nil
+}
+
+func (np *GUINetPlayDrawer) dial() {
+	np.dialing = true
+	addr := np.addr
+	go func() {
+		c, err := netplay.Dial(addr)
+		np.dialCh <- netDial{client: c, err: err}
+	}()
+}
+
+// connection is ready: the first request or resume of seat
+func (np *GUINetPlayDrawer) connected(ctx *ghelper.GUIGameContext, c *netplay.Client) {
+	np.client = c
+	switch {
+	case np.token != "":
+		np.pending = netplay.TypeResume
+		_ = c.Resume(np.game, np.token)
+	case np.game != "":
+		np.pending = netplay.TypeWatch
+		_ = c.Watch(np.game)
+	case ctx.NetHost:
+		tc := ""
+		if ctx.Config.UseClock {
+			if c := ctx.Config.ClockControl(); c.HasClock() {
+				tc = c.String()
+			}
+		}
+		np.pending = netplay.TypeHost
+		_ = c.Host(ctx.Config.NetName, ctx.Config.PlayAs, tc)
+	default:
+		np.pending = netplay.TypeJoin
+		_ = c.Join("", ctx.Config.NetName)
+	}
+}
+
+func (np *GUINetPlayDrawer) disconnected(ctx *ghelper.GUIGameContext) {
+	ctx.Logx.Errorf("netplay connection lost: %v", np.client.Err())
+	np.client = nil
+	np.selectedSq = -1
+	if np.game != "" {
+		np.retryAt = time.Now().Add(netReconnect)
+	}
+}
+
+// received messages of server
+func (np *GUINetPlayDrawer) receive(ctx *ghelper.GUIGameContext) {
+	for np.client != nil {
+		select {
+		case m, ok := <-np.client.Incoming():
+			if !ok {
+				np.disconnected(ctx)
+				return
+			}
+			np.handle(ctx, m)
+		default:
+			return
+		}
+	}
+}
+
+func (np *GUINetPlayDrawer) handle(ctx *ghelper.GUIGameContext, m netplay.Message) {
+	lang := ctx.AssetsWorker.Lang()
+	switch m.Type {
+	case netplay.TypeJoined:
+		np.pending = ""
+		np.game, np.color, np.token = m.Game, m.Color, m.Token
+		np.flipped = m.Color == netplay.ColorBlack
+	case netplay.TypeWatching:
+		np.pending = ""
+		np.game, np.color = m.Game, ""
+	case netplay.TypeState:
+		if m.State != nil {
+			np.applyState(ctx, m.State)
+		}
+	case netplay.TypeChat:
+		np.addChat(fmt.Sprintf("%s: %s", m.Name, m.Text))
+	case netplay.TypeOffer:
+		np.addChat(fmt.Sprintf("* %s: %s", m.Color, m.Offer))
+		if np.color == "" || m.Color == np.color {
+			return
+		}
+		kind := m.Offer
+		np.msg.ShowMessageWithChoices(lang.T("net.offer."+kind), yesNoChoices(ctx), func(idx int, v interface{}) {
+			if np.client != nil {
+				_ = np.client.Answer(kind, v.(bool))
+			}
+		})
+	case netplay.TypeDecline:
+		if np.color != "" && m.Color != np.color {
+			np.msg.ShowMessage(lang.T("net.declined."+m.Offer), nil)
+		}
+	case netplay.TypeError:
+		np.serverError(ctx, m.Error)
+	}
+}
+
+// error of request: join falls back to watch, lost seat ends the game
+func (np *GUINetPlayDrawer) serverError(ctx *ghelper.GUIGameContext, e string) {
+	lang := ctx.AssetsWorker.Lang()
+	pending := np.pending
+	np.pending = ""
+	switch pending {
+	case netplay.TypeJoin:
+		np.pending = netplay.TypeWatch
+		_ = np.client.Watch("")
+	case netplay.TypeWatch:
+		if np.game == "" {
+			np.msg.ShowMessage(lang.T("net.no_games"), nil)
+			return
+		}
+		np.msg.ShowMessage(e, nil)
+	case netplay.TypeResume, netplay.TypeHost:
+		np.game, np.token = "", ""
+		np.msg.ShowMessage(e, nil)
+	default:
+		np.errText = e
+	}
+}
+
+func (np *GUINetPlayDrawer) applyState(ctx *ghelper.GUIGameContext, st *netplay.State) {
+	if np.state == nil || len(np.state.Moves) != len(st.Moves) {
+		np.selectedSq = -1
+	}
+	np.state, np.stateAt = st, time.Now()
+	np.errText = ""
+	b, err := convfen.ConvertFENToBoard(st.FEN)
+	if err != nil {
+		ctx.Logx.Errorf("error netplay FEN %s: %v", st.FEN, err)
+		return
+	}
+	np.board = b
+	np.lastFrom, np.lastTo = -1, -1
+	if n := len(st.Moves); n > 0 && len(st.Moves[n-1]) >= 4 {
+		np.lastFrom, _ = base.SquareFromAlgebraic(st.Moves[n-1][0:2])
+		np.lastTo, _ = base.SquareFromAlgebraic(st.Moves[n-1][2:4])
+	}
+
+	if st.Active() {
+		np.shownOver = false
+		return
+	}
+	if !np.shownOver {
+		np.shownOver = true
+		lang := ctx.AssetsWorker.Lang()
+		key, ok := netOutcomeKeys[st.Reason]
+		if !ok {
+			key = "net.game_over"
+		}
+		np.msg.ShowMessage(fmt.Sprintf("%s %s", lang.T(key), st.Result), nil)
+	}
+}
+
+func (np *GUINetPlayDrawer) addChat(line string) {
+	np.chat = append(np.chat, line)
+	if len(np.chat) > netChatLines {
+		np.chat = np.chat[len(np.chat)-netChatLines:]
+	}
+}
+
+// player can play: seat, both players and game goes on
+func (np *GUINetPlayDrawer) playing() bool {
+	return np.client != nil && np.color != "" && np.state != nil && np.state.Active() &&
+		np.state.White != "" && np.state.Black != ""
+}
+
+func (np *GUINetPlayDrawer) myMove() bool {
+	return np.playing() && np.board != nil && np.board.WhiteToMove == (np.color == netplay.ColorWhite)
+}
+
+// threefold repetition or fifty-move rule by moves of state
+func (np *GUINetPlayDrawer) canClaim() bool {
+	b, err := convfen.ConvertFENToBoard(base.FEN_START_GAME)
+	if err != nil {
+		return false
+	}
+	positions := []base.Board{*b}
+	for _, s := range np.state.Moves {
+		mv, err := moves.UCIToMove(b, s)
+		if err != nil || moves.ApplyMove(b, mv) != nil {
+			return false
+		}
+		positions = append(positions, *b)
+	}
+	_, ok := outcome.Claim(positions)
+	return ok
+}
+
+func (np *GUINetPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error) {
+	now := time.Now()
+	dt := now.Sub(np.lastTick).Seconds()
+	np.lastTick = now
+
+	// connection
+	select {
+	case d := <-np.dialCh:
+		np.dialing = false
+		switch {
+		case d.err == nil && np.left:
+			_ = d.client.Close()
+		case d.err == nil:
+			np.connected(ctx, d.client)
+		case np.game != "":
+			np.retryAt = now.Add(netReconnect)
+		default:
+			ctx.Logx.Errorf("error connect to %s: %v", np.addr, d.err)
+			np.msg.ShowMessage(ctx.AssetsWorker.Lang().T("net.connect_failed"), nil)
+		}
+	default:
+	}
+	if np.left {
+		return SceneNotChanged, nil
+	}
+	if np.client == nil && !np.dialing && !np.retryAt.IsZero() && now.After(np.retryAt) {
+		np.retryAt = time.Time{}
+		np.dial()
+	}
+	np.receive(ctx)
+
+	mx, my := ebiten.CursorPosition()
+	mouseDown := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	justPressed := mouseDown && !np.prevMouseDown
+	justReleased := !mouseDown && np.prevMouseDown
+	np.prevMouseDown = mouseDown
+
+	np.msg.Update(ctx, mx, my, justReleased)
+	np.msg.AnimateMessage()
+	if np.msg.IsOverlayed() || np.msg.Open {
+		return SceneNotChanged, nil
+	}
+
+	for i, b := range np.buttons {
+		clicked := b.HandleInput(mx, my, justPressed, !mouseDown && b.Pressed == true)
+		b.UpdateAnim(dt)
+		if !clicked {
+			continue
+		}
+		switch i {
+		case np.btnResignIdx:
+			if np.playing() {
+				lang := ctx.AssetsWorker.Lang()
+				np.msg.ShowMessageWithChoices(lang.T("play.resign.confirm"), yesNoChoices(ctx), func(idx int, v interface{}) {
+					if v.(bool) && np.client != nil {
+						_ = np.client.Resign()
+					}
+				})
+			}
+		case np.btnDrawIdx:
+			if np.playing() {
+				if np.canClaim() {
+					_ = np.client.Claim()
+				} else {
+					_ = np.client.Offer(netplay.OfferDraw)
+				}
+			}
+		case np.btnTakebackIdx:
+			if np.playing() && len(np.state.Moves) > 0 {
+				_ = np.client.Offer(netplay.OfferTakeback)
+			}
+		case np.btnLeaveIdx:
+			np.leave()
+			return ScenePlayMenu, nil
+		}
+	}
+
+	// chat input
+	if np.client != nil && np.game != "" {
+		for _, r := range ebiten.AppendInputChars(nil) {
+			if len([]rune(np.input)) < netChatInput {
+				np.input += string(r)
+			}
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && np.input != "" {
+			rs := []rune(np.input)
+			np.input = string(rs[:len(rs)-1])
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter) {
+			if strings.TrimSpace(np.input) != "" {
+				_ = np.client.Chat(np.input)
+			}
+			np.input = ""
+		}
+	}
+
+	// click-click moves, server checks them
+	if justReleased && np.myMove() && inBoard(mx, my, np.boardX, np.boardY, np.sqSize) {
+		board := np.board
+		sq := pixelToSquare(mx, my, np.boardX, np.boardY, np.sqSize, np.flipped)
+		pc := board.Mailbox[sq]
+		switch {
+		case pc != base.EmptyPiece && isWhitePiece(pc) == board.WhiteToMove:
+			np.selectedSq = sq
+		case np.selectedSq >= 0:
+			mv := base.Move{
+				From:  base.ConvIndexToPoint(np.selectedSq),
+				To:    base.ConvIndexToPoint(sq),
+				Piece: board.Mailbox[np.selectedSq],
+			}
+			np.selectedSq = -1
+			if base.IsPawnPromotionFromIndices(&board.Mailbox, base.ConvPointToIndex(mv.From), sq) {
+				np.msg.ShowMessageWithChoices("", *GetChoises(ctx, board.WhiteToMove), func(idx int, v interface{}) {
+					mv.Piece = v.(base.Piece)
+					np.sendMove(board, mv)
+				})
+			} else {
+				np.sendMove(board, mv)
+			}
+		}
+	}
+
+	// escape clears chat input, then leaves the game
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		if np.input != "" {
+			np.input = ""
+		} else {
+			np.leave()
+			return ScenePlayMenu, nil
+		}
+	}
+	return SceneNotChanged, nil
+}
+
+// connection and embedded server are closed
+func (np *GUINetPlayDrawer) leave() {
+	np.left = true
+	if np.client != nil {
+		_ = np.client.Close()
+		np.client = nil
+	}
+	if np.stopServer != nil {
+		np.stopServer()
+		np.stopServer = nil
+	}
+}
+
+func (np *GUINetPlayDrawer) sendMove(board *base.Board, mv base.Move) {
+	if np.client == nil || !rules.IsLegalMove(board, mv) {
+		return
+	}
+	_ = np.client.Move(moves.MoveToUCI(board, mv))
+}
+
+// left time of clock, running clock goes on from receive time of state
+func (np *GUINetPlayDrawer) clockLeft(white bool) time.Duration {
+	ms := np.state.BlackMs
+	if white {
+		ms = np.state.WhiteMs
+	}
+	left := time.Duration(ms) * time.Millisecond
+	if np.state.Running == netplay.ColorWhite && white || np.state.Running == netplay.ColorBlack && !white {
+		left -= time.Since(np.stateAt)
+	}
+	return max(left, 0)
+}
+
+func (np *GUINetPlayDrawer) statusKey() string {
+	switch {
+	case np.client == nil && np.game != "":
+		return "net.reconnecting"
+	case np.client == nil || np.state == nil:
+		return "net.connecting"
+	case !np.state.Active():
+		return "net.game_over"
+	case np.state.White == "" || np.state.Black == "":
+		return "net.waiting"
+	case np.color == "":
+		return "net.watching"
+	case np.myMove():
+		return "net.your_move"
+	}
+	return "net.their_move"
+}
+
+func (np *GUINetPlayDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Image) {
+	screen.Fill(ctx.Theme.Bg)
+
+	if np.borderImg != nil {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(np.boardX-4), float64(np.boardY-4))
+		screen.DrawImage(np.borderImg, op)
+	}
+	for r := 0; r < 8; r++ {
+		for f := 0; f < 8; f++ {
+			img := np.sqLightImg
+			if ((f + r) & 1) == 1 {
+				img = np.sqDarkImg
+			}
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Translate(float64(np.boardX+f*np.sqSize), float64(np.boardY+r*np.sqSize))
+			screen.DrawImage(img, op)
+		}
+	}
+
+	highlight := func(idx, pad int, col color.Color) {
+		sx, sy := np.indexToScreenXY(idx)
+		ghelper.EbitenutilDrawRectStroke(screen, float64(sx+pad), float64(sy+pad), float64(np.sqSize-2*pad), float64(np.sqSize-2*pad), 2, col)
+	}
+	if np.board != nil {
+		if np.lastFrom >= 0 && np.lastTo >= 0 {
+			highlight(np.lastFrom, 5, ctx.Theme.ButtonStroke)
+			highlight(np.lastTo, 5, ctx.Theme.ButtonStroke)
+		}
+		for idx, pc := range np.board.Mailbox {
+			if img := np.scaledPieces[pc]; pc != base.EmptyPiece && img != nil {
+				px, py := np.indexToScreenXY(idx)
+				op := &ebiten.DrawImageOptions{}
+				op.GeoM.Translate(float64(px), float64(py))
+				screen.DrawImage(img, op)
+			}
+		}
+		if np.selectedSq >= 0 {
+			highlight(np.selectedSq, 2, ctx.Theme.Accent)
+		}
+	}
+
+	lang := ctx.AssetsWorker.Lang()
+	title := lang.T("net.title")
+	if np.game != "" {
+		title += " #" + np.game
+	}
+	text.Draw(screen, title, ctx.AssetsWorker.Fonts().Pixel, np.boardX+24, np.boardY-8, ctx.Theme.MenuText)
+
+	// right panel: players with clocks, status and chat
+	x := np.boardX + np.boardSize + 20
+	w := ctx.Config.WindowW - x - 20
+	drawPlayer := func(y int, white bool) {
+		h := 56
+		img := ghelper.RenderRoundedRect(w, h, 12, ctx.Theme.ButtonFill, ctx.Theme.ButtonStroke, 3)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(x), float64(y))
+		screen.DrawImage(img, op)
+		if np.state == nil {
+			return
+		}
+		name, online := np.state.Black, np.state.BlackOnline
+		if white {
+			name, online = np.state.White, np.state.WhiteOnline
+		}
+		if name != "" && !online {
+			name += " (" + lang.T("net.offline") + ")"
+		}
+		running := np.state.Running == netplay.ColorWhite && white || np.state.Running == netplay.ColorBlack && !white
+		if running {
+			ghelper.EbitenutilDrawRectStroke(screen, float64(x)+1, float64(y)+1, float64(w)-2, float64(h)-2, 3, ctx.Theme.Accent)
+		}
+		text.Draw(screen, name, ctx.AssetsWorker.Fonts().Pixel, x+10, y+18, ctx.Theme.MenuText)
+		if np.state.TimeControl != "" {
+			text.Draw(screen, clock.Format(np.clockLeft(white)), ctx.AssetsWorker.Fonts().Pixel, x+10, y+42, ctx.Theme.ButtonText)
+		}
+	}
+	// the player is at the bottom
+	drawPlayer(np.boardY, np.flipped)
+	drawPlayer(np.boardY+np.boardSize-56, !np.flipped)
+
+	face := ctx.AssetsWorker.Fonts().Normal
+	y := np.boardY + 90
+	lines := []string{lang.T(np.statusKey())}
+	if np.state != nil {
+		lines = append(lines, fmt.Sprintf("%s: %d", lang.T("net.spectators"), np.state.Spectators))
+	}
+	if np.errText != "" {
+		lines = append(lines, wrapText(face, np.errText, w)...)
+	}
+	for _, l := range lines {
+		text.Draw(screen, l, face, x, y, ctx.Theme.MenuText)
+		y += 22
+	}
+
+	// chat: the last lines which fit above input line
+	top, bottom := y+10, np.boardY+np.boardSize-56-40
+	text.Draw(screen, lang.T("net.chat"), ctx.AssetsWorker.Fonts().Pixel, x, top, ctx.Theme.MenuText)
+	var chat []string
+	for _, l := range np.chat {
+		chat = append(chat, wrapText(face, l, w)...)
+	}
+	if fit := max((bottom-top-22)/22, 0); len(chat) > fit {
+		chat = chat[len(chat)-fit:]
+	}
+	y = top + 26
+	for _, l := range chat {
+		text.Draw(screen, l, face, x, y, ctx.Theme.ButtonText)
+		y += 22
+	}
+	input := "> " + np.input
+	if time.Now().UnixMilli()/500%2 == 0 {
+		input += "_"
+	}
+	for text.BoundString(face, input).Dx() > w && len([]rune(input)) > 3 {
+		input = "> " + string([]rune(input)[3:])
+	}
+	text.Draw(screen, input, face, x, bottom+22, ctx.Theme.MenuText)
+
+	for _, b := range np.buttons {
+		b.DrawAnimated(screen, ctx.AssetsWorker.Fonts().PixelLow, ctx.Theme)
+	}
+	np.msg.Draw(ctx, screen)
+
+	if ctx.Config.Debug {
+		ebitenutil.DebugPrint(screen, fmt.Sprintf("TPS: %0.2f", ebiten.ActualTPS()))
+	}
+}
+
+// text is split by words into lines of width
+func wrapText(face font.Face, s string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		next := word
+		if line != "" {
+			next = line + " " + word
+		}
+		if line != "" && text.BoundString(face, next).Dx() > width {
+			lines = append(lines, line)
+			next = word
+		}
+		line = next
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (np *GUINetPlayDrawer) prepareCache(ctx *ghelper.GUIGameContext) {
+	np.sqLightImg = ebiten.NewImage(np.sqSize, np.sqSize)
+	np.sqLightImg.Fill(ctx.Theme.SquareLight)
+	np.sqDarkImg = ebiten.NewImage(np.sqSize, np.sqSize)
+	np.sqDarkImg.Fill(ctx.Theme.SquareDark)
+	np.borderImg = ghelper.RenderRoundedRect(np.boardSize+8, np.boardSize+8, 6, ctx.Theme.ButtonFill, ctx.Theme.ButtonStroke, 3)
+
+	np.scaledPieces = make(map[base.Piece]*ebiten.Image, 12)
+	for _, k := range []base.Piece{
+		base.WKing, base.BKing, base.WQueen, base.BQueen, base.WBishop, base.BBishop,
+		base.WKnight, base.BKnight, base.WRook, base.BRook, base.WPawn, base.BPawn,
+	} {
+		src := ctx.AssetsWorker.Piece(k)
+		if src == nil {
+			continue
+		}
+		dst := ebiten.NewImage(np.sqSize, np.sqSize)
+		iw, ih := src.Size()
+		s := math.Min(float64(np.sqSize)/float64(iw), float64(np.sqSize)/float64(ih))
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(s, s)
+		op.GeoM.Translate((float64(np.sqSize)-float64(iw)*s)/2, (float64(np.sqSize)-float64(ih)*s)/2)
+		op.Filter = ebiten.FilterLinear
+		dst.DrawImage(src, op)
+		np.scaledPieces[k] = dst
+	}
+}
+
+func (np *GUINetPlayDrawer) indexToScreenXY(idx int) (int, int) {
+	f, r := indexToFileRank(idx)
+	if np.flipped {
+		return np.boardX + (7-f)*np.sqSize, np.boardY + r*np.sqSize
+	}
+	return np.boardX + f*np.sqSize, np.boardY + (7-r)*np.sqSize
+}
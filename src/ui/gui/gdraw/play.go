@@ -1,15 +1,22 @@
 package gdraw
 
 import (
+	"context"
 	"evilchess/src/chesslib"
 	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/clock"
 	"evilchess/src/chesslib/engine"
-	"evilchess/src/chesslib/engine/myengine"
-	"evilchess/src/chesslib/engine/uci"
+	"evilchess/src/chesslib/engine/book"
+	"evilchess/src/chesslib/engine/review"
+	"evilchess/src/chesslib/engine/skill"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/outcome"
 	"evilchess/src/ui/gui/ghelper"
+	"evilchess/src/ui/gui/ghelper/gclipboard"
 	"fmt"
 	"math"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -42,19 +49,23 @@ type GUIPlayDrawer struct {
 	// flip board
 	flipped bool
 
-	// clocks (in seconds)
-	started    bool
-	allblock   bool
-	timeIsUp   bool
-	whiteClock float64
-	blackClock float64
-	lastTick   time.Time
+	// clock of game is kept by builder (started after the first move)
+	started  bool
+	allblock bool
+	timeIsUp bool
+	lastTick time.Time
 
 	// engine
 	engineNotValid bool
 	engineThinking bool
 	engineMu       sync.Mutex
 	engineDoneCh   chan struct{}
+	drawCh         chan bool // answer of engine to draw offer
+
+	// review of finished game by internal engine
+	reviewing    bool
+	reviewCancel context.CancelFunc
+	reviewCh     chan reviewResult
 
 	// load anim
 	loader *ghelper.CircularLoader
@@ -62,13 +73,16 @@ type GUIPlayDrawer struct {
 	// buttons
 	msg           *ghelper.MessageBox
 	buttons       []*ghelper.Button
+	btnNewGameIdx int
 	btnResignIdx  int
+	btnDrawIdx    int // claim or offer draw
 	btnFlipIdx    int
 	btnEngineIdx  int
 	btnAnalyzeIdx int
 	btnUndoIdx    int
 	btnRedoIdx    int
 	btnBackIdx    int
+	btnReviewIdx  int // shown at the end of game
 
 	prevMouseDown bool
 
@@ -91,8 +105,8 @@ func NewGUIPlayDrawer(ctx *ghelper.GUIGameContext) *GUIPlayDrawer {
 		selectedSq:   -1,
 		dragFrom:     -1,
 		engineDoneCh: make(chan struct{}, 1),
-		whiteClock:   float64(ctx.Config.Clock) * time.Hour.Minutes(),
-		blackClock:   float64(ctx.Config.Clock) * time.Hour.Minutes(),
+		drawCh:       make(chan bool, 1),
+		reviewCh:     make(chan reviewResult, 1),
 		lastTick:     time.Now(),
 	}
 
@@ -116,26 +130,46 @@ func NewGUIPlayDrawer(ctx *ghelper.GUIGameContext) *GUIPlayDrawer {
 	}
 
 	if ctx.Config.UseEngine {
+		var e engine.Engine
 		if ctx.Config.Engine == "internal" {
-			e := myengine.NewEvilEngine()
-			ctx.Builder.SetEngineWorker(e)
-			ctx.Builder.SetEngineLevel(engine.LevelAnalyze(ctx.Config.Strength))
+			e = NewInternalEngine(ctx)
 		} else if ctx.Config.Engine == "external" && ctx.Config.UCIPath != "" {
-			e := uci.NewUCIExec(ctx.Logx, ctx.Config.UCIPath)
+			e = NewExternalEngine(ctx)
+		} else if ctx.Config.Engine == "model" && ctx.Config.ModelPath != "" {
+			if m := NewModelEngine(ctx); m != nil {
+				e = m
+			}
+		}
+		if e == nil {
+			pd.engineNotValid = true
+		} else {
+			// human-like moves at target Elo instead of levels
+			if ctx.Config.HumanLike {
+				e = skill.ForElo(e, ctx.Config.Elo)
+			}
+			// opening moves of internal engine from book
+			if ctx.Config.Engine == "internal" && ctx.Config.UseBook {
+				if bk, err := LoadBook(ctx); err == nil {
+					e = book.NewBookEngine(e, bk)
+				} else {
+					ctx.Logx.Errorf("error load book: %v", err)
+				}
+			}
 			ctx.Builder.SetEngineWorker(e)
 			ctx.Builder.SetEngineLevel(engine.LevelAnalyze(ctx.Config.Strength))
-		} else {
-			pd.engineNotValid = true
+			ctx.Builder.SetEngineThreads(ctx.Config.Threads)
+			ctx.Builder.SetEnginePonder(ctx.Config.Ponder)
 		}
 	}
 
+	pd.resetClock(ctx)
 	pd.recalcLayout(ctx)
 
 	pd.buttons = []*ghelper.Button{}
 	x := 20
 	y := pd.boardY + 160
 	w, h := 160, 48
-	pd.btnResignIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("play.newgame"), x, y, w, h, pd.buttons)
+	pd.btnNewGameIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("play.newgame"), x, y, w, h, pd.buttons)
 	y += h + 14
 	pd.btnFlipIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("play.flip"), x, y, w, h, pd.buttons)
 	y += h + 14
@@ -144,6 +178,14 @@ func NewGUIPlayDrawer(ctx *ghelper.GUIGameContext) *GUIPlayDrawer {
 	pd.btnAnalyzeIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("play.analyze"), x, y, w, h, pd.buttons)
 	y += h + 14
 	pd.btnBackIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.back"), x, y, w, h, pd.buttons)
+	y += h + 14
+	pd.btnReviewIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("play.review"), x, y, w, h, pd.buttons)
+
+	// between clocks
+	x, y, w = pd.boardX+pd.boardSize+20, pd.boardY+pd.boardSize/2-h-7, 140
+	pd.btnResignIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("play.resign"), x, y, w, h, pd.buttons)
+	y += h + 14
+	pd.btnDrawIdx, pd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("play.offer_draw"), x, y, w, h, pd.buttons)
 
 	if ctx.Config.Training || ctx.Config.Debug {
 		pd.btnUndoIdx, pd.buttons = ghelper.AppendButton(ctx, "<", pd.boardX+pd.boardSize/2-h-7, pd.boardY+pd.boardSize+14, h, h, pd.buttons)
@@ -193,19 +235,37 @@ func (pd *GUIPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error)
 	default:
 	}
 
+	// handle answer to draw offer
+	select {
+	case accepted := <-pd.drawCh:
+		pd.engineThinking = false
+		pd.loader.Active = false
+		if accepted {
+			pd.endGame(ctx, ctx.Builder.Outcome())
+		} else {
+			pd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("play.draw.declined"), nil)
+			pd.maybeStartEngine(ctx)
+		}
+	default:
+	}
+
+	// handle review done
+	select {
+	case res := <-pd.reviewCh:
+		pd.reviewing = false
+		pd.loader.Active = false
+		pd.showReview(ctx, res)
+	default:
+	}
+
 	now := time.Now()
 	dt := now.Sub(pd.lastTick).Seconds()
 	pd.lastTick = now
 
 	pd.loader.Update(dt)
 
-	// clocks update
+	// flag-fall ends game
 	if ctx.Config.UseClock && !pd.allblock && pd.started {
-		if ctx.Builder.IsWhiteToMove() {
-			pd.whiteClock -= dt
-		} else {
-			pd.blackClock -= dt
-		}
 		pd.maybeTimeIsUp(ctx)
 	}
 
@@ -236,6 +296,9 @@ func (pd *GUIPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error)
 
 	// Buttons handling
 	for i, b := range pd.buttons {
+		if !pd.buttonShown(ctx, i) {
+			continue
+		}
 		clicked := b.HandleInput(mx, my, justPressed, !mouseDown && b.Pressed == true)
 		b.UpdateAnim(dt)
 		if clicked {
@@ -251,12 +314,18 @@ func (pd *GUIPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error)
 			}
 			switch i {
 			case pd.btnResignIdx:
+				pd.askResign(ctx)
+			case pd.btnDrawIdx:
+				pd.claimOrOfferDraw(ctx)
+			case pd.btnNewGameIdx:
 				// start new game
+				pd.stopReview()
+				go ctx.Builder.StopPonder()
 				ctx.Builder.CreateClassic()
 				pd.selectedSq = -1
 				pd.flipped = pd.lastTick.Second()%2 == 1
-				pd.whiteClock = float64(ctx.Config.Clock) * time.Hour.Minutes()
-				pd.blackClock = float64(ctx.Config.Clock) * time.Hour.Minutes()
+				pd.allblock = false
+				pd.resetClock(ctx)
 			case pd.btnFlipIdx:
 				if ctx.Builder.CountHalfMoves() != 0 {
 					pd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("play.flip_warning"), nil)
@@ -281,12 +350,18 @@ func (pd *GUIPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error)
 					pd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("editor.apply_failed"), nil)
 				} else {
 					// apply successful -> switch to Play scene
+					ctx.Builder.SetClock(nil)
 					ctx.IsReady = true
 					return SceneAnalyzer, nil
 				}
 			case pd.btnBackIdx:
+				pd.stopReview()
+				go ctx.Builder.CloseEngine()
+				ctx.Builder.SetClock(nil)
 				ctx.IsReady = false
 				return SceneMenu, nil
+			case pd.btnReviewIdx:
+				pd.startReviewAsync(ctx)
 			}
 		}
 	}
@@ -475,6 +550,9 @@ func (pd *GUIPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error)
 
 	// escape -> redo
 	if ebiten.IsKeyPressed(ebiten.KeyEscape) {
+		pd.stopReview()
+		go ctx.Builder.CloseEngine()
+		ctx.Builder.SetClock(nil)
 		ctx.IsReady = false
 		return SceneMenu, nil
 	}
@@ -482,12 +560,122 @@ func (pd *GUIPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error)
 	return SceneNotChanged, nil
 }
 
+// new clock of game by config
+func (pd *GUIPlayDrawer) resetClock(ctx *ghelper.GUIGameContext) {
+	if !ctx.Config.UseClock || !ctx.Config.ClockControl().HasClock() {
+		ctx.Builder.SetClock(nil)
+		return
+	}
+	ctx.Builder.SetClock(clock.New(ctx.Config.ClockControl()))
+}
+
 func (pd *GUIPlayDrawer) maybeTimeIsUp(ctx *ghelper.GUIGameContext) {
-	if pd.blackClock <= 0 || pd.whiteClock <= 0 {
-		if !ctx.Config.Debug && !ctx.Config.Training {
-			pd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("play.timeisup"), nil)
+	if _, fallen := ctx.Builder.TimeForfeit(); fallen {
+		if ctx.Config.Debug || ctx.Config.Training {
+			go ctx.Builder.StopPonder()
+			pd.allblock = true
+			return
 		}
-		pd.allblock = true
+		pd.endGame(ctx, ctx.Builder.Outcome())
+	}
+}
+
+// ---- Outcome ----
+
+// resign, draw buttons are shown in running game, review at the end
+func (pd *GUIPlayDrawer) buttonShown(ctx *ghelper.GUIGameContext, i int) bool {
+	switch i {
+	case pd.btnReviewIdx:
+		return pd.canReview(ctx)
+	case pd.btnResignIdx, pd.btnDrawIdx:
+		return !pd.allblock
+	}
+	return true
+}
+
+// color of the player: the side to move in game without engine
+func (pd *GUIPlayDrawer) playerIsWhite(ctx *ghelper.GUIGameContext) bool {
+	if !ctx.Config.UseEngine || pd.engineNotValid {
+		return ctx.Builder.IsWhiteToMove()
+	}
+	return !pd.flipped
+}
+
+func (pd *GUIPlayDrawer) askResign(ctx *ghelper.GUIGameContext) {
+	if pd.allblock || pd.engineThinking {
+		return
+	}
+	lang := ctx.AssetsWorker.Lang()
+	pd.msg.ShowMessageWithChoices(lang.T("play.resign.confirm"), yesNoChoices(ctx), func(idx int, v interface{}) {
+		if v.(bool) {
+			pd.endGame(ctx, ctx.Builder.Resign(pd.playerIsWhite(ctx)))
+		}
+	})
+}
+
+// draw by repetition or fifty-move rule is claimed, otherwise it is offered
+// to engine (or to the other player)
+func (pd *GUIPlayDrawer) claimOrOfferDraw(ctx *ghelper.GUIGameContext) {
+	if pd.allblock || pd.engineThinking {
+		return
+	}
+	if o, ok := ctx.Builder.ClaimDraw(); ok {
+		pd.endGame(ctx, o)
+		return
+	}
+	lang := ctx.AssetsWorker.Lang()
+	if !ctx.Config.UseEngine || pd.engineNotValid {
+		pd.msg.ShowMessageWithChoices(lang.T("play.draw.offer"), yesNoChoices(ctx), func(idx int, v interface{}) {
+			if v.(bool) {
+				pd.endGame(ctx, ctx.Builder.AgreeDraw())
+			}
+		})
+		return
+	}
+
+	// engine thinks over offer in background
+	pd.engineMu.Lock()
+	pd.engineThinking = true
+	pd.loader.Active = true
+	pd.engineMu.Unlock()
+	white := pd.playerIsWhite(ctx)
+	go func() {
+		pd.drawCh <- ctx.Builder.OfferDraw(white)
+	}()
+}
+
+// game is over: board is blocked, the result and its reason are shown
+func (pd *GUIPlayDrawer) endGame(ctx *ghelper.GUIGameContext, o outcome.Outcome) {
+	go ctx.Builder.StopPonder()
+	pd.allblock = true
+	pd.selectedSq = -1
+	lang := ctx.AssetsWorker.Lang()
+	var key string
+	switch o.Reason {
+	case outcome.Resignation:
+		key = "play.outcome.resignation"
+	case outcome.Agreement:
+		key = "play.outcome.agreement"
+	case outcome.Repetition:
+		key = "play.outcome.repetition"
+	case outcome.FiftyMoves:
+		key = "play.outcome.fifty"
+	case outcome.Timeout:
+		key = "play.timeisup"
+	case outcome.TimeoutVsInsufficient:
+		key = "play.outcome.timeout_draw"
+	default:
+		pd.maybeShowStatus(ctx)
+		return
+	}
+	pd.msg.ShowMessage(fmt.Sprintf("%s %s", lang.T(key), convpgn.ConvPGNStatusToString(o.Result)), nil)
+}
+
+func yesNoChoices(ctx *ghelper.GUIGameContext) []ghelper.MessageChoice {
+	lang := ctx.AssetsWorker.Lang()
+	return []ghelper.MessageChoice{
+		{Label: lang.T("play.yes"), Value: true},
+		{Label: lang.T("play.no"), Value: false},
 	}
 }
 
@@ -519,6 +707,7 @@ func (pd *GUIPlayDrawer) maybeShowStatus(ctx *ghelper.GUIGameContext) {
 func (pd *GUIPlayDrawer) maybeStartEngine(ctx *ghelper.GUIGameContext) {
 	// check end game
 	if pd.allblock {
+		go ctx.Builder.StopPonder()
 		pd.maybeShowStatus(ctx)
 		return
 	}
@@ -583,6 +772,80 @@ func (pd *GUIPlayDrawer) startEngineMoveAsync(ctx *ghelper.GUIGameContext) {
 	}()
 }
 
+// ---- Review ----
+
+type reviewResult struct {
+	review *review.Review
+	pgn    string
+	err    error
+}
+
+// game is over and has moves
+func (pd *GUIPlayDrawer) canReview(ctx *ghelper.GUIGameContext) bool {
+	return pd.allblock && !pd.reviewing && !pd.engineThinking && ctx.Builder.CountHalfMoves() > 1
+}
+
+// review all moves by internal engine in background
+func (pd *GUIPlayDrawer) startReviewAsync(ctx *ghelper.GUIGameContext) {
+	if pd.reviewing {
+		return
+	}
+	pd.reviewing = true
+	pd.loader.Active = true
+	rctx, cancel := context.WithCancel(context.Background())
+	pd.reviewCancel = cancel
+
+	go func() {
+		var res reviewResult
+		e := NewInternalEngine(ctx)
+		if res.err = e.Init(); res.err == nil {
+			res.review, res.err = ctx.Builder.Review(rctx, e, review.Options{})
+			e.Close()
+		}
+		if res.err == nil {
+			var sb strings.Builder
+			res.err = ctx.Builder.AnnotatedPGN(&sb, res.review)
+			res.pgn = sb.String()
+		}
+		if rctx.Err() != nil {
+			// game is left
+			return
+		}
+		pd.reviewCh <- res
+	}()
+}
+
+func (pd *GUIPlayDrawer) stopReview() {
+	if pd.reviewCancel != nil {
+		pd.reviewCancel()
+		pd.reviewCancel = nil
+	}
+	pd.reviewing = false
+	pd.loader.Active = false
+}
+
+// accuracy of sides, annotated PGN is copied to clipboard
+func (pd *GUIPlayDrawer) showReview(ctx *ghelper.GUIGameContext, res reviewResult) {
+	lang := ctx.AssetsWorker.Lang()
+	if res.err != nil {
+		ctx.Logx.Errorf("error review game: %v", res.err)
+		pd.msg.ShowMessage(lang.T("play.review.failed"), nil)
+		return
+	}
+	side := func(name string, s review.SideStats) string {
+		return fmt.Sprintf("%s: %s %.1f%%\n?! %d  ? %d  ?? %d", name, lang.T("play.review.accuracy"),
+			s.Accuracy, s.Inaccuracies, s.Mistakes, s.Blunders)
+	}
+	text := side(lang.T("play.review.white"), res.review.White) + "\n" + side(lang.T("play.review.black"), res.review.Black)
+	if err := gclipboard.WriteAll(res.pgn); err != nil {
+		ctx.Logx.Errorf("error copy PGN: %v", err)
+		text += "\n" + lang.T("message.copy.failed")
+	} else {
+		text += "\n" + lang.T("play.review.copied")
+	}
+	pd.msg.ShowMessage(text, nil)
+}
+
 // Draw
 func (pd *GUIPlayDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Image) {
 	// background
@@ -663,15 +926,23 @@ func (pd *GUIPlayDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Image)
 		if ctx.Builder != nil && pd.engineNotValid == false {
 			if ctx.Config.Engine == "internal" {
 				engineName = "Internal Engine"
+				if ctx.Config.UseBook {
+					engineName += " + Book"
+				}
 			} else if ctx.Config.Engine == "external" {
 				engineName = fmt.Sprintf("External Engine (%s)", filepath.Base(ctx.Config.UCIPath))
+			} else if ctx.Config.Engine == "model" {
+				engineName = fmt.Sprintf("AI Model (%s)", filepath.Base(ctx.Config.ModelPath))
+			}
+			if ctx.Config.HumanLike {
+				engineName += fmt.Sprintf(" ~%d Elo", ctx.Config.Elo)
 			}
 		}
 	}
 	text.Draw(screen, engineName, ctx.AssetsWorker.Fonts().Pixel, pd.boardX+24, pd.boardY-8, ctx.Theme.MenuText)
 
 	// -------------------- clocks --------------------
-	if ctx.Config.UseClock {
+	if c := ctx.Builder.Clock(); ctx.Config.UseClock && c != nil {
 		// helper to render clock box
 		drawClock := func(x, y int, label, timeStr string, active bool) {
 			w, h := 140, 56
@@ -690,17 +961,21 @@ func (pd *GUIPlayDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Image)
 		}
 
 		// format times
-		wc := fmt.Sprintf("%02d:%02d", int(pd.whiteClock)/60, int(pd.whiteClock)%60)
-		bc := fmt.Sprintf("%02d:%02d", int(pd.blackClock)/60, int(pd.blackClock)%60)
+		wc, bc := clock.Format(c.Left(true)), clock.Format(c.Left(false))
 		if pd.flipped {
 			wc, bc = bc, wc
 		}
+		// running clock is highlighted
+		engineRuns := c.WhiteToMove() == pd.flipped
 
-		drawClock(pd.boardX+pd.boardSize+20, pd.boardY+10, "Engine", bc, pd.flipped)
-		drawClock(pd.boardX+pd.boardSize+20, pd.boardY+pd.boardSize-70, "You", wc, !pd.flipped)
+		drawClock(pd.boardX+pd.boardSize+20, pd.boardY+10, "Engine", bc, c.Running() && engineRuns)
+		drawClock(pd.boardX+pd.boardSize+20, pd.boardY+pd.boardSize-70, "You", wc, c.Running() && !engineRuns)
 	}
 	// draw UI buttons (animated via b.DrawAnimated)
-	for _, b := range pd.buttons {
+	for i, b := range pd.buttons {
+		if !pd.buttonShown(ctx, i) {
+			continue
+		}
 		b.DrawAnimated(screen, ctx.AssetsWorker.Fonts().PixelLow, ctx.Theme)
 	}
 
@@ -26,6 +26,9 @@ type GUIPlayMenuDrawer struct {
 	btnStartIdx     int
 	btnSaveIdx      int
 	btnBackIdx      int
+	btnNetHostIdx   int
+	btnNetJoinIdx   int
+	btnServerIdx    int
 
 	// clock
 	timeWheel *ghelper.NumberWheel
@@ -76,6 +79,8 @@ func NewGUIPlayMenuDrawer(ctx *ghelper.GUIGameContext) *GUIPlayMenuDrawer {
 		ctx.AssetsWorker.Fonts().Pixel, "playmenu.time.min",
 	)
 	pmd.timeWheel.SetOnChange(func(v int) {
+		// minutes of wheel replace time control of config
+		ctx.Config.ClockTC = ""
 		if ctx.Config.Clock = v; ctx.Config.Clock == 0 {
 			pmd.timeWheel.Title = "playmenu.unlimited"
 		} else {
@@ -102,6 +107,11 @@ func NewGUIPlayMenuDrawer(ctx *ghelper.GUIGameContext) *GUIPlayMenuDrawer {
 	pmd.btnStartIdx, pmd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("playmenu.start"), ctx.Config.WindowW-w-60, ctx.Config.WindowH-h-60, w, h, pmd.buttons)
 	pmd.btnSaveIdx, pmd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.save"), ctx.Config.WindowW-240-w, ctx.Config.WindowH-h-60, w, h, pmd.buttons)
 	pmd.btnBackIdx, pmd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.back"), ctx.Config.WindowW-420-w, ctx.Config.WindowH-h-60, w, h, pmd.buttons)
+	// network game bottuns
+	pmd.btnNetHostIdx, pmd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("playmenu.net.host"), x, ctx.Config.WindowH-h-60, w, h, pmd.buttons)
+	pmd.btnNetJoinIdx, pmd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("playmenu.net.join"), x+w+spacingX, ctx.Config.WindowH-h-60, w, h, pmd.buttons)
+	// game on server of HTTP API (server of page in WASM build)
+	pmd.btnServerIdx, pmd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("playmenu.server"), x, ctx.Config.WindowH-h*2-60-spacingY, w, h, pmd.buttons)
 
 	pmd.refreshButtons(ctx, -1)
 	pmd.msg = &ghelper.MessageBox{}
@@ -165,6 +175,14 @@ func (pmd *GUIPlayMenuDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, er
 				break
 			case pmd.btnBackIdx:
 				return SceneMenu, nil
+			case pmd.btnNetHostIdx:
+				ctx.NetHost = true
+				return SceneNetPlay, nil
+			case pmd.btnNetJoinIdx:
+				ctx.NetHost = false
+				return SceneNetPlay, nil
+			case pmd.btnServerIdx:
+				return SceneServerPlay, nil
 			}
 			pmd.refreshButtons(ctx, i)
 			break
@@ -0,0 +1,503 @@
+package gdraw
+
+import (
+	"bytes"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine/puzzle"
+	"evilchess/src/ui/gui/gbase/gassets"
+	"evilchess/src/ui/gui/gbase/gos"
+	"evilchess/src/ui/gui/ghelper"
+	"evilchess/src/ui/gui/ghelper/gdialog"
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// puzzle trainer: the user finds moves of solver, replies are played automatically,
+// rating and streaks of the user are kept in config
+
+const (
+	puzzleReply   = 400 * time.Millisecond // pause before reply of opponent
+	builtinPuzzle = "assets/puzzles/puzzles.json"
+)
+
+type puzzleSet struct {
+	name string
+	path string // empty - data of browser or built-in set
+	list []puzzle.Puzzle
+	err  error
+}
+
+type GUIPuzzleDrawer struct {
+	// layout
+	boardX, boardY int
+	boardSize      int
+	sqSize         int
+	flipped        bool // solver is black
+
+	selectedSq         int // -1 (index 0..63)
+	hintFrom, hintTo   int // squares of hint, -1
+	lastFrom, lastTo   int // move of opponent before puzzle, -1
+	replyAt            time.Time
+	status             string // lang key of status
+	delta              int    // change of rating
+	recorded, finished bool
+
+	// puzzle set
+	set     puzzleSet
+	done    map[string]bool // puzzles of session
+	attempt *puzzle.Attempt
+	loading bool
+	loadCh  chan puzzleSet
+
+	// buttons
+	msg         *ghelper.MessageBox
+	buttons     []*ghelper.Button
+	btnNextIdx  int
+	btnRetryIdx int
+	btnHintIdx  int
+	btnSolveIdx int
+	btnLoadIdx  int
+	btnBackIdx  int
+
+	prevMouseDown bool
+	lastTick      time.Time
+
+	// cache
+	sqLightImg   *ebiten.Image
+	sqDarkImg    *ebiten.Image
+	borderImg    *ebiten.Image
+	scaledPieces map[base.Piece]*ebiten.Image
+}
+
+func NewGUIPuzzleDrawer(ctx *ghelper.GUIGameContext) *GUIPuzzleDrawer {
+	pz := &GUIPuzzleDrawer{
+		selectedSq: -1,
+		done:       map[string]bool{},
+		loadCh:     make(chan puzzleSet, 1),
+		lastTick:   time.Now(),
+		msg:        &ghelper.MessageBox{},
+	}
+	pz.boardSize = max(ctx.Config.WindowW-420, 320)
+	pz.sqSize = pz.boardSize / 8
+	pz.boardX = (ctx.Config.WindowW-pz.boardSize)/2 - 10
+	pz.boardY = (ctx.Config.WindowH-pz.boardSize)/2 - 20
+	pz.prepareCache(ctx)
+
+	lang := ctx.AssetsWorker.Lang()
+	x, y := 20, pz.boardY
+	w, h := 160, 44
+	pz.btnNextIdx, pz.buttons = ghelper.AppendButton(ctx, lang.T("puzzle.next"), x, y, w, h, pz.buttons)
+	y += h + 10
+	pz.btnRetryIdx, pz.buttons = ghelper.AppendButton(ctx, lang.T("trainer.retry"), x, y, w, h, pz.buttons)
+	y += h + 10
+	pz.btnHintIdx, pz.buttons = ghelper.AppendButton(ctx, lang.T("trainer.hint"), x, y, w, h, pz.buttons)
+	y += h + 10
+	pz.btnSolveIdx, pz.buttons = ghelper.AppendButton(ctx, lang.T("puzzle.solution"), x, y, w, h, pz.buttons)
+	y += h + 30
+	pz.btnLoadIdx, pz.buttons = ghelper.AppendButton(ctx, lang.T("puzzle.load"), x, y, w, h, pz.buttons)
+	y += h + 10
+	pz.btnBackIdx, pz.buttons = ghelper.AppendButton(ctx, lang.T("button.back"), x, y, w, h, pz.buttons)
+
+	pz.set = loadPuzzleSet(ctx)
+	if pz.set.err != nil {
+		ctx.Logx.Errorf("error load puzzles: %v", pz.set.err)
+		pz.msg.ShowMessage(lang.T("puzzle.load_failed"), nil)
+	}
+	pz.next(ctx)
+	return pz
+}
+
+// puzzle set of config, built-in set if it is not set or can't be read
+func loadPuzzleSet(ctx *ghelper.GUIGameContext) puzzleSet {
+	var set puzzleSet
+	if path := ctx.Config.PuzzlePath; path != "" {
+		data, err := gos.ReadFile(path)
+		if err == nil {
+			set = readPuzzleSet(filepath.Base(path), path, data)
+		} else {
+			set.err = err
+		}
+		if set.err == nil {
+			return set
+		}
+	}
+	data, err := gassets.ReadAsset(builtinPuzzle)
+	if err != nil {
+		return puzzleSet{err: err}
+	}
+	builtin := readPuzzleSet(filepath.Base(builtinPuzzle), "", data)
+	if builtin.err == nil {
+		builtin.err = set.err
+	}
+	return builtin
+}
+
+func readPuzzleSet(name, path string, data []byte) puzzleSet {
+	list, err := puzzle.ReadSet(bytes.NewReader(data), name)
+	return puzzleSet{name: name, path: path, list: list, err: err}
+}
+
+// the next puzzle near rating of the user
+func (pz *GUIPuzzleDrawer) next(ctx *ghelper.GUIGameContext) {
+	if pz.attempt != nil && !pz.recorded && !pz.attempt.Clean() {
+		pz.record(ctx, false)
+	}
+	pz.attempt = nil
+	idx := puzzle.Pick(pz.set.list, ctx.Config.Puzzles.Rating, pz.done)
+	if idx < 0 {
+		return
+	}
+	p := pz.set.list[idx]
+	pz.done[p.ID] = true
+	pz.recorded = false
+	pz.start(ctx, p)
+}
+
+func (pz *GUIPuzzleDrawer) start(ctx *ghelper.GUIGameContext, p puzzle.Puzzle) {
+	a, err := puzzle.NewAttempt(p)
+	if err != nil {
+		ctx.Logx.Errorf("error puzzle %s: %v", p.ID, err)
+		return
+	}
+	pz.attempt = a
+	pz.flipped = !a.SolverWhite()
+	pz.selectedSq, pz.hintFrom, pz.hintTo = -1, -1, -1
+	pz.lastFrom, pz.lastTo = -1, -1
+	if len(p.LastMove) >= 4 {
+		pz.lastFrom, _ = base.SquareFromAlgebraic(p.LastMove[0:2])
+		pz.lastTo, _ = base.SquareFromAlgebraic(p.LastMove[2:4])
+	}
+	pz.replyAt = time.Time{}
+	pz.finished = false
+	pz.status = "puzzle.white_to_move"
+	if pz.flipped {
+		pz.status = "puzzle.black_to_move"
+	}
+}
+
+// result of puzzle changes rating once
+func (pz *GUIPuzzleDrawer) record(ctx *ghelper.GUIGameContext, solved bool) {
+	if pz.recorded || pz.attempt == nil {
+		return
+	}
+	pz.recorded = true
+	pz.delta = ctx.Config.Puzzles.Record(pz.attempt.Puzzle.Rating, solved)
+	if err := ctx.Config.Save(); err != nil {
+		ctx.Logx.Errorf("error save config: %v", err)
+	}
+}
+
+// select set file (browser: file data)
+func (pz *GUIPuzzleDrawer) browse(ctx *ghelper.GUIGameContext) {
+	pz.loading = true
+	go func() {
+		res, err := gdialog.OpenFile("Select puzzle set (.json, .epd)")
+		if err != nil {
+			// dialog is closed
+			ctx.Logx.Errorf("error dialog: %v", err)
+			pz.loadCh <- puzzleSet{}
+			return
+		}
+		pz.loadCh <- readPuzzleSet(res.Name, res.Path, res.Data)
+	}()
+}
+
+func (pz *GUIPuzzleDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error) {
+	now := time.Now()
+	dt := now.Sub(pz.lastTick).Seconds()
+	pz.lastTick = now
+
+	// set is selected
+	select {
+	case set := <-pz.loadCh:
+		pz.loading = false
+		if set.err != nil {
+			ctx.Logx.Errorf("error load puzzles: %v", set.err)
+			pz.msg.ShowMessage(ctx.AssetsWorker.Lang().T("puzzle.load_failed"), nil)
+			break
+		}
+		if len(set.list) == 0 {
+			break
+		}
+		pz.set = set
+		pz.done = map[string]bool{}
+		if set.path != "" {
+			ctx.Config.PuzzlePath = set.path
+			if err := ctx.Config.Save(); err != nil {
+				ctx.Logx.Errorf("error save config: %v", err)
+			}
+		}
+		pz.attempt = nil
+		pz.next(ctx)
+	default:
+	}
+
+	// reply of opponent or the next move of solution
+	if !pz.replyAt.IsZero() && now.After(pz.replyAt) {
+		pz.replyAt = time.Time{}
+		pz.reply()
+	}
+
+	mx, my := ebiten.CursorPosition()
+	mouseDown := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	justPressed := mouseDown && !pz.prevMouseDown
+	justReleased := !mouseDown && pz.prevMouseDown
+	pz.prevMouseDown = mouseDown
+
+	pz.msg.Update(ctx, mx, my, justReleased)
+	pz.msg.AnimateMessage()
+	if pz.msg.IsOverlayed() || pz.msg.Open {
+		return SceneNotChanged, nil
+	}
+
+	waiting := !pz.replyAt.IsZero()
+	for i, b := range pz.buttons {
+		clicked := b.HandleInput(mx, my, justPressed, !mouseDown && b.Pressed == true)
+		b.UpdateAnim(dt)
+		if !clicked {
+			continue
+		}
+		switch i {
+		case pz.btnNextIdx:
+			if !pz.loading {
+				pz.next(ctx)
+			}
+		case pz.btnRetryIdx:
+			if pz.attempt != nil && !pz.loading {
+				// rating is changed by the first try only
+				if !pz.attempt.Clean() {
+					pz.record(ctx, false)
+				}
+				pz.start(ctx, pz.attempt.Puzzle)
+			}
+		case pz.btnHintIdx:
+			if pz.attempt != nil && !pz.finished && !waiting {
+				if from, to, ok := pz.attempt.Hint(); ok {
+					pz.hintFrom, pz.hintTo = from, to
+				}
+			}
+		case pz.btnSolveIdx:
+			if pz.attempt != nil && !pz.finished && !waiting {
+				pz.attempt.GiveUp()
+				pz.record(ctx, false)
+				pz.finished = true
+				pz.status = "puzzle.shown"
+				pz.hintFrom, pz.hintTo, pz.selectedSq = -1, -1, -1
+				pz.replyAt = now.Add(puzzleReply)
+			}
+		case pz.btnLoadIdx:
+			if !pz.loading {
+				pz.browse(ctx)
+			}
+		case pz.btnBackIdx:
+			return SceneMenu, nil
+		}
+	}
+
+	// click-click moves of solver
+	if justReleased && pz.attempt != nil && !pz.finished && !waiting && pz.attempt.SolverToMove() &&
+		inBoard(mx, my, pz.boardX, pz.boardY, pz.sqSize) {
+		board := pz.attempt.Board()
+		sq := pixelToSquare(mx, my, pz.boardX, pz.boardY, pz.sqSize, pz.flipped)
+		pc := board.Mailbox[sq]
+		switch {
+		case pc != base.EmptyPiece && isWhitePiece(pc) == board.WhiteToMove:
+			pz.selectedSq = sq
+		case pz.selectedSq >= 0:
+			mv := base.Move{
+				From:  base.ConvIndexToPoint(pz.selectedSq),
+				To:    base.ConvIndexToPoint(sq),
+				Piece: board.Mailbox[pz.selectedSq],
+			}
+			pz.selectedSq = -1
+			if base.IsPawnPromotionFromIndices(&board.Mailbox, base.ConvPointToIndex(mv.From), sq) {
+				choices := GetWhiteChoices(ctx)
+				if !board.WhiteToMove {
+					choices = GetBlackChoices(ctx)
+				}
+				pz.msg.ShowMessageWithChoices("", *choices, func(idx int, v interface{}) {
+					mv.Piece = v.(base.Piece)
+					pz.userMove(ctx, mv)
+				})
+			} else {
+				pz.userMove(ctx, mv)
+			}
+		}
+	}
+
+	if ebiten.IsKeyPressed(ebiten.KeyEscape) {
+		return SceneMenu, nil
+	}
+	return SceneNotChanged, nil
+}
+
+func (pz *GUIPuzzleDrawer) userMove(ctx *ghelper.GUIGameContext, mv base.Move) {
+	switch pz.attempt.Play(mv) {
+	case puzzle.MoveIllegal:
+		return
+	case puzzle.MoveWrong:
+		// the first mistake fails puzzle, the user can try again
+		pz.record(ctx, false)
+		pz.status = "puzzle.wrong"
+		return
+	case puzzle.MoveRight:
+		pz.status = "puzzle.right"
+		pz.replyAt = time.Now().Add(puzzleReply)
+	case puzzle.MoveSolved:
+		pz.record(ctx, pz.attempt.Clean())
+		pz.finished = true
+		pz.status = "puzzle.solved"
+	}
+	pz.hintFrom, pz.hintTo = -1, -1
+}
+
+// reply of opponent, moves of shown solution are played one by one
+func (pz *GUIPuzzleDrawer) reply() {
+	if _, ok := pz.attempt.Reply(); !ok {
+		return
+	}
+	if pz.finished && !pz.attempt.Done() {
+		pz.replyAt = time.Now().Add(puzzleReply)
+	}
+}
+
+func (pz *GUIPuzzleDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Image) {
+	screen.Fill(ctx.Theme.Bg)
+
+	if pz.borderImg != nil {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(pz.boardX-4), float64(pz.boardY-4))
+		screen.DrawImage(pz.borderImg, op)
+	}
+	for r := 0; r < 8; r++ {
+		for f := 0; f < 8; f++ {
+			img := pz.sqLightImg
+			if ((f + r) & 1) == 1 {
+				img = pz.sqDarkImg
+			}
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Translate(float64(pz.boardX+f*pz.sqSize), float64(pz.boardY+r*pz.sqSize))
+			screen.DrawImage(img, op)
+		}
+	}
+
+	highlight := func(idx, pad int, col color.Color) {
+		sx, sy := pz.indexToScreenXY(idx)
+		ghelper.EbitenutilDrawRectStroke(screen, float64(sx+pad), float64(sy+pad), float64(pz.sqSize-2*pad), float64(pz.sqSize-2*pad), 2, col)
+	}
+	if pz.attempt != nil {
+		from, to := pz.lastFrom, pz.lastTo
+		if mv := pz.attempt.LastMove(); mv != nil {
+			from, to = base.ConvPointToIndex(mv.From), base.ConvPointToIndex(mv.To)
+		}
+		if from >= 0 && to >= 0 {
+			highlight(from, 5, ctx.Theme.ButtonStroke)
+			highlight(to, 5, ctx.Theme.ButtonStroke)
+		}
+		for idx, pc := range pz.attempt.Board().Mailbox {
+			if img := pz.scaledPieces[pc]; pc != base.EmptyPiece && img != nil {
+				px, py := pz.indexToScreenXY(idx)
+				op := &ebiten.DrawImageOptions{}
+				op.GeoM.Translate(float64(px), float64(py))
+				screen.DrawImage(img, op)
+			}
+		}
+		if pz.selectedSq >= 0 {
+			highlight(pz.selectedSq, 2, ctx.Theme.Accent)
+		}
+		if pz.hintFrom >= 0 {
+			highlight(pz.hintFrom, 2, ctx.Theme.Warning)
+		}
+		if pz.hintTo >= 0 {
+			highlight(pz.hintTo, 2, ctx.Theme.Warning)
+		}
+	}
+
+	// right panel
+	lang := ctx.AssetsWorker.Lang()
+	stats := ctx.Config.Puzzles
+	x, y := pz.boardX+pz.boardSize+20, pz.boardY+20
+	text.Draw(screen, lang.T("puzzle.title"), ctx.AssetsWorker.Fonts().Pixel, pz.boardX+24, pz.boardY-8, ctx.Theme.MenuText)
+	rating := fmt.Sprintf("%s: %d", lang.T("puzzle.rating"), stats.Rating)
+	if pz.recorded && pz.delta != 0 {
+		rating += fmt.Sprintf(" (%+d)", pz.delta)
+	}
+	lines := []string{
+		rating,
+		fmt.Sprintf("%s: %d (%d)", lang.T("puzzle.streak"), stats.Streak, stats.BestStreak),
+		fmt.Sprintf("%s: %d / %d", lang.T("puzzle.solved_count"), stats.Solved, stats.Played),
+		"",
+	}
+	if pz.attempt != nil {
+		lines = append(lines, lang.T(pz.status))
+		// rating and themes of puzzle are shown after its result
+		if pz.recorded || pz.finished {
+			p := pz.attempt.Puzzle
+			lines = append(lines, "", fmt.Sprintf("%s %s: %d", lang.T("puzzle.puzzle"), p.ID, p.Rating))
+			lines = append(lines, p.Themes...)
+		}
+	}
+	for _, l := range lines {
+		text.Draw(screen, l, ctx.AssetsWorker.Fonts().Normal, x, y, ctx.Theme.MenuText)
+		y += 26
+	}
+	name := pz.set.name
+	if pz.set.path == "" && name == filepath.Base(builtinPuzzle) {
+		name = lang.T("puzzle.builtin")
+	}
+	text.Draw(screen, fmt.Sprintf("%s (%d)", strings.TrimSuffix(name, filepath.Ext(name)), len(pz.set.list)),
+		ctx.AssetsWorker.Fonts().Normal, x, pz.boardY+pz.boardSize, ctx.Theme.MenuText)
+
+	for _, b := range pz.buttons {
+		b.DrawAnimated(screen, ctx.AssetsWorker.Fonts().PixelLow, ctx.Theme)
+	}
+	pz.msg.Draw(ctx, screen)
+
+	if ctx.Config.Debug {
+		ebitenutil.DebugPrint(screen, fmt.Sprintf("TPS: %0.2f", ebiten.ActualTPS()))
+	}
+}
+
+func (pz *GUIPuzzleDrawer) prepareCache(ctx *ghelper.GUIGameContext) {
+	pz.sqLightImg = ebiten.NewImage(pz.sqSize, pz.sqSize)
+	pz.sqLightImg.Fill(ctx.Theme.SquareLight)
+	pz.sqDarkImg = ebiten.NewImage(pz.sqSize, pz.sqSize)
+	pz.sqDarkImg.Fill(ctx.Theme.SquareDark)
+	pz.borderImg = ghelper.RenderRoundedRect(pz.boardSize+8, pz.boardSize+8, 6, ctx.Theme.ButtonFill, ctx.Theme.ButtonStroke, 3)
+
+	pz.scaledPieces = make(map[base.Piece]*ebiten.Image, 12)
+	for _, k := range []base.Piece{
+		base.WKing, base.BKing, base.WQueen, base.BQueen, base.WBishop, base.BBishop,
+		base.WKnight, base.BKnight, base.WRook, base.BRook, base.WPawn, base.BPawn,
+	} {
+		src := ctx.AssetsWorker.Piece(k)
+		if src == nil {
+			continue
+		}
+		dst := ebiten.NewImage(pz.sqSize, pz.sqSize)
+		iw, ih := src.Size()
+		s := math.Min(float64(pz.sqSize)/float64(iw), float64(pz.sqSize)/float64(ih))
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(s, s)
+		op.GeoM.Translate((float64(pz.sqSize)-float64(iw)*s)/2, (float64(pz.sqSize)-float64(ih)*s)/2)
+		op.Filter = ebiten.FilterLinear
+		dst.DrawImage(src, op)
+		pz.scaledPieces[k] = dst
+	}
+}
+
+func (pz *GUIPuzzleDrawer) indexToScreenXY(idx int) (int, int) {
+	f, r := indexToFileRank(idx)
+	if pz.flipped {
+		return pz.boardX + (7-f)*pz.sqSize, pz.boardY + r*pz.sqSize
+	}
+	return pz.boardX + f*pz.sqSize, pz.boardY + (7-r)*pz.sqSize
+}
@@ -1,9 +1,19 @@
 package gdraw
 
 import (
+	"bytes"
+	"evilchess/src/chesslib/engine/aiengine"
+	"evilchess/src/chesslib/engine/book"
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/engine/syzygy"
 	"evilchess/src/chesslib/engine/uci"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/ui/gui/gbase/gos"
 	"evilchess/src/ui/gui/ghelper"
+	"fmt"
 	"image/color"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
@@ -25,6 +35,10 @@ const (
 	SceneEditor
 	SceneAnalyzer
 	SceneSettings
+	SceneTrainer
+	ScenePuzzle
+	SceneNetPlay
+	SceneServerPlay
 	SceneNotChanged
 )
 
@@ -42,12 +56,189 @@ func (t SceneType) ToScene(s Scene, ctx *ghelper.GUIGameContext) Scene {
 		s = NewGUIAnalyzeDrawer(ctx)
 	case SceneSettings:
 		s = NewGUISettingsDrawer(ctx)
+	case SceneTrainer:
+		s = NewGUIEndgameDrawer(ctx)
+	case ScenePuzzle:
+		s = NewGUIPuzzleDrawer(ctx)
+	case SceneNetPlay:
+		s = NewGUINetPlayDrawer(ctx)
+	case SceneServerPlay:
+		s = NewGUIServerPlayDrawer(ctx)
 	case SceneNotChanged:
 	default:
 	}
 	return s
 }
 
+// internal engine with tuned weights (from config or default weights file if exists)
+func NewInternalEngine(ctx *ghelper.GUIGameContext) *myengine.EvilEngine {
+	e := myengine.NewEvilEngine()
+	e.SetEndgameTables(EndgameTables())
+	if ctx.Config.SyzygyPath != "" {
+		if tb, err := LoadTablebase(ctx); err == nil {
+			e.SetTablebase(tb)
+		} else {
+			ctx.Logx.Errorf("error load tablebases: %v", err)
+		}
+	}
+	path := ctx.Config.Weights
+	if path == "" {
+		if _, err := gos.Stat(myengine.DefaultWeightsFile); err != nil {
+			return e
+		}
+		path = myengine.DefaultWeightsFile
+	}
+	data, err := gos.ReadFile(path)
+	if err == nil {
+		var w myengine.EvalWeights
+		if w, err = myengine.ParseWeights(data); err == nil {
+			e.SetWeights(w)
+			return e
+		}
+	}
+	ctx.Logx.Errorf("error load engine weights: %v", err)
+	return e
+}
+
+// loaded model is shared between scenes (loading takes time)
+var (
+	modelMu     sync.Mutex
+	loadedModel *aiengine.Model
+	modelPath   string
+)
+
+func LoadModel(ctx *ghelper.GUIGameContext) (*aiengine.Model, error) {
+	modelMu.Lock()
+	defer modelMu.Unlock()
+	if loadedModel != nil && modelPath == ctx.Config.ModelPath {
+		return loadedModel, nil
+	}
+	data, err := gos.ReadFile(ctx.Config.ModelPath)
+	if err != nil {
+		return nil, err
+	}
+	m, err := aiengine.ReadModel(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	loadedModel, modelPath = m, ctx.Config.ModelPath
+	return loadedModel, nil
+}
+
+// model from file data (browser: file can't be read by path later)
+func SetModelData(ctx *ghelper.GUIGameContext, name string, data []byte) error {
+	m, err := aiengine.ReadModel(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	modelMu.Lock()
+	loadedModel, modelPath = m, name
+	modelMu.Unlock()
+	ctx.Config.ModelPath = name
+	return nil
+}
+
+// AI model engine, nil if model can't be loaded
+func NewModelEngine(ctx *ghelper.GUIGameContext) *aiengine.AIEngine {
+	m, err := LoadModel(ctx)
+	if err != nil {
+		ctx.Logx.Errorf("error load model: %v", err)
+		return nil
+	}
+	return aiengine.NewAIEngine(m)
+}
+
+// opening book of internal engine is shared between scenes too
+var (
+	bookMu     sync.Mutex
+	loadedBook *book.Book
+	bookPath   string
+)
+
+func LoadBook(ctx *ghelper.GUIGameContext) (*book.Book, error) {
+	bookMu.Lock()
+	defer bookMu.Unlock()
+	if loadedBook != nil && bookPath == ctx.Config.BookPath {
+		return loadedBook, nil
+	}
+	data, err := gos.ReadFile(ctx.Config.BookPath)
+	if err != nil {
+		return nil, err
+	}
+	bk, err := book.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if bk.Len() == 0 {
+		return nil, fmt.Errorf("empty book")
+	}
+	loadedBook, bookPath = bk, ctx.Config.BookPath
+	return loadedBook, nil
+}
+
+// book from file data (browser)
+func SetBookData(ctx *ghelper.GUIGameContext, name string, data []byte) error {
+	bk, err := book.Parse(data)
+	if err != nil {
+		return err
+	}
+	if bk.Len() == 0 {
+		return fmt.Errorf("empty book")
+	}
+	bookMu.Lock()
+	loadedBook, bookPath = bk, name
+	bookMu.Unlock()
+	ctx.Config.BookPath = name
+	return nil
+}
+
+// tablebases are shared between scenes too (tables are read on first probe)
+var (
+	tbMu     sync.Mutex
+	loadedTB *syzygy.Tablebase
+	tbPath   string
+)
+
+func LoadTablebase(ctx *ghelper.GUIGameContext) (*syzygy.Tablebase, error) {
+	tbMu.Lock()
+	defer tbMu.Unlock()
+	if loadedTB != nil && tbPath == ctx.Config.SyzygyPath {
+		return loadedTB, nil
+	}
+	tb, err := syzygy.Open(ctx.Config.SyzygyPath)
+	if err != nil {
+		return nil, err
+	}
+	loadedTB, tbPath = tb, ctx.Config.SyzygyPath
+	return loadedTB, nil
+}
+
+// own endgame tables are shared between scenes too (generated tables stay in memory)
+var (
+	egOnce   sync.Once
+	egTables *endgame.Tables
+)
+
+func EndgameTables() *endgame.Tables {
+	egOnce.Do(func() {
+		dir := endgame.DefaultDir
+		if runtime.GOOS == "js" {
+			dir = "" // browser: no file system
+		}
+		egTables = endgame.NewTables(dir)
+	})
+	return egTables
+}
+
+// external UCI engine with options of config
+func NewExternalEngine(ctx *ghelper.GUIGameContext) *uci.UCIExecutor {
+	e := uci.NewUCIExec(ctx.Logx, ctx.Config.UCIPath)
+	if ctx.Config.SyzygyPath != "" {
+		_ = e.SetOption("SyzygyPath", ctx.Config.SyzygyPath)
+	}
+	return e
+}
+
 func IsCorrectEngine(ctx *ghelper.GUIGameContext) error {
 	e := uci.NewUCIExec(ctx.Logx, ctx.Config.UCIPath)
 	if err := e.Init(); err != nil {
@@ -0,0 +1,578 @@
+package gdraw
+
+import (
+	"context"
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/httpapi"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/ui/gui/gbase/gos"
+	"evilchess/src/ui/gui/ghelper"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// game on server of HTTP API (evilchess http): the scene creates game, sends
+// moves and asks the server engine for replies, the board shows the stream of
+// game with analysis, so moves of other clients of the game (scripts) are shown
+// too; the WASM build talks to the server of its page
+
+const (
+	serverDefaultURL = "http://localhost" + httpapi.DefaultAddr
+	serverDelete     = 5 * time.Second // the game is deleted on leave not longer
+	serverPVMoves    = 8               // shown moves of analysis
+)
+
+// answer of request: game, stream of created game
+type serverReply struct {
+	game   *httpapi.Game
+	events <-chan httpapi.Event
+	err    error
+}
+
+type GUIServerPlayDrawer struct {
+	// layout
+	boardX, boardY int
+	boardSize      int
+	sqSize         int
+	flipped        bool // player is black
+
+	selectedSq       int // -1 (index 0..63)
+	lastFrom, lastTo int // last move, -1
+
+	// connection
+	url     string
+	client  *httpapi.Client
+	reqCtx  context.Context
+	cancel  context.CancelFunc
+	replyCh chan serverReply
+	events  <-chan httpapi.Event
+	busy    bool // request waits for answer
+	engine  bool // engine move is requested
+	stalled bool // engine move failed: it's asked again by button
+
+	// game
+	color     string // white, black
+	useEngine bool   // server engine plays the other side
+	level     int
+	game      *httpapi.Game
+	board     *base.Board
+	analysis  *httpapi.Analysis
+	shownOver bool
+	errText   string // the last error of server
+
+	// buttons
+	msg          *ghelper.MessageBox
+	buttons      []*ghelper.Button
+	btnEngineIdx int
+	btnLeaveIdx  int
+
+	prevMouseDown bool
+	lastTick      time.Time
+
+	// cache
+	sqLightImg   *ebiten.Image
+	sqDarkImg    *ebiten.Image
+	borderImg    *ebiten.Image
+	scaledPieces map[base.Piece]*ebiten.Image
+}
+
+func NewGUIServerPlayDrawer(ctx *ghelper.GUIGameContext) *GUIServerPlayDrawer {
+	sp := &GUIServerPlayDrawer{
+		selectedSq: -1,
+		lastFrom:   -1,
+		lastTo:     -1,
+		url:        serverURL(ctx),
+		replyCh:    make(chan serverReply, 1),
+		useEngine:  ctx.Config.UseEngine,
+		level:      min(ctx.Config.Strength+1, httpapi.MaxLevel),
+		lastTick:   time.Now(),
+		msg:        &ghelper.MessageBox{},
+	}
+	sp.client = httpapi.NewClient(sp.url)
+	sp.reqCtx, sp.cancel = context.WithCancel(context.Background())
+	switch ctx.Config.PlayAs {
+	case "black":
+		sp.color = "black"
+	case "random":
+		sp.color = []string{"white", "black"}[sp.lastTick.Second()%2]
+	default:
+		sp.color = "white"
+	}
+	sp.flipped = sp.color == "black"
+
+	sp.boardSize = max(min(ctx.Config.WindowW-460, ctx.Config.WindowH-140), 320)
+	sp.sqSize = sp.boardSize / 8
+	sp.boardX = 200
+	sp.boardY = (ctx.Config.WindowH - sp.boardSize) / 2
+	sp.prepareCache(ctx)
+
+	lang := ctx.AssetsWorker.Lang()
+	x, y := 20, sp.boardY
+	w, h := 160, 44
+	sp.btnEngineIdx, sp.buttons = ghelper.AppendButton(ctx, lang.T("server.engine_move"), x, y, w, h, sp.buttons)
+	y += h + 30
+	sp.btnLeaveIdx, sp.buttons = ghelper.AppendButton(ctx, lang.T("net.leave"), x, y, w, h, sp.buttons)
+
+	sp.create(ctx)
+	return sp
+}
+
+// server of config, else server of WASM page, else local server
+func serverURL(ctx *ghelper.GUIGameContext) string {
+	if u := strings.TrimSpace(ctx.Config.ServerURL); u != "" {
+		return u
+	}
+	if u := gos.Origin(); u != "" {
+		return u
+	}
+	return serverDefaultURL
+}
+
+// game of menu is created, its stream is opened
+func (sp *GUIServerPlayDrawer) create(ctx *ghelper.GUIGameContext) {
+	req := httpapi.CreateRequest{}
+	opponent := ""
+	if sp.useEngine {
+		opponent = ctx.AssetsWorker.Lang().T("server.engine")
+	}
+	if sp.color == "white" {
+		req.White, req.Black = ctx.Config.NetName, opponent
+	} else {
+		req.White, req.Black = opponent, ctx.Config.NetName
+	}
+	sp.busy = true
+	go func() {
+		g, err := sp.client.CreateGame(sp.reqCtx, req)
+		if err != nil {
+			sp.replyCh <- serverReply{err: err}
+			return
+		}
+		events, err := sp.client.Stream(sp.reqCtx, g.ID, true)
+		sp.replyCh <- serverReply{game: g, events: events, err: err}
+	}()
+}
+
+// move of player (UCI)
+func (sp *GUIServerPlayDrawer) sendMove(board *base.Board, mv base.Move) {
+	if sp.busy || !rules.IsLegalMove(board, mv) {
+		return
+	}
+	sp.busy = true
+	id, uci := sp.game.ID, moves.MoveToUCI(board, mv)
+	go func() {
+		g, err := sp.client.Move(sp.reqCtx, id, uci)
+		sp.replyCh <- serverReply{game: g, err: err}
+	}()
+}
+
+// engine of server plays move of side to move
+func (sp *GUIServerPlayDrawer) requestEngine() {
+	sp.busy, sp.engine = true, true
+	id, level := sp.game.ID, sp.level
+	go func() {
+		res, err := sp.client.EngineMove(sp.reqCtx, id, httpapi.EngineRequest{Level: level})
+		if err != nil {
+			sp.replyCh <- serverReply{err: err}
+			return
+		}
+		sp.replyCh <- serverReply{game: res.Game}
+	}()
+}
+
+func (sp *GUIServerPlayDrawer) reply(ctx *ghelper.GUIGameContext, r serverReply) {
+	sp.stalled = sp.engine && r.err != nil
+	sp.busy, sp.engine = false, false
+	if r.events != nil {
+		sp.events = r.events
+	}
+	if r.game != nil {
+		sp.applyGame(ctx, r.game)
+	}
+	switch {
+	case r.err == nil:
+		sp.errText = ""
+	case sp.game == nil:
+		ctx.Logx.Errorf("error create game on %s: %v", sp.url, r.err)
+		sp.msg.ShowMessage(ctx.AssetsWorker.Lang().T("net.connect_failed"), nil)
+	default:
+		sp.errText = r.err.Error()
+	}
+}
+
+// events of game stream: moves of all clients and analysis
+func (sp *GUIServerPlayDrawer) receive(ctx *ghelper.GUIGameContext) {
+	for sp.events != nil {
+		select {
+		case ev, ok := <-sp.events:
+			if !ok {
+				sp.events = nil
+				sp.errText = ctx.AssetsWorker.Lang().T("server.stream_closed")
+				return
+			}
+			switch ev.Type {
+			case httpapi.EventGame, httpapi.EventMove:
+				if ev.Game != nil {
+					sp.applyGame(ctx, ev.Game)
+				}
+			case httpapi.EventAnalysis:
+				if ev.Analysis != nil && sp.game != nil && ev.Analysis.FEN == sp.game.FEN {
+					sp.analysis = ev.Analysis
+				}
+			case httpapi.EventError:
+				sp.errText = ev.Error
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (sp *GUIServerPlayDrawer) applyGame(ctx *ghelper.GUIGameContext, g *httpapi.Game) {
+	if sp.game != nil && len(sp.game.Moves) > len(g.Moves) {
+		// answer of request is older than event of stream
+		return
+	}
+	if sp.game == nil || len(sp.game.Moves) != len(g.Moves) {
+		sp.selectedSq = -1
+		sp.analysis = nil
+	}
+	sp.game = g
+	b, err := convfen.ConvertFENToBoard(g.FEN)
+	if err != nil {
+		ctx.Logx.Errorf("error server FEN %s: %v", g.FEN, err)
+		return
+	}
+	sp.board = b
+	sp.lastFrom, sp.lastTo = -1, -1
+	if n := len(g.Moves); n > 0 && len(g.Moves[n-1]) >= 4 {
+		sp.lastFrom, _ = base.SquareFromAlgebraic(g.Moves[n-1][0:2])
+		sp.lastTo, _ = base.SquareFromAlgebraic(g.Moves[n-1][2:4])
+	}
+
+	if g.Active() {
+		sp.shownOver = false
+		return
+	}
+	if !sp.shownOver {
+		sp.shownOver = true
+		lang := ctx.AssetsWorker.Lang()
+		key, ok := netOutcomeKeys[g.Reason]
+		if !ok {
+			key = "net.game_over"
+		}
+		sp.msg.ShowMessage(fmt.Sprintf("%s %s", lang.T(key), g.Result), nil)
+	}
+}
+
+// game goes on and no request waits
+func (sp *GUIServerPlayDrawer) ready() bool {
+	return sp.game != nil && sp.board != nil && sp.game.Active() && !sp.busy
+}
+
+// player moves own side, both sides without engine (other clients may move too)
+func (sp *GUIServerPlayDrawer) myMove() bool {
+	return sp.ready() && (!sp.useEngine || sp.game.Turn == sp.color)
+}
+
+func (sp *GUIServerPlayDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error) {
+	now := time.Now()
+	dt := now.Sub(sp.lastTick).Seconds()
+	sp.lastTick = now
+
+	select {
+	case r := <-sp.replyCh:
+		sp.reply(ctx, r)
+	default:
+	}
+	sp.receive(ctx)
+	// the engine answers move of player
+	if sp.useEngine && !sp.stalled && sp.ready() && sp.game.Turn != sp.color {
+		sp.requestEngine()
+	}
+
+	mx, my := ebiten.CursorPosition()
+	mouseDown := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	justPressed := mouseDown && !sp.prevMouseDown
+	justReleased := !mouseDown && sp.prevMouseDown
+	sp.prevMouseDown = mouseDown
+
+	sp.msg.Update(ctx, mx, my, justReleased)
+	sp.msg.AnimateMessage()
+	if sp.msg.IsOverlayed() || sp.msg.Open {
+		return SceneNotChanged, nil
+	}
+
+	for i, b := range sp.buttons {
+		clicked := b.HandleInput(mx, my, justPressed, !mouseDown && b.Pressed == true)
+		b.UpdateAnim(dt)
+		if !clicked {
+			continue
+		}
+		switch i {
+		case sp.btnEngineIdx:
+			if sp.ready() {
+				sp.requestEngine()
+			}
+		case sp.btnLeaveIdx:
+			sp.leave()
+			return ScenePlayMenu, nil
+		}
+	}
+
+	// click-click moves, server checks them
+	if justReleased && sp.myMove() && inBoard(mx, my, sp.boardX, sp.boardY, sp.sqSize) {
+		board := sp.board
+		sq := pixelToSquare(mx, my, sp.boardX, sp.boardY, sp.sqSize, sp.flipped)
+		pc := board.Mailbox[sq]
+		switch {
+		case pc != base.EmptyPiece && isWhitePiece(pc) == board.WhiteToMove:
+			sp.selectedSq = sq
+		case sp.selectedSq >= 0:
+			mv := base.Move{
+				From:  base.ConvIndexToPoint(sp.selectedSq),
+				To:    base.ConvIndexToPoint(sq),
+				Piece: board.Mailbox[sp.selectedSq],
+			}
+			sp.selectedSq = -1
+			if base.IsPawnPromotionFromIndices(&board.Mailbox, base.ConvPointToIndex(mv.From), sq) {
+				sp.msg.ShowMessageWithChoices("", *GetChoises(ctx, board.WhiteToMove), func(idx int, v interface{}) {
+					mv.Piece = v.(base.Piece)
+					sp.sendMove(board, mv)
+				})
+			} else {
+				sp.sendMove(board, mv)
+			}
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		sp.leave()
+		return ScenePlayMenu, nil
+	}
+	return SceneNotChanged, nil
+}
+
+// requests and stream are stopped, the game is deleted on server
+func (sp *GUIServerPlayDrawer) leave() {
+	sp.cancel()
+	sp.events = nil
+	if sp.game == nil {
+		return
+	}
+	id, client := sp.game.ID, sp.client
+	go func() {
+		dctx, cancel := context.WithTimeout(context.Background(), serverDelete)
+		defer cancel()
+		_ = client.DeleteGame(dctx, id)
+	}()
+}
+
+func (sp *GUIServerPlayDrawer) statusKey() string {
+	switch {
+	case sp.game == nil && sp.busy:
+		return "net.connecting"
+	case sp.game == nil:
+		return "net.connect_failed"
+	case !sp.game.Active():
+		return "net.game_over"
+	case sp.engine:
+		return "server.thinking"
+	case sp.useEngine && sp.game.Turn != sp.color:
+		return "net.their_move"
+	}
+	return "net.your_move"
+}
+
+// score of white POV: "+0.35", "#-3"
+func (sp *GUIServerPlayDrawer) analysisLine() string {
+	a := sp.analysis
+	score, mate := a.ScoreCP, a.MateIn
+	if sp.game.Turn == "black" {
+		score, mate = -score, -mate
+	}
+	line := fmt.Sprintf("%+.2f", float64(score)/100)
+	if mate != 0 {
+		line = fmt.Sprintf("#%d", mate)
+	}
+	line = fmt.Sprintf("d%d %s", a.Depth, line)
+	// moves of PV in SAN on copy of position
+	b := moves.CloneBoard(sp.board)
+	for i, s := range a.PV {
+		mv, err := moves.UCIToMove(b, s)
+		if i == serverPVMoves || err != nil {
+			break
+		}
+		line += " " + moves.MoveToSAN(b, mv)
+		if moves.ApplyMove(b, mv) != nil {
+			break
+		}
+	}
+	return line
+}
+
+func (sp *GUIServerPlayDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Image) {
+	screen.Fill(ctx.Theme.Bg)
+
+	if sp.borderImg != nil {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(sp.boardX-4), float64(sp.boardY-4))
+		screen.DrawImage(sp.borderImg, op)
+	}
+	for r := 0; r < 8; r++ {
+		for f := 0; f < 8; f++ {
+			img := sp.sqLightImg
+			if ((f + r) & 1) == 1 {
+				img = sp.sqDarkImg
+			}
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Translate(float64(sp.boardX+f*sp.sqSize), float64(sp.boardY+r*sp.sqSize))
+			screen.DrawImage(img, op)
+		}
+	}
+
+	highlight := func(idx, pad int, col color.Color) {
+		sx, sy := sp.indexToScreenXY(idx)
+		ghelper.EbitenutilDrawRectStroke(screen, float64(sx+pad), float64(sy+pad), float64(sp.sqSize-2*pad), float64(sp.sqSize-2*pad), 2, col)
+	}
+	if sp.board != nil {
+		if sp.lastFrom >= 0 && sp.lastTo >= 0 {
+			highlight(sp.lastFrom, 5, ctx.Theme.ButtonStroke)
+			highlight(sp.lastTo, 5, ctx.Theme.ButtonStroke)
+		}
+		for idx, pc := range sp.board.Mailbox {
+			if img := sp.scaledPieces[pc]; pc != base.EmptyPiece && img != nil {
+				px, py := sp.indexToScreenXY(idx)
+				op := &ebiten.DrawImageOptions{}
+				op.GeoM.Translate(float64(px), float64(py))
+				screen.DrawImage(img, op)
+			}
+		}
+		if sp.selectedSq >= 0 {
+			highlight(sp.selectedSq, 2, ctx.Theme.Accent)
+		}
+	}
+
+	lang := ctx.AssetsWorker.Lang()
+	title := lang.T("server.title")
+	if sp.game != nil {
+		title += " #" + sp.game.ID
+	}
+	text.Draw(screen, title, ctx.AssetsWorker.Fonts().Pixel, sp.boardX+24, sp.boardY-8, ctx.Theme.MenuText)
+
+	// right panel: players, status, analysis and moves
+	x := sp.boardX + sp.boardSize + 20
+	w := ctx.Config.WindowW - x - 20
+	drawPlayer := func(y int, white bool) {
+		h := 56
+		img := ghelper.RenderRoundedRect(w, h, 12, ctx.Theme.ButtonFill, ctx.Theme.ButtonStroke, 3)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(x), float64(y))
+		screen.DrawImage(img, op)
+		if sp.game == nil {
+			return
+		}
+		name := sp.game.Black
+		if white {
+			name = sp.game.White
+		}
+		if sp.game.Active() && (sp.game.Turn == "white") == white {
+			ghelper.EbitenutilDrawRectStroke(screen, float64(x)+1, float64(y)+1, float64(w)-2, float64(h)-2, 3, ctx.Theme.Accent)
+		}
+		text.Draw(screen, name, ctx.AssetsWorker.Fonts().Pixel, x+10, y+34, ctx.Theme.MenuText)
+	}
+	// the player is at the bottom
+	drawPlayer(sp.boardY, sp.flipped)
+	drawPlayer(sp.boardY+sp.boardSize-56, !sp.flipped)
+
+	face := ctx.AssetsWorker.Fonts().Normal
+	y := sp.boardY + 90
+	lines := []string{lang.T(sp.statusKey())}
+	if sp.analysis != nil {
+		lines = append(lines, lang.T("server.analysis")+":")
+		lines = append(lines, wrapText(face, sp.analysisLine(), w)...)
+	}
+	if sp.errText != "" {
+		lines = append(lines, wrapText(face, sp.errText, w)...)
+	}
+	for _, l := range lines {
+		text.Draw(screen, l, face, x, y, ctx.Theme.MenuText)
+		y += 22
+	}
+
+	// moves: the last lines which fit above the player
+	if sp.game != nil && len(sp.game.SAN) > 0 {
+		top, bottom := y+10, sp.boardY+sp.boardSize-56-10
+		text.Draw(screen, lang.T("server.moves"), ctx.AssetsWorker.Fonts().Pixel, x, top, ctx.Theme.MenuText)
+		var sb strings.Builder
+		for i, s := range sp.game.SAN {
+			if i%2 == 0 {
+				fmt.Fprintf(&sb, "%d. ", i/2+1)
+			}
+			sb.WriteString(s + " ")
+		}
+		list := wrapText(face, sb.String(), w)
+		if fit := max((bottom-top-4)/22, 0); len(list) > fit {
+			list = list[len(list)-fit:]
+		}
+		y = top + 26
+		for _, l := range list {
+			text.Draw(screen, l, face, x, y, ctx.Theme.ButtonText)
+			y += 22
+		}
+	}
+
+	for _, b := range sp.buttons {
+		b.DrawAnimated(screen, ctx.AssetsWorker.Fonts().PixelLow, ctx.Theme)
+	}
+	sp.msg.Draw(ctx, screen)
+
+	if ctx.Config.Debug {
+		ebitenutil.DebugPrint(screen, fmt.Sprintf("TPS: %0.2f", ebiten.ActualTPS()))
+	}
+}
+
+func (sp *GUIServerPlayDrawer) prepareCache(ctx *ghelper.GUIGameContext) {
+	sp.sqLightImg = ebiten.NewImage(sp.sqSize, sp.sqSize)
+	sp.sqLightImg.Fill(ctx.Theme.SquareLight)
+	sp.sqDarkImg = ebiten.NewImage(sp.sqSize, sp.sqSize)
+	sp.sqDarkImg.Fill(ctx.Theme.SquareDark)
+	sp.borderImg = ghelper.RenderRoundedRect(sp.boardSize+8, sp.boardSize+8, 6, ctx.Theme.ButtonFill, ctx.Theme.ButtonStroke, 3)
+
+	sp.scaledPieces = make(map[base.Piece]*ebiten.Image, 12)
+	for _, k := range []base.Piece{
+		base.WKing, base.BKing, base.WQueen, base.BQueen, base.WBishop, base.BBishop,
+		base.WKnight, base.BKnight, base.WRook, base.BRook, base.WPawn, base.BPawn,
+	} {
+		src := ctx.AssetsWorker.Piece(k)
+		if src == nil {
+			continue
+		}
+		dst := ebiten.NewImage(sp.sqSize, sp.sqSize)
+		iw, ih := src.Size()
+		s := math.Min(float64(sp.sqSize)/float64(iw), float64(sp.sqSize)/float64(ih))
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(s, s)
+		op.GeoM.Translate((float64(sp.sqSize)-float64(iw)*s)/2, (float64(sp.sqSize)-float64(ih)*s)/2)
+		op.Filter = ebiten.FilterLinear
+		dst.DrawImage(src, op)
+		sp.scaledPieces[k] = dst
+	}
+}
+
+func (sp *GUIServerPlayDrawer) indexToScreenXY(idx int) (int, int) {
+	f, r := indexToFileRank(idx)
+	if sp.flipped {
+		return sp.boardX + (7-f)*sp.sqSize, sp.boardY + r*sp.sqSize
+	}
+	return sp.boardX + f*sp.sqSize, sp.boardY + (7-r)*sp.sqSize
+}
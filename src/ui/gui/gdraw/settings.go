@@ -1,6 +1,7 @@
 package gdraw
 
 import (
+	"evilchess/src/chesslib/engine/skill"
 	"evilchess/src/ui/gui/gbase"
 	"evilchess/src/ui/gui/ghelper/gdialog"
 	"evilchess/src/ui/gui/ghelper"
@@ -25,11 +26,19 @@ type GUISettingsDrawer struct {
 	btnThemeDarkIdx  int
 	btnEngineIntIdx  int
 	btnEngineUciIdx  int
+	btnEngineAIIdx   int
 	btnBrowseIdx     int
 	btnDebugIdx      int
+	btnPonderIdx     int
+	btnHumanIdx      int
+	btnBookIdx       int
+	btnSyzygyIdx     int
 	btnApplyIdx      int
 	btnBackIdx       int
 
+	// target Elo of human-like engine
+	eloWheel *ghelper.NumberWheel
+
 	// internal ui state
 	prevMouseDown bool
 	browseActive  bool
@@ -39,15 +48,14 @@ type GUISettingsDrawer struct {
 
 func NewGUISettingsDrawer(ctx *ghelper.GUIGameContext) *GUISettingsDrawer {
 	sd := &GUISettingsDrawer{lastTick: time.Now()}
-	textBrowse := ctx.AssetsWorker.Lang().T("settings.engine.no_file")
 	if ctx.Config.UCIPath != "" && ctx.Config.Engine == "external" {
 		if err := IsCorrectEngine(ctx); err != nil {
 			ctx.Logx.Error("invalid engine config")
 			ctx.Config.UCIPath = ""
 			ctx.Config.Engine = "internal"
 		}
-		textBrowse = filepath.Base(ctx.Config.UCIPath)
 	}
+	textBrowse := sd.browseLabel(ctx)
 
 	// buttons
 	sd.buttons = []*ghelper.Button{}
@@ -69,6 +77,7 @@ func NewGUISettingsDrawer(ctx *ghelper.GUIGameContext) *GUISettingsDrawer {
 	engineY := themeY + btnH + spacingY
 	sd.btnEngineIntIdx, sd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("settings.engine.internal"), startX, engineY, btnW, btnH, sd.buttons)
 	sd.btnEngineUciIdx, sd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("settings.engine.uci"), startX+btnW+spacingX, engineY, btnW, btnH, sd.buttons)
+	sd.btnEngineAIIdx, sd.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("settings.engine.model"), startX+2*(btnW+spacingX), engineY, btnW, btnH, sd.buttons)
 	// browse
 	browseY := engineY + btnH + spacingY
 	browseW := btnW*2 + spacingX
@@ -76,6 +85,24 @@ func NewGUISettingsDrawer(ctx *ghelper.GUIGameContext) *GUISettingsDrawer {
 	// debug
 	debugY := browseY + btnH + spacingY
 	sd.btnDebugIdx, sd.buttons = ghelper.AppendButton(ctx, "", startX, debugY, btnW, btnH, sd.buttons)
+	// ponder
+	sd.btnPonderIdx, sd.buttons = ghelper.AppendButton(ctx, "", startX+btnW+spacingX, debugY, btnW, btnH, sd.buttons)
+	// endgame tablebases of internal and external engines
+	sd.btnSyzygyIdx, sd.buttons = ghelper.AppendButton(ctx, "", startX+2*(btnW+spacingX), debugY, btnW, btnH, sd.buttons)
+	// human-like strength
+	humanY := debugY + btnH + spacingY
+	sd.btnHumanIdx, sd.buttons = ghelper.AppendButton(ctx, "", startX, humanY, btnW, btnH, sd.buttons)
+	// opening book of internal engine
+	sd.btnBookIdx, sd.buttons = ghelper.AppendButton(ctx, "", startX+btnW+spacingX, humanY, btnW, btnH, sd.buttons)
+	sd.eloWheel = ghelper.NewNumberWheel(
+		startX+2*(btnW+spacingX), humanY,
+		btnW, btnH*2+spacingY,
+		skill.MinElo, skill.MaxElo, 100, ctx.Config.Elo, 3,
+		ctx.AssetsWorker.Fonts().Pixel, "settings.elo",
+	)
+	sd.eloWheel.SetOnChange(func(v int) {
+		ctx.Config.Elo = v
+	})
 	// apply
 	applyW, applyH := 160, 56
 	applyX := ctx.Config.WindowW - applyW - 60
@@ -110,6 +137,10 @@ func (sd *GUISettingsDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, err
 		return SceneNotChanged, nil
 	}
 
+	if ctx.Config.HumanLike {
+		sd.eloWheel.Update(ctx)
+	}
+
 	// HandleInput + UpdateAnim
 	for i, b := range sd.buttons {
 		clicked := b.HandleInput(mx, my, justClicked, justReleased)
@@ -131,6 +162,14 @@ func (sd *GUISettingsDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, err
 				// ctx.Config.UCIPath = ""
 			case sd.btnEngineUciIdx:
 				ctx.Config.Engine = "external"
+				if !sd.browseActive {
+					sd.buttons[sd.btnBrowseIdx].Label = sd.browseLabel(ctx)
+				}
+			case sd.btnEngineAIIdx:
+				ctx.Config.Engine = "model"
+				if !sd.browseActive {
+					sd.buttons[sd.btnBrowseIdx].Label = sd.browseLabel(ctx)
+				}
 				// case sd.btnBrowseIdx:
 				// 	// open dialog if UCI used
 				// 	if ctx.Config.Engine == "external" && !sd.browseActive {
@@ -157,7 +196,9 @@ func (sd *GUISettingsDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, err
 				// 	}
 				// 	break
 			case sd.btnBrowseIdx:
-				if ctx.Config.Engine == "external" && !sd.browseActive {
+				if ctx.Config.Engine == "model" && !sd.browseActive {
+					sd.browseModel(ctx, b)
+				} else if ctx.Config.Engine == "external" && !sd.browseActive {
 					sd.browseActive = true
 					b.Label = ctx.AssetsWorker.Lang().T("settings.engine.selecting")
 
@@ -215,6 +256,28 @@ func (sd *GUISettingsDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, err
 				break
 			case sd.btnDebugIdx:
 				ctx.Config.Debug = !ctx.Config.Debug
+			case sd.btnPonderIdx:
+				ctx.Config.Ponder = !ctx.Config.Ponder
+			case sd.btnHumanIdx:
+				ctx.Config.HumanLike = !ctx.Config.HumanLike
+			case sd.btnBookIdx:
+				if ctx.Config.Engine != "internal" {
+					break
+				}
+				if ctx.Config.UseBook {
+					ctx.Config.UseBook = false
+				} else if !sd.browseActive {
+					sd.browseBook(ctx, b)
+				}
+			case sd.btnSyzygyIdx:
+				if ctx.Config.Engine == "model" {
+					break
+				}
+				if ctx.Config.SyzygyPath != "" {
+					ctx.Config.SyzygyPath = ""
+				} else if !sd.browseActive {
+					sd.browseSyzygy(ctx, b)
+				}
 			case sd.btnApplyIdx:
 				// save Config
 				ctx.Config.Theme = ctx.Theme.String()
@@ -269,15 +332,32 @@ func (sd *GUISettingsDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Im
 		if i == sd.btnBrowseIdx && ctx.Config.Engine == "internal" {
 			continue
 		}
+		// book only for internal engine
+		if i == sd.btnBookIdx && ctx.Config.Engine != "internal" {
+			continue
+		}
+		// model engine doesn't search
+		if i == sd.btnSyzygyIdx && ctx.Config.Engine == "model" {
+			continue
+		}
 		// debug up if browse skiped
-		if i == sd.btnDebugIdx && ctx.Config.Engine == "internal" {
+		debugRow := i == sd.btnDebugIdx || i == sd.btnPonderIdx || i == sd.btnSyzygyIdx
+		if debugRow && ctx.Config.Engine == "internal" {
 			b.Y = sd.buttons[sd.btnBrowseIdx].Y
-		} else if i == sd.btnDebugIdx && ctx.Config.Engine == "external" {
+		} else if debugRow {
 			// debug down if browse used
 			b.Y = sd.buttons[sd.btnBrowseIdx].Y + b.H + 18
 		}
+		// human-like row is under debug
+		if i == sd.btnHumanIdx || i == sd.btnBookIdx {
+			b.Y = sd.buttons[sd.btnDebugIdx].Y + b.H + 18
+			sd.eloWheel.Y = b.Y
+		}
 		b.DrawAnimated(screen, ctx.AssetsWorker.Fonts().PixelLow, ctx.Theme)
 	}
+	if ctx.Config.HumanLike {
+		sd.eloWheel.Draw(ctx, screen)
+	}
 
 	// if message box open -> draw overlay and modal
 	// if sd.msg.Open || sd.msg.Animating {
@@ -327,6 +407,11 @@ func (sd *GUISettingsDrawer) refreshButtons(ctx *ghelper.GUIGameContext) {
 			if ctx.Config.Engine == "external" {
 				fill = ctx.Theme.Accent
 			}
+		case sd.btnEngineAIIdx:
+			b.Label = ctx.AssetsWorker.Lang().T("settings.engine.model")
+			if ctx.Config.Engine == "model" {
+				fill = ctx.Theme.Accent
+			}
 		case sd.btnBrowseIdx:
 			// if ctx.Config.Engine == "external" {
 			// 	fill = ctx.Theme.ButtonFill
@@ -342,7 +427,168 @@ func (sd *GUISettingsDrawer) refreshButtons(ctx *ghelper.GUIGameContext) {
 			} else {
 				b.Label = ctx.AssetsWorker.Lang().T("settings.debug.off")
 			}
+		case sd.btnPonderIdx:
+			if ctx.Config.Ponder {
+				b.Label = ctx.AssetsWorker.Lang().T("settings.ponder.on")
+				fill = ctx.Theme.Accent
+			} else {
+				b.Label = ctx.AssetsWorker.Lang().T("settings.ponder.off")
+			}
+		case sd.btnHumanIdx:
+			if ctx.Config.HumanLike {
+				b.Label = ctx.AssetsWorker.Lang().T("settings.human.on")
+				fill = ctx.Theme.Accent
+			} else {
+				b.Label = ctx.AssetsWorker.Lang().T("settings.human.off")
+			}
+		case sd.btnBookIdx:
+			if sd.browseActive && ctx.Config.Engine == "internal" {
+				break
+			}
+			if ctx.Config.UseBook {
+				b.Label = filepath.Base(ctx.Config.BookPath)
+				fill = ctx.Theme.Accent
+			} else {
+				b.Label = ctx.AssetsWorker.Lang().T("settings.book.off")
+			}
+		case sd.btnSyzygyIdx:
+			if sd.browseActive && ctx.Config.Engine != "model" {
+				break
+			}
+			if ctx.Config.SyzygyPath != "" {
+				b.Label = filepath.Base(ctx.Config.SyzygyPath)
+				fill = ctx.Theme.Accent
+			} else {
+				b.Label = ctx.AssetsWorker.Lang().T("settings.syzygy.off")
+			}
 		}
 		b.Image = ghelper.RenderRoundedRect(b.W, b.H, 12, fill, stroke, 3)
 	}
 }
+
+// file name of selected engine/model
+func (sd *GUISettingsDrawer) browseLabel(ctx *ghelper.GUIGameContext) string {
+	if ctx.Config.Engine == "external" && ctx.Config.UCIPath != "" {
+		return filepath.Base(ctx.Config.UCIPath)
+	}
+	if ctx.Config.Engine == "model" && ctx.Config.ModelPath != "" {
+		return filepath.Base(ctx.Config.ModelPath)
+	}
+	return ctx.AssetsWorker.Lang().T("settings.engine.no_file")
+}
+
+// select exported AI model file (loaded to check it)
+func (sd *GUISettingsDrawer) browseModel(ctx *ghelper.GUIGameContext, b *ghelper.Button) {
+	sd.browseActive = true
+	b.Label = ctx.AssetsWorker.Lang().T("settings.engine.selecting")
+
+	go func() {
+		defer func() { sd.browseActive = false }()
+
+		res, err := gdialog.OpenFile("Select AI model file")
+		b.Label = sd.browseLabel(ctx)
+		if err != nil {
+			ctx.Logx.Errorf("error dialog: %v", err)
+			return
+		}
+
+		if res.Path != "" {
+			old := ctx.Config.ModelPath
+			ctx.Config.ModelPath = res.Path
+			if _, err := LoadModel(ctx); err != nil {
+				ctx.Config.ModelPath = old
+				ctx.Logx.Errorf("selected file is not model: %v", err)
+				sd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("settings.model.failed"), nil)
+			}
+			b.Label = sd.browseLabel(ctx)
+			return
+		}
+
+		// browser: model is loaded from file data for this session
+		if len(res.Data) == 0 {
+			ctx.Logx.Error("no file data returned")
+			return
+		}
+		if err := SetModelData(ctx, res.Name, res.Data); err != nil {
+			ctx.Logx.Errorf("selected file is not model: %v", err)
+			sd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("settings.model.failed"), nil)
+			return
+		}
+		b.Label = res.Name
+	}()
+}
+
+// select opening book and enable it (book is loaded to check it)
+func (sd *GUISettingsDrawer) browseBook(ctx *ghelper.GUIGameContext, b *ghelper.Button) {
+	sd.browseActive = true
+	b.Label = ctx.AssetsWorker.Lang().T("settings.engine.selecting")
+
+	go func() {
+		defer func() {
+			sd.browseActive = false
+			sd.refreshButtons(ctx)
+		}()
+
+		res, err := gdialog.OpenFile("Select Polyglot book")
+		if err != nil {
+			ctx.Logx.Errorf("error dialog: %v", err)
+			return
+		}
+
+		if res.Path != "" {
+			old := ctx.Config.BookPath
+			ctx.Config.BookPath = res.Path
+			if _, err := LoadBook(ctx); err != nil {
+				ctx.Config.BookPath = old
+				ctx.Logx.Errorf("selected file is not book: %v", err)
+				sd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("settings.book.failed"), nil)
+				return
+			}
+			ctx.Config.UseBook = true
+			return
+		}
+
+		// browser: book is loaded from file data for this session
+		if len(res.Data) == 0 {
+			ctx.Logx.Error("no file data returned")
+			return
+		}
+		if err := SetBookData(ctx, res.Name, res.Data); err != nil {
+			ctx.Logx.Errorf("selected file is not book: %v", err)
+			sd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("settings.book.failed"), nil)
+			return
+		}
+		ctx.Config.UseBook = true
+	}()
+}
+
+// select any table file, tablebases of its folder are enabled
+func (sd *GUISettingsDrawer) browseSyzygy(ctx *ghelper.GUIGameContext, b *ghelper.Button) {
+	sd.browseActive = true
+	b.Label = ctx.AssetsWorker.Lang().T("settings.engine.selecting")
+
+	go func() {
+		defer func() {
+			sd.browseActive = false
+			sd.refreshButtons(ctx)
+		}()
+
+		res, err := gdialog.OpenFile("Select Syzygy table file (.rtbw)")
+		if err != nil {
+			ctx.Logx.Errorf("error dialog: %v", err)
+			return
+		}
+		// browser: tables are read from disk on demand, so path is required
+		if res.Path == "" {
+			sd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("settings.syzygy.failed"), nil)
+			return
+		}
+		dir := filepath.Dir(res.Path)
+		ctx.Config.SyzygyPath = dir
+		if _, err := LoadTablebase(ctx); err != nil {
+			ctx.Config.SyzygyPath = ""
+			ctx.Logx.Errorf("no tablebases in %s: %v", dir, err)
+			sd.msg.ShowMessage(ctx.AssetsWorker.Lang().T("settings.syzygy.failed"), nil)
+		}
+	}()
+}
@@ -0,0 +1,461 @@
+package gdraw
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"evilchess/src/ui/gui/ghelper"
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// endgame trainer: the user (white) must mate against perfect defense of tables
+
+const (
+	trainerMinPlies = 11                     // start positions are not shorter than mate in 6
+	trainerReply    = 400 * time.Millisecond // pause before defender move
+)
+
+type GUIEndgameDrawer struct {
+	// layout
+	boardX, boardY int
+	boardSize      int
+	sqSize         int
+
+	selectedSq int // -1 (index 0..63)
+	hintSq     int // from square of perfect move, -1
+
+	// exercise
+	tables   *endgame.Tables
+	key      string
+	start    *base.Board
+	board    *base.Board
+	lastMove *base.Move
+	optimal  int // mate in moves of start position
+	played   int // moves of user
+	result   endgame.Result
+	finished bool
+	replyAt  time.Time // defender moves at this time (zero - not waiting)
+
+	// generation of tables
+	building bool
+	buildCh  chan error
+
+	loader *ghelper.CircularLoader
+
+	// buttons
+	msg         *ghelper.MessageBox
+	buttons     []*ghelper.Button
+	btnMatIdx   []int
+	btnRetryIdx int
+	btnHintIdx  int
+	btnBackIdx  int
+
+	prevMouseDown bool
+	lastTick      time.Time
+
+	// cache
+	sqLightImg   *ebiten.Image
+	sqDarkImg    *ebiten.Image
+	borderImg    *ebiten.Image
+	scaledPieces map[base.Piece]*ebiten.Image
+}
+
+func NewGUIEndgameDrawer(ctx *ghelper.GUIGameContext) *GUIEndgameDrawer {
+	td := &GUIEndgameDrawer{
+		selectedSq: -1,
+		hintSq:     -1,
+		tables:     EndgameTables(),
+		buildCh:    make(chan error, 1),
+		lastTick:   time.Now(),
+		msg:        &ghelper.MessageBox{},
+	}
+	td.boardSize = max(ctx.Config.WindowW-400, 320)
+	td.sqSize = td.boardSize / 8
+	td.boardX = (ctx.Config.WindowW - td.boardSize) / 2
+	td.boardY = (ctx.Config.WindowH-td.boardSize)/2 - 20
+	td.prepareCache(ctx)
+
+	x, y := 20, td.boardY
+	w, h := 160, 44
+	for _, key := range endgame.Basic {
+		var idx int
+		idx, td.buttons = ghelper.AppendButton(ctx, strings.Replace(key, "v", " vs ", 1), x, y, w, h, td.buttons)
+		td.btnMatIdx = append(td.btnMatIdx, idx)
+		y += h + 10
+	}
+	y += 20
+	td.btnRetryIdx, td.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("trainer.retry"), x, y, w, h, td.buttons)
+	y += h + 10
+	td.btnHintIdx, td.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("trainer.hint"), x, y, w, h, td.buttons)
+	y += h + 10
+	td.btnBackIdx, td.buttons = ghelper.AppendButton(ctx, ctx.AssetsWorker.Lang().T("button.back"), x, y, w, h, td.buttons)
+
+	td.loader = ghelper.NewCircularLoader(
+		ctx.Config.WindowW-50, 50, // x, y
+		30,  // radius
+		8,   // dotSize
+		1.8, // speedRPS
+		10,  // segments
+		ctx,
+	)
+	td.selectMaterial(ctx, endgame.Basic[0])
+	return td
+}
+
+// start exercise of material, tables are generated in background if missing
+func (td *GUIEndgameDrawer) selectMaterial(ctx *ghelper.GUIGameContext, key string) {
+	td.key = key
+	td.refreshButtons(ctx)
+	if td.tables.Has(key) {
+		td.newExercise(ctx)
+		return
+	}
+	td.board, td.start = nil, nil
+	td.building = true
+	td.loader.Active = true
+	go func() {
+		td.buildCh <- td.tables.Build(key, func(k string) {
+			ctx.Logx.Infof("generate endgame table %s", k)
+		})
+	}()
+}
+
+// random won position of white to move
+func (td *GUIEndgameDrawer) newExercise(ctx *ghelper.GUIGameContext) {
+	pieces := []base.Piece{}
+	w, b, _ := strings.Cut(td.key, "v")
+	for _, l := range w {
+		pieces = append(pieces, pieceOfLetter(l, true))
+	}
+	for _, l := range b {
+		pieces = append(pieces, pieceOfLetter(l, false))
+	}
+	for try := 0; try < 100000; try++ {
+		pos := &base.Board{WhiteToMove: true, EnPassant: -1, Fullmove: 1}
+		for _, p := range pieces {
+			for {
+				sq := rand.IntN(64)
+				r := sq / 8
+				if pos.Mailbox[sq] != base.EmptyPiece || ((p == base.WPawn || p == base.BPawn) && (r == 0 || r == 7)) {
+					continue
+				}
+				pos.Mailbox[sq] = p
+				break
+			}
+		}
+		res, ok := rules.EndgameResult(td.tables, pos)
+		if !ok || res.WDL != 1 || res.Plies < trainerMinPlies {
+			continue
+		}
+		td.start = pos
+		td.restart()
+		return
+	}
+	ctx.Logx.Errorf("no won position of %s", td.key)
+}
+
+func (td *GUIEndgameDrawer) restart() {
+	td.board = moves.CloneBoard(td.start)
+	td.result, _ = rules.EndgameResult(td.tables, td.board)
+	td.optimal = td.result.MateIn()
+	td.played = 0
+	td.finished = false
+	td.lastMove = nil
+	td.selectedSq, td.hintSq = -1, -1
+	td.replyAt = time.Time{}
+}
+
+func pieceOfLetter(l rune, white bool) base.Piece {
+	i := strings.IndexRune("KQRBNP", l)
+	w := []base.Piece{base.WKing, base.WQueen, base.WRook, base.WBishop, base.WKnight, base.WPawn}
+	b := []base.Piece{base.BKing, base.BQueen, base.BRook, base.BBishop, base.BKnight, base.BPawn}
+	if white {
+		return w[i]
+	}
+	return b[i]
+}
+
+func (td *GUIEndgameDrawer) Update(ctx *ghelper.GUIGameContext) (SceneType, error) {
+	now := time.Now()
+	dt := now.Sub(td.lastTick).Seconds()
+	td.lastTick = now
+	td.loader.Update(dt)
+
+	// tables are generated
+	select {
+	case err := <-td.buildCh:
+		td.building = false
+		td.loader.Active = false
+		if err != nil {
+			ctx.Logx.Errorf("error generate endgame tables: %v", err)
+			td.msg.ShowMessage(ctx.AssetsWorker.Lang().T("trainer.failed"), nil)
+		} else {
+			td.newExercise(ctx)
+		}
+	default:
+	}
+
+	// defender move
+	if !td.replyAt.IsZero() && now.After(td.replyAt) {
+		td.replyAt = time.Time{}
+		td.defend(ctx)
+	}
+
+	mx, my := ebiten.CursorPosition()
+	mouseDown := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	justPressed := mouseDown && !td.prevMouseDown
+	justReleased := !mouseDown && td.prevMouseDown
+	td.prevMouseDown = mouseDown
+
+	td.msg.Update(ctx, mx, my, justReleased)
+	td.msg.AnimateMessage()
+	if td.msg.IsOverlayed() || td.msg.Open {
+		return SceneNotChanged, nil
+	}
+
+	for i, b := range td.buttons {
+		clicked := b.HandleInput(mx, my, justPressed, !mouseDown && b.Pressed == true)
+		b.UpdateAnim(dt)
+		if !clicked {
+			continue
+		}
+		switch i {
+		case td.btnRetryIdx:
+			if td.start != nil && !td.building {
+				td.restart()
+			}
+		case td.btnHintIdx:
+			if td.board != nil && !td.finished && td.replyAt.IsZero() {
+				if mvs := rules.PerfectMoves(td.tables, td.board); len(mvs) > 0 {
+					td.hintSq = base.ConvPointToIndex(mvs[0].From)
+				}
+			}
+		case td.btnBackIdx:
+			return SceneMenu, nil
+		default:
+			for k, idx := range td.btnMatIdx {
+				if i == idx && !td.building {
+					td.selectMaterial(ctx, endgame.Basic[k])
+				}
+			}
+		}
+	}
+
+	// click-click moves of user
+	if justReleased && td.board != nil && !td.finished && td.replyAt.IsZero() && inBoard(mx, my, td.boardX, td.boardY, td.sqSize) {
+		sq := pixelToSquare(mx, my, td.boardX, td.boardY, td.sqSize, false)
+		pc := td.board.Mailbox[sq]
+		switch {
+		case pc != base.EmptyPiece && isWhitePiece(pc):
+			td.selectedSq = sq
+		case td.selectedSq >= 0:
+			mv := base.Move{
+				From:  base.ConvIndexToPoint(td.selectedSq),
+				To:    base.ConvIndexToPoint(sq),
+				Piece: td.board.Mailbox[td.selectedSq],
+			}
+			td.selectedSq = -1
+			if base.IsPawnPromotionFromIndices(&td.board.Mailbox, base.ConvPointToIndex(mv.From), sq) {
+				td.msg.ShowMessageWithChoices("", *GetWhiteChoices(ctx), func(idx int, v interface{}) {
+					mv.Piece = v.(base.Piece)
+					td.userMove(ctx, mv)
+				})
+			} else {
+				td.userMove(ctx, mv)
+			}
+		}
+	}
+
+	if ebiten.IsKeyPressed(ebiten.KeyEscape) {
+		return SceneMenu, nil
+	}
+	return SceneNotChanged, nil
+}
+
+func isWhitePiece(p base.Piece) bool {
+	switch p {
+	case base.WKing, base.WQueen, base.WRook, base.WBishop, base.WKnight, base.WPawn:
+		return true
+	}
+	return false
+}
+
+func (td *GUIEndgameDrawer) userMove(ctx *ghelper.GUIGameContext, mv base.Move) {
+	if !rules.IsLegalMove(td.board, mv) {
+		td.msg.ShowMessage(ctx.AssetsWorker.Lang().T("play.bad_move"), nil)
+		return
+	}
+	keeps := rules.KeepsEndgameResult(td.tables, td.board, mv)
+	td.apply(mv)
+	td.played++
+	td.hintSq = -1
+
+	switch rules.GameStatusOf(td.board) {
+	case base.Checkmate:
+		td.finished = true
+		td.msg.ShowMessage(fmt.Sprintf("%s\n%s: %d / %d", ctx.AssetsWorker.Lang().T("trainer.success"),
+			ctx.AssetsWorker.Lang().T("trainer.moves"), td.played, td.optimal), nil)
+		return
+	}
+	if !keeps {
+		td.finished = true
+		td.msg.ShowMessage(ctx.AssetsWorker.Lang().T("trainer.lost"), nil)
+		return
+	}
+	td.replyAt = time.Now().Add(trainerReply)
+}
+
+// perfect defense: the longest mate (random move of equal ones)
+func (td *GUIEndgameDrawer) defend(ctx *ghelper.GUIGameContext) {
+	mvs := rules.PerfectMoves(td.tables, td.board)
+	if len(mvs) == 0 {
+		td.finished = true
+		return
+	}
+	td.apply(mvs[rand.IntN(len(mvs))])
+	if st := rules.GameStatusOf(td.board); st == base.Draw || st == base.Stalemate {
+		// defender captured the last piece
+		td.finished = true
+		td.msg.ShowMessage(ctx.AssetsWorker.Lang().T("trainer.lost"), nil)
+	}
+}
+
+func (td *GUIEndgameDrawer) apply(mv base.Move) {
+	_ = moves.ApplyMove(td.board, mv)
+	td.lastMove = &mv
+	td.result, _ = rules.EndgameResult(td.tables, td.board)
+}
+
+func (td *GUIEndgameDrawer) Draw(ctx *ghelper.GUIGameContext, screen *ebiten.Image) {
+	screen.Fill(ctx.Theme.Bg)
+	td.loader.Draw(screen)
+
+	if td.borderImg != nil {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(td.boardX-4), float64(td.boardY-4))
+		screen.DrawImage(td.borderImg, op)
+	}
+	for r := 0; r < 8; r++ {
+		for f := 0; f < 8; f++ {
+			img := td.sqLightImg
+			if ((f + r) & 1) == 1 {
+				img = td.sqDarkImg
+			}
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Translate(float64(td.boardX+f*td.sqSize), float64(td.boardY+r*td.sqSize))
+			screen.DrawImage(img, op)
+		}
+	}
+
+	highlight := func(idx, pad int, col color.Color) {
+		sx, sy := td.indexToScreenXY(idx)
+		ghelper.EbitenutilDrawRectStroke(screen, float64(sx+pad), float64(sy+pad), float64(td.sqSize-2*pad), float64(td.sqSize-2*pad), 2, col)
+	}
+	if td.board != nil {
+		if td.lastMove != nil {
+			highlight(base.ConvPointToIndex(td.lastMove.From), 5, ctx.Theme.ButtonStroke)
+			highlight(base.ConvPointToIndex(td.lastMove.To), 5, ctx.Theme.ButtonStroke)
+		}
+		for idx, pc := range td.board.Mailbox {
+			if img := td.scaledPieces[pc]; pc != base.EmptyPiece && img != nil {
+				px, py := td.indexToScreenXY(idx)
+				op := &ebiten.DrawImageOptions{}
+				op.GeoM.Translate(float64(px), float64(py))
+				screen.DrawImage(img, op)
+			}
+		}
+		if td.selectedSq >= 0 {
+			highlight(td.selectedSq, 2, ctx.Theme.Accent)
+		}
+		if td.hintSq >= 0 {
+			highlight(td.hintSq, 2, ctx.Theme.Warning)
+		}
+	}
+
+	// right panel
+	x, y := td.boardX+td.boardSize+20, td.boardY+20
+	lang := ctx.AssetsWorker.Lang()
+	text.Draw(screen, lang.T("trainer.title"), ctx.AssetsWorker.Fonts().Pixel, td.boardX+24, td.boardY-8, ctx.Theme.MenuText)
+	lines := []string{strings.Replace(td.key, "v", " vs ", 1)}
+	if td.building {
+		lines = append(lines, lang.T("trainer.generating"))
+	} else if td.board != nil {
+		lines = append(lines,
+			fmt.Sprintf("%s: %d", lang.T("trainer.optimal"), td.optimal),
+			fmt.Sprintf("%s: %d", lang.T("trainer.moves"), td.played),
+		)
+		switch {
+		case td.result.WDL != 0 && td.result.Plies > 0:
+			lines = append(lines, fmt.Sprintf("%s %d", lang.T("analyzer.mate_in"), td.result.MateIn()))
+		case td.result.WDL == 0:
+			lines = append(lines, lang.T("play.draw"))
+		}
+	}
+	for _, l := range lines {
+		text.Draw(screen, l, ctx.AssetsWorker.Fonts().Normal, x, y, ctx.Theme.MenuText)
+		y += 28
+	}
+
+	for _, b := range td.buttons {
+		b.DrawAnimated(screen, ctx.AssetsWorker.Fonts().PixelLow, ctx.Theme)
+	}
+	td.msg.Draw(ctx, screen)
+
+	if ctx.Config.Debug {
+		ebitenutil.DebugPrint(screen, fmt.Sprintf("TPS: %0.2f", ebiten.ActualTPS()))
+	}
+}
+
+func (td *GUIEndgameDrawer) refreshButtons(ctx *ghelper.GUIGameContext) {
+	for k, idx := range td.btnMatIdx {
+		b := td.buttons[idx]
+		fill := ctx.Theme.ButtonFill
+		if endgame.Basic[k] == td.key {
+			fill = ctx.Theme.Accent
+		}
+		b.Image = ghelper.RenderRoundedRect(b.W, b.H, 12, fill, ctx.Theme.ButtonStroke, 3)
+	}
+}
+
+func (td *GUIEndgameDrawer) prepareCache(ctx *ghelper.GUIGameContext) {
+	td.sqLightImg = ebiten.NewImage(td.sqSize, td.sqSize)
+	td.sqLightImg.Fill(ctx.Theme.SquareLight)
+	td.sqDarkImg = ebiten.NewImage(td.sqSize, td.sqSize)
+	td.sqDarkImg.Fill(ctx.Theme.SquareDark)
+	td.borderImg = ghelper.RenderRoundedRect(td.boardSize+8, td.boardSize+8, 6, ctx.Theme.ButtonFill, ctx.Theme.ButtonStroke, 3)
+
+	td.scaledPieces = make(map[base.Piece]*ebiten.Image, 12)
+	for _, k := range []base.Piece{
+		base.WKing, base.BKing, base.WQueen, base.BQueen, base.WBishop, base.BBishop,
+		base.WKnight, base.BKnight, base.WRook, base.BRook, base.WPawn, base.BPawn,
+	} {
+		src := ctx.AssetsWorker.Piece(k)
+		if src == nil {
+			continue
+		}
+		dst := ebiten.NewImage(td.sqSize, td.sqSize)
+		iw, ih := src.Size()
+		s := math.Min(float64(td.sqSize)/float64(iw), float64(td.sqSize)/float64(ih))
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(s, s)
+		op.GeoM.Translate((float64(td.sqSize)-float64(iw)*s)/2, (float64(td.sqSize)-float64(ih)*s)/2)
+		op.Filter = ebiten.FilterLinear
+		dst.DrawImage(src, op)
+		td.scaledPieces[k] = dst
+	}
+}
+
+func (td *GUIEndgameDrawer) indexToScreenXY(idx int) (int, int) {
+	f, r := indexToFileRank(idx)
+	return td.boardX + f*td.sqSize, td.boardY + (7-r)*td.sqSize
+}
@@ -24,6 +24,7 @@ type GUIGameContext struct {
 	Theme        gbase.Palette
 	Logx         logx.Logger
 	IsReady      bool
+	NetHost      bool // network game is hosted (false - joined)
 }
 
 func NewGUIGameContext(b *chesslib.GameBuilder, a *GUIAssetsWorker, c *gconf.Config, l logx.Logger) *GUIGameContext {
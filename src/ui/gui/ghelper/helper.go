@@ -29,6 +29,30 @@ func EbitenutilDrawRect(screen *ebiten.Image, x, y, w, h float64, c color.RGBA)
 	screen.DrawImage(img, op)
 }
 
+// graph of values 0..100 (win probability of white): area under the curve is white
+func RenderEvalGraph(w, h int, values []float64, white, black, line color.RGBA) *ebiten.Image {
+	dc := gg.NewContext(w, h)
+	dc.SetRGBA255(int(black.R), int(black.G), int(black.B), int(black.A))
+	dc.DrawRectangle(0, 0, float64(w), float64(h))
+	dc.Fill()
+	if n := len(values); n > 1 {
+		dc.MoveTo(0, float64(h))
+		for i, v := range values {
+			dc.LineTo(float64(i)*float64(w)/float64(n-1), float64(h)*(1-v/100))
+		}
+		dc.LineTo(float64(w), float64(h))
+		dc.ClosePath()
+		dc.SetRGBA255(int(white.R), int(white.G), int(white.B), int(white.A))
+		dc.Fill()
+	}
+	// equal line
+	dc.SetRGBA255(int(line.R), int(line.G), int(line.B), int(line.A))
+	dc.SetLineWidth(1)
+	dc.DrawLine(0, float64(h)/2, float64(w), float64(h)/2)
+	dc.Stroke()
+	return ebiten.NewImageFromImage(dc.Image())
+}
+
 func PointInRect(px, py, rx, ry, rw, rh int) bool {
 	return px >= rx && px < rx+rw && py >= ry && py < ry+rh
 }
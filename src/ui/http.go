@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"context"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/engine/syzygy"
+	"evilchess/src/chesslib/httpapi"
+	"evilchess/src/chesslib/logic/endgame"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/urfave/cli/v3"
+)
+
+// engines of games (flags weights, syzygy, endgame), weights and tables are
+// loaded once and shared
+func engineFactory(c *cli.Command) (func() engine.Engine, error) {
+	var err error
+	w := myengine.DefaultWeights()
+	if path := c.String("weights"); path != "" {
+		if w, err = myengine.LoadWeights(path); err != nil {
+			return nil, err
+		}
+	}
+	var tb *syzygy.Tablebase
+	if path := c.String("syzygy"); path != "" {
+		if tb, err = syzygy.Open(path); err != nil {
+			return nil, err
+		}
+	}
+	var tables *endgame.Tables
+	if dir := c.String("endgame"); dir != "" {
+		tables = endgame.NewTables(dir)
+	}
+	return func() engine.Engine {
+		e := myengine.NewEvilEngine()
+		e.SetWeights(w)
+		if tb != nil {
+			e.SetTablebase(tb)
+		}
+		if tables != nil {
+			e.SetEndgameTables(tables)
+		}
+		return e
+	}, nil
+}
+
+// HTTP/WebSocket game API with internal engine until interrupt
+func RunHTTP(ctx context.Context, c *cli.Command) error {
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	logger := GetLogger(file, c)
+
+	newEngine, err := engineFactory(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	srv := httpapi.NewServer(logger, newEngine)
+	srv.Static = c.String("static")
+	if d := c.Duration("analysis-time"); d > 0 {
+		srv.AnalysisTime = d
+	}
+	fmt.Printf("serving http api on %s (Ctrl+C to stop)\n", c.String("addr"))
+	return srv.ListenAndServe(ctx, c.String("addr"))
+}
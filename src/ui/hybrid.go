@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"context"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/aiengine"
+	"evilchess/src/chesslib/engine/arena"
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// games of hybrid engine against both parents (search only and model only)
+func RunHybridBench(ctx context.Context, c *cli.Command) error {
+	model, err := aiengine.LoadModel(c.String("model"))
+	if err != nil {
+		return fmt.Errorf("error load model: %v", err)
+	}
+	weights := myengine.DefaultWeights()
+	if path := c.String("weights"); path != "" {
+		if weights, err = myengine.LoadWeights(path); err != nil {
+			return err
+		}
+	}
+
+	opts := myengine.DefaultHybridOptions()
+	opts.Rating = int(c.Int("rating"))
+	opts.ValueBlend = c.Float("blend")
+	opts.PolicyPlies = int(c.Int("policy-plies"))
+	opts.RootTopN = int(c.Int("topn"))
+	opts.LeafPlies = int(c.Int("leaf-plies"))
+
+	params := engine.SearchParams{
+		MaxDepth:  int(c.Int("depth")),
+		MaxTimeMs: int64(c.Int("movetime")),
+		Threads:   int(c.Int("threads")),
+	}
+	games := int(c.Int("games"))
+	// every opening is played twice with swapped colors
+	var openings []arena.Opening
+	if path := c.String("openings"); path != "" {
+		if openings, err = arena.LoadOpenings(path, int(c.Int("plies"))); err != nil {
+			return err
+		}
+	}
+
+	newHybrid := func() engine.Engine {
+		e := myengine.NewHybridEngine(model, opts)
+		e.SetWeights(weights)
+		return e
+	}
+	newSearch := func() engine.Engine {
+		e := myengine.NewEvilEngine()
+		e.SetWeights(weights)
+		return e
+	}
+	newModel := func() engine.Engine {
+		e := aiengine.NewAIEngine(model)
+		e.SetRating(opts.Rating)
+		return e
+	}
+
+	fmt.Printf("hybrid: blend %.2f, leaf plies %d, policy plies %d, top-N %d, rating %d, openings %d\n",
+		opts.ValueBlend, opts.LeafPlies, opts.PolicyPlies, opts.RootTopN, opts.Rating, len(openings))
+	for _, opp := range []struct {
+		name string
+		new  func() engine.Engine
+	}{
+		{"EvilEngine", newSearch},
+		{"AI Model", newModel},
+	} {
+		var win, draw, loss int
+		for g := 0; g < games; g++ {
+			hybrid, other := newHybrid(), opp.new()
+			// colors alternate every game, pair of games has the same opening
+			hybridWhite := g%2 == 0
+			white, black, side := hybrid, other, "white"
+			if !hybridWhite {
+				white, black, side = other, hybrid, "black"
+			}
+			gopts := arena.GameOptions{White: params, Black: params}
+			if len(openings) > 0 {
+				op := openings[(g/2)%len(openings)]
+				gopts.StartFEN, gopts.Opening = op.FEN, op.Moves
+			}
+			res, err := arena.PlayGame(ctx, white, black, gopts)
+			hybrid.Close()
+			other.Close()
+			if err != nil {
+				return err
+			}
+
+			outcome := "="
+			switch {
+			case res.Result == convpgn.PGNStatusDraw:
+				draw++
+			case (res.Result == convpgn.PGNStatusWW) == hybridWhite:
+				win++
+				outcome = "+"
+			default:
+				loss++
+				outcome = "-"
+			}
+			fmt.Printf("vs %s game %d (hybrid %s): %s %s, %d plies\n", opp.name, g+1, side,
+				convpgn.ConvPGNStatusToString(res.Result), res.Reason, res.Plies)
+			if c.Bool("moves") {
+				fmt.Printf("  %s %s\n", outcome, strings.Join(res.SAN, " "))
+			}
+		}
+		if games > 0 {
+			score := (float64(win) + float64(draw)/2) / float64(games) * 100
+			fmt.Printf("hybrid vs %s: +%d =%d -%d (%.1f%%)\n\n", opp.name, win, draw, loss, score)
+		}
+	}
+	return nil
+}
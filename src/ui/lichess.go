@@ -0,0 +1,238 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"evilchess/src/chesslib/clock"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/lichess"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// local Lichess server (accounts of flags) for bots and clients until interrupt
+func RunLichessMock(ctx context.Context, c *cli.Command) error {
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	logger := GetLogger(file, c)
+
+	srv := lichess.NewMockServer(logger)
+	if d := c.Duration("claim-win"); d > 0 {
+		srv.ClaimWin = d
+	}
+	// name:token[:bot]
+	for _, u := range c.StringSlice("user") {
+		parts := strings.Split(u, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid user %q (name:token[:bot])", u)
+		}
+		bot := len(parts) == 3 && parts[2] == "bot"
+		if len(parts) == 3 && !bot {
+			return fmt.Errorf("invalid user %q (name:token[:bot])", u)
+		}
+		if err := srv.AddUser(parts[0], parts[1], bot); err != nil {
+			return err
+		}
+		fmt.Printf("user %s (bot: %v)\n", parts[0], bot)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	fmt.Printf("serving lichess mock on %s (Ctrl+C to stop)\n", c.String("addr"))
+	return srv.ListenAndServe(ctx, c.String("addr"))
+}
+
+// internal engine plays games of account until interrupt
+func RunLichessBot(ctx context.Context, c *cli.Command) error {
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	logger := GetLogger(file, c)
+
+	newEngine, err := engineFactory(c)
+	if err != nil {
+		return err
+	}
+	lvl := c.Int("strength")
+	if lvl < int(engine.LevelOne) || lvl >= int(engine.LevelLast) {
+		return fmt.Errorf("invalid strength %d (0-%d)", lvl, int(engine.LevelLast)-1)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	client, acc, err := lichessClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	if c.Bool("upgrade") && !acc.IsBot() {
+		if err := client.UpgradeToBot(ctx); err != nil {
+			return err
+		}
+		client.Bot = true
+		fmt.Printf("account %s is bot now\n", acc.Username)
+	}
+	// challenge of bot starts the game when the opponent accepts it
+	if user := c.String("challenge"); user != "" {
+		req, err := challengeRequest(c)
+		if err != nil {
+			return err
+		}
+		ch, err := client.Challenge(ctx, user, req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("challenge %s sent to %s\n", ch.ID, user)
+	}
+
+	bot := lichess.NewBot(logger, client, newEngine)
+	bot.Level = engine.LevelAnalyze(lvl)
+	bot.Threads = c.Int("threads")
+	bot.MaxGames = c.Int("max-games")
+	bot.Greeting = c.String("greeting")
+	fmt.Printf("bot %s plays on %s (Ctrl+C to stop)\n", acc.Username, c.String("url"))
+	return bot.Run(ctx)
+}
+
+// challenge of user by account
+func RunLichessChallenge(ctx context.Context, c *cli.Command) error {
+	user := c.Args().First()
+	if user == "" {
+		return errors.New("no user to challenge")
+	}
+	req, err := challengeRequest(c)
+	if err != nil {
+		return err
+	}
+	client, _, err := lichessClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	ch, err := client.Challenge(ctx, user, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("challenge %s: %s %s (%s)\n", ch.ID, ch.Speed, ch.TimeControl.Show, ch.Status)
+	return nil
+}
+
+// running games of account
+func RunLichessGames(ctx context.Context, c *cli.Command) error {
+	client, _, err := lichessClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	games, err := client.Playing(ctx)
+	if err != nil {
+		return err
+	}
+	if len(games) == 0 {
+		fmt.Println("no games")
+	}
+	for _, g := range games {
+		turn := ""
+		if g.IsMyTurn {
+			turn = " (your turn)"
+		}
+		fmt.Printf("%s %s vs %s %s%s\n  %s\n", g.GameID, g.Color, g.Opponent.Username, g.Speed, turn, g.FEN)
+	}
+	return nil
+}
+
+// move (SAN or UCI) of account in game
+func RunLichessMove(ctx context.Context, c *cli.Command) error {
+	id, move := c.Args().Get(0), c.Args().Get(1)
+	if id == "" || move == "" {
+		return errors.New("game id and move are required")
+	}
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	logger := GetLogger(file, c)
+
+	client, acc, err := lichessClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	// position of game is the first event of its stream
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := client.StreamGame(sctx, id)
+	if err != nil {
+		return err
+	}
+	full, ok := <-events
+	if !ok {
+		return errors.New("game stream is closed")
+	}
+	g, err := lichess.NewGame(logger, &full, acc.ID)
+	if err != nil {
+		return err
+	}
+	if g.Over() {
+		return fmt.Errorf("game is over: %s", g.State.Status)
+	}
+	if !g.MyTurn() {
+		return errors.New("not your turn")
+	}
+	uci, err := g.ParseMove(move)
+	if err != nil {
+		return err
+	}
+	if err := client.Move(ctx, id, uci, c.Bool("offer-draw")); err != nil {
+		return err
+	}
+	fmt.Printf("move %s played\n", uci)
+	return nil
+}
+
+// client of flags url and token, bot endpoints are chosen by account
+func lichessClient(ctx context.Context, c *cli.Command) (*lichess.Client, *lichess.Account, error) {
+	if c.String("token") == "" {
+		return nil, nil, errors.New("no API token (--token or LICHESS_TOKEN)")
+	}
+	client := lichess.NewClient(c.String("url"), c.String("token"))
+	acc, err := client.Account(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, acc, nil
+}
+
+// challenge of flags tc (PGN time control, e.g. 180+2), days, color, rated, fen
+func challengeRequest(c *cli.Command) (lichess.ChallengeRequest, error) {
+	req := lichess.ChallengeRequest{
+		Rated: c.Bool("rated"),
+		Days:  c.Int("days"),
+		Color: c.String("color"),
+		FEN:   c.String("fen"),
+	}
+	if req.Days > 0 {
+		return req, nil
+	}
+	ctl, err := clock.Parse(c.String("tc"))
+	if err != nil {
+		return req, err
+	}
+	if len(ctl.Stages) == 0 {
+		return req, nil
+	}
+	if len(ctl.Stages) != 1 || ctl.Stages[0].Moves != 0 || ctl.Mode != clock.Fischer {
+		return req, fmt.Errorf("time control %q: lichess has base time and increment only", c.String("tc"))
+	}
+	st := ctl.Stages[0]
+	req.Limit = int(st.Time / time.Second)
+	req.Increment = int(st.Bonus / time.Second)
+	return req, nil
+}
@@ -0,0 +1,438 @@
+package ui
+
+import (
+	"context"
+	"evilchess/src/chesslib/engine"
+	"evilchess/src/chesslib/engine/aiengine"
+	"evilchess/src/chesslib/engine/arena"
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/engine/skill"
+	"evilchess/src/chesslib/engine/syzygy"
+	"evilchess/src/chesslib/engine/uci"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"evilchess/src/chesslib/logic/endgame"
+	"evilchess/src/logx"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v3"
+)
+
+// --------------------------------------------------
+// Engine specs of matches
+// --------------------------------------------------
+// options are separated by spaces (commas split values of flags):
+// "name=Evil type=internal depth=6 tc=10+0.1 threads=2 weights=w.json elo=1500 syzygy=dir endgame=dir"
+// "name=NoLMR type=internal features=nolmr+nonullmove" (disabled search heuristics)
+// "name=SF type=uci cmd=path/stockfish arg=--flag option.Hash=64"
+// "name=Model type=model model=model.json rating=1800"
+// "name=Hybrid type=hybrid model=model.json blend=0.3 leaf-plies=4"
+
+type engineSpec struct {
+	name string
+	kind string
+	opts map[string]string
+}
+
+func parseEngineSpec(s string) (engineSpec, error) {
+	spec := engineSpec{kind: "internal", opts: map[string]string{}}
+	for _, kv := range strings.Fields(s) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return spec, fmt.Errorf("invalid option %q of engine", kv)
+		}
+		switch k {
+		case "name":
+			spec.name = v
+		case "type":
+			spec.kind = v
+		default:
+			spec.opts[k] = v
+		}
+	}
+	if spec.name == "" {
+		spec.name = spec.kind
+		if cmd := spec.opts["cmd"]; cmd != "" {
+			spec.name = cmd
+		}
+	}
+	return spec, nil
+}
+
+func (s engineSpec) int(key string) (int, error) {
+	v, ok := s.opts[key]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid %s %q", s.name, key, v)
+	}
+	return n, nil
+}
+
+// resources shared by engines of all games
+type matchResources struct {
+	logger logx.Logger
+
+	mu      sync.Mutex
+	models  map[string]*aiengine.Model
+	syzygy  map[string]*syzygy.Tablebase
+	endgame map[string]*endgame.Tables
+}
+
+func (r *matchResources) model(path string) (*aiengine.Model, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.models[path]; ok {
+		return m, nil
+	}
+	m, err := aiengine.LoadModel(path)
+	if err != nil {
+		return nil, fmt.Errorf("error load model: %v", err)
+	}
+	r.models[path] = m
+	return m, nil
+}
+
+func (r *matchResources) tablebase(path string) (*syzygy.Tablebase, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tb, ok := r.syzygy[path]; ok {
+		return tb, nil
+	}
+	tb, err := syzygy.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r.syzygy[path] = tb
+	return tb, nil
+}
+
+func (r *matchResources) tables(dir string) *endgame.Tables {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.endgame[dir]; ok {
+		return t
+	}
+	t := endgame.NewTables(dir)
+	r.endgame[dir] = t
+	return t
+}
+
+// player of tournament by spec, tc - default time control
+func (r *matchResources) player(spec engineSpec, tc arena.TimeControl) (arena.Player, error) {
+	p := arena.Player{Name: spec.name, TC: tc}
+	var err error
+	if v, ok := spec.opts["tc"]; ok {
+		if p.TC, err = arena.ParseTimeControl(v); err != nil {
+			return p, fmt.Errorf("%s: %v", spec.name, err)
+		}
+	}
+	if p.Params.Threads, err = spec.int("threads"); err != nil {
+		return p, err
+	}
+	if p.Params.MaxDepth, err = spec.int("depth"); err != nil {
+		return p, err
+	}
+	elo, err := spec.int("elo")
+	if err != nil {
+		return p, err
+	}
+
+	var newEngine func() (engine.Engine, error)
+	switch spec.kind {
+	case "internal", "hybrid":
+		weights := myengine.DefaultWeights()
+		if path := spec.opts["weights"]; path != "" {
+			if weights, err = myengine.LoadWeights(path); err != nil {
+				return p, fmt.Errorf("%s: %v", spec.name, err)
+			}
+		}
+		var tb *syzygy.Tablebase
+		if path := spec.opts["syzygy"]; path != "" {
+			if tb, err = r.tablebase(path); err != nil {
+				return p, fmt.Errorf("%s: %v", spec.name, err)
+			}
+		}
+		var eg *endgame.Tables
+		if dir := spec.opts["endgame"]; dir != "" {
+			eg = r.tables(dir)
+		}
+		features := myengine.DefaultFeatures()
+		if v, ok := spec.opts["features"]; ok {
+			if features, err = myengine.ParseFeatures(v); err != nil {
+				return p, fmt.Errorf("%s: %v", spec.name, err)
+			}
+		}
+		var model *aiengine.Model
+		opts := myengine.DefaultHybridOptions()
+		if spec.kind == "hybrid" {
+			if model, err = r.model(modelPath(spec)); err != nil {
+				return p, fmt.Errorf("%s: %v", spec.name, err)
+			}
+			if v, ok := spec.opts["blend"]; ok {
+				if opts.ValueBlend, err = strconv.ParseFloat(v, 64); err != nil {
+					return p, fmt.Errorf("%s: invalid blend %q", spec.name, v)
+				}
+			}
+			if v, ok := spec.opts["rating"]; ok {
+				if opts.Rating, err = strconv.Atoi(v); err != nil {
+					return p, fmt.Errorf("%s: invalid rating %q", spec.name, v)
+				}
+			}
+			if v, ok := spec.opts["leaf-plies"]; ok {
+				if opts.LeafPlies, err = strconv.Atoi(v); err != nil {
+					return p, fmt.Errorf("%s: invalid leaf-plies %q", spec.name, v)
+				}
+			}
+		}
+		newEngine = func() (engine.Engine, error) {
+			e := myengine.NewEvilEngine()
+			if model != nil {
+				e = myengine.NewHybridEngine(model, opts)
+			}
+			e.SetWeights(weights)
+			e.SetTablebase(tb)
+			e.SetEndgameTables(eg)
+			e.SetFeatures(features)
+			return e, e.Init()
+		}
+	case "uci":
+		cmd := spec.opts["cmd"]
+		if cmd == "" {
+			return p, fmt.Errorf("%s: cmd of UCI engine is not set", spec.name)
+		}
+		var args []string
+		if v := spec.opts["arg"]; v != "" {
+			args = []string{v}
+		}
+		newEngine = func() (engine.Engine, error) {
+			e := uci.NewUCIExec(r.logger, cmd, args...)
+			for k, v := range spec.opts {
+				if name, ok := strings.CutPrefix(k, "option."); ok {
+					_ = e.SetOption(name, v)
+				}
+			}
+			if path := spec.opts["syzygy"]; path != "" {
+				_ = e.SetOption("SyzygyPath", path)
+			}
+			if err := e.Init(); err != nil {
+				e.Close()
+				return nil, err
+			}
+			return e, nil
+		}
+	case "model":
+		model, err := r.model(modelPath(spec))
+		if err != nil {
+			return p, fmt.Errorf("%s: %v", spec.name, err)
+		}
+		rating := aiengine.DefaultRating
+		if v, ok := spec.opts["rating"]; ok {
+			if rating, err = strconv.Atoi(v); err != nil {
+				return p, fmt.Errorf("%s: invalid rating %q", spec.name, v)
+			}
+		}
+		newEngine = func() (engine.Engine, error) {
+			e := aiengine.NewAIEngine(model)
+			e.SetRating(rating)
+			return e, e.Init()
+		}
+	default:
+		return p, fmt.Errorf("%s: unknown engine type %q (internal, uci, model, hybrid)", spec.name, spec.kind)
+	}
+
+	p.New = newEngine
+	if elo > 0 {
+		p.New = func() (engine.Engine, error) {
+			e, err := newEngine()
+			if err != nil {
+				return nil, err
+			}
+			return skill.ForElo(e, elo), nil
+		}
+	}
+	return p, nil
+}
+
+func modelPath(spec engineSpec) string {
+	if path := spec.opts["model"]; path != "" {
+		return path
+	}
+	return aiengine.DefaultModelFile
+}
+
+// --------------------------------------------------
+// Match command
+// --------------------------------------------------
+
+// engines of --engine flags with shared resources, tc - default time control
+func matchPlayers(c *cli.Command, res *matchResources, tc arena.TimeControl) ([]arena.Player, error) {
+	var players []arena.Player
+	for _, s := range c.StringSlice("engine") {
+		spec, err := parseEngineSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		p, err := res.player(spec, tc)
+		if err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, nil
+}
+
+func newMatchResources(logger logx.Logger) *matchResources {
+	return &matchResources{
+		logger:  logger,
+		models:  map[string]*aiengine.Model{},
+		syzygy:  map[string]*syzygy.Tablebase{},
+		endgame: map[string]*endgame.Tables{},
+	}
+}
+
+// options of games common to match and sprt: openings, adjudication, concurrency
+func matchOptions(c *cli.Command, res *matchResources) (arena.TournamentOptions, error) {
+	opts := arena.TournamentOptions{
+		MaxPlies:    int(c.Int("maxplies")),
+		Concurrency: int(c.Int("concurrency")),
+		Event:       c.String("event"),
+	}
+	if path := c.String("openings"); path != "" {
+		var err error
+		if opts.Openings, err = arena.LoadOpenings(path, int(c.Int("plies"))); err != nil {
+			return opts, err
+		}
+		if c.Bool("shuffle") {
+			rand.Shuffle(len(opts.Openings), func(i, j int) {
+				opts.Openings[i], opts.Openings[j] = opts.Openings[j], opts.Openings[i]
+			})
+		}
+	}
+	return opts, parseAdjudication(c, res, &opts.Adjudication)
+}
+
+// PGN file of games (appended), nil if path is empty
+func openPGNOut(path string) (*os.File, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+func writeGamePGN(out *os.File, g *arena.Game, players []arena.Player, event string) {
+	if out == nil {
+		return
+	}
+	if err := convpgn.WritePGN(out, g.PGN(players, event)); err != nil {
+		fmt.Printf("error write PGN: %v\n", err)
+	}
+	fmt.Fprintln(out)
+}
+
+// tournament of engines with PGN of games and crosstable
+func RunMatch(ctx context.Context, c *cli.Command) error {
+	if len(c.StringSlice("engine")) < 2 {
+		return fmt.Errorf("at least 2 engines are needed (--engine)")
+	}
+	tc, err := arena.ParseTimeControl(c.String("tc"))
+	if err != nil {
+		return err
+	}
+	format, err := arena.ParseFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	res := newMatchResources(GetLogger(file, c))
+	players, err := matchPlayers(c, res, tc)
+	if err != nil {
+		return err
+	}
+	opts, err := matchOptions(c, res)
+	if err != nil {
+		return err
+	}
+	opts.Format = format
+	opts.Games = int(c.Int("games"))
+	opts.Repeat = c.Bool("repeat")
+
+	out, err := openPGNOut(c.String("out"))
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		defer out.Close()
+	}
+
+	// Ctrl+C stops games and prints crosstable of finished ones
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	total, finished := len(arena.Schedule(len(players), opts)), 0
+	fmt.Printf("%s: %d engines, %d games, time control %s\n", opts.Event, len(players), total, tc)
+	ct, err := arena.RunTournament(ctx, players, opts, func(g *arena.Game, ct *arena.Crosstable) {
+		finished++
+		white, black := players[g.White].Name, players[g.Black].Name
+		if g.Err != nil {
+			fmt.Printf("game %d/%d %s vs %s: error %v\n", g.Number, total, white, black, g.Err)
+			return
+		}
+		fmt.Printf("game %d/%d %s vs %s: %s {%s}\n", g.Number, total, white, black,
+			convpgn.ConvPGNStatusToString(g.Result.Result), g.Result.Reason)
+		writeGamePGN(out, g, players, opts.Event)
+		if every := int(c.Int("ratinginterval")); every > 0 && finished%every == 0 {
+			fmt.Println()
+			ct.Write(os.Stdout)
+			fmt.Println()
+		}
+	})
+	if ct != nil {
+		fmt.Println()
+		ct.Write(os.Stdout)
+	}
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func parseAdjudication(c *cli.Command, res *matchResources, a *arena.Adjudication) error {
+	if s := c.String("draw"); s != "" {
+		number, count, score, err := arena.ParseAdjudicationRule(s)
+		if err != nil {
+			return fmt.Errorf("draw adjudication: %v", err)
+		}
+		a.DrawMoveNumber, a.DrawMoveCount, a.DrawScore = number, count, score
+	}
+	if s := c.String("resign"); s != "" {
+		_, count, score, err := arena.ParseAdjudicationRule(s)
+		if err != nil {
+			return fmt.Errorf("resign adjudication: %v", err)
+		}
+		a.ResignMoveCount, a.ResignScore = count, score
+	}
+	if path := c.String("syzygy"); path != "" {
+		tb, err := res.tablebase(path)
+		if err != nil {
+			return err
+		}
+		a.Syzygy = tb
+	}
+	if dir := c.String("endgame"); dir != "" {
+		a.Endgame = res.tables(dir)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/motifs"
+	"evilchess/src/chesslib/logic/rules"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// print tactical motifs of position and of moves (SAN or UCI) played from it
+func RunMotifs(c *cli.Command) error {
+	fen := c.String("fen")
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return fmt.Errorf("parse FEN: %v", err)
+	}
+
+	fmt.Println("Position:")
+	printMotifs(motifs.Position(b))
+
+	nb := moves.CloneBoard(b)
+	var line []base.Move
+	var san []string
+	for _, s := range strings.Fields(c.String("move")) {
+		mv, err := moves.SANToMove(nb, s)
+		if err != nil {
+			if mv, err = moves.UCIToMove(nb, s); err != nil {
+				return fmt.Errorf("invalid move %s", s)
+			}
+		}
+		if !rules.IsLegalMove(nb, mv) {
+			return fmt.Errorf("illegal move %s", s)
+		}
+		san = append(san, moves.MoveToSAN(nb, mv))
+		line = append(line, mv)
+		_ = moves.ApplyMove(nb, mv)
+	}
+	found, err := motifs.DetectLine(b, line)
+	if err != nil {
+		return err
+	}
+	for i, s := range san {
+		fmt.Printf("%d. %s:\n", i+1, s)
+		var list []motifs.Motif
+		for _, m := range found {
+			if m.Ply == i {
+				list = append(list, m)
+			}
+		}
+		printMotifs(list)
+	}
+	if len(found) > 0 {
+		fmt.Printf("Themes: %s\n", strings.Join(motifs.Themes(found), ", "))
+	}
+	return nil
+}
+
+func printMotifs(list []motifs.Motif) {
+	if len(list) == 0 {
+		fmt.Println("  -")
+	}
+	for _, m := range list {
+		fmt.Printf("  %-16s %s\n", m.Kind, m)
+	}
+}
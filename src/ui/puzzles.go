@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"evilchess/src/chesslib/engine/puzzle"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	clic "evilchess/src/ui/cli"
+	"evilchess/src/ui/gui/gbase/gassets"
+	"evilchess/src/ui/gui/gbase/gconf"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// find puzzles in games of PGN files and save them as JSON or EPD set
+func RunPuzzlesExtract(ctx context.Context, c *cli.Command) error {
+	paths := c.Args().Slice()
+	if len(paths) == 0 {
+		return fmt.Errorf("PGN files are not set")
+	}
+	var games []*convpgn.PGNGame
+	for _, path := range paths {
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		list, err := convpgn.ParseAll(in)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("error read %s: %v", path, err)
+		}
+		games = append(games, list...)
+	}
+
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	e, params, err := analysisEngine(c, GetLogger(file, c))
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+	opts := puzzle.Options{
+		Params:   params,
+		MaxMoves: int(c.Int("max-moves")),
+		MinPly:   int(c.Int("min-ply")),
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	var found []puzzle.Puzzle
+	seen := map[string]bool{}
+	for i, pg := range games {
+		label := fmt.Sprintf("game %d/%d", i+1, len(games))
+		opts.Progress = func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d positions, %d puzzles", label, done, total, len(found))
+		}
+		h, err := gameHistory(pg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: error %v\n", label, err)
+			continue
+		}
+		list, err := puzzle.Extract(ctx, e, h.Moves(), opts)
+		for _, p := range list {
+			if seen[p.ID] {
+				continue
+			}
+			seen[p.ID] = true
+			p.Game = gameName(pg)
+			found = append(found, p)
+		}
+		fmt.Fprintln(os.Stderr)
+		if ctx.Err() != nil {
+			// puzzles found before interrupt are saved
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: error %v\n", label, err)
+		}
+	}
+
+	out := c.String("out")
+	if err := puzzle.Save(out, found); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d puzzles saved to %s\n", len(found), out)
+	return nil
+}
+
+// "White - Black, Event, Date" of tags of game
+func gameName(pg *convpgn.PGNGame) string {
+	name := pg.Headers[convpgn.PGNHeaderWhite] + " - " + pg.Headers[convpgn.PGNHeaderBlack]
+	for _, h := range []convpgn.PGNHeader{convpgn.PGNHeaderEvent, convpgn.PGNHeaderDate} {
+		if v := pg.Headers[h]; v != "" && !strings.Contains(v, "?") {
+			name += ", " + v
+		}
+	}
+	return name
+}
+
+// solve puzzles of set in terminal, rating is shared with GUI (evilchess.json)
+func RunPuzzle(c *cli.Command) error {
+	var list []puzzle.Puzzle
+	var err error
+	if path := c.String("set"); path != "" {
+		list, err = puzzle.Load(path)
+	} else {
+		var data []byte
+		if data, err = gassets.ReadAsset("assets/puzzles/puzzles.json"); err == nil {
+			list, err = puzzle.ReadSet(bytes.NewReader(data), "puzzles.json")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	conf, err := gconf.NewGUIConfig()
+	if err != nil {
+		return err
+	}
+	return clic.NewPuzzleCLI(list, &conf.Puzzles, conf.Save).Run()
+}
@@ -0,0 +1,30 @@
+package ui
+
+import (
+	"context"
+	"evilchess/src/chesslib/netplay"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/urfave/cli/v3"
+)
+
+// server of network games (GUI "Join Game" and other clients) until interrupt
+func RunServe(ctx context.Context, c *cli.Command) error {
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	logger := GetLogger(file, c)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	srv := netplay.NewServer(logger)
+	if d := c.Duration("abandon"); d > 0 {
+		srv.Abandon = d
+	}
+	fmt.Printf("serving network games on %s (Ctrl+C to stop)\n", c.String("addr"))
+	return srv.ListenAndServe(ctx, c.String("addr"))
+}
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"context"
+	"evilchess/src/chesslib/engine/arena"
+	"evilchess/src/chesslib/logic/convert/convpgn"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/urfave/cli/v3"
+)
+
+// points of player in game (-1 - no result)
+func gamePoints(g *arena.Game, player int) float64 {
+	switch g.Result.Result {
+	case convpgn.PGNStatusDraw:
+		return 0.5
+	case convpgn.PGNStatusWW:
+		if g.White == player {
+			return 1
+		}
+		return 0
+	case convpgn.PGNStatusBW:
+		if g.Black == player {
+			return 1
+		}
+		return 0
+	}
+	return -1
+}
+
+// game pairs of test engine (first) against base engine (second) until SPRT decision
+func RunSPRT(ctx context.Context, c *cli.Command) error {
+	if len(c.StringSlice("engine")) != 2 {
+		return fmt.Errorf("2 engines are needed: test and base (--engine)")
+	}
+	test := arena.SPRT{
+		Elo0:  c.Float("elo0"),
+		Elo1:  c.Float("elo1"),
+		Alpha: c.Float("alpha"),
+		Beta:  c.Float("beta"),
+	}
+	if err := test.Validate(); err != nil {
+		return err
+	}
+	tc, err := arena.ParseTimeControl(c.String("tc"))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error open logfile: %v", err)
+	}
+	defer file.Close()
+	res := newMatchResources(GetLogger(file, c))
+	players, err := matchPlayers(c, res, tc)
+	if err != nil {
+		return err
+	}
+	opts, err := matchOptions(c, res)
+	if err != nil {
+		return err
+	}
+	if len(opts.Openings) == 0 {
+		fmt.Println("warning: no openings, all pairs start from the initial position")
+	}
+	// pair: the same opening with swapped colors
+	opts.Format, opts.Repeat = arena.RoundRobin, true
+	opts.Games = int(c.Int("max-games")) / 2 * 2
+
+	out, err := openPGNOut(c.String("out"))
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		defer out.Close()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	lower, upper := test.Bounds()
+	fmt.Printf("SPRT %s vs %s: elo0 %g, elo1 %g, alpha %g, beta %g, LLR bounds [%.2f, %.2f], time control %s\n",
+		players[0].Name, players[1].Name, test.Elo0, test.Elo1, test.Alpha, test.Beta, lower, upper, tc)
+
+	var penta arena.Pentanomial
+	var wdl arena.Score
+	status := arena.SPRTContinue
+	first := map[int]float64{} // points of test engine in the first game of pair
+	_, err = arena.RunTournament(ctx, players, opts, func(g *arena.Game, _ *arena.Crosstable) {
+		if status != arena.SPRTContinue {
+			return
+		}
+		if g.Err != nil {
+			fmt.Printf("game %d: error %v (pair is skipped)\n", g.Number, g.Err)
+			return
+		}
+		writeGamePGN(out, g, players, opts.Event)
+		pts := gamePoints(g, 0)
+		switch pts {
+		case 1:
+			wdl.Win++
+		case 0.5:
+			wdl.Draw++
+		case 0:
+			wdl.Loss++
+		}
+		pair := (g.Number - 1) / 2
+		other, ok := first[pair]
+		if !ok {
+			first[pair] = pts
+			return
+		}
+		delete(first, pair)
+		if pts < 0 || other < 0 {
+			return
+		}
+		penta.Add(other, pts)
+		elo, margin := penta.Elo()
+		status = test.Status(penta)
+		fmt.Printf("pairs %d: LLR %.2f [%.2f, %.2f], Elo %+.1f +/- %.1f, %s, pentanomial %s\n", penta.Pairs(),
+			test.LLR(penta), lower, upper, elo, margin, wdl, penta)
+		if status != arena.SPRTContinue {
+			cancel()
+		}
+	})
+	if err != nil && status == arena.SPRTContinue && ctx.Err() == nil {
+		return err
+	}
+
+	elo, margin := penta.Elo()
+	fmt.Printf("\nresult: %s after %d games (LLR %.2f), Elo %+.1f +/- %.1f, LOS %.1f%%\n",
+		status, wdl.Games(), test.LLR(penta), elo, margin, wdl.LOS()*100)
+	return nil
+}
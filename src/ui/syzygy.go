@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"evilchess/src/chesslib/base"
+	"evilchess/src/chesslib/engine/syzygy"
+	"evilchess/src/chesslib/logic/convert/convfen"
+	"evilchess/src/chesslib/logic/rules/moves"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+)
+
+// print tablebase result of position and its moves
+func RunSyzygyProbe(c *cli.Command) error {
+	tb, err := syzygy.Open(c.String("path"))
+	if err != nil {
+		return err
+	}
+	wdl, dtz := tb.Tables()
+	fmt.Printf("tables: %d WDL, %d DTZ, up to %d pieces\n", wdl, dtz, tb.MaxPieces())
+
+	fen := c.String("fen")
+	if fen == "" {
+		fen = base.FEN_START_GAME
+	}
+	b, err := convfen.ConvertFENToBoard(fen)
+	if err != nil {
+		return err
+	}
+	res, err := tb.ProbeWDL(b)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wdl: %s\n", res)
+	if d, err := tb.ProbeDTZ(b); err == nil {
+		fmt.Printf("dtz: %d\n", d)
+	} else {
+		fmt.Printf("dtz: %v\n", err)
+	}
+
+	list, err := tb.ProbeRoot(b)
+	if err != nil {
+		return nil // no moves or no DTZ tables
+	}
+	for _, m := range list {
+		fmt.Printf("%-8s %-6s %-12s dtz %d\n", moves.MoveToSAN(b, m.Move), moves.MoveToUCI(b, m.Move), m.WDL, m.DTZ)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/engine/myengine/tuner"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+func RunTune(c *cli.Command) error {
+	opts := tuner.DefaultExtractOptions()
+	opts.MaxPositions = int(c.Int("positions"))
+	opts.MaxPerGame = int(c.Int("per-game"))
+
+	var positions []tuner.Position
+	for _, path := range c.StringSlice("pgn") {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		positions, err = tuner.ExtractPositions(file, opts, positions)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("error read PGN %s: %v", path, err)
+		}
+	}
+	if len(positions) == 0 {
+		return fmt.Errorf("no quiet positions found")
+	}
+	fmt.Printf("positions: %d\n", len(positions))
+
+	w := myengine.DefaultWeights()
+	if path := c.String("weights"); path != "" {
+		var err error
+		if w, err = myengine.LoadWeights(path); err != nil {
+			return err
+		}
+	}
+	t := tuner.NewTuner(positions, w)
+	fmt.Printf("K = %.3f, error = %.6f\n", t.FitK(), t.Error(&w, t.K))
+
+	out := c.String("out")
+	start := time.Now()
+	t.Tune(int(c.Int("iterations")), func(p tuner.Progress) {
+		fmt.Printf("pass %d: error = %.6f, changed %d params (%s)\n",
+			p.Iteration, p.Error, p.Improved, time.Since(start).Truncate(time.Second))
+		// save after every pass: tuning can take hours
+		if err := myengine.SaveWeights(out, t.Weights()); err != nil {
+			fmt.Printf("error save weights: %v\n", err)
+		}
+	})
+	fmt.Printf("weights saved to %s\n", out)
+	return nil
+}
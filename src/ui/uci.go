@@ -0,0 +1,34 @@
+package ui
+
+import (
+	"evilchess/src/chesslib/engine/myengine"
+	"evilchess/src/chesslib/engine/syzygy"
+	"evilchess/src/chesslib/engine/uci"
+	"evilchess/src/chesslib/logic/endgame"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+// internal engine speaks UCI on stdin/stdout (for matches of builds and other GUIs)
+func RunUCI(c *cli.Command) error {
+	e := myengine.NewEvilEngine()
+	if path := c.String("weights"); path != "" {
+		w, err := myengine.LoadWeights(path)
+		if err != nil {
+			return err
+		}
+		e.SetWeights(w)
+	}
+	if path := c.String("syzygy"); path != "" {
+		tb, err := syzygy.Open(path)
+		if err != nil {
+			return err
+		}
+		e.SetTablebase(tb)
+	}
+	if dir := c.String("endgame"); dir != "" {
+		e.SetEndgameTables(endgame.NewTables(dir))
+	}
+	return uci.NewUCIServer(e, "EvilChess", "redrockstyle").Run(os.Stdin, os.Stdout)
+}